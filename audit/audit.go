@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/google/uuid"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// Actor identifies the worker as the actor of all audit events
+	Actor = "clinic-worker"
+
+	EventTypePrefix = "audit:"
+)
+
+var Module = fx.Provide(
+	NewConfig,
+	NewSink,
+	NewAuditor,
+)
+
+type Action string
+
+const (
+	ActionUserDeleted              Action = "user_deleted"
+	ActionUserEmailsRemoved        Action = "user_emails_removed"
+	ActionUserRolesChanged         Action = "user_roles_changed"
+	ActionUserSessionsDeleted      Action = "user_sessions_deleted"
+	ActionRestrictedTokenCreated   Action = "restricted_token_created"
+	ActionRestrictedTokenUpdated   Action = "restricted_token_updated"
+	ActionRestrictedTokenDeleted   Action = "restricted_token_deleted"
+	ActionSharingConnectionDeleted Action = "sharing_connection_deleted"
+	// ActionPHISent is recorded for each payload with PHI which is delivered to an EHR destination
+	ActionPHISent Action = "phi_sent"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+// Target is the user, patient or clinic affected by the action
+type Target struct {
+	UserId    string `json:"userId,omitempty"`
+	ClinicId  string `json:"clinicId,omitempty"`
+	PatientId string `json:"patientId,omitempty"`
+}
+
+// Trigger is the Kafka message which caused the action. Actions of the scheduler don't have a trigger.
+type Trigger struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+func NewTrigger(cm *sarama.ConsumerMessage) Trigger {
+	return Trigger{
+		Topic:     cm.Topic,
+		Partition: cm.Partition,
+		Offset:    cm.Offset,
+	}
+}
+
+type Event struct {
+	Id      string            `json:"id"`
+	Time    time.Time         `json:"time"`
+	Actor   string            `json:"actor"`
+	Action  Action            `json:"action"`
+	Target  Target            `json:"target"`
+	Trigger *Trigger          `json:"trigger,omitempty"`
+	Outcome Outcome           `json:"outcome"`
+	Error   string            `json:"error,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// NewEvent returns an event for the action with the outcome derived from the error
+func NewEvent(action Action, target Target, err error) Event {
+	event := Event{
+		Action:  action,
+		Target:  target,
+		Outcome: OutcomeSuccess,
+	}
+	if err != nil {
+		event.Outcome = OutcomeFailure
+		event.Error = err.Error()
+	}
+	return event
+}
+
+func (e Event) GetEventType() string {
+	return EventTypePrefix + string(e.Action)
+}
+
+func (e Event) GetEventKey() string {
+	if e.Target.UserId != "" {
+		return e.Target.UserId
+	}
+	return e.Target.ClinicId
+}
+
+type triggerContextKey struct{}
+
+// WithTrigger returns a context which attributes the audit events recorded with it to the Kafka message
+func WithTrigger(ctx context.Context, trigger Trigger) context.Context {
+	return context.WithValue(ctx, triggerContextKey{}, trigger)
+}
+
+func GetTrigger(ctx context.Context) *Trigger {
+	if trigger, ok := ctx.Value(triggerContextKey{}).(Trigger); ok {
+		return &trigger
+	}
+	return nil
+}
+
+// Auditor records the side effects performed by the worker. Recording is best-effort, because the action was already
+// performed and retrying the message would repeat it. Failures are logged instead.
+type Auditor interface {
+	Record(ctx context.Context, event Event)
+}
+
+type auditor struct {
+	sink   Sink
+	logger *zap.SugaredLogger
+}
+
+var _ Auditor = &auditor{}
+
+func NewAuditor(sink Sink, logger *zap.SugaredLogger) Auditor {
+	return &auditor{
+		sink:   sink,
+		logger: logger,
+	}
+}
+
+func (a *auditor) Record(ctx context.Context, event Event) {
+	if event.Id == "" {
+		event.Id = uuid.NewString()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Actor == "" {
+		event.Actor = Actor
+	}
+	if event.Trigger == nil {
+		event.Trigger = GetTrigger(ctx)
+	}
+
+	if err := a.sink.Write(ctx, event); err != nil {
+		a.logger.Errorw("unable to record audit event", "auditEventId", event.Id, "action", event.Action, "outcome", event.Outcome, zap.Error(err))
+	}
+}
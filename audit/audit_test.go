@@ -0,0 +1,66 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+
+	"github.com/IBM/sarama"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/audit"
+)
+
+type sink struct {
+	events []audit.Event
+	err    error
+}
+
+func (s *sink) Write(_ context.Context, event audit.Event) error {
+	s.events = append(s.events, event)
+	return s.err
+}
+
+var _ = Describe("Auditor", func() {
+	var events *sink
+	var auditor audit.Auditor
+
+	BeforeEach(func() {
+		events = &sink{}
+		auditor = audit.NewAuditor(events, zap.NewNop().Sugar())
+	})
+
+	It("sets the id, time, actor and trigger of the event", func() {
+		cm := &sarama.ConsumerMessage{Topic: "clinic.patients", Partition: 2, Offset: 42}
+		ctx := audit.WithTrigger(context.Background(), audit.NewTrigger(cm))
+
+		auditor.Record(ctx, audit.NewEvent(audit.ActionUserDeleted, audit.Target{UserId: "1234"}, nil))
+
+		Expect(events.events).To(HaveLen(1))
+		event := events.events[0]
+		Expect(event.Id).ToNot(BeEmpty())
+		Expect(event.Time).ToNot(BeZero())
+		Expect(event.Actor).To(Equal(audit.Actor))
+		Expect(event.Outcome).To(Equal(audit.OutcomeSuccess))
+		Expect(event.Trigger).To(Equal(&audit.Trigger{Topic: "clinic.patients", Partition: 2, Offset: 42}))
+		Expect(event.GetEventType()).To(Equal("audit:user_deleted"))
+		Expect(event.GetEventKey()).To(Equal("1234"))
+	})
+
+	It("records the error of failed actions", func() {
+		auditor.Record(context.Background(), audit.NewEvent(audit.ActionUserDeleted, audit.Target{UserId: "1234"}, errors.New("not found")))
+
+		Expect(events.events).To(HaveLen(1))
+		Expect(events.events[0].Outcome).To(Equal(audit.OutcomeFailure))
+		Expect(events.events[0].Error).To(Equal("not found"))
+		Expect(events.events[0].Trigger).To(BeNil())
+	})
+
+	It("doesn't panic when the event can't be written", func() {
+		events.err = errors.New("broker is unavailable")
+		Expect(func() {
+			auditor.Record(context.Background(), audit.NewEvent(audit.ActionPHISent, audit.Target{ClinicId: "abcd"}, nil))
+		}).ToNot(Panic())
+	})
+})
@@ -0,0 +1,185 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Record is a line of the audit file. Each record contains the hash of the previous record, so removing or changing
+// a record breaks the chain of all subsequent records.
+type Record struct {
+	Event        json.RawMessage `json:"event"`
+	PreviousHash string          `json:"previousHash"`
+	Hash         string          `json:"hash"`
+}
+
+// FileSink appends hash-chained audit records to a local file
+type FileSink struct {
+	file     *os.File
+	lastHash string
+	mu       sync.Mutex
+	// TruncatedBytes is the size of the torn record which was removed from the end of the file when it was opened
+	TruncatedBytes int64
+}
+
+var _ Sink = &FileSink{}
+
+// NewFileSink opens the audit file and continues the chain of the existing records. A record which was torn by a
+// crash while it was appended is removed, because it was never acknowledged. It returns an error if the complete
+// records don't form a valid chain.
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("unable to create audit directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit file: %w", err)
+	}
+
+	truncated, err := truncateTornRecord(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unable to recover audit file %s: %w", path, err)
+	}
+	lastHash, err := Verify(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unable to continue audit file %s: %w", path, err)
+	}
+
+	return &FileSink{
+		file:           file,
+		lastHash:       lastHash,
+		TruncatedBytes: truncated,
+	}, nil
+}
+
+// ReplicaFilePath returns the path of the audit file of a replica. Each replica keeps its own chain, because the
+// records of replicas which append to the same file would interleave and break the chain.
+func ReplicaFilePath(path string, replicaId string) (string, error) {
+	if replicaId == "" || strings.ContainsAny(replicaId, `/\`) || replicaId == "." || replicaId == ".." {
+		return "", fmt.Errorf("invalid audit replica id %q", replicaId)
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + replicaId + ext, nil
+}
+
+// truncateTornRecord removes the incomplete last line of the file and returns the number of removed bytes. Records
+// are always terminated by a new line, so only the last record can be incomplete.
+func truncateTornRecord(file *os.File) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return 0, nil
+	}
+
+	// Read the file backwards until the end of the last complete record is found
+	end := size
+	buffer := make([]byte, 64*1024)
+	for end > 0 {
+		offset := end - int64(len(buffer))
+		if offset < 0 {
+			offset = 0
+		}
+		chunk := buffer[:end-offset]
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return 0, err
+		}
+		if index := bytes.LastIndexByte(chunk, '\n'); index >= 0 {
+			end = offset + int64(index) + 1
+			break
+		}
+		end = offset
+	}
+	if end == size {
+		return 0, nil
+	}
+
+	if err := file.Truncate(end); err != nil {
+		return 0, err
+	}
+	if err := file.Sync(); err != nil {
+		return 0, err
+	}
+	return size - end, nil
+}
+
+func (f *FileSink) Write(_ context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to encode audit event: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	record := Record{
+		Event:        data,
+		PreviousHash: f.lastHash,
+		Hash:         hashRecord(f.lastHash, data),
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("unable to encode audit record: %w", err)
+	}
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("unable to write audit record: %w", err)
+	}
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync audit file: %w", err)
+	}
+
+	f.lastHash = record.Hash
+	return nil
+}
+
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// Verify checks the chain of the audit records and returns the hash of the last record
+func Verify(reader io.Reader) (string, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	lastHash := ""
+	for line := 1; scanner.Scan(); line++ {
+		record := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return "", fmt.Errorf("invalid audit record on line %d: %w", line, err)
+		}
+		if record.PreviousHash != lastHash {
+			return "", fmt.Errorf("audit record on line %d doesn't follow the previous record", line)
+		}
+		if record.Hash != hashRecord(record.PreviousHash, record.Event) {
+			return "", fmt.Errorf("audit record on line %d was modified", line)
+		}
+		lastHash = record.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("unable to read audit records: %w", err)
+	}
+	return lastHash, nil
+}
+
+func hashRecord(previousHash string, event []byte) string {
+	h := sha256.New()
+	h.Write([]byte(previousHash))
+	h.Write(event)
+	return hex.EncodeToString(h.Sum(nil))
+}
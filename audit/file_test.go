@@ -0,0 +1,145 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/audit"
+)
+
+var _ = Describe("FileSink", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "audit", "audit.jsonl")
+	})
+
+	write := func(sink *audit.FileSink, userIds ...string) {
+		for _, userId := range userIds {
+			Expect(sink.Write(context.Background(), audit.NewEvent(audit.ActionUserDeleted, audit.Target{UserId: userId}, nil))).To(Succeed())
+		}
+	}
+
+	It("appends records which form a valid chain", func() {
+		sink, err := audit.NewFileSink(path)
+		Expect(err).ToNot(HaveOccurred())
+		write(sink, "1", "2", "3")
+		Expect(sink.Close()).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bytes.Count(data, []byte("\n"))).To(Equal(3))
+		lastHash, err := audit.Verify(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lastHash).ToNot(BeEmpty())
+	})
+
+	It("continues the chain of an existing file", func() {
+		sink, err := audit.NewFileSink(path)
+		Expect(err).ToNot(HaveOccurred())
+		write(sink, "1")
+		Expect(sink.Close()).To(Succeed())
+
+		sink, err = audit.NewFileSink(path)
+		Expect(err).ToNot(HaveOccurred())
+		write(sink, "2")
+		Expect(sink.Close()).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = audit.Verify(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("detects modified records", func() {
+		sink, err := audit.NewFileSink(path)
+		Expect(err).ToNot(HaveOccurred())
+		write(sink, "1", "2")
+		Expect(sink.Close()).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.WriteFile(path, bytes.Replace(data, []byte(`"userId":"1"`), []byte(`"userId":"9"`), 1), 0o600)).To(Succeed())
+
+		_, err = audit.NewFileSink(path)
+		Expect(err).To(MatchError(ContainSubstring("line 1 was modified")))
+	})
+
+	It("detects removed records", func() {
+		sink, err := audit.NewFileSink(path)
+		Expect(err).ToNot(HaveOccurred())
+		write(sink, "1", "2")
+		Expect(sink.Close()).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		lines := bytes.SplitAfter(data, []byte("\n"))
+
+		_, err = audit.Verify(bytes.NewReader(lines[1]))
+		Expect(err).To(MatchError(ContainSubstring("line 1 doesn't follow the previous record")))
+	})
+
+	It("removes a record which was torn while it was appended and continues the chain", func() {
+		sink, err := audit.NewFileSink(path)
+		Expect(err).ToNot(HaveOccurred())
+		write(sink, "1", "2")
+		Expect(sink.Close()).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		complete := len(data)
+		Expect(os.WriteFile(path, append(data, []byte(`{"event":{"id":"3"},"previ`)...), 0o600)).To(Succeed())
+
+		sink, err = audit.NewFileSink(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sink.TruncatedBytes).To(BeEquivalentTo(len(`{"event":{"id":"3"},"previ`)))
+		write(sink, "3")
+		Expect(sink.Close()).To(Succeed())
+
+		data, err = os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(data)).To(BeNumerically(">", complete))
+		Expect(bytes.Count(data, []byte("\n"))).To(Equal(3))
+		_, err = audit.Verify(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("removes the first record if it was torn", func() {
+		Expect(os.MkdirAll(filepath.Dir(path), 0o750)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(`{"event":{"id":"1"}`), 0o600)).To(Succeed())
+
+		sink, err := audit.NewFileSink(path)
+		Expect(err).ToNot(HaveOccurred())
+		write(sink, "1")
+		Expect(sink.Close()).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = audit.Verify(bytes.NewReader(data))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("doesn't remove complete records which are invalid", func() {
+		Expect(os.MkdirAll(filepath.Dir(path), 0o750)).To(Succeed())
+		Expect(os.WriteFile(path, []byte("{\"event\":\n"), 0o600)).To(Succeed())
+
+		_, err := audit.NewFileSink(path)
+		Expect(err).To(MatchError(ContainSubstring("invalid audit record on line 1")))
+	})
+
+	Describe("ReplicaFilePath", func() {
+		It("keeps a file for each replica", func() {
+			Expect(audit.ReplicaFilePath("/var/log/clinic-worker/audit.jsonl", "clinic-worker-0")).To(Equal("/var/log/clinic-worker/audit-clinic-worker-0.jsonl"))
+		})
+
+		It("rejects replica ids which would change the directory", func() {
+			_, err := audit.ReplicaFilePath("/var/log/clinic-worker/audit.jsonl", "../other")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
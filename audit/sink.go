@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/go-common/events"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	SinkTypeKafka = "kafka"
+	SinkTypeFile  = "file"
+)
+
+type Config struct {
+	// Sink is "kafka" or "file". The file sink is meant for environments without Kafka.
+	Sink       string `envconfig:"TIDEPOOL_AUDIT_SINK" default:"kafka"`
+	KafkaTopic string `envconfig:"TIDEPOOL_AUDIT_KAFKA_TOPIC" default:"clinic-worker-audit"`
+	// FilePath is suffixed with the replica id, so each replica appends to its own file
+	FilePath string `envconfig:"TIDEPOOL_AUDIT_FILE_PATH" default:"/var/log/clinic-worker/audit.jsonl"`
+	// ReplicaId defaults to the hostname, which is the name of the pod
+	ReplicaId string `envconfig:"TIDEPOOL_AUDIT_REPLICA_ID"`
+}
+
+func NewConfig() (Config, error) {
+	config := Config{}
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+// Sink persists audit events
+type Sink interface {
+	Write(ctx context.Context, event Event) error
+}
+
+func NewSink(config Config, lifecycle fx.Lifecycle, logger *zap.SugaredLogger) (Sink, error) {
+	switch config.Sink {
+	case SinkTypeKafka:
+		return NewKafkaSink(config)
+	case SinkTypeFile:
+		replicaId := config.ReplicaId
+		if replicaId == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return nil, fmt.Errorf("unable to get audit replica id: %w", err)
+			}
+			replicaId = hostname
+		}
+		path, err := ReplicaFilePath(config.FilePath, replicaId)
+		if err != nil {
+			return nil, err
+		}
+		sink, err := NewFileSink(path)
+		if err != nil {
+			return nil, err
+		}
+		if sink.TruncatedBytes > 0 {
+			logger.Warnw("removed torn audit record", "path", path, "bytes", sink.TruncatedBytes)
+		}
+		lifecycle.Append(fx.Hook{
+			OnStop: func(ctx context.Context) error {
+				return sink.Close()
+			},
+		})
+		return sink, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %s", config.Sink)
+	}
+}
+
+// KafkaSink produces audit events as cloud events to a dedicated topic
+type KafkaSink struct {
+	producer events.EventProducer
+}
+
+var _ Sink = &KafkaSink{}
+
+func NewKafkaSink(config Config) (*KafkaSink, error) {
+	eventsConfig := events.NewConfig()
+	if err := eventsConfig.LoadFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// Use '-' as separator like the other topics which are not produced by mongo CDC
+	if strings.HasSuffix(eventsConfig.KafkaTopicPrefix, ".") {
+		eventsConfig.KafkaTopicPrefix = strings.TrimSuffix(eventsConfig.KafkaTopicPrefix, ".") + "-"
+	}
+	eventsConfig.KafkaTopic = config.KafkaTopic
+	eventsConfig.EventSource = Actor
+
+	producer, err := events.NewKafkaCloudEventsProducer(eventsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create audit events producer: %w", err)
+	}
+	return &KafkaSink{producer: producer}, nil
+}
+
+func (k *KafkaSink) Write(ctx context.Context, event Event) error {
+	if err := k.producer.Send(ctx, event); err != nil {
+		return fmt.Errorf("unable to send audit event: %w", err)
+	}
+	return nil
+}
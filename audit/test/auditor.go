@@ -0,0 +1,36 @@
+package test
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tidepool-org/clinic-worker/audit"
+)
+
+type Auditor struct {
+	Events []audit.Event
+	mu     sync.Mutex
+}
+
+var _ audit.Auditor = &Auditor{}
+
+func (a *Auditor) Record(ctx context.Context, event audit.Event) {
+	if event.Trigger == nil {
+		event.Trigger = audit.GetTrigger(ctx)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Events = append(a.Events, event)
+}
+
+func (a *Auditor) Actions() []audit.Action {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	actions := make([]audit.Action, 0, len(a.Events))
+	for _, event := range a.Events {
+		actions = append(actions, event.Action)
+	}
+	return actions
+}
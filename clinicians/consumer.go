@@ -7,8 +7,8 @@ import (
 	"github.com/IBM/sarama"
 	"github.com/tidepool-org/clinic-worker/cdc"
 	"github.com/tidepool-org/clinic-worker/marketo"
+	"github.com/tidepool-org/clinic-worker/outbox"
 	clinics "github.com/tidepool-org/clinic/client"
-	"github.com/tidepool-org/go-common/clients"
 	"github.com/tidepool-org/go-common/clients/shoreline"
 	"github.com/tidepool-org/go-common/clients/status"
 	"github.com/tidepool-org/go-common/events"
@@ -35,7 +35,7 @@ type ClinicianCDCConsumer struct {
 	logger *zap.SugaredLogger
 
 	clinics       clinics.ClientWithResponsesInterface
-	mailer        clients.MailerClient
+	outbox        outbox.Outbox
 	marketoClient marketo.Client
 	shoreline     shoreline.Client
 }
@@ -45,7 +45,7 @@ type Params struct {
 
 	Clinics       clinics.ClientWithResponsesInterface
 	Logger        *zap.SugaredLogger
-	Mailer        clients.MailerClient
+	Outbox        outbox.Outbox
 	MarketoClient marketo.Client
 	Shoreline     shoreline.Client
 }
@@ -75,7 +75,7 @@ func NewClinicianCDCConsumer(p Params) (events.MessageConsumer, error) {
 	return &ClinicianCDCConsumer{
 		clinics:       p.Clinics,
 		logger:        p.Logger,
-		mailer:        p.Mailer,
+		outbox:        p.Outbox,
 		marketoClient: p.MarketoClient,
 		shoreline:     p.Shoreline,
 	}, nil
@@ -211,7 +211,9 @@ func (p *ClinicianCDCConsumer) sendPermissionsUpdatedEmail(event PatientCDCEvent
 			},
 		}
 
-		return p.mailer.SendEmailTemplate(ctx, template)
+		// The number of role updates of the clinician identifies the version of the roles
+		key := outbox.NewKey(template.Template, clinicId, clinicianId, strconv.Itoa(len(event.FullDocument.RolesUpdates)))
+		return p.outbox.Enqueue(ctx, key, template)
 	}
 
 	return nil
@@ -10,8 +10,8 @@ import (
 
 	"github.com/IBM/sarama"
 	"github.com/tidepool-org/clinic-worker/cdc"
+	"github.com/tidepool-org/clinic-worker/outbox"
 	clinics "github.com/tidepool-org/clinic/client"
-	"github.com/tidepool-org/go-common/clients"
 	"github.com/tidepool-org/go-common/clients/shoreline"
 	"github.com/tidepool-org/go-common/clients/status"
 	"github.com/tidepool-org/go-common/events"
@@ -33,7 +33,7 @@ type ClinicsCDCConsumer struct {
 	logger *zap.SugaredLogger
 
 	clinics   clinics.ClientWithResponsesInterface
-	mailer    clients.MailerClient
+	outbox    outbox.Outbox
 	shoreline shoreline.Client
 }
 
@@ -41,7 +41,7 @@ type Params struct {
 	fx.In
 
 	Logger    *zap.SugaredLogger
-	Mailer    clients.MailerClient
+	Outbox    outbox.Outbox
 	Shoreline shoreline.Client
 	Clinics   clinics.ClientWithResponsesInterface
 }
@@ -70,7 +70,7 @@ func CreateConsumer(p Params) events.ConsumerFactory {
 func NewClinicsCDCConsumer(p Params) (events.MessageConsumer, error) {
 	return &ClinicsCDCConsumer{
 		logger:    p.Logger,
-		mailer:    p.Mailer,
+		outbox:    p.Outbox,
 		shoreline: p.Shoreline,
 		clinics:   p.Clinics,
 	}, nil
@@ -147,7 +147,9 @@ func (p *ClinicsCDCConsumer) handleCDCEvent(event ClinicCDCEvent) error {
 		},
 	}
 
-	return p.mailer.SendEmailTemplate(ctx, template)
+	// A clinic is created only once, so the id of the clinic identifies the email
+	key := outbox.NewKey(template.Template, event.FullDocument.Id.Value)
+	return p.outbox.Enqueue(ctx, key, template)
 }
 
 func (p *ClinicsCDCConsumer) getUserEmail(userId string) (string, error) {
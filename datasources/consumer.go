@@ -13,6 +13,7 @@ import (
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
+	"github.com/tidepool-org/clinic-worker/audit"
 	"github.com/tidepool-org/clinic-worker/cdc"
 	token "github.com/tidepool-org/clinic-worker/restrictedtoken"
 	clinics "github.com/tidepool-org/clinic/client"
@@ -32,7 +33,8 @@ var Module = fx.Provide(fx.Annotated{
 })
 
 type CDCConsumer struct {
-	logger *zap.SugaredLogger
+	logger  *zap.SugaredLogger
+	auditor audit.Auditor
 
 	auth      clients.AuthClient
 	clinics   clinics.ClientWithResponsesInterface
@@ -45,6 +47,7 @@ type Params struct {
 	fx.In
 
 	Logger    *zap.SugaredLogger
+	Auditor   audit.Auditor
 	Auth      clients.AuthClient
 	Clinics   clinics.ClientWithResponsesInterface
 	Data      clients.DataClient
@@ -76,6 +79,7 @@ func CreateConsumer(p Params) events.ConsumerFactory {
 func NewCDCConsumer(p Params) (events.MessageConsumer, error) {
 	return &CDCConsumer{
 		logger:    p.Logger,
+		auditor:   p.Auditor,
 		auth:      p.Auth,
 		clinics:   p.Clinics,
 		data:      p.Data,
@@ -107,7 +111,8 @@ func (p *CDCConsumer) handleMessage(cm *sarama.ConsumerMessage) error {
 		return err
 	}
 
-	if err := p.handleCDCEvent(event); err != nil {
+	ctx := audit.WithTrigger(context.Background(), audit.NewTrigger(cm))
+	if err := p.handleCDCEvent(ctx, event); err != nil {
 		p.logger.Errorw("unable to process cdc event", "offset", cm.Offset, zap.Error(err))
 		return err
 	}
@@ -122,7 +127,7 @@ func (p *CDCConsumer) unmarshalEvent(value []byte, event *CDCEvent) error {
 	return json.Unmarshal([]byte(message), event)
 }
 
-func (p *CDCConsumer) handleCDCEvent(event CDCEvent) error {
+func (p *CDCConsumer) handleCDCEvent(ctx context.Context, event CDCEvent) error {
 	if !event.ShouldApplyUpdates() {
 		p.logger.Debugw("skipping handling of event", "offset", event.Offset)
 		return nil
@@ -135,13 +140,13 @@ func (p *CDCConsumer) handleCDCEvent(event CDCEvent) error {
 		return err
 	}
 
-	if err := p.handleDeviceIssues(event); err != nil {
+	if err := p.handleDeviceIssues(ctx, event); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (p *CDCConsumer) handleDeviceIssues(event CDCEvent) error {
+func (p *CDCConsumer) handleDeviceIssues(ctx context.Context, event CDCEvent) error {
 	if event.FullDocument.UserID == nil ||
 		event.OperationType != cdc.OperationTypeUpdate ||
 		event.UpdateDescription.UpdatedFields.State == nil ||
@@ -152,7 +157,7 @@ func (p *CDCConsumer) handleDeviceIssues(event CDCEvent) error {
 	updatedState := *event.UpdateDescription.UpdatedFields.State
 	userID := *event.FullDocument.UserID
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 	clinicsResponse, err := p.clinics.ListClinicsForPatientWithResponse(ctx, userID, nil)
 	if err != nil {
@@ -175,7 +180,7 @@ func (p *CDCConsumer) handleDeviceIssues(event CDCEvent) error {
 	}
 	if user.Username != "" {
 		providerName := *event.FullDocument.ProviderName
-		restrictedToken, err := token.UpsertRestrictedTokenForProvider(p.auth, p.shoreline, userID, providerName)
+		restrictedToken, err := token.UpsertRestrictedTokenForProvider(ctx, p.auth, p.shoreline, p.auditor, userID, providerName)
 		if err != nil {
 			return fmt.Errorf(`error creating restricted token: %w`, err)
 		}
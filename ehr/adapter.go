@@ -0,0 +1,99 @@
+package ehr
+
+import (
+	"context"
+	"io"
+)
+
+// Adapter connects the worker to an EHR integration. It normalizes the orders received from the EHR and delivers
+// results, observations and documents in the format of the EHR.
+type Adapter interface {
+	Name() string
+	NormalizeOrder(message []byte) (Order, error)
+	SendResults(ctx context.Context, destination Destination, results Results) error
+	SendObservations(ctx context.Context, destination Destination, observations Observations) error
+	SendDocument(ctx context.Context, destination Destination, document Document) error
+}
+
+// Destination addresses a delivery. Adapters ignore the fields which aren't used by their EHR.
+type Destination struct {
+	// SourceId selects the credentials of the clinic if the adapter is configured with more than one
+	SourceId string
+	// Id is the receiving system of the EHR
+	Id string
+}
+
+type Operation string
+
+const (
+	OperationMatching        Operation = "matching"
+	OperationAccountCreation Operation = "accountCreation"
+)
+
+// Results report the outcome of the operation which was requested by an order
+type Results struct {
+	Order     Order
+	Operation Operation
+	IsSuccess bool
+	// Code is included in the results if set
+	Code    ResultCode
+	Message string
+	// MatchMethod and MatchConfidence are included in the results of patient matching if set
+	MatchMethod     string
+	MatchConfidence float64
+	// Details are additional string results of the operation, e.g. the values which were mapped during account creation
+	Details []ResultDetail
+}
+
+type ResultDetail struct {
+	Code        string
+	Description string
+	Value       string
+}
+
+type Observations struct {
+	Order        Order
+	Observations []Observation
+}
+
+// Observation is a summary statistic of a patient. The code is the code which is used by the clinic, which isn't
+// the Tidepool code if the clinic uses standard codes or overrides.
+type Observation struct {
+	Code        string
+	Codeset     string
+	Value       string
+	ValueType   string
+	Units       *string
+	DateTime    string
+	Description string
+	// Period qualifies observations which have the same code but were calculated over different summary periods
+	Period string
+}
+
+// Document is the PDF report of a patient, or a plain-text note if it doesn't have a report
+type Document struct {
+	Order Order
+	Id    string
+	// ReplacedId is the id of a document which was sent earlier and is replaced by this document if set
+	ReplacedId string
+	FileName   string
+	Content    []byte
+	// Upload references the report instead of the content if the report was uploaded by the adapter
+	Upload *Upload
+	// Text is the content of plain-text notes, e.g. when the report couldn't be created
+	Text string
+	// Observations are summary statistics which are included in the document, e.g. the GMI of the patient
+	Observations []Observation
+}
+
+// Upload is a report which was uploaded to the EHR before the document which references it was sent
+type Upload struct {
+	URI string
+}
+
+// Uploader is implemented by adapters which upload large reports separately from the documents
+type Uploader interface {
+	// IsUploadRequired returns true if the destination doesn't accept embedded reports
+	IsUploadRequired(destination Destination) bool
+	Upload(ctx context.Context, destination Destination, fileName string, content io.Reader) (Upload, error)
+}
@@ -0,0 +1,13 @@
+package ehr_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestEHR(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "EHR Suite")
+}
@@ -0,0 +1,225 @@
+package ehr
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	codegentypes "github.com/oapi-codegen/runtime/types"
+)
+
+const (
+	MinimumAgeSelfOwnedAccountYears = 13
+
+	PhoneNumberTypeHome   = "home"
+	PhoneNumberTypeMobile = "mobile"
+	PhoneNumberTypeWork   = "work"
+)
+
+var (
+	ErrEmailInvalid       = NewResultError(ResultCodeEmailInvalid, "email address is invalid")
+	ErrDateOfBirthMissing = NewResultError(ResultCodeDobMissing, "date of birth is missing")
+	ErrMrnMissing         = NewResultError(ResultCodeMrnMissing, "mrn is missing")
+)
+
+// Order is an order received from an EHR, normalized by the adapter of the EHR
+type Order struct {
+	Id string
+	// SourceId identifies the system which sent the order if the EHR distinguishes them
+	SourceId string
+	// Time is when the order was placed if known
+	Time                 *time.Time
+	ProcedureCode        string
+	ProcedureCodeset     string
+	ProcedureDescription string
+	Patient              Patient
+	Visit                *Visit
+	Provider             *Provider
+	ClinicalInfo         []ClinicalInfo
+	Diagnoses            []Diagnosis
+	// Native is the order as received from the EHR. Adapters use it to reply with the identifiers and demographics
+	// of the original order.
+	Native any
+	// Adapter is the name of the adapter which normalized the order if it was normalized by a router
+	Adapter string
+}
+
+type Identifier struct {
+	Id   string
+	Type string
+}
+
+type Patient struct {
+	Identifiers []Identifier
+	FirstName   string
+	MiddleName  string
+	LastName    string
+	// BirthDate is the date of birth as received from the EHR, it is validated by GetBirthDate
+	BirthDate      string
+	Sex            string
+	EmailAddresses []string
+	PhoneNumbers   []PhoneNumber
+}
+
+type Visit struct {
+	Number        string
+	AccountNumber string
+	Time          *time.Time
+	Location      Location
+	// GuarantorEmailAddresses are used instead of the addresses of the patient if the patient is a minor
+	GuarantorEmailAddresses []string
+	Guarantor               *Guarantor
+}
+
+// Guarantor is the person responsible for the patient, e.g. the parent or legal guardian of a minor
+type Guarantor struct {
+	FirstName         string
+	LastName          string
+	RelationToPatient string
+	PhoneNumbers      []PhoneNumber
+}
+
+func (g Guarantor) GetFullName() string {
+	return strings.TrimSpace(g.FirstName + " " + g.LastName)
+}
+
+type PhoneNumber struct {
+	Type   string
+	Number string
+}
+
+type Location struct {
+	Facility   string
+	Department string
+	Room       string
+}
+
+type Provider struct {
+	Id        string
+	IdType    string
+	FirstName string
+	LastName  string
+}
+
+type ClinicalInfo struct {
+	Code  string
+	Value string
+}
+
+type Diagnosis struct {
+	Code    string
+	Codeset string
+	Name    string
+}
+
+func (o Order) GetBirthDate() (codegentypes.Date, error) {
+	if o.Patient.BirthDate == "" {
+		return codegentypes.Date{}, ErrDateOfBirthMissing
+	}
+
+	birthDate := &codegentypes.Date{}
+	err := birthDate.UnmarshalText([]byte(o.Patient.BirthDate))
+	if err != nil {
+		return *birthDate, NewResultError(ResultCodeDobInvalid, fmt.Sprintf("date of birth is invalid: %s", err))
+	}
+	return *birthDate, nil
+}
+
+// GetEmailAddress returns the email address of the account of the patient, which is the email address of the
+// guarantor if the patient is too young to own the account
+func (o Order) GetEmailAddress() (*string, error) {
+	birthDate, err := o.GetBirthDate()
+	if err != nil {
+		return nil, err
+	}
+
+	var email *string
+	if shouldUseGuarantorEmail(birthDate) {
+		email = o.GetGuarantorEmailAddress()
+	} else {
+		email = o.GetPatientEmailAddress()
+	}
+
+	if email == nil {
+		return nil, nil
+	}
+
+	addr, err := mail.ParseAddress(*email)
+	if err != nil {
+		return nil, ErrEmailInvalid
+	}
+
+	return &addr.Address, nil
+}
+
+func shouldUseGuarantorEmail(birthDate codegentypes.Date) bool {
+	now := time.Now()
+	cutoff := birthDate.AddDate(MinimumAgeSelfOwnedAccountYears, 0, 0)
+	return !cutoff.Before(now)
+}
+
+func (o Order) GetPatientEmailAddress() *string {
+	if len(o.Patient.EmailAddresses) == 0 {
+		return nil
+	}
+	return &o.Patient.EmailAddresses[0]
+}
+
+func (o Order) GetGuarantorEmailAddress() *string {
+	if o.Visit == nil || len(o.Visit.GuarantorEmailAddresses) == 0 {
+		return nil
+	}
+	return &o.Visit.GuarantorEmailAddresses[0]
+}
+
+func (o Order) GetFullName() (string, error) {
+	if o.Patient.FirstName == "" {
+		return "", NewResultError(ResultCodeNameMissing, "first name is missing")
+	}
+	if o.Patient.LastName == "" {
+		return "", NewResultError(ResultCodeNameMissing, "last name is missing")
+	}
+	return strings.Join([]string{o.Patient.FirstName, o.Patient.LastName}, " "), nil
+}
+
+func (o Order) GetMrn(mrnIdType string) (*string, error) {
+	for _, identifier := range o.Patient.Identifiers {
+		if strings.EqualFold(identifier.Type, mrnIdType) {
+			mrn := identifier.Id
+			return &mrn, nil
+		}
+	}
+	return nil, ErrMrnMissing
+}
+
+// GetClinicalInfoValues returns the values of the clinical info with one of the codes. Values are split by the
+// separator if it isn't empty.
+func (o Order) GetClinicalInfoValues(codes map[string]struct{}, separator string) []string {
+	values := make([]string, 0)
+	for _, info := range o.ClinicalInfo {
+		if _, found := codes[info.Code]; !found {
+			continue
+		}
+		if separator == "" {
+			values = append(values, strings.TrimSpace(info.Value))
+			continue
+		}
+		for _, value := range strings.Split(info.Value, separator) {
+			values = append(values, strings.TrimSpace(value))
+		}
+	}
+	return values
+}
+
+// GetPhoneNumber returns the first number with the preferred types in order of preference, or an empty string
+func GetPhoneNumber(numbers []PhoneNumber, preferredTypes []string) string {
+	for _, phoneType := range preferredTypes {
+		for _, number := range numbers {
+			if number.Type == phoneType && number.Number != "" {
+				return number.Number
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package ehr_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+)
+
+var _ = Describe("Order", func() {
+	var order ehr.Order
+
+	BeforeEach(func() {
+		order = ehr.Order{
+			Patient: ehr.Patient{
+				Identifiers:    []ehr.Identifier{{Id: "0000000001", Type: "MRN"}},
+				FirstName:      "Timothy",
+				LastName:       "Bixby",
+				BirthDate:      "2000-01-06",
+				EmailAddresses: []string{"tim@test.com"},
+			},
+			Visit: &ehr.Visit{
+				GuarantorEmailAddresses: []string{"kent@test.com"},
+			},
+		}
+	})
+
+	Describe("GetEmailAddress", func() {
+		It("returns the email address of adult patients", func() {
+			Expect(order.GetEmailAddress()).To(HaveValue(Equal("tim@test.com")))
+		})
+
+		It("returns the email address of the guarantor of minors", func() {
+			order.Patient.BirthDate = time.Now().AddDate(-10, 0, 0).Format(time.DateOnly)
+			Expect(order.GetEmailAddress()).To(HaveValue(Equal("kent@test.com")))
+		})
+
+		It("returns a result error if the email address is invalid", func() {
+			order.Patient.EmailAddresses = []string{"invalid"}
+			_, err := order.GetEmailAddress()
+			Expect(ehr.GetResultCode(err)).To(Equal(ehr.ResultCodeEmailInvalid))
+		})
+
+		It("returns a result error if the date of birth is missing", func() {
+			order.Patient.BirthDate = ""
+			_, err := order.GetEmailAddress()
+			Expect(err).To(MatchError(ehr.ErrDateOfBirthMissing))
+		})
+	})
+
+	Describe("GetMrn", func() {
+		It("matches the id type case insensitively", func() {
+			Expect(order.GetMrn("mrn")).To(HaveValue(Equal("0000000001")))
+		})
+
+		It("returns a result error if the mrn is missing", func() {
+			_, err := order.GetMrn("EHRID")
+			Expect(err).To(MatchError(ehr.ErrMrnMissing))
+		})
+	})
+
+	Describe("GetClinicalInfoValues", func() {
+		It("splits the values of the clinical info with the codes", func() {
+			order.ClinicalInfo = []ehr.ClinicalInfo{{Code: "TAGS", Value: "T1D; ADULT"}, {Code: "OTHER", Value: "ignored"}}
+			Expect(order.GetClinicalInfoValues(map[string]struct{}{"TAGS": {}}, ";")).To(Equal([]string{"T1D", "ADULT"}))
+		})
+	})
+
+	Describe("GetPhoneNumber", func() {
+		It("returns the number with the first preferred type", func() {
+			numbers := []ehr.PhoneNumber{{Type: ehr.PhoneNumberTypeHome, Number: "555-0100"}, {Type: ehr.PhoneNumberTypeWork, Number: "555-0102"}}
+			Expect(ehr.GetPhoneNumber(numbers, []string{ehr.PhoneNumberTypeMobile, ehr.PhoneNumberTypeWork})).To(Equal("555-0102"))
+			Expect(ehr.GetPhoneNumber(numbers, []string{ehr.PhoneNumberTypeMobile})).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,55 @@
+package ehr
+
+import (
+	"errors"
+)
+
+// ResultCode is a stable, machine-readable code which is sent to the EHR alongside the human-readable result message
+type ResultCode string
+
+const (
+	ResultCodeSuccess             ResultCode = "SUCCESS"
+	ResultCodeUnknownError        ResultCode = "UNKNOWN_ERROR"
+	ResultCodeDuplicateOrder      ResultCode = "DUPLICATE_ORDER"
+	ResultCodeReportUnavailable   ResultCode = "REPORT_UNAVAILABLE"
+	ResultCodeNoMatches           ResultCode = "NO_MATCHES"
+	ResultCodeMultipleMatches     ResultCode = "MULTIPLE_MATCHES"
+	ResultCodeMatchReviewRequired ResultCode = "MATCH_REVIEW_REQUIRED"
+	ResultCodePatientExists       ResultCode = "PATIENT_EXISTS"
+	ResultCodeMrnMissing          ResultCode = "MRN_MISSING"
+	ResultCodeDobMissing          ResultCode = "DOB_MISSING"
+	ResultCodeDobInvalid          ResultCode = "DOB_INVALID"
+	ResultCodeNameMissing         ResultCode = "NAME_MISSING"
+	ResultCodeEmailInvalid        ResultCode = "EMAIL_INVALID"
+	ResultCodeEmailInUse          ResultCode = "EMAIL_IN_USE"
+)
+
+// ResultError is an error which is reported back to the EHR with a result code
+type ResultError struct {
+	Code    ResultCode
+	Message string
+}
+
+func NewResultError(code ResultCode, message string) *ResultError {
+	return &ResultError{
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (r *ResultError) Error() string {
+	return r.Message
+}
+
+// GetResultCode returns the code of the first result error in the chain or UNKNOWN_ERROR if there isn't one
+func GetResultCode(err error) ResultCode {
+	if err == nil {
+		return ResultCodeSuccess
+	}
+
+	var resultError *ResultError
+	if errors.As(err, &resultError) {
+		return resultError.Code
+	}
+	return ResultCodeUnknownError
+}
@@ -0,0 +1,80 @@
+package ehr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Router is the adapter of a worker which receives orders from more than one EHR integration. Orders are normalized
+// by the first adapter which accepts the message and are delivered with the adapter which normalized them.
+type Router struct {
+	adapters []Adapter
+}
+
+var _ Adapter = &Router{}
+
+func NewRouter(adapters ...Adapter) *Router {
+	return &Router{
+		adapters: adapters,
+	}
+}
+
+func (r *Router) Name() string {
+	return "router"
+}
+
+func (r *Router) NormalizeOrder(message []byte) (Order, error) {
+	var errs []error
+	for _, adapter := range r.adapters {
+		order, err := adapter.NormalizeOrder(message)
+		if err == nil {
+			order.Adapter = adapter.Name()
+			return order, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", adapter.Name(), err))
+	}
+	return Order{}, fmt.Errorf("unable to normalize order: %w", errors.Join(errs...))
+}
+
+// For returns the adapter which normalized the order
+func (r *Router) For(order Order) (Adapter, error) {
+	for _, adapter := range r.adapters {
+		if adapter.Name() == order.Adapter {
+			return adapter, nil
+		}
+	}
+	return nil, fmt.Errorf("the order %s wasn't normalized by a configured adapter", order.Id)
+}
+
+func (r *Router) SendResults(ctx context.Context, destination Destination, results Results) error {
+	adapter, err := r.For(results.Order)
+	if err != nil {
+		return err
+	}
+	return adapter.SendResults(ctx, destination, results)
+}
+
+func (r *Router) SendObservations(ctx context.Context, destination Destination, observations Observations) error {
+	adapter, err := r.For(observations.Order)
+	if err != nil {
+		return err
+	}
+	return adapter.SendObservations(ctx, destination, observations)
+}
+
+func (r *Router) SendDocument(ctx context.Context, destination Destination, document Document) error {
+	adapter, err := r.For(document.Order)
+	if err != nil {
+		return err
+	}
+	return adapter.SendDocument(ctx, destination, document)
+}
+
+// AdapterFor returns the adapter which delivers the payloads of the order
+func AdapterFor(adapter Adapter, order Order) (Adapter, error) {
+	if router, ok := adapter.(*Router); ok {
+		return router.For(order)
+	}
+	return adapter, nil
+}
@@ -0,0 +1,79 @@
+package ehr_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+)
+
+// fakeAdapter normalizes the messages which start with its name
+type fakeAdapter struct {
+	name string
+	sent []ehr.Results
+}
+
+func (f *fakeAdapter) Name() string {
+	return f.name
+}
+
+func (f *fakeAdapter) NormalizeOrder(message []byte) (ehr.Order, error) {
+	if len(message) < len(f.name) || string(message[:len(f.name)]) != f.name {
+		return ehr.Order{}, errors.New("unexpected message")
+	}
+	return ehr.Order{Id: string(message)}, nil
+}
+
+func (f *fakeAdapter) SendResults(ctx context.Context, destination ehr.Destination, results ehr.Results) error {
+	f.sent = append(f.sent, results)
+	return nil
+}
+
+func (f *fakeAdapter) SendObservations(ctx context.Context, destination ehr.Destination, observations ehr.Observations) error {
+	return nil
+}
+
+func (f *fakeAdapter) SendDocument(ctx context.Context, destination ehr.Destination, document ehr.Document) error {
+	return nil
+}
+
+var _ = Describe("Router", func() {
+	var fhir *fakeAdapter
+	var redox *fakeAdapter
+	var router *ehr.Router
+
+	BeforeEach(func() {
+		fhir = &fakeAdapter{name: "fhir"}
+		redox = &fakeAdapter{name: "redox"}
+		router = ehr.NewRouter(fhir, redox)
+	})
+
+	It("delivers the payloads of an order with the adapter which normalized it", func() {
+		order, err := router.NormalizeOrder([]byte("redox-order"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(order.Adapter).To(Equal("redox"))
+
+		Expect(router.SendResults(context.Background(), ehr.Destination{}, ehr.Results{Order: order})).To(Succeed())
+		Expect(redox.sent).To(HaveLen(1))
+		Expect(fhir.sent).To(BeEmpty())
+
+		adapter, err := ehr.AdapterFor(router, order)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(adapter).To(BeIdenticalTo(redox))
+	})
+
+	It("returns the errors of all adapters if none accepts the message", func() {
+		_, err := router.NormalizeOrder([]byte("hl7"))
+		Expect(err).To(MatchError(ContainSubstring("fhir: unexpected message")))
+		Expect(err).To(MatchError(ContainSubstring("redox: unexpected message")))
+	})
+
+	It("doesn't deliver orders which weren't normalized by a configured adapter", func() {
+		Expect(router.SendResults(context.Background(), ehr.Destination{}, ehr.Results{Order: ehr.Order{Id: "1"}})).ToNot(Succeed())
+		Expect(redox.sent).To(BeEmpty())
+		Expect(fhir.sent).To(BeEmpty())
+	})
+})
@@ -0,0 +1,27 @@
+package test
+
+const (
+	DeliveryResults      = "results"
+	DeliveryObservations = "observations"
+	DeliveryDocument     = "document"
+)
+
+// Delivery is a payload which was delivered by an adapter, decoded by the test double of the EHR, so tests can
+// run against all adapters
+type Delivery struct {
+	Type string
+	// DestinationId is empty if the EHR doesn't address destinations
+	DestinationId string
+	// Results
+	IsSuccess bool
+	Code      string
+	Message   string
+	// Details are the additional results keyed by code
+	Details map[string]string
+	// Observations are the values of the observations keyed by code
+	Observations map[string]string
+	// Document
+	DocumentId string
+	Content    []byte
+	Text       string
+}
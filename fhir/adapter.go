@@ -0,0 +1,495 @@
+package fhir
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"go.uber.org/zap"
+)
+
+const (
+	AdapterName = "fhir"
+
+	valueTypeNumeric  = "Numeric"
+	valueTypeDateTime = "DateTime"
+
+	resultValueSuccess = "SUCCESS"
+	resultValueFailure = "FAILURE"
+
+	ResultCodeCode         = "RESULT_CODE"
+	ResultMessageCode      = "RESULT_MESSAGE"
+	MatchingMethodCode     = "MATCHING_METHOD"
+	MatchingConfidenceCode = "MATCHING_CONFIDENCE"
+	ReportingPeriodCode    = "REPORTING_PERIOD"
+)
+
+// ResultCodes are the codes of the results of the operations requested by orders
+var ResultCodes = map[ehr.Operation]string{
+	ehr.OperationMatching:        "MATCHING_RESULT",
+	ehr.OperationAccountCreation: "ACCOUNT_CREATION_RESULT",
+}
+
+var ErrServiceRequestMissing = errors.New("the bundle doesn't contain a service request")
+
+// Order is an order received from the FHIR server. It's a service request with the resources it references.
+type Order struct {
+	ServiceRequest ServiceRequest
+	Patient        Patient
+	Encounter      *Encounter
+	Practitioner   *Practitioner
+}
+
+type adapter struct {
+	client *client
+	logger *zap.SugaredLogger
+}
+
+var _ ehr.Adapter = &adapter{}
+
+// NewAdapter returns the EHR adapter which creates FHIR resources with SMART backend services authorization
+func NewAdapter(config Config, logger *zap.SugaredLogger) (ehr.Adapter, error) {
+	client, err := newClient(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &adapter{
+		client: client,
+		logger: logger,
+	}, nil
+}
+
+func (a *adapter) Name() string {
+	return AdapterName
+}
+
+// NormalizeOrder normalizes a bundle with a service request and the patient, encounter and practitioner it references
+func (a *adapter) NormalizeOrder(message []byte) (ehr.Order, error) {
+	order, err := ParseOrder(message)
+	if err != nil {
+		return ehr.Order{}, err
+	}
+	return NormalizeOrder(order), nil
+}
+
+func ParseOrder(message []byte) (Order, error) {
+	bundle := Bundle{}
+	if err := json.Unmarshal(message, &bundle); err != nil {
+		return Order{}, fmt.Errorf("unable to unmarshal bundle: %w", err)
+	}
+	if bundle.ResourceType != ResourceTypeBundle {
+		return Order{}, fmt.Errorf("unexpected resource type %s", bundle.ResourceType)
+	}
+
+	// Resources are referenced by their full url or by their type and id
+	resources := make(map[string]json.RawMessage)
+	var serviceRequest json.RawMessage
+	for _, entry := range bundle.Entry {
+		resource := Resource{}
+		if err := json.Unmarshal(entry.Resource, &resource); err != nil {
+			return Order{}, fmt.Errorf("unable to unmarshal resource: %w", err)
+		}
+		if resource.ResourceType == ResourceTypeServiceRequest && serviceRequest == nil {
+			serviceRequest = entry.Resource
+		}
+		if entry.FullUrl != "" {
+			resources[entry.FullUrl] = entry.Resource
+		}
+		if resource.Id != "" {
+			resources[resource.ResourceType+"/"+resource.Id] = entry.Resource
+		}
+	}
+	if serviceRequest == nil {
+		return Order{}, ErrServiceRequestMissing
+	}
+
+	order := Order{}
+	if err := json.Unmarshal(serviceRequest, &order.ServiceRequest); err != nil {
+		return Order{}, fmt.Errorf("unable to unmarshal service request: %w", err)
+	}
+
+	patient, ok := resources[order.ServiceRequest.Subject.Reference]
+	if !ok {
+		return Order{}, fmt.Errorf("the bundle doesn't contain the patient %s", order.ServiceRequest.Subject.Reference)
+	}
+	if err := json.Unmarshal(patient, &order.Patient); err != nil {
+		return Order{}, fmt.Errorf("unable to unmarshal patient: %w", err)
+	}
+	if ref := order.ServiceRequest.Encounter; ref != nil {
+		if encounter, ok := resources[ref.Reference]; ok {
+			order.Encounter = &Encounter{}
+			if err := json.Unmarshal(encounter, order.Encounter); err != nil {
+				return Order{}, fmt.Errorf("unable to unmarshal encounter: %w", err)
+			}
+		}
+	}
+	if ref := order.ServiceRequest.Requester; ref != nil {
+		if practitioner, ok := resources[ref.Reference]; ok {
+			order.Practitioner = &Practitioner{}
+			if err := json.Unmarshal(practitioner, order.Practitioner); err != nil {
+				return Order{}, fmt.Errorf("unable to unmarshal practitioner: %w", err)
+			}
+		}
+	}
+
+	return order, nil
+}
+
+// NormalizeOrder converts a FHIR order to the order model which is shared by all EHR adapters
+func NormalizeOrder(order Order) ehr.Order {
+	request := order.ServiceRequest
+	normalized := ehr.Order{
+		Id:     request.Id,
+		Native: order,
+	}
+	if len(request.Identifier) > 0 {
+		normalized.Id = request.Identifier[0].Value
+	}
+	if request.AuthoredOn != "" {
+		if authored, err := time.Parse(time.RFC3339, request.AuthoredOn); err == nil {
+			normalized.Time = &authored
+		}
+	}
+	if request.Code != nil {
+		normalized.ProcedureCode = request.Code.GetCode()
+		if len(request.Code.Coding) > 0 {
+			normalized.ProcedureCodeset = request.Code.Coding[0].System
+		}
+		normalized.ProcedureDescription = request.Code.Text
+		if normalized.ProcedureDescription == "" && len(request.Code.Coding) > 0 {
+			normalized.ProcedureDescription = request.Code.Coding[0].Display
+		}
+	}
+	for _, detail := range request.OrderDetail {
+		if code := detail.GetCode(); code != "" {
+			normalized.ClinicalInfo = append(normalized.ClinicalInfo, ehr.ClinicalInfo{Code: code, Value: detail.Text})
+		}
+	}
+	for _, reason := range request.ReasonCode {
+		for _, coding := range reason.Coding {
+			if coding.Code == "" {
+				continue
+			}
+			codeset := coding.System
+			if codeset == CodeSystemICD10 {
+				codeset = "ICD-10"
+			}
+			normalized.Diagnoses = append(normalized.Diagnoses, ehr.Diagnosis{Code: coding.Code, Codeset: codeset, Name: coding.Display})
+		}
+	}
+
+	patient := order.Patient
+	for _, identifier := range patient.Identifier {
+		normalized.Patient.Identifiers = append(normalized.Patient.Identifiers, ehr.Identifier{Id: identifier.Value, Type: getIdentifierType(identifier)})
+	}
+	if len(patient.Name) > 0 {
+		name := patient.Name[0]
+		normalized.Patient.LastName = name.Family
+		if len(name.Given) > 0 {
+			normalized.Patient.FirstName = name.Given[0]
+		}
+		if len(name.Given) > 1 {
+			normalized.Patient.MiddleName = strings.Join(name.Given[1:], " ")
+		}
+	}
+	normalized.Patient.BirthDate = patient.BirthDate
+	normalized.Patient.Sex = patient.Gender
+	normalized.Patient.EmailAddresses = getEmailAddresses(patient.Telecom)
+	normalized.Patient.PhoneNumbers = getPhoneNumbers(patient.Telecom)
+
+	var guarantorEmailAddresses []string
+	var guarantor *ehr.Guarantor
+	for _, contact := range patient.Contact {
+		for _, relationship := range contact.Relationship {
+			if relationship.GetCode() != RelationshipGuardian {
+				continue
+			}
+			guarantorEmailAddresses = append(guarantorEmailAddresses, getEmailAddresses(contact.Telecom)...)
+			if guarantor == nil {
+				guarantor = &ehr.Guarantor{
+					RelationToPatient: relationship.Text,
+					PhoneNumbers:      getPhoneNumbers(contact.Telecom),
+				}
+				if contact.Name != nil {
+					guarantor.LastName = contact.Name.Family
+					if len(contact.Name.Given) > 0 {
+						guarantor.FirstName = contact.Name.Given[0]
+					}
+				}
+			}
+		}
+	}
+
+	if encounter := order.Encounter; encounter != nil {
+		normalized.Visit = &ehr.Visit{}
+		if len(encounter.Identifier) > 0 {
+			normalized.Visit.Number = encounter.Identifier[0].Value
+		}
+		if encounter.Period != nil && encounter.Period.Start != "" {
+			if start, err := time.Parse(time.RFC3339, encounter.Period.Start); err == nil {
+				normalized.Visit.Time = &start
+			}
+		}
+		if len(encounter.Location) > 0 {
+			normalized.Visit.Location.Facility = encounter.Location[0].Location.Display
+		}
+	}
+	if guarantor != nil {
+		if normalized.Visit == nil {
+			normalized.Visit = &ehr.Visit{}
+		}
+		normalized.Visit.GuarantorEmailAddresses = guarantorEmailAddresses
+		normalized.Visit.Guarantor = guarantor
+	}
+
+	if practitioner := order.Practitioner; practitioner != nil {
+		normalized.Provider = &ehr.Provider{}
+		if len(practitioner.Identifier) > 0 {
+			normalized.Provider.Id = practitioner.Identifier[0].Value
+			normalized.Provider.IdType = getIdentifierType(practitioner.Identifier[0])
+		}
+		if len(practitioner.Name) > 0 {
+			normalized.Provider.LastName = practitioner.Name[0].Family
+			if len(practitioner.Name[0].Given) > 0 {
+				normalized.Provider.FirstName = practitioner.Name[0].Given[0]
+			}
+		}
+	}
+
+	return normalized
+}
+
+// getIdentifierType returns MRN for medical record numbers, so MRNs are matched with the same id type as for
+// other EHRs, and the code or text of the identifier type otherwise
+func getIdentifierType(identifier Identifier) string {
+	if identifier.Type == nil {
+		return identifier.System
+	}
+	if code := identifier.Type.GetCode(); code == IdentifierTypeMedicalRecordNumber {
+		return "MRN"
+	} else if code != "" {
+		return code
+	}
+	return identifier.Type.Text
+}
+
+// getPhoneNumbers returns the phone numbers with the types of the shared order model
+func getPhoneNumbers(telecom []ContactPoint) []ehr.PhoneNumber {
+	var result []ehr.PhoneNumber
+	for _, contact := range telecom {
+		if contact.System != ContactPointSystemPhone || contact.Value == "" {
+			continue
+		}
+		// The contact point uses of FHIR match the phone number types, other uses are treated as home numbers
+		phoneType := ehr.PhoneNumberTypeHome
+		if contact.Use == ehr.PhoneNumberTypeMobile || contact.Use == ehr.PhoneNumberTypeWork {
+			phoneType = contact.Use
+		}
+		result = append(result, ehr.PhoneNumber{Type: phoneType, Number: contact.Value})
+	}
+	return result
+}
+
+func getEmailAddresses(telecom []ContactPoint) []string {
+	var result []string
+	for _, contact := range telecom {
+		if contact.System == ContactPointSystemEmail {
+			result = append(result, contact.Value)
+		}
+	}
+	return result
+}
+
+func (a *adapter) SendResults(ctx context.Context, destination ehr.Destination, results ehr.Results) error {
+	order, err := getNativeOrder(results.Order)
+	if err != nil {
+		return err
+	}
+
+	value := resultValueFailure
+	if results.IsSuccess {
+		value = resultValueSuccess
+	}
+
+	observation := newObservation(order, ResultCodes[results.Operation], CodeSystemTidepool)
+	observation.Issued = time.Now().Format(time.RFC3339)
+	observation.ValueString = &value
+	observation.Component = append(observation.Component, newStringComponent(ResultMessageCode, results.Message))
+	if results.Code != "" {
+		observation.Component = append(observation.Component, newStringComponent(ResultCodeCode, string(results.Code)))
+	}
+	if results.MatchMethod != "" {
+		observation.Component = append(observation.Component,
+			newStringComponent(MatchingMethodCode, results.MatchMethod),
+			ObservationComponent{
+				Code:          CodeableConcept{Coding: []Coding{{System: CodeSystemTidepool, Code: MatchingConfidenceCode}}},
+				ValueQuantity: &Quantity{Value: results.MatchConfidence},
+			},
+		)
+	}
+	for _, detail := range results.Details {
+		component := newStringComponent(detail.Code, detail.Value)
+		component.Code.Text = detail.Description
+		observation.Component = append(observation.Component, component)
+	}
+
+	return a.client.Create(ctx, ResourceTypeObservation, observation)
+}
+
+// SendObservations creates the observations in a single transaction
+func (a *adapter) SendObservations(ctx context.Context, destination ehr.Destination, observations ehr.Observations) error {
+	order, err := getNativeOrder(observations.Order)
+	if err != nil {
+		return err
+	}
+
+	bundle := Bundle{
+		ResourceType: ResourceTypeBundle,
+		Type:         BundleTypeTransaction,
+		Entry:        make([]BundleEntry, 0, len(observations.Observations)),
+	}
+	for _, o := range observations.Observations {
+		observation := newObservation(order, o.Code, getCodeSystem(o.Codeset))
+		observation.Code.Text = o.Description
+		observation.EffectiveDateTime = o.DateTime
+		if err := setObservationValue(&observation, o); err != nil {
+			return err
+		}
+		if o.Period != "" {
+			observation.Component = append(observation.Component, newStringComponent(ReportingPeriodCode, o.Period))
+		}
+
+		resource, err := json.Marshal(observation)
+		if err != nil {
+			return fmt.Errorf("unable to marshal observation: %w", err)
+		}
+		bundle.Entry = append(bundle.Entry, BundleEntry{
+			Resource: resource,
+			Request:  &BundleEntryRequest{Method: "POST", Url: ResourceTypeObservation},
+		})
+	}
+
+	return a.client.Create(ctx, ResourceTypeBundle, bundle)
+}
+
+// SendDocument creates a document reference with the embedded report, or with the text of the document if it
+// doesn't have a report. The observations of the document are delivered separately.
+func (a *adapter) SendDocument(ctx context.Context, destination ehr.Destination, document ehr.Document) error {
+	order, err := getNativeOrder(document.Order)
+	if err != nil {
+		return err
+	}
+	if document.Upload != nil {
+		return errors.New("uploaded documents aren't supported by the fhir adapter")
+	}
+
+	reference := DocumentReference{
+		ResourceType:     ResourceTypeDocumentReference,
+		MasterIdentifier: &Identifier{System: IdentifierSystemReports, Value: document.Id},
+		Status:           DocumentStatusCurrent,
+		Subject:          getPatientReference(order),
+		Date:             time.Now().Format(time.RFC3339),
+	}
+	attachment := Attachment{ContentType: ContentTypePDF, Data: document.Content, Title: document.FileName}
+	if document.Content == nil {
+		attachment = Attachment{ContentType: ContentTypePlainText, Data: []byte(document.Text)}
+	}
+	reference.Content = []DocumentContent{{Attachment: attachment}}
+	if document.ReplacedId != "" {
+		reference.RelatesTo = []DocumentRelatesTo{{
+			Code:   DocumentRelationReplace,
+			Target: Reference{Identifier: &Identifier{System: IdentifierSystemReports, Value: document.ReplacedId}},
+		}}
+	}
+	reference.Context = &DocumentContext{Related: []Reference{getServiceRequestReference(order)}}
+	if order.Encounter != nil {
+		reference.Context.Encounter = []Reference{getEncounterReference(order)}
+	}
+
+	return a.client.Create(ctx, ResourceTypeDocumentReference, reference)
+}
+
+func newObservation(order Order, code string, system string) Observation {
+	observation := Observation{
+		ResourceType: ResourceTypeObservation,
+		Status:       ObservationStatusFinal,
+		Code:         CodeableConcept{Coding: []Coding{{System: system, Code: code}}},
+		Subject:      getPatientReference(order),
+		BasedOn:      []Reference{getServiceRequestReference(order)},
+	}
+	if order.Encounter != nil {
+		encounter := getEncounterReference(order)
+		observation.Encounter = &encounter
+	}
+	return observation
+}
+
+func newStringComponent(code string, value string) ObservationComponent {
+	return ObservationComponent{
+		Code:        CodeableConcept{Coding: []Coding{{System: CodeSystemTidepool, Code: code}}},
+		ValueString: &value,
+	}
+}
+
+func setObservationValue(observation *Observation, o ehr.Observation) error {
+	switch o.ValueType {
+	case valueTypeNumeric:
+		value, err := strconv.ParseFloat(o.Value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid numeric value of observation %s: %w", o.Code, err)
+		}
+		observation.ValueQuantity = &Quantity{Value: value}
+		if o.Units != nil {
+			observation.ValueQuantity.Unit = *o.Units
+		}
+	case valueTypeDateTime:
+		value := o.Value
+		observation.ValueDateTime = &value
+	default:
+		value := o.Value
+		observation.ValueString = &value
+	}
+	return nil
+}
+
+// getCodeSystem returns the system of the codeset of an observation code. Observations without a codeset have
+// Tidepool codes.
+func getCodeSystem(codeset string) string {
+	switch {
+	case codeset == "":
+		return CodeSystemTidepool
+	case strings.EqualFold(codeset, "LOINC"):
+		return CodeSystemLOINC
+	default:
+		return codeset
+	}
+}
+
+func getPatientReference(order Order) Reference {
+	if order.ServiceRequest.Subject.Reference != "" && !strings.HasPrefix(order.ServiceRequest.Subject.Reference, "urn:") {
+		return Reference{Reference: order.ServiceRequest.Subject.Reference}
+	}
+	return Reference{Reference: ResourceTypePatient + "/" + order.Patient.Id}
+}
+
+func getServiceRequestReference(order Order) Reference {
+	return Reference{Reference: ResourceTypeServiceRequest + "/" + order.ServiceRequest.Id}
+}
+
+func getEncounterReference(order Order) Reference {
+	return Reference{Reference: ResourceTypeEncounter + "/" + order.Encounter.Id}
+}
+
+// getNativeOrder returns the FHIR order from which the order was normalized
+func getNativeOrder(order ehr.Order) (Order, error) {
+	native, ok := order.Native.(Order)
+	if !ok {
+		return Order{}, fmt.Errorf("the order %s wasn't received from a fhir server", order.Id)
+	}
+	return native, nil
+}
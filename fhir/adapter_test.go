@@ -0,0 +1,111 @@
+package fhir_test
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	ehrTest "github.com/tidepool-org/clinic-worker/ehr/test"
+	"github.com/tidepool-org/clinic-worker/fhir"
+	testFhir "github.com/tidepool-org/clinic-worker/fhir/test"
+	"github.com/tidepool-org/clinic-worker/test"
+)
+
+var _ = Describe("Adapter", func() {
+	var server *testFhir.Server
+	var adapter ehr.Adapter
+	var message []byte
+
+	BeforeEach(func() {
+		var err error
+		server, err = testFhir.NewServer()
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(server.Close)
+
+		adapter, err = fhir.NewAdapter(server.Config(), zap.NewNop().Sugar())
+		Expect(err).ToNot(HaveOccurred())
+
+		message, err = test.LoadFixture("test/fixtures/servicerequestbundle.json")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("normalizes the service request and the resources it references", func() {
+		order, err := adapter.NormalizeOrder(message)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(order.Id).To(Equal("157968300"))
+		Expect(order.ProcedureCode).To(Equal("PRO1092"))
+		Expect(order.ProcedureCodeset).To(Equal("https://fhir.example.org/procedures"))
+		Expect(order.Time).ToNot(BeNil())
+		Expect(order.GetMrn("MRN")).To(HaveValue(Equal("0000000001")))
+		Expect(order.GetFullName()).To(Equal("Timothy Bixby"))
+		Expect(order.Patient.BirthDate).To(Equal("2008-01-06"))
+		Expect(order.GetPatientEmailAddress()).To(HaveValue(Equal("tim@test.com")))
+		Expect(order.GetGuarantorEmailAddress()).To(HaveValue(Equal("kent@test.com")))
+		Expect(order.GetClinicalInfoValues(map[string]struct{}{"TIDEPOOL_TAGS": {}}, ",")).To(Equal([]string{"T1D", "ADULT"}))
+		Expect(order.Visit).ToNot(BeNil())
+		Expect(order.Visit.Number).To(Equal("1234"))
+		Expect(order.Visit.Guarantor.GetFullName()).To(Equal("Kent Bixby"))
+		Expect(order.Provider).ToNot(BeNil())
+		Expect(order.Provider.Id).To(Equal("4356789876"))
+		Expect(ehr.GetPhoneNumber(order.Patient.PhoneNumbers, []string{ehr.PhoneNumberTypeHome})).To(Equal("+18088675301"))
+		Expect(order.Diagnoses).To(ContainElement(HaveField("Code", "Z31.41")))
+	})
+
+	It("authorizes requests with a SMART backend services token which is reused until it expires", func() {
+		order, err := adapter.NormalizeOrder(message)
+		Expect(err).ToNot(HaveOccurred())
+
+		results := ehr.Results{Order: order, Operation: ehr.OperationMatching, IsSuccess: true}
+		Expect(adapter.SendResults(context.Background(), ehr.Destination{}, results)).To(Succeed())
+		Expect(adapter.SendResults(context.Background(), ehr.Destination{}, results)).To(Succeed())
+
+		Expect(server.TokenRequests).To(Equal(1))
+		Expect(server.Assertions[0]["iss"]).To(Equal("tidepool"))
+		Expect(server.Assertions[0]["aud"]).To(Equal(server.URL + "/token"))
+		Expect(server.Scopes[0]).To(Equal("system/Observation.write system/DocumentReference.write"))
+	})
+
+	It("references the patient, the service request and the encounter of the order", func() {
+		order, err := adapter.NormalizeOrder(message)
+		Expect(err).ToNot(HaveOccurred())
+
+		results := ehr.Results{Order: order, Operation: ehr.OperationMatching, IsSuccess: true}
+		Expect(adapter.SendResults(context.Background(), ehr.Destination{}, results)).To(Succeed())
+
+		observation := fhir.Observation{}
+		Expect(json.Unmarshal(server.Created[0], &observation)).To(Succeed())
+		Expect(observation.Subject.Reference).To(Equal("Patient/e167267c-16c9-4fe3-96ae-9cff5703e90a"))
+		Expect(observation.BasedOn).To(ConsistOf(fhir.Reference{Reference: "ServiceRequest/sr-157968300"}))
+		Expect(observation.Encounter.Reference).To(Equal("Encounter/enc-1234"))
+	})
+
+	It("delivers plain-text documents which replace an earlier document", func() {
+		order, err := adapter.NormalizeOrder(message)
+		Expect(err).ToNot(HaveOccurred())
+
+		document := ehr.Document{Order: order, Id: "report-2", ReplacedId: "report-1", Text: "The report is unavailable"}
+		Expect(adapter.SendDocument(context.Background(), ehr.Destination{}, document)).To(Succeed())
+
+		Expect(server.Delivered()).To(ConsistOf(ehrTest.Delivery{Type: ehrTest.DeliveryDocument, DocumentId: "report-2", Text: document.Text}))
+		reference := fhir.DocumentReference{}
+		Expect(json.Unmarshal(server.Created[0], &reference)).To(Succeed())
+		Expect(reference.RelatesTo).To(HaveLen(1))
+		Expect(reference.RelatesTo[0].Code).To(Equal(fhir.DocumentRelationReplace))
+		Expect(reference.RelatesTo[0].Target.Identifier.Value).To(Equal("report-1"))
+	})
+
+	It("doesn't deliver orders which weren't normalized by the adapter", func() {
+		results := ehr.Results{Order: ehr.Order{Id: "157968300"}, Operation: ehr.OperationMatching, IsSuccess: true}
+		Expect(adapter.SendResults(context.Background(), ehr.Destination{}, results)).ToNot(Succeed())
+		Expect(server.Delivered()).To(BeEmpty())
+	})
+
+	It("returns an error if the bundle doesn't contain a service request", func() {
+		_, err := adapter.NormalizeOrder([]byte(`{"resourceType":"Bundle","type":"collection","entry":[]}`))
+		Expect(err).To(MatchError(fhir.ErrServiceRequestMissing))
+	})
+})
@@ -0,0 +1,126 @@
+package fhir
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/clinic-worker/smart"
+	"go.uber.org/zap"
+)
+
+const contentTypeFHIR = "application/fhir+json"
+
+type Config struct {
+	BaseUrl  string `envconfig:"TIDEPOOL_FHIR_BASE_URL" required:"true"`
+	TokenUrl string `envconfig:"TIDEPOOL_FHIR_TOKEN_URL" required:"true"`
+	ClientId string `envconfig:"TIDEPOOL_FHIR_CLIENT_ID" required:"true"`
+	// KeyId and PrivateKeyPem are the key which is registered with the JWK set of the client
+	KeyId         string `envconfig:"TIDEPOOL_FHIR_KEY_ID" required:"true"`
+	PrivateKeyPem string `envconfig:"TIDEPOOL_FHIR_PRIVATE_KEY" required:"true"`
+	Scope         string `envconfig:"TIDEPOOL_FHIR_SCOPE" default:"system/Observation.write system/DocumentReference.write"`
+}
+
+func NewConfig() (Config, error) {
+	config := Config{}
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+// client authorizes requests to the FHIR server with the SMART backend services flow
+type client struct {
+	config      Config
+	privateKey  *rsa.PrivateKey
+	restyClient *resty.Client
+	logger      *zap.SugaredLogger
+
+	token *smart.Token
+	mu    sync.RWMutex
+}
+
+func newClient(config Config, logger *zap.SugaredLogger) (*client, error) {
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(config.PrivateKeyPem))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key %s: %w", config.KeyId, err)
+	}
+
+	return &client{
+		config:      config,
+		privateKey:  privateKey,
+		restyClient: resty.New(),
+		logger:      logger,
+	}, nil
+}
+
+// Create posts the resource to the endpoint of its type, or posts a transaction bundle to the base url
+func (c *client) Create(ctx context.Context, resourceType string, resource any) error {
+	req, err := c.getRequestWithFreshToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(c.config.BaseUrl, "/")
+	if resourceType != ResourceTypeBundle {
+		url = url + "/" + resourceType
+	}
+
+	resp, err := req.
+		SetBody(resource).
+		SetHeader("Content-Type", contentTypeFHIR).
+		SetHeader("Accept", contentTypeFHIR).
+		Post(url)
+	if err != nil {
+		return fmt.Errorf("error sending %s to fhir server: %w", resourceType, err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("received %s error response when sending %s to fhir server: %s", resp.Status(), resourceType, resp.String())
+	}
+
+	return nil
+}
+
+func (c *client) getRequestWithFreshToken(ctx context.Context) (*resty.Request, error) {
+	if c.shouldRefreshToken() {
+		if err := c.obtainFreshToken(ctx); err != nil {
+			return nil, err
+		}
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.restyClient.R().SetContext(ctx).SetAuthToken(c.token.AccessToken), nil
+}
+
+func (c *client) shouldRefreshToken() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token == nil || c.token.IsExpired(smart.ExpirationDelta)
+}
+
+func (c *client) obtainFreshToken(ctx context.Context) error {
+	assertion, err := smart.Assertion{
+		ClientId:   c.config.ClientId,
+		Audience:   c.config.TokenUrl,
+		KeyId:      c.config.KeyId,
+		PrivateKey: c.privateKey,
+	}.Sign()
+	if err != nil {
+		return err
+	}
+
+	c.logger.Debugw("obtaining a fresh token from the fhir server")
+	token, err := smart.RequestToken(ctx, c.restyClient, c.config.TokenUrl, assertion, c.config.Scope)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+	return nil
+}
@@ -0,0 +1,39 @@
+package fhir
+
+import (
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var Module = fx.Provide(
+	NewModuleConfig,
+	fx.Annotated{
+		Name:   "fhir",
+		Target: NewModuleAdapter,
+	},
+)
+
+type ModuleConfig struct {
+	Enabled bool `envconfig:"TIDEPOOL_FHIR_ENABLED" default:"false"`
+}
+
+func NewModuleConfig() (ModuleConfig, error) {
+	config := ModuleConfig{}
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+// NewModuleAdapter returns nil if the FHIR integration isn't enabled, so the client configuration is only required
+// when it is
+func NewModuleAdapter(moduleConfig ModuleConfig, logger *zap.SugaredLogger) (ehr.Adapter, error) {
+	if !moduleConfig.Enabled {
+		return nil, nil
+	}
+	config, err := NewConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewAdapter(config, logger)
+}
@@ -0,0 +1,211 @@
+package fhir
+
+import (
+	"encoding/json"
+)
+
+const (
+	ResourceTypeBundle            = "Bundle"
+	ResourceTypeServiceRequest    = "ServiceRequest"
+	ResourceTypePatient           = "Patient"
+	ResourceTypeEncounter         = "Encounter"
+	ResourceTypePractitioner      = "Practitioner"
+	ResourceTypeObservation       = "Observation"
+	ResourceTypeDocumentReference = "DocumentReference"
+
+	BundleTypeTransaction = "transaction"
+
+	// IdentifierTypeMedicalRecordNumber is the code of medical record numbers in the identifier types of HL7 v2
+	IdentifierTypeMedicalRecordNumber = "MR"
+	// RelationshipGuardian is the code of guardians in the role codes of HL7 v3
+	RelationshipGuardian    = "GUARD"
+	ContactPointSystemEmail = "email"
+	ContactPointSystemPhone = "phone"
+	// CodeSystemICD10 is the code system of diagnoses in the reason codes of service requests
+	CodeSystemICD10 = "http://hl7.org/fhir/sid/icd-10-cm"
+
+	ObservationStatusFinal  = "final"
+	DocumentStatusCurrent   = "current"
+	DocumentRelationReplace = "replaces"
+	ContentTypePDF          = "application/pdf"
+	ContentTypePlainText    = "text/plain"
+	CodeSystemLOINC         = "http://loinc.org"
+	CodeSystemTidepool      = "https://tidepool.org/fhir/CodeSystem/observations"
+	IdentifierSystemReports = "https://tidepool.org/fhir/NamingSystem/reports"
+)
+
+// Resource is a FHIR resource of any type. The type is decoded first, so the resource can be decoded to the
+// matching struct.
+type Resource struct {
+	ResourceType string `json:"resourceType"`
+	Id           string `json:"id,omitempty"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Entry        []BundleEntry `json:"entry"`
+}
+
+type BundleEntry struct {
+	FullUrl  string              `json:"fullUrl,omitempty"`
+	Resource json.RawMessage     `json:"resource"`
+	Request  *BundleEntryRequest `json:"request,omitempty"`
+}
+
+type BundleEntryRequest struct {
+	Method string `json:"method"`
+	Url    string `json:"url"`
+}
+
+type Reference struct {
+	Reference  string      `json:"reference,omitempty"`
+	Identifier *Identifier `json:"identifier,omitempty"`
+	Display    string      `json:"display,omitempty"`
+}
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// GetCode returns the code of the first coding
+func (c CodeableConcept) GetCode() string {
+	if len(c.Coding) == 0 {
+		return ""
+	}
+	return c.Coding[0].Code
+}
+
+type Identifier struct {
+	System string           `json:"system,omitempty"`
+	Type   *CodeableConcept `json:"type,omitempty"`
+	Value  string           `json:"value"`
+}
+
+type HumanName struct {
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Use    string `json:"use,omitempty"`
+}
+
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type Patient struct {
+	ResourceType string         `json:"resourceType"`
+	Id           string         `json:"id,omitempty"`
+	Identifier   []Identifier   `json:"identifier,omitempty"`
+	Name         []HumanName    `json:"name,omitempty"`
+	Gender       string         `json:"gender,omitempty"`
+	BirthDate    string         `json:"birthDate,omitempty"`
+	Telecom      []ContactPoint `json:"telecom,omitempty"`
+	Contact      []struct {
+		Relationship []CodeableConcept `json:"relationship,omitempty"`
+		Name         *HumanName        `json:"name,omitempty"`
+		Telecom      []ContactPoint    `json:"telecom,omitempty"`
+	} `json:"contact,omitempty"`
+}
+
+type Practitioner struct {
+	ResourceType string       `json:"resourceType"`
+	Id           string       `json:"id,omitempty"`
+	Identifier   []Identifier `json:"identifier,omitempty"`
+	Name         []HumanName  `json:"name,omitempty"`
+}
+
+type Encounter struct {
+	ResourceType string       `json:"resourceType"`
+	Id           string       `json:"id,omitempty"`
+	Identifier   []Identifier `json:"identifier,omitempty"`
+	Period       *Period      `json:"period,omitempty"`
+	Location     []struct {
+		Location Reference `json:"location"`
+	} `json:"location,omitempty"`
+}
+
+type ServiceRequest struct {
+	ResourceType string            `json:"resourceType"`
+	Id           string            `json:"id,omitempty"`
+	Identifier   []Identifier      `json:"identifier,omitempty"`
+	Status       string            `json:"status,omitempty"`
+	Intent       string            `json:"intent,omitempty"`
+	Code         *CodeableConcept  `json:"code,omitempty"`
+	OrderDetail  []CodeableConcept `json:"orderDetail,omitempty"`
+	ReasonCode   []CodeableConcept `json:"reasonCode,omitempty"`
+	Subject      Reference         `json:"subject"`
+	Encounter    *Reference        `json:"encounter,omitempty"`
+	Requester    *Reference        `json:"requester,omitempty"`
+	AuthoredOn   string            `json:"authoredOn,omitempty"`
+}
+
+type Quantity struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+}
+
+type Observation struct {
+	ResourceType      string                 `json:"resourceType"`
+	Status            string                 `json:"status"`
+	Code              CodeableConcept        `json:"code"`
+	Subject           Reference              `json:"subject"`
+	BasedOn           []Reference            `json:"basedOn,omitempty"`
+	Encounter         *Reference             `json:"encounter,omitempty"`
+	EffectiveDateTime string                 `json:"effectiveDateTime,omitempty"`
+	Issued            string                 `json:"issued,omitempty"`
+	ValueQuantity     *Quantity              `json:"valueQuantity,omitempty"`
+	ValueString       *string                `json:"valueString,omitempty"`
+	ValueDateTime     *string                `json:"valueDateTime,omitempty"`
+	Component         []ObservationComponent `json:"component,omitempty"`
+}
+
+type ObservationComponent struct {
+	Code          CodeableConcept `json:"code"`
+	ValueQuantity *Quantity       `json:"valueQuantity,omitempty"`
+	ValueString   *string         `json:"valueString,omitempty"`
+}
+
+type DocumentReference struct {
+	ResourceType     string              `json:"resourceType"`
+	MasterIdentifier *Identifier         `json:"masterIdentifier,omitempty"`
+	Status           string              `json:"status"`
+	Subject          Reference           `json:"subject"`
+	Date             string              `json:"date,omitempty"`
+	RelatesTo        []DocumentRelatesTo `json:"relatesTo,omitempty"`
+	Content          []DocumentContent   `json:"content"`
+	Context          *DocumentContext    `json:"context,omitempty"`
+}
+
+type DocumentRelatesTo struct {
+	Code   string    `json:"code"`
+	Target Reference `json:"target"`
+}
+
+type DocumentContent struct {
+	Attachment Attachment `json:"attachment"`
+}
+
+type DocumentContext struct {
+	Encounter []Reference `json:"encounter,omitempty"`
+	Related   []Reference `json:"related,omitempty"`
+}
+
+type Attachment struct {
+	ContentType string `json:"contentType"`
+	// Data is encoded as base64 when marshalled
+	Data  []byte `json:"data"`
+	Title string `json:"title,omitempty"`
+}
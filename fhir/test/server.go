@@ -0,0 +1,187 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	ehrTest "github.com/tidepool-org/clinic-worker/ehr/test"
+	"github.com/tidepool-org/clinic-worker/fhir"
+)
+
+// Server is a FHIR server with a SMART backend services token endpoint which records the created resources
+type Server struct {
+	*httptest.Server
+	privateKey *rsa.PrivateKey
+
+	mu            sync.Mutex
+	TokenRequests int
+	Assertions    []jwt.MapClaims
+	Scopes        []string
+	Created       [][]byte
+}
+
+func NewServer() (*Server, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &Server{privateKey: privateKey}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", server.handleToken)
+	mux.HandleFunc("/fhir/", server.handleCreate)
+	server.Server = httptest.NewServer(mux)
+	return server, nil
+}
+
+// Config returns the configuration of an adapter which is authorized by the server
+func (s *Server) Config() fhir.Config {
+	return fhir.Config{
+		BaseUrl:       s.URL + "/fhir",
+		TokenUrl:      s.URL + "/token",
+		ClientId:      "tidepool",
+		KeyId:         "key-1",
+		PrivateKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(s.privateKey)})),
+		Scope:         "system/Observation.write system/DocumentReference.write",
+	}
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(r.PostForm.Get("client_assertion"), claims, func(token *jwt.Token) (interface{}, error) {
+		return &s.privateKey.PublicKey, nil
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	s.TokenRequests++
+	s.Assertions = append(s.Assertions, claims)
+	s.Scopes = append(s.Scopes, r.PostForm.Get("scope"))
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"access_token":"fhir-token","expires_in":300}`))
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer fhir-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.Created = append(s.Created, body)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Delivered returns the created resources, decoded to the deliveries of the EHR adapter
+func (s *Server) Delivered() []ehrTest.Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var delivered []ehrTest.Delivery
+	for _, body := range s.Created {
+		delivered = append(delivered, decodeDelivery(body))
+	}
+	return delivered
+}
+
+func decodeDelivery(body []byte) ehrTest.Delivery {
+	resource := fhir.Resource{}
+	if err := json.Unmarshal(body, &resource); err != nil {
+		return ehrTest.Delivery{}
+	}
+
+	switch resource.ResourceType {
+	case fhir.ResourceTypeObservation:
+		observation := fhir.Observation{}
+		if err := json.Unmarshal(body, &observation); err != nil {
+			return ehrTest.Delivery{}
+		}
+		delivery := ehrTest.Delivery{Type: ehrTest.DeliveryResults, IsSuccess: getString(observation.ValueString) == "SUCCESS", Details: map[string]string{}}
+		for _, component := range observation.Component {
+			switch code := component.Code.GetCode(); code {
+			case fhir.ResultCodeCode:
+				delivery.Code = getString(component.ValueString)
+			case fhir.ResultMessageCode:
+				delivery.Message = getString(component.ValueString)
+			case fhir.MatchingMethodCode, fhir.MatchingConfidenceCode:
+			default:
+				delivery.Details[code] = getString(component.ValueString)
+			}
+		}
+		return delivery
+	case fhir.ResourceTypeBundle:
+		bundle := fhir.Bundle{}
+		if err := json.Unmarshal(body, &bundle); err != nil {
+			return ehrTest.Delivery{}
+		}
+		delivery := ehrTest.Delivery{Type: ehrTest.DeliveryObservations, Observations: map[string]string{}}
+		for _, entry := range bundle.Entry {
+			observation := fhir.Observation{}
+			if err := json.Unmarshal(entry.Resource, &observation); err != nil {
+				continue
+			}
+			var value string
+			switch {
+			case observation.ValueQuantity != nil:
+				value = strconv.FormatFloat(observation.ValueQuantity.Value, 'f', -1, 64)
+			case observation.ValueDateTime != nil:
+				value = *observation.ValueDateTime
+			case observation.ValueString != nil:
+				value = *observation.ValueString
+			}
+			delivery.Observations[observation.Code.GetCode()] = value
+		}
+		return delivery
+	case fhir.ResourceTypeDocumentReference:
+		reference := fhir.DocumentReference{}
+		if err := json.Unmarshal(body, &reference); err != nil {
+			return ehrTest.Delivery{}
+		}
+		delivery := ehrTest.Delivery{Type: ehrTest.DeliveryDocument}
+		if reference.MasterIdentifier != nil {
+			delivery.DocumentId = reference.MasterIdentifier.Value
+		}
+		if len(reference.Content) > 0 {
+			attachment := reference.Content[0].Attachment
+			if attachment.ContentType == fhir.ContentTypePlainText {
+				delivery.Text = string(attachment.Data)
+			} else {
+				delivery.Content = attachment.Data
+			}
+		}
+		return delivery
+	}
+	return ehrTest.Delivery{}
+}
+
+func getString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
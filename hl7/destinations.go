@@ -0,0 +1,52 @@
+package hl7
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+type Config struct {
+	// Destinations is a JSON object of the transport configurations keyed by the name of the destination, e.g.
+	// {"hospital-a": {"type": "mllp", "address": "10.0.0.5:2575"}}
+	Destinations Destinations `envconfig:"TIDEPOOL_HL7_DESTINATIONS"`
+}
+
+func NewConfig() (Config, error) {
+	config := Config{}
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+// Destinations are the receivers of HL7v2 messages which were approved by the operators. Clinics select one of them
+// by name, so the settings of a clinic never decide which hosts the worker connects to or where it writes files.
+type Destinations map[string]TransportConfig
+
+// Decode decodes and validates the destinations from their JSON encoding
+func (d *Destinations) Decode(value string) error {
+	destinations := Destinations{}
+	if err := json.Unmarshal([]byte(value), &destinations); err != nil {
+		return fmt.Errorf("unable to parse hl7 destinations: %w", err)
+	}
+	for name, config := range destinations {
+		if config.Type == TransportTypeFile && !filepath.IsAbs(config.Directory) {
+			return fmt.Errorf("the directory of hl7 destination %s must be absolute", name)
+		}
+		if _, err := NewTransport(config); err != nil {
+			return fmt.Errorf("invalid hl7 destination %s: %w", name, err)
+		}
+	}
+	*d = destinations
+	return nil
+}
+
+// NewTransport returns the transport of the destination with the name
+func (d Destinations) NewTransport(name string) (Transport, error) {
+	config, ok := d[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown hl7 destination %q", name)
+	}
+	return NewTransport(config)
+}
@@ -0,0 +1,32 @@
+package hl7_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/hl7"
+)
+
+var _ = Describe("Destinations", func() {
+	It("decodes the destinations configured by the operators", func() {
+		destinations := hl7.Destinations{}
+		Expect(destinations.Decode(`{"hospital": {"type": "mllp", "address": "10.0.0.5:2575"}, "drop": {"type": "file", "directory": "/var/hl7"}}`)).To(Succeed())
+		Expect(destinations).To(HaveLen(2))
+
+		transport, err := destinations.NewTransport("hospital")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(transport).To(BeAssignableToTypeOf(&hl7.MLLPTransport{}))
+		Expect(transport.(*hl7.MLLPTransport).Address).To(Equal("10.0.0.5:2575"))
+	})
+
+	It("rejects invalid destinations", func() {
+		destinations := hl7.Destinations{}
+		Expect(destinations.Decode(`{"hospital": {"type": "mllp"}}`)).ToNot(Succeed())
+		Expect(destinations.Decode(`{"drop": {"type": "file", "directory": "hl7"}}`)).ToNot(Succeed())
+	})
+
+	It("doesn't return transports of unknown destinations", func() {
+		_, err := hl7.Destinations{}.NewTransport("attacker")
+		Expect(err).To(MatchError(ContainSubstring("unknown hl7 destination")))
+	})
+})
@@ -0,0 +1,13 @@
+package hl7_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestHL7(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HL7 Suite")
+}
@@ -0,0 +1,186 @@
+package hl7
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	Version = "2.5.1"
+
+	FieldSeparator        = "|"
+	ComponentSeparator    = "^"
+	RepetitionSeparator   = "~"
+	EscapeCharacter       = `\`
+	SubcomponentSeparator = "&"
+	EncodingCharacters    = ComponentSeparator + RepetitionSeparator + EscapeCharacter + SubcomponentSeparator
+
+	SegmentTerminator = "\r"
+
+	ProcessingIdProduction = "P"
+	ProcessingIdTraining   = "T"
+
+	dateTimeLayout = "20060102150405-0700"
+	dateLayout     = "20060102"
+)
+
+var escaper = strings.NewReplacer(
+	EscapeCharacter, `\E\`,
+	FieldSeparator, `\F\`,
+	ComponentSeparator, `\S\`,
+	RepetitionSeparator, `\R\`,
+	SubcomponentSeparator, `\T\`,
+	"\r", `\X0D\`,
+	"\n", `\X0A\`,
+)
+
+// Escape replaces the delimiters in a value with the corresponding HL7 escape sequences
+func Escape(value string) string {
+	return escaper.Replace(value)
+}
+
+// Components escapes each of the values and joins them with the component separator.
+// Trailing empty components are trimmed.
+func Components(values ...string) string {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = Escape(value)
+	}
+	return strings.TrimRight(strings.Join(escaped, ComponentSeparator), ComponentSeparator)
+}
+
+// Repetitions joins already encoded field values with the repetition separator
+func Repetitions(values ...string) string {
+	return strings.Join(values, RepetitionSeparator)
+}
+
+func FormatDateTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(dateTimeLayout)
+}
+
+func FormatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(dateLayout)
+}
+
+type Header struct {
+	SendingApplication   string
+	SendingFacility      string
+	ReceivingApplication string
+	ReceivingFacility    string
+	MessageType          string
+	TriggerEvent         string
+	MessageStructure     string
+	ControlId            string
+	ProcessingId         string
+	DateTime             time.Time
+}
+
+// Segment is a list of encoded fields. The first item is the segment id.
+type Segment []string
+
+func (s Segment) Id() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
+
+// Field returns the encoded field at the given (1-based) position
+func (s Segment) Field(position int) string {
+	if position <= 0 || position >= len(s) {
+		return ""
+	}
+	return s[position]
+}
+
+type Message struct {
+	header   Header
+	segments []Segment
+}
+
+func NewMessage(header Header) *Message {
+	if header.ProcessingId == "" {
+		header.ProcessingId = ProcessingIdProduction
+	}
+	if header.DateTime.IsZero() {
+		header.DateTime = time.Now()
+	}
+
+	msg := &Message{header: header}
+	msg.segments = append(msg.segments, Segment{
+		"MSH",
+		FieldSeparator,
+		EncodingCharacters,
+		Escape(header.SendingApplication),
+		Escape(header.SendingFacility),
+		Escape(header.ReceivingApplication),
+		Escape(header.ReceivingFacility),
+		FormatDateTime(header.DateTime),
+		"",
+		Components(header.MessageType, header.TriggerEvent, header.MessageStructure),
+		Escape(header.ControlId),
+		header.ProcessingId,
+		Version,
+	})
+	return msg
+}
+
+func (m *Message) ControlId() string {
+	return m.header.ControlId
+}
+
+// AddSegment appends a segment with already encoded fields to the message
+func (m *Message) AddSegment(id string, fields ...string) {
+	segment := make(Segment, 0, len(fields)+1)
+	segment = append(segment, id)
+	segment = append(segment, fields...)
+	m.segments = append(m.segments, segment)
+}
+
+func (m *Message) Segments() []Segment {
+	return m.segments
+}
+
+func (m *Message) Encode() []byte {
+	builder := strings.Builder{}
+	for _, segment := range m.segments {
+		fields := segment
+		if segment.Id() == "MSH" {
+			// MSH-1 is the field separator itself and is not delimited
+			builder.WriteString("MSH")
+			builder.WriteString(FieldSeparator)
+			fields = segment[2:]
+		} else {
+			builder.WriteString(segment.Id())
+			builder.WriteString(FieldSeparator)
+			fields = segment[1:]
+		}
+		builder.WriteString(strings.TrimRight(strings.Join(fields, FieldSeparator), FieldSeparator))
+		builder.WriteString(SegmentTerminator)
+	}
+	return []byte(builder.String())
+}
+
+// ParseSegments splits an encoded message in segments. Escape sequences are not decoded.
+func ParseSegments(message []byte) []Segment {
+	var segments []Segment
+	normalized := strings.ReplaceAll(string(message), "\n", SegmentTerminator)
+	for _, line := range strings.Split(normalized, SegmentTerminator) {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, FieldSeparator)
+		if fields[0] == "MSH" {
+			// Restore MSH-1 so field positions match the specification
+			fields = append([]string{"MSH", FieldSeparator}, fields[1:]...)
+		}
+		segments = append(segments, fields)
+	}
+	return segments
+}
@@ -0,0 +1,63 @@
+package hl7_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/hl7"
+)
+
+var _ = Describe("Message", func() {
+	Describe("Escape", func() {
+		It("escapes delimiters", func() {
+			Expect(hl7.Escape(`a|b^c~d\e&f`)).To(Equal(`a\F\b\S\c\R\d\E\e\T\f`))
+		})
+	})
+
+	Describe("Components", func() {
+		It("trims trailing empty components", func() {
+			Expect(hl7.Components("Doe", "John", "")).To(Equal("Doe^John"))
+		})
+
+		It("keeps leading empty components", func() {
+			Expect(hl7.Components("", "AP", "PDF")).To(Equal("^AP^PDF"))
+		})
+	})
+
+	Describe("Encode", func() {
+		var message *hl7.Message
+
+		BeforeEach(func() {
+			message = hl7.NewMessage(hl7.Header{
+				SendingApplication:   "Tidepool",
+				SendingFacility:      "Tidepool",
+				ReceivingApplication: "EHR",
+				ReceivingFacility:    "Clinic",
+				MessageType:          "ORU",
+				TriggerEvent:         "R01",
+				MessageStructure:     "ORU_R01",
+				ControlId:            "12345",
+				DateTime:             time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			})
+			message.AddSegment("PID", "1", "", hl7.Components("123", "", "", "MR"))
+		})
+
+		It("encodes the message header", func() {
+			segments := hl7.ParseSegments(message.Encode())
+			Expect(segments).To(HaveLen(2))
+			Expect(string(message.Encode())).To(HavePrefix("MSH|^~\\&|Tidepool|Tidepool|EHR|Clinic|20240102030405+0000||ORU^R01^ORU_R01|12345|P|2.5.1\r"))
+		})
+
+		It("encodes segments", func() {
+			Expect(string(message.Encode())).To(HaveSuffix("PID|1||123^^^MR\r"))
+		})
+
+		It("returns the fields by position", func() {
+			segments := hl7.ParseSegments(message.Encode())
+			Expect(segments[0].Field(10)).To(Equal("12345"))
+			Expect(segments[1].Field(3)).To(Equal("123^^^MR"))
+		})
+	})
+})
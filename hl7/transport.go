@@ -0,0 +1,173 @@
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	TransportTypeMLLP = "mllp"
+	TransportTypeFile = "file"
+
+	defaultMLLPTimeout = 30 * time.Second
+
+	mllpStartBlock     byte = 0x0b
+	mllpEndBlock       byte = 0x1c
+	mllpCarriageReturn byte = 0x0d
+
+	AcknowledgmentCodeAccept        = "AA"
+	AcknowledgmentCodeCommitAccept  = "CA"
+	AcknowledgmentCodeError         = "AE"
+	AcknowledgmentCodeReject        = "AR"
+	acknowledgmentSegmentId         = "MSA"
+	acknowledgmentCodeFieldPosition = 1
+	acknowledgmentTextFieldPosition = 3
+)
+
+type Transport interface {
+	Deliver(ctx context.Context, message *Message) error
+}
+
+type TransportConfig struct {
+	// Type is the transport type - either "mllp" or "file"
+	Type string `json:"type"`
+	// Address is the host:port of the MLLP listener of the interface engine
+	Address string `json:"address,omitempty"`
+	// TimeoutSeconds is the maximum duration of a single MLLP exchange
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// Directory is the drop folder where messages are written when using the file transport
+	Directory string `json:"directory,omitempty"`
+}
+
+func NewTransport(config TransportConfig) (Transport, error) {
+	switch config.Type {
+	case TransportTypeMLLP:
+		if config.Address == "" {
+			return nil, fmt.Errorf("mllp address is required")
+		}
+		timeout := time.Duration(config.TimeoutSeconds) * time.Second
+		if timeout <= 0 {
+			timeout = defaultMLLPTimeout
+		}
+		return &MLLPTransport{Address: config.Address, Timeout: timeout}, nil
+	case TransportTypeFile:
+		if config.Directory == "" {
+			return nil, fmt.Errorf("file drop directory is required")
+		}
+		return &FileTransport{Directory: config.Directory}, nil
+	default:
+		return nil, fmt.Errorf("unsupported hl7 transport type %q", config.Type)
+	}
+}
+
+// MLLPTransport delivers messages over TCP using the Minimal Lower Layer Protocol and
+// waits for the acknowledgment of the receiver
+type MLLPTransport struct {
+	Address string
+	Timeout time.Duration
+}
+
+func (m *MLLPTransport) Deliver(ctx context.Context, message *Message) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", m.Address)
+	if err != nil {
+		return fmt.Errorf("unable to connect to mllp listener: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	if _, err := conn.Write(FrameMLLP(message.Encode())); err != nil {
+		return fmt.Errorf("unable to write message: %w", err)
+	}
+
+	ack, err := ReadMLLPFrame(bufio.NewReader(conn))
+	if err != nil {
+		return fmt.Errorf("unable to read acknowledgment: %w", err)
+	}
+
+	return CheckAcknowledgment(ack)
+}
+
+func FrameMLLP(payload []byte) []byte {
+	framed := make([]byte, 0, len(payload)+3)
+	framed = append(framed, mllpStartBlock)
+	framed = append(framed, payload...)
+	framed = append(framed, mllpEndBlock, mllpCarriageReturn)
+	return framed
+}
+
+func ReadMLLPFrame(reader *bufio.Reader) ([]byte, error) {
+	if _, err := reader.ReadBytes(mllpStartBlock); err != nil {
+		return nil, err
+	}
+	frame, err := reader.ReadBytes(mllpEndBlock)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := reader.ReadByte(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(frame, []byte{mllpEndBlock}), nil
+}
+
+// CheckAcknowledgment returns an error if the acknowledgment message doesn't accept the delivered message
+func CheckAcknowledgment(ack []byte) error {
+	for _, segment := range ParseSegments(ack) {
+		if segment.Id() != acknowledgmentSegmentId {
+			continue
+		}
+		code := segment.Field(acknowledgmentCodeFieldPosition)
+		if code == AcknowledgmentCodeAccept || code == AcknowledgmentCodeCommitAccept {
+			return nil
+		}
+		return fmt.Errorf("message was not accepted: %s %s", code, segment.Field(acknowledgmentTextFieldPosition))
+	}
+	return fmt.Errorf("acknowledgment segment is missing")
+}
+
+// FileTransport writes messages to a drop folder which is monitored by the interface engine
+type FileTransport struct {
+	Directory string
+}
+
+func (f *FileTransport) Deliver(ctx context.Context, message *Message) error {
+	if message.ControlId() == "" {
+		return fmt.Errorf("message control id is required")
+	}
+
+	// Write to a temporary file first, so the interface engine never picks up partially written messages
+	tmp, err := os.CreateTemp(f.Directory, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(message.Encode()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write message: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write message: %w", err)
+	}
+
+	fileName := filepath.Join(f.Directory, filepath.Base(message.ControlId())+".hl7")
+	if err := os.Rename(tmp.Name(), fileName); err != nil {
+		return fmt.Errorf("unable to move message to drop folder: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package hl7_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/hl7"
+)
+
+var _ = Describe("Transport", func() {
+	var message *hl7.Message
+
+	BeforeEach(func() {
+		message = hl7.NewMessage(hl7.Header{
+			MessageType:  "ORU",
+			TriggerEvent: "R01",
+			ControlId:    "abcdef",
+		})
+	})
+
+	Describe("NewTransport", func() {
+		It("returns an error for unknown transport types", func() {
+			_, err := hl7.NewTransport(hl7.TransportConfig{Type: "ftp"})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("requires an address for mllp", func() {
+			_, err := hl7.NewTransport(hl7.TransportConfig{Type: hl7.TransportTypeMLLP})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("requires a directory for file drop", func() {
+			_, err := hl7.NewTransport(hl7.TransportConfig{Type: hl7.TransportTypeFile})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("FileTransport", func() {
+		It("writes the message to the drop folder", func() {
+			dir := GinkgoT().TempDir()
+			transport, err := hl7.NewTransport(hl7.TransportConfig{Type: hl7.TransportTypeFile, Directory: dir})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(transport.Deliver(context.Background(), message)).To(Succeed())
+
+			contents, err := os.ReadFile(filepath.Join(dir, "abcdef.hl7"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(contents).To(Equal(message.Encode()))
+
+			entries, err := os.ReadDir(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+	})
+
+	Describe("MLLPTransport", func() {
+		var listener net.Listener
+		var received chan []byte
+
+		serve := func(ack string) {
+			go func() {
+				defer GinkgoRecover()
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				frame, err := hl7.ReadMLLPFrame(bufio.NewReader(conn))
+				Expect(err).ToNot(HaveOccurred())
+				received <- frame
+
+				_, err = conn.Write(hl7.FrameMLLP([]byte(ack)))
+				Expect(err).ToNot(HaveOccurred())
+			}()
+		}
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			received = make(chan []byte, 1)
+		})
+
+		AfterEach(func() {
+			Expect(listener.Close()).To(Succeed())
+		})
+
+		It("delivers the message and accepts a positive acknowledgment", func() {
+			serve("MSH|^~\\&|EHR||Tidepool||20240101000000||ACK^R01|1|P|2.5.1\rMSA|AA|abcdef\r")
+
+			transport, err := hl7.NewTransport(hl7.TransportConfig{Type: hl7.TransportTypeMLLP, Address: listener.Addr().String()})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(transport.Deliver(context.Background(), message)).To(Succeed())
+			Eventually(received).Should(Receive(Equal(message.Encode())))
+		})
+
+		It("returns an error when the message is rejected", func() {
+			serve("MSH|^~\\&|EHR||Tidepool||20240101000000||ACK^R01|1|P|2.5.1\rMSA|AE|abcdef|Unknown patient\r")
+
+			transport, err := hl7.NewTransport(hl7.TransportConfig{Type: hl7.TransportTypeMLLP, Address: listener.Addr().String()})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(transport.Deliver(context.Background(), message)).To(MatchError(ContainSubstring("Unknown patient")))
+		})
+	})
+})
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"github.com/IBM/sarama"
 	"github.com/tidepool-org/clinic-worker/cdc"
-	"github.com/tidepool-org/go-common/clients"
+	"github.com/tidepool-org/clinic-worker/outbox"
 	"github.com/tidepool-org/go-common/clients/shoreline"
 	"github.com/tidepool-org/go-common/clients/status"
 	"github.com/tidepool-org/go-common/events"
@@ -30,7 +30,7 @@ var Module = fx.Provide(fx.Annotated{
 // MergePlansCDCConsumer is kafka consumer for executed merge plans
 type MergePlansCDCConsumer struct {
 	logger    *zap.SugaredLogger
-	mailer    clients.MailerClient
+	outbox    outbox.Outbox
 	shoreline shoreline.Client
 }
 
@@ -38,7 +38,7 @@ type MergePlansConsumerCDCConsumerParams struct {
 	fx.In
 
 	Logger    *zap.SugaredLogger
-	Mailer    clients.MailerClient
+	Outbox    outbox.Outbox
 	Shoreline shoreline.Client
 }
 
@@ -66,7 +66,7 @@ func NewMergePlansConsumer(p MergePlansConsumerCDCConsumerParams) events.Consume
 func NewMergePlansConsumerCDCConsumer(p MergePlansConsumerCDCConsumerParams) (events.MessageConsumer, error) {
 	return &MergePlansCDCConsumer{
 		logger:    p.Logger,
-		mailer:    p.Mailer,
+		outbox:    p.Outbox,
 		shoreline: p.Shoreline,
 	}, nil
 }
@@ -149,7 +149,7 @@ func (s *MergePlansCDCConsumer) handlePatientPlan(event cdc.Event[PersistentPlan
 		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 		defer cancel()
 
-		return s.mailer.SendEmailTemplate(ctx, template)
+		return s.outbox.Enqueue(ctx, notificationKey(event, template), template)
 	}
 
 	return nil
@@ -184,12 +184,22 @@ func (s *MergePlansCDCConsumer) handleClinicianPlan(event cdc.Event[PersistentPl
 		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 		defer cancel()
 
-		return s.mailer.SendEmailTemplate(ctx, template)
+		return s.outbox.Enqueue(ctx, notificationKey(event, template), template)
 	}
 
 	return nil
 }
 
+// notificationKey returns the deduplication key of the email. Each plan of a merge is persisted once, so the id of the
+// persisted plan identifies the email.
+func notificationKey(event cdc.Event[PersistentPlan[bson.Raw]], email events.SendEmailTemplateEvent) string {
+	id := ""
+	if event.FullDocument.Id != nil {
+		id = event.FullDocument.Id.Hex()
+	}
+	return outbox.NewKey(email.Template, event.FullDocument.PlanId.Hex(), id, email.Recipient)
+}
+
 func (s *MergePlansCDCConsumer) getUserEmail(userId string) (string, error) {
 	s.logger.Debugw("Fetching user by id", "userId", userId)
 	user, err := s.shoreline.GetUser(userId, s.shoreline.TokenProvide())
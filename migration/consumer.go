@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/IBM/sarama"
+	"github.com/tidepool-org/clinic-worker/audit"
 	"github.com/tidepool-org/clinic-worker/cdc"
 	"github.com/tidepool-org/go-common/events"
 	"go.uber.org/fx"
@@ -87,7 +88,8 @@ func (p *MigrationCDCConsumer) handleMessage(cm *sarama.ConsumerMessage) error {
 		return err
 	}
 
-	if err := p.handleCDCEvent(event); err != nil {
+	ctx := audit.WithTrigger(context.Background(), audit.NewTrigger(cm))
+	if err := p.handleCDCEvent(ctx, event); err != nil {
 		p.logger.Errorw("unable to process cdc event", "offset", cm.Offset, zap.Error(err))
 		return err
 	}
@@ -102,7 +104,7 @@ func (p *MigrationCDCConsumer) unmarshalEvent(value []byte, event *MigrationCDCE
 	return json.Unmarshal([]byte(message), event)
 }
 
-func (p *MigrationCDCConsumer) handleCDCEvent(event MigrationCDCEvent) error {
+func (p *MigrationCDCConsumer) handleCDCEvent(ctx context.Context, event MigrationCDCEvent) error {
 	if event.OperationType != cdc.OperationTypeInsert {
 		p.logger.Debugw("skipping handling of event", "offset", event.Offset)
 		return nil
@@ -111,5 +113,5 @@ func (p *MigrationCDCConsumer) handleCDCEvent(event MigrationCDCEvent) error {
 	p.logger.Infow("processing event", "event", event, "offset", event.Offset)
 	userId := event.FullDocument.UserId
 	clinicId := event.FullDocument.ClinicId.Value
-	return p.migrator.MigratePatients(context.Background(), userId, clinicId)
+	return p.migrator.MigratePatients(ctx, userId, clinicId)
 }
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/tidepool-org/clinic-worker/audit"
+	"github.com/tidepool-org/clinic-worker/outbox"
 	clinics "github.com/tidepool-org/clinic/client"
 	"github.com/tidepool-org/go-common/clients"
 	"github.com/tidepool-org/go-common/clients/shoreline"
@@ -32,11 +34,12 @@ type Migrator interface {
 }
 
 type migrator struct {
+	auditor     audit.Auditor
 	clinics     clinics.ClientWithResponsesInterface
 	gatekeeper  clients.Gatekeeper
 	logger      *zap.SugaredLogger
 	rateLimiter *RateLimiter
-	mailer      clients.MailerClient
+	outbox      outbox.Outbox
 	seagull     clients.Seagull
 	shoreline   shoreline.Client
 }
@@ -46,21 +49,23 @@ var _ Migrator = &migrator{}
 type MigratorParams struct {
 	fx.In
 
+	Auditor     audit.Auditor
 	Clinics     clinics.ClientWithResponsesInterface
 	Gatekeeper  clients.Gatekeeper
 	Logger      *zap.SugaredLogger
 	RateLimiter *RateLimiter
-	Mailer      clients.MailerClient
+	Outbox      outbox.Outbox
 	Seagull     clients.Seagull
 	Shoreline   shoreline.Client
 }
 
 func NewMigrator(p MigratorParams) (Migrator, error) {
 	return &migrator{
+		auditor:     p.Auditor,
 		clinics:     p.Clinics,
 		gatekeeper:  p.Gatekeeper,
 		logger:      p.Logger,
-		mailer:      p.Mailer,
+		outbox:      p.Outbox,
 		rateLimiter: p.RateLimiter,
 		seagull:     p.Seagull,
 		shoreline:   p.Shoreline,
@@ -81,13 +86,15 @@ func (m *migrator) MigratePatients(ctx context.Context, userId, clinicId string)
 
 	// Make sure the clinician cannot use legacy version of uploader
 	m.logger.Infof("Removing legacy clinician role of user %v", userId)
-	if err := m.removeLegacyClinicianRole(userId); err != nil {
+	if err := m.removeLegacyClinicianRole(ctx, userId, clinicId); err != nil {
 		return err
 	}
 
 	// Make sure the clinician cannot create legacy custodial accounts in uploader
 	m.logger.Infof("Deleting active user sessions of user %v", userId)
-	if err := m.shoreline.DeleteUserSessions(userId, m.shoreline.TokenProvide()); err != nil {
+	err = m.shoreline.DeleteUserSessions(userId, m.shoreline.TokenProvide())
+	m.auditor.Record(ctx, audit.NewEvent(audit.ActionUserSessionsDeleted, audit.Target{UserId: userId, ClinicId: clinicId}, err))
+	if err != nil {
 		return err
 	}
 
@@ -191,12 +198,16 @@ func (m *migrator) updateMigrationsStatus(ctx context.Context, migration *Migrat
 	return nil
 }
 
-func (m *migrator) removeLegacyClinicianRole(userId string) error {
+func (m *migrator) removeLegacyClinicianRole(ctx context.Context, userId, clinicId string) error {
 	roles := []string{postMigrationRole}
 	update := shoreline.UserUpdate{
 		Roles: &roles,
 	}
-	return m.shoreline.UpdateUser(userId, update, m.shoreline.TokenProvide())
+	err := m.shoreline.UpdateUser(userId, update, m.shoreline.TokenProvide())
+	event := audit.NewEvent(audit.ActionUserRolesChanged, audit.Target{UserId: userId, ClinicId: clinicId}, err)
+	event.Details = map[string]string{"roles": postMigrationRole}
+	m.auditor.Record(ctx, event)
+	return err
 }
 
 func (m *migrator) migratePatient(ctx context.Context, migration *Migration, patientId string, permissions clients.Permissions) error {
@@ -214,7 +225,7 @@ func (m *migrator) migratePatient(ctx context.Context, migration *Migration, pat
 	if err = m.sendMigrationEmail(ctx, migration, patient); err != nil {
 		return err
 	}
-	if err = m.removeSharingConnection(migration.legacyClinicianUserId, patientId); err != nil {
+	if err = m.removeSharingConnection(ctx, migration, patientId); err != nil {
 		return err
 	}
 	return nil
@@ -268,9 +279,12 @@ func (m *migrator) createPatient(ctx context.Context, migration *Migration, pati
 	return patient, err
 }
 
-func (m *migrator) removeSharingConnection(userId, patientId string) error {
+func (m *migrator) removeSharingConnection(ctx context.Context, migration *Migration, patientId string) error {
+	userId := migration.legacyClinicianUserId
 	m.logger.Infof("Removing sharing connection between legacy clinician %v and patient %v", userId, patientId)
 	_, err := m.gatekeeper.SetPermissions(userId, patientId, nil)
+	target := audit.Target{UserId: userId, ClinicId: string(*migration.clinic.Id), PatientId: patientId}
+	m.auditor.Record(ctx, audit.NewEvent(audit.ActionSharingConnectionDeleted, target, err))
 	return err
 }
 
@@ -290,7 +304,8 @@ func (m *migrator) sendMigrationEmail(ctx context.Context, migrationContext *Mig
 		},
 	}
 
-	return m.mailer.SendEmailTemplate(ctx, email)
+	key := outbox.NewKey(email.Template, string(*migrationContext.clinic.Id), migrationContext.legacyClinicianUserId, string(*patient.Id))
+	return m.outbox.Enqueue(ctx, key, email)
 }
 
 func (m *migrator) sendMigrationCompletedEmail(ctx context.Context, migrationContext *Migration) error {
@@ -309,7 +324,8 @@ func (m *migrator) sendMigrationCompletedEmail(ctx context.Context, migrationCon
 		},
 	}
 
-	return m.mailer.SendEmailTemplate(ctx, email)
+	key := outbox.NewKey(email.Template, string(*migrationContext.clinic.Id), migrationContext.legacyClinicianUserId)
+	return m.outbox.Enqueue(ctx, key, email)
 }
 
 func mapPermissions(permissions clients.Permissions) *clinics.PatientPermissionsV1 {
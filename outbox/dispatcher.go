@@ -0,0 +1,125 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/cdc"
+	"github.com/tidepool-org/clinic-worker/store"
+	"github.com/tidepool-org/go-common/clients"
+	"github.com/tidepool-org/go-common/events"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	dispatcherLeaseName = "outbox-dispatcher"
+	maxBackoff          = time.Hour
+)
+
+// Dispatcher periodically delivers the pending emails of the outbox to the mailer. Only the instance which holds the
+// dispatcher lease delivers emails, so each email is sent once. An email is sent again only if the delivery succeeds,
+// but it can't be marked as sent afterward.
+type Dispatcher struct {
+	config Config
+	store  Store
+	mailer clients.MailerClient
+	runner *store.LeaseRunner
+	logger *zap.SugaredLogger
+}
+
+var _ events.EventConsumer = &Dispatcher{}
+
+type DispatcherParams struct {
+	fx.In
+
+	Logger *zap.SugaredLogger
+
+	Config Config
+	Store  Store
+	Leases store.Leases
+	Mailer clients.MailerClient
+}
+
+// CreateDispatcher returns the dispatcher as a consumer, so it's started and stopped together with the consumers
+func CreateDispatcher(p DispatcherParams) (events.EventConsumer, error) {
+	if !p.Config.Enabled {
+		return &cdc.DisabledEventConsumer{}, nil
+	}
+	return NewDispatcher(p.Config, p.Store, p.Leases, p.Mailer, p.Logger), nil
+}
+
+func NewDispatcher(config Config, outbox Store, leases store.Leases, mailer clients.MailerClient, logger *zap.SugaredLogger) *Dispatcher {
+	return &Dispatcher{
+		config: config,
+		store:  outbox,
+		mailer: mailer,
+		runner: store.NewLeaseRunner(dispatcherLeaseName, config.Interval, leases, logger),
+		logger: logger,
+	}
+}
+
+// Start runs the dispatcher until it's stopped
+func (d *Dispatcher) Start() error {
+	return d.runner.Run(func(ctx context.Context, lease *store.Lease) error {
+		return d.dispatchDue(ctx, lease, time.Now())
+	})
+}
+
+func (d *Dispatcher) Stop() error {
+	return d.runner.Stop()
+}
+
+// RunOnce delivers the emails which are due if this instance holds the dispatcher lease
+func (d *Dispatcher) RunOnce(ctx context.Context, now time.Time) error {
+	return d.runner.RunOnce(ctx, func(ctx context.Context, lease *store.Lease) error {
+		return d.dispatchDue(ctx, lease, now)
+	})
+}
+
+func (d *Dispatcher) dispatchDue(ctx context.Context, lease *store.Lease, now time.Time) error {
+	notifications, err := d.store.ListDue(ctx, now, d.config.BatchSize)
+	if err != nil {
+		return err
+	}
+	for _, notification := range notifications {
+		// The lease is renewed before each email, so an email isn't sent by two instances if the batch outlives the lease
+		if err := lease.Renew(ctx); err != nil {
+			return err
+		}
+		// A failure to deliver one email shouldn't prevent the others from being delivered
+		if err := d.dispatch(ctx, notification, now); err != nil {
+			d.logger.Errorw("unable to dispatch email", "key", notification.Key, "template", notification.Email.Template, zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, notification Notification, now time.Time) error {
+	if err := d.mailer.SendEmailTemplate(ctx, notification.Email); err != nil {
+		var nextAttemptTime *time.Time
+		if attempts := notification.Attempts + 1; attempts < d.config.MaxAttempts {
+			next := now.Add(d.backoff(attempts))
+			nextAttemptTime = &next
+		} else {
+			d.logger.Errorw("giving up sending email after the maximum number of attempts", "key", notification.Key, "template", notification.Email.Template, "attempts", attempts)
+		}
+		if recordErr := d.store.RecordFailure(ctx, notification.Key, err.Error(), nextAttemptTime); recordErr != nil {
+			return recordErr
+		}
+		return fmt.Errorf("unable to send email: %w", err)
+	}
+
+	d.logger.Infow("sent email", "key", notification.Key, "template", notification.Email.Template)
+	return d.store.MarkSent(ctx, notification.Key)
+}
+
+// backoff doubles the delay between attempts starting from the dispatch interval
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.Interval
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
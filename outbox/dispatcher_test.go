@@ -0,0 +1,117 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tidepool-org/go-common/events"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/outbox"
+	testOutbox "github.com/tidepool-org/clinic-worker/outbox/test"
+	storePkg "github.com/tidepool-org/clinic-worker/store"
+	testStore "github.com/tidepool-org/clinic-worker/store/test"
+)
+
+var _ = Describe("Dispatcher", func() {
+	var store *testOutbox.Store
+	var mailer *testOutbox.Mailer
+	var leases *testStore.Leases
+	var dispatcher *outbox.Dispatcher
+	var email events.SendEmailTemplateEvent
+
+	BeforeEach(func() {
+		store = testOutbox.NewStore()
+		mailer = &testOutbox.Mailer{}
+		leases = testStore.NewLeases()
+		config := outbox.Config{
+			Enabled:     true,
+			Interval:    time.Minute,
+			BatchSize:   10,
+			MaxAttempts: 3,
+		}
+		dispatcher = outbox.NewDispatcher(config, store, leases, mailer, zap.NewNop().Sugar())
+		email = events.SendEmailTemplateEvent{Recipient: "jane@example.com", Template: "migrate_patient"}
+	})
+
+	It("sends each recorded email once", func() {
+		Expect(store.Enqueue(context.Background(), "key", email)).To(Succeed())
+		Expect(store.Enqueue(context.Background(), "key", email)).To(Succeed())
+
+		Expect(dispatcher.RunOnce(context.Background(), time.Now())).To(Succeed())
+		Expect(dispatcher.RunOnce(context.Background(), time.Now())).To(Succeed())
+
+		Expect(mailer.Sent).To(Equal([]events.SendEmailTemplateEvent{email}))
+		Expect(store.Notifications["key"].Status).To(Equal(outbox.StatusSent))
+		Expect(store.Notifications["key"].SentTime).ToNot(BeNil())
+	})
+
+	It("doesn't send emails when the lease is held by another instance", func() {
+		Expect(leases.TryAcquire(context.Background(), "outbox-dispatcher", "other", time.Minute)).To(BeTrue())
+		Expect(store.Enqueue(context.Background(), "key", email)).To(Succeed())
+
+		Expect(dispatcher.RunOnce(context.Background(), time.Now())).To(Succeed())
+		Expect(mailer.Sent).To(BeEmpty())
+		Expect(store.Notifications["key"].Status).To(Equal(outbox.StatusPending))
+	})
+
+	It("retries failed emails with a backoff", func() {
+		Expect(store.Enqueue(context.Background(), "key", email)).To(Succeed())
+		mailer.Err = errors.New("broker is unavailable")
+
+		now := time.Now()
+		Expect(dispatcher.RunOnce(context.Background(), now)).To(Succeed())
+		Expect(store.Notifications["key"].Status).To(Equal(outbox.StatusPending))
+		Expect(store.Notifications["key"].Attempts).To(Equal(1))
+		Expect(store.Notifications["key"].LastError).To(Equal("broker is unavailable"))
+		Expect(store.Notifications["key"].NextAttemptTime).To(Equal(now.Add(time.Minute)))
+
+		mailer.Err = nil
+		Expect(dispatcher.RunOnce(context.Background(), now.Add(30*time.Second))).To(Succeed())
+		Expect(mailer.Sent).To(BeEmpty())
+
+		Expect(dispatcher.RunOnce(context.Background(), now.Add(time.Minute))).To(Succeed())
+		Expect(mailer.Sent).To(HaveLen(1))
+		Expect(store.Notifications["key"].Status).To(Equal(outbox.StatusSent))
+	})
+
+	It("marks the email as failed after the maximum number of attempts", func() {
+		Expect(store.Enqueue(context.Background(), "key", email)).To(Succeed())
+		mailer.Err = errors.New("broker is unavailable")
+
+		now := time.Now()
+		for i := 0; i < 3; i++ {
+			now = now.Add(time.Hour)
+			Expect(dispatcher.RunOnce(context.Background(), now)).To(Succeed())
+		}
+		Expect(store.Notifications["key"].Status).To(Equal(outbox.StatusFailed))
+		Expect(store.Notifications["key"].Attempts).To(Equal(3))
+	})
+	It("stops sending emails when the lease is taken over by another instance", func() {
+		Expect(store.Enqueue(context.Background(), "first", email)).To(Succeed())
+		Expect(store.Enqueue(context.Background(), "second", email)).To(Succeed())
+		mailer.Err = errors.New("broker is unavailable")
+		store.Notifications["second"].CreatedTime = store.Notifications["first"].CreatedTime.Add(time.Second)
+
+		taken := &leaseTakingMailer{Mailer: mailer, leases: leases}
+		dispatcher = outbox.NewDispatcher(outbox.Config{Enabled: true, Interval: time.Minute, BatchSize: 10, MaxAttempts: 3}, store, leases, taken, zap.NewNop().Sugar())
+
+		Expect(dispatcher.RunOnce(context.Background(), time.Now().Add(time.Second))).To(MatchError(storePkg.ErrLeaseLost))
+		Expect(store.Notifications["first"].Attempts).To(Equal(1))
+		Expect(store.Notifications["second"].Attempts).To(BeZero())
+	})
+})
+
+// leaseTakingMailer hands the dispatcher lease to another instance when an email is sent
+type leaseTakingMailer struct {
+	*testOutbox.Mailer
+	leases *testStore.Leases
+}
+
+func (m *leaseTakingMailer) SendEmailTemplate(ctx context.Context, email events.SendEmailTemplateEvent) error {
+	m.leases.Owners["outbox-dispatcher"] = "other"
+	return m.Mailer.SendEmailTemplate(ctx, email)
+}
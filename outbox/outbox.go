@@ -0,0 +1,86 @@
+package outbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/go-common/clients"
+	"github.com/tidepool-org/go-common/events"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(
+	NewConfig,
+	NewStore,
+	NewOutbox,
+	fx.Annotated{
+		Group:  "consumers",
+		Target: CreateDispatcher,
+	},
+)
+
+const (
+	keyLength = 32
+)
+
+type Config struct {
+	// Enabled records the emails in the outbox. Emails are sent directly by the handlers if the outbox is disabled.
+	Enabled     bool          `envconfig:"TIDEPOOL_OUTBOX_ENABLED" default:"false"`
+	Interval    time.Duration `envconfig:"TIDEPOOL_OUTBOX_DISPATCH_INTERVAL" default:"10s"`
+	BatchSize   int           `envconfig:"TIDEPOOL_OUTBOX_BATCH_SIZE" default:"100"`
+	MaxAttempts int           `envconfig:"TIDEPOOL_OUTBOX_MAX_ATTEMPTS" default:"10"`
+	// Retention is the duration for which sent emails are kept to deduplicate retried events
+	Retention time.Duration `envconfig:"TIDEPOOL_OUTBOX_RETENTION" default:"720h"`
+}
+
+func NewConfig() (Config, error) {
+	config := Config{}
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+// Outbox records the emails which should be sent as a result of processing an event. Handlers record emails instead
+// of sending them, so retrying an event doesn't send the same email again.
+type Outbox interface {
+	// Enqueue records the email with the deduplication key. The email is ignored if the key was already recorded.
+	Enqueue(ctx context.Context, key string, email events.SendEmailTemplateEvent) error
+	// Contains returns true if an email with the deduplication key was already recorded
+	Contains(ctx context.Context, key string) (bool, error)
+}
+
+func NewOutbox(config Config, store Store, mailer clients.MailerClient) Outbox {
+	if !config.Enabled {
+		return &DirectOutbox{mailer: mailer}
+	}
+	return store
+}
+
+// NewKey returns a deterministic deduplication key. The parts should identify the CDC document and its version,
+// e.g. the id of the document and the time of the change which triggered the email. The parts are hashed, so they
+// can include PHI like email addresses.
+func NewKey(template string, parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return template + ":" + hex.EncodeToString(h.Sum(nil))[:keyLength]
+}
+
+// DirectOutbox sends the emails immediately without deduplication
+type DirectOutbox struct {
+	mailer clients.MailerClient
+}
+
+var _ Outbox = &DirectOutbox{}
+
+func (d *DirectOutbox) Enqueue(ctx context.Context, _ string, email events.SendEmailTemplateEvent) error {
+	return d.mailer.SendEmailTemplate(ctx, email)
+}
+
+func (d *DirectOutbox) Contains(context.Context, string) (bool, error) {
+	return false, nil
+}
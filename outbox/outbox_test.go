@@ -0,0 +1,61 @@
+package outbox_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tidepool-org/go-common/events"
+
+	"github.com/tidepool-org/clinic-worker/outbox"
+	testOutbox "github.com/tidepool-org/clinic-worker/outbox/test"
+)
+
+var _ = Describe("Outbox", func() {
+	Describe("NewKey", func() {
+		It("returns the same key for the same parts", func() {
+			Expect(outbox.NewKey("clinic_created", "1234")).To(Equal(outbox.NewKey("clinic_created", "1234")))
+		})
+
+		It("returns different keys for different versions of the document", func() {
+			Expect(outbox.NewKey("patient_upload_reminder", "1234", "1")).ToNot(Equal(outbox.NewKey("patient_upload_reminder", "1234", "2")))
+		})
+
+		It("doesn't return the same key for parts which concatenate to the same value", func() {
+			Expect(outbox.NewKey("migrate_patient", "ab", "c")).ToNot(Equal(outbox.NewKey("migrate_patient", "a", "bc")))
+		})
+
+		It("prefixes the key with the template and doesn't include the parts", func() {
+			key := outbox.NewKey("request_dexcom_connect", "jane@example.com")
+			Expect(key).To(HavePrefix("request_dexcom_connect:"))
+			Expect(key).ToNot(ContainSubstring("jane"))
+		})
+	})
+
+	Describe("NewOutbox", func() {
+		var store *testOutbox.Store
+		var mailer *testOutbox.Mailer
+		var email events.SendEmailTemplateEvent
+
+		BeforeEach(func() {
+			store = testOutbox.NewStore()
+			mailer = &testOutbox.Mailer{}
+			email = events.SendEmailTemplateEvent{Recipient: "jane@example.com", Template: "clinic_created"}
+		})
+
+		It("records the emails in the store when enabled", func() {
+			o := outbox.NewOutbox(outbox.Config{Enabled: true}, store, mailer)
+			Expect(o.Enqueue(context.Background(), "key", email)).To(Succeed())
+			Expect(mailer.Sent).To(BeEmpty())
+			Expect(o.Contains(context.Background(), "key")).To(BeTrue())
+		})
+
+		It("sends the emails directly when disabled", func() {
+			o := outbox.NewOutbox(outbox.Config{Enabled: false}, store, mailer)
+			Expect(o.Enqueue(context.Background(), "key", email)).To(Succeed())
+			Expect(mailer.Sent).To(Equal([]events.SendEmailTemplateEvent{email}))
+			Expect(store.Notifications).To(BeEmpty())
+			Expect(o.Contains(context.Background(), "key")).To(BeFalse())
+		})
+	})
+})
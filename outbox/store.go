@@ -0,0 +1,169 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tidepool-org/go-common/events"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+)
+
+const (
+	outboxCollectionName = "email_outbox"
+)
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusSent    Status = "sent"
+	// StatusFailed is set when the email couldn't be sent after the maximum number of attempts
+	StatusFailed Status = "failed"
+)
+
+type Notification struct {
+	Key             string                        `bson:"_id"`
+	Email           events.SendEmailTemplateEvent `bson:"email"`
+	Status          Status                        `bson:"status"`
+	Attempts        int                           `bson:"attempts"`
+	LastError       string                        `bson:"lastError,omitempty"`
+	NextAttemptTime time.Time                     `bson:"nextAttemptTime"`
+	SentTime        *time.Time                    `bson:"sentTime,omitempty"`
+	CreatedTime     time.Time                     `bson:"createdTime"`
+	ModifiedTime    time.Time                     `bson:"modifiedTime"`
+}
+
+// Store persists the emails of the outbox until they are delivered by the dispatcher
+type Store interface {
+	Outbox
+	// ListDue returns the pending emails which are due for delivery in the order they were recorded
+	ListDue(ctx context.Context, now time.Time, limit int) ([]Notification, error)
+	MarkSent(ctx context.Context, key string) error
+	// RecordFailure increments the attempts of the email. The email is marked as failed if the next attempt is nil.
+	RecordFailure(ctx context.Context, key string, reason string, nextAttemptTime *time.Time) error
+}
+
+type MongoStore struct {
+	collection *mongo.Collection
+	retention  time.Duration
+}
+
+var _ Store = &MongoStore{}
+
+func NewStore(db *mongo.Database, config Config, lifecycle fx.Lifecycle) Store {
+	store := &MongoStore{
+		collection: db.Collection(outboxCollectionName),
+		retention:  config.Retention,
+	}
+	if config.Enabled {
+		lifecycle.Append(fx.Hook{
+			OnStart: store.CreateIndexes,
+		})
+	}
+	return store
+}
+
+func (m *MongoStore) CreateIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptTime", Value: 1}},
+		},
+		{
+			// Sent emails are removed after the retention period. Documents without sent time are never removed.
+			Keys:    bson.D{{Key: "sentTime", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(m.retention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create outbox indexes: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) Enqueue(ctx context.Context, key string, email events.SendEmailTemplateEvent) error {
+	now := time.Now()
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"email":           email,
+			"status":          StatusPending,
+			"attempts":        0,
+			"nextAttemptTime": now,
+			"createdTime":     now,
+			"modifiedTime":    now,
+		},
+	}
+
+	// The key is the id of the document, so recording the same email again is a no-op
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": key}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("unable to enqueue email: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) Contains(ctx context.Context, key string) (bool, error) {
+	count, err := m.collection.CountDocuments(ctx, bson.M{"_id": key}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("unable to find email in outbox: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (m *MongoStore) ListDue(ctx context.Context, now time.Time, limit int) ([]Notification, error) {
+	filter := bson.M{
+		"status":          StatusPending,
+		"nextAttemptTime": bson.M{"$lte": now},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdTime", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := m.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list due emails: %w", err)
+	}
+	var notifications []Notification
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, fmt.Errorf("unable to decode due emails: %w", err)
+	}
+	return notifications, nil
+}
+
+func (m *MongoStore) MarkSent(ctx context.Context, key string) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"status":       StatusSent,
+			"sentTime":     now,
+			"modifiedTime": now,
+		},
+		"$unset": bson.M{"lastError": ""},
+		"$inc":   bson.M{"attempts": 1},
+	}
+	if _, err := m.collection.UpdateOne(ctx, bson.M{"_id": key}, update); err != nil {
+		return fmt.Errorf("unable to mark email as sent: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) RecordFailure(ctx context.Context, key string, reason string, nextAttemptTime *time.Time) error {
+	set := bson.M{
+		"lastError":    reason,
+		"modifiedTime": time.Now(),
+	}
+	if nextAttemptTime != nil {
+		set["nextAttemptTime"] = *nextAttemptTime
+	} else {
+		set["status"] = StatusFailed
+	}
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{"attempts": 1},
+	}
+	if _, err := m.collection.UpdateOne(ctx, bson.M{"_id": key}, update); err != nil {
+		return fmt.Errorf("unable to record email failure: %w", err)
+	}
+	return nil
+}
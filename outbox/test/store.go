@@ -0,0 +1,117 @@
+package test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tidepool-org/go-common/clients"
+	"github.com/tidepool-org/go-common/events"
+
+	"github.com/tidepool-org/clinic-worker/outbox"
+)
+
+// Store keeps the emails of the outbox in memory
+type Store struct {
+	Notifications map[string]*outbox.Notification
+	mu            sync.Mutex
+}
+
+var _ outbox.Store = &Store{}
+
+func NewStore() *Store {
+	return &Store{
+		Notifications: make(map[string]*outbox.Notification),
+	}
+}
+
+func (s *Store) Enqueue(ctx context.Context, key string, email events.SendEmailTemplateEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Notifications[key]; ok {
+		return nil
+	}
+	now := time.Now()
+	s.Notifications[key] = &outbox.Notification{
+		Key:             key,
+		Email:           email,
+		Status:          outbox.StatusPending,
+		NextAttemptTime: now,
+		CreatedTime:     now,
+		ModifiedTime:    now,
+	}
+	return nil
+}
+
+func (s *Store) Contains(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.Notifications[key]
+	return ok, nil
+}
+
+func (s *Store) ListDue(ctx context.Context, now time.Time, limit int) ([]outbox.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []outbox.Notification
+	for _, notification := range s.Notifications {
+		if notification.Status == outbox.StatusPending && !notification.NextAttemptTime.After(now) {
+			due = append(due, *notification)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedTime.Before(due[j].CreatedTime)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (s *Store) MarkSent(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	notification := s.Notifications[key]
+	notification.Status = outbox.StatusSent
+	notification.Attempts++
+	notification.LastError = ""
+	notification.SentTime = &now
+	return nil
+}
+
+func (s *Store) RecordFailure(ctx context.Context, key string, reason string, nextAttemptTime *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notification := s.Notifications[key]
+	notification.Attempts++
+	notification.LastError = reason
+	if nextAttemptTime != nil {
+		notification.NextAttemptTime = *nextAttemptTime
+	} else {
+		notification.Status = outbox.StatusFailed
+	}
+	return nil
+}
+
+// Mailer records the sent emails
+type Mailer struct {
+	Sent []events.SendEmailTemplateEvent
+	Err  error
+}
+
+var _ clients.MailerClient = &Mailer{}
+
+func (m *Mailer) SendEmailTemplate(ctx context.Context, email events.SendEmailTemplateEvent) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.Sent = append(m.Sent, email)
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
+	"github.com/tidepool-org/clinic-worker/audit"
 	"github.com/tidepool-org/clinic-worker/cdc"
 	"github.com/tidepool-org/go-common/clients/shoreline"
 	"github.com/tidepool-org/go-common/events"
@@ -33,7 +34,8 @@ var Module = fx.Provide(fx.Annotated{
 })
 
 type PatientDeletionsCDCConsumer struct {
-	logger *zap.SugaredLogger
+	logger  *zap.SugaredLogger
+	auditor audit.Auditor
 
 	data                 dataclient.Client
 	shoreline            shoreline.Client
@@ -54,6 +56,7 @@ type Params struct {
 	fx.In
 
 	Logger    *zap.SugaredLogger
+	Auditor   audit.Auditor
 	Data      dataclient.Client
 	Shoreline shoreline.Client
 }
@@ -82,6 +85,7 @@ func CreateConsumer(p Params) events.ConsumerFactory {
 func NewPatientDeletionsCDCConsumer(p Params) (events.MessageConsumer, error) {
 	return &PatientDeletionsCDCConsumer{
 		logger:               p.Logger,
+		auditor:              p.Auditor,
 		data:                 p.Data,
 		shoreline:            p.Shoreline,
 		sessionTokenProvider: &serverSessionTokenProvider{p.Shoreline},
@@ -110,14 +114,15 @@ func (p *PatientDeletionsCDCConsumer) handleMessage(cm *sarama.ConsumerMessage)
 		return err
 	}
 
-	if err := p.handleCDCEvent(event); err != nil {
+	ctx := audit.WithTrigger(context.Background(), audit.NewTrigger(cm))
+	if err := p.handleCDCEvent(ctx, event); err != nil {
 		p.logger.Errorw("unable to process cdc event", "offset", cm.Offset, zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func (p *PatientDeletionsCDCConsumer) handleCDCEvent(event PatientDeletionsCDCEvent) error {
+func (p *PatientDeletionsCDCConsumer) handleCDCEvent(ctx context.Context, event PatientDeletionsCDCEvent) error {
 	// Every patient deletion is recorded as an insertion into the patient_deletions collection.
 	if event.OperationType != cdc.OperationTypeInsert ||
 		!event.FullDocument.IsCustodial() ||
@@ -126,10 +131,14 @@ func (p *PatientDeletionsCDCConsumer) handleCDCEvent(event PatientDeletionsCDCEv
 		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(auth.NewContextWithServerSessionTokenProvider(platformlog.NewContextWithLogger(context.Background(), null.NewLogger()), p.sessionTokenProvider), defaultTimeout)
+	ctx, cancel := context.WithTimeout(auth.NewContextWithServerSessionTokenProvider(platformlog.NewContextWithLogger(ctx, null.NewLogger()), p.sessionTokenProvider), defaultTimeout)
 	defer cancel()
 
 	userID := event.FullDocument.Patient.UserId
+	target := audit.Target{UserId: userID}
+	if event.FullDocument.Patient.ClinicId != nil {
+		target.ClinicId = event.FullDocument.Patient.ClinicId.Value
+	}
 	pagination := &page.Pagination{
 		Size: 1,
 	}
@@ -142,7 +151,9 @@ func (p *PatientDeletionsCDCConsumer) handleCDCEvent(event PatientDeletionsCDCEv
 	// Only custodial users with NO data can have their keycloak user account actually deleted.
 	if !hasData {
 		p.logger.Infow("processing custodial patient deletion without data", "event", event)
-		if err := p.shoreline.DeleteUser(userID, p.shoreline.TokenProvide()); err != nil {
+		err := p.shoreline.DeleteUser(userID, p.shoreline.TokenProvide())
+		p.auditor.Record(ctx, audit.NewEvent(audit.ActionUserDeleted, target, err))
+		if err != nil {
 			return fmt.Errorf(`unable to delete custodial user without data: %w`, err)
 		}
 	} else {
@@ -154,7 +165,9 @@ func (p *PatientDeletionsCDCConsumer) handleCDCEvent(event PatientDeletionsCDCEv
 		update := shoreline.UserUpdate{
 			Emails: &emptyEmails,
 		}
-		if err := p.shoreline.UpdateUser(userID, update, p.shoreline.TokenProvide()); err != nil {
+		err := p.shoreline.UpdateUser(userID, update, p.shoreline.TokenProvide())
+		p.auditor.Record(ctx, audit.NewEvent(audit.ActionUserEmailsRemoved, target, err))
+		if err != nil {
 			return fmt.Errorf(`unable to update custodial user with data to empty email: %w`, err)
 		}
 	}
@@ -13,7 +13,9 @@ import (
 	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/tidepool-org/clinic-worker/audit"
 	"github.com/tidepool-org/clinic-worker/cdc"
+	"github.com/tidepool-org/clinic-worker/outbox"
 
 	clinics "github.com/tidepool-org/clinic/client"
 	"github.com/tidepool-org/go-common/clients"
@@ -42,10 +44,11 @@ var Module = fx.Provide(
 	})
 
 type PatientCDCConsumer struct {
-	logger *zap.SugaredLogger
+	logger  *zap.SugaredLogger
+	auditor audit.Auditor
 
 	confirmations confirmations.ClientWithResponsesInterface
-	mailer        clients.MailerClient
+	outbox        outbox.Outbox
 	auth          clients.AuthClient
 	shoreline     shoreline.Client
 	seagull       clients.Seagull
@@ -58,10 +61,11 @@ type PatientCDCConsumer struct {
 type Params struct {
 	fx.In
 
-	Logger *zap.SugaredLogger
+	Logger  *zap.SugaredLogger
+	Auditor audit.Auditor
 
 	Confirmations confirmations.ClientWithResponsesInterface
-	Mailer        clients.MailerClient
+	Outbox        outbox.Outbox
 	Auth          clients.AuthClient
 	Shoreline     shoreline.Client
 	Seagull       clients.Seagull
@@ -95,8 +99,9 @@ func CreateConsumer(p Params) events.ConsumerFactory {
 func NewPatientCDCConsumer(p Params) (events.MessageConsumer, error) {
 	return &PatientCDCConsumer{
 		logger:        p.Logger,
+		auditor:       p.Auditor,
 		confirmations: p.Confirmations,
-		mailer:        p.Mailer,
+		outbox:        p.Outbox,
 		auth:          p.Auth,
 		seagull:       p.Seagull,
 		shoreline:     p.Shoreline,
@@ -129,7 +134,8 @@ func (p *PatientCDCConsumer) handleMessage(cm *sarama.ConsumerMessage) error {
 		return err
 	}
 
-	if err := p.handleCDCEvent(event); err != nil {
+	ctx := audit.WithTrigger(context.Background(), audit.NewTrigger(cm))
+	if err := p.handleCDCEvent(ctx, event); err != nil {
 		p.logger.Errorw("unable to process cdc event", "offset", cm.Offset, zap.Error(err))
 		return err
 	}
@@ -144,8 +150,8 @@ func UnmarshalEvent(value []byte, event *PatientCDCEvent) error {
 	return json.Unmarshal([]byte(message), event)
 }
 
-func (p *PatientCDCConsumer) handleCDCEvent(event PatientCDCEvent) error {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+func (p *PatientCDCConsumer) handleCDCEvent(ctx context.Context, event PatientCDCEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
 	if event.IsProfileUpdateEvent() {
@@ -177,7 +183,7 @@ func (p *PatientCDCConsumer) handleCDCEvent(event PatientCDCEvent) error {
 
 	if event.IsUploadReminderEvent() {
 		p.logger.Infow("processing upload reminder", "event", event)
-		return p.sendUploadReminder(*event.FullDocument.UserId)
+		return p.sendUploadReminder(ctx, *event.FullDocument.UserId, *event.UpdateDescription.UpdatedFields.LastUploadReminderTime)
 	}
 
 	var connectionRequests ConnectionRequests
@@ -196,13 +202,14 @@ func (p *PatientCDCConsumer) handleCDCEvent(event PatientCDCEvent) error {
 	if len(connectionRequests) > 0 {
 		p.logger.Infow("processing connection requests", "event", event)
 
-		providers := map[string]struct{}{}
+		// The time of the most recent request of each provider identifies the version of the request
+		providers := map[string]int64{}
 		for _, r := range connectionRequests {
-			providers[r.ProviderName] = struct{}{}
+			providers[r.ProviderName] = max(providers[r.ProviderName], r.CreatedTime.Value)
 		}
 
 		errs := make([]error, 0, len(providers))
-		for providerName := range providers {
+		for providerName, requestTime := range providers {
 			templatePrefix := fmt.Sprintf("request_%s_", providerName)
 			action := "connect"
 			if event.FullDocument.IsCustodial() {
@@ -224,6 +231,7 @@ func (p *PatientCDCConsumer) handleCDCEvent(event PatientCDCEvent) error {
 				UserId:       *event.FullDocument.UserId,
 				PatientName:  *event.FullDocument.FullName,
 				TemplateName: templateName,
+				RequestTime:  requestTime,
 			}))
 		}
 		if err := errors.Join(errs...); err != nil {
@@ -282,10 +290,7 @@ func (p *PatientCDCConsumer) populateSummary(userId string) error {
 	return nil
 }
 
-func (p *PatientCDCConsumer) sendUploadReminder(userId string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
-	defer cancel()
-
+func (p *PatientCDCConsumer) sendUploadReminder(ctx context.Context, userId string, reminderTime cdc.Date) error {
 	email, err := p.getUserEmail(userId)
 	if err != nil {
 		return err
@@ -300,7 +305,8 @@ func (p *PatientCDCConsumer) sendUploadReminder(userId string) error {
 		Template:  "patient_upload_reminder",
 	}
 
-	return p.mailer.SendEmailTemplate(ctx, template)
+	key := outbox.NewKey(template.Template, userId, strconv.FormatInt(reminderTime.Value, 10))
+	return p.outbox.Enqueue(ctx, key, template)
 }
 
 type SendProviderConnectEmailParams struct {
@@ -310,15 +316,40 @@ type SendProviderConnectEmailParams struct {
 	PatientName          string
 	TemplateName         string
 	RevokeExistingTokens bool
+	// RequestTime is the creation time of the connection request, which is used to deduplicate the email
+	RequestTime int64
 }
 
 func (p *PatientCDCConsumer) sendProviderConnectEmail(ctx context.Context, params SendProviderConnectEmailParams) error {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), defaultTimeout)
 	defer cancel()
 
 	restrictedTokenPaths := []string{"/v1/oauth/" + params.ProviderName}
 	restrictedTokenExpirationTime := time.Now().Add(restrictedTokenExpirationDuration)
 
+	email, err := p.getUserEmail(params.UserId)
+	if err != nil {
+		return err
+	}
+
+	// The email for the request was already recorded when the event was processed before. The restricted token in
+	// the recorded email is kept valid, because the email will be sent with it.
+	key := outbox.NewKey(params.TemplateName, params.ClinicId, params.UserId, params.ProviderName, strconv.FormatInt(params.RequestTime, 10), email)
+	if email != "" {
+		recorded, err := p.outbox.Contains(ctx, key)
+		if err != nil {
+			return err
+		}
+		if recorded {
+			p.logger.Infow("Skipping data provider connect email - already recorded",
+				"userId", params.UserId,
+				"clinicId", params.ClinicId,
+				"providerName", params.ProviderName,
+			)
+			return nil
+		}
+	}
+
 	currentRestrictedTokens, err := p.getUserRestrictedTokens(params.UserId)
 	if err != nil {
 		return err
@@ -334,18 +365,17 @@ func (p *PatientCDCConsumer) sendProviderConnectEmail(ctx context.Context, param
 
 	// Revoke all existing tokens and re-create them to make sure old ones are not valid
 	// in case the email of the patient changed
+	target := audit.Target{UserId: params.UserId, ClinicId: params.ClinicId}
 	if currentRestrictedTokenId != "" {
 		err := p.auth.DeleteRestrictedToken(currentRestrictedTokenId, p.shoreline.TokenProvide())
+		event := audit.NewEvent(audit.ActionRestrictedTokenDeleted, target, err)
+		event.Details = map[string]string{"restrictedTokenId": currentRestrictedTokenId, "providerName": params.ProviderName}
+		p.auditor.Record(ctx, event)
 		if err != nil {
 			return err
 		}
 	}
 
-	email, err := p.getUserEmail(params.UserId)
-	if err != nil {
-		return err
-	}
-
 	// Email has been removed, no need to (re)create tokens or send an email
 	if email == "" {
 		p.logger.Infow("Abort sending data provider connect email - empty email",
@@ -362,6 +392,12 @@ func (p *PatientCDCConsumer) sendProviderConnectEmail(ctx context.Context, param
 	}
 
 	createdRestrictedToken, err := p.auth.CreateRestrictedToken(params.UserId, restrictedTokenExpirationTime, restrictedTokenPaths, p.shoreline.TokenProvide())
+	event := audit.NewEvent(audit.ActionRestrictedTokenCreated, target, err)
+	event.Details = map[string]string{"providerName": params.ProviderName}
+	if createdRestrictedToken != nil {
+		event.Details["restrictedTokenId"] = createdRestrictedToken.ID
+	}
+	p.auditor.Record(ctx, event)
 	if err != nil {
 		return err
 	}
@@ -384,7 +420,7 @@ func (p *PatientCDCConsumer) sendProviderConnectEmail(ctx context.Context, param
 			"ProviderName":      params.ProviderName,
 		},
 	}
-	if err := p.mailer.SendEmailTemplate(ctx, template); err != nil {
+	if err := p.outbox.Enqueue(ctx, key, template); err != nil {
 		return err
 	}
 
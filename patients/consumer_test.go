@@ -1,10 +1,13 @@
 package patients_test
 
 import (
+	"bytes"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/tidepool-org/clinic-worker/patients"
 	"github.com/tidepool-org/clinic-worker/test"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"strings"
 )
 
@@ -27,6 +30,28 @@ var _ = Describe("PatientCDCConsumer", func() {
 		})
 	})
 
+	Describe("MarshalLogObject", func() {
+		It("logs the event with the PHI of the patient redacted", func() {
+			fixture, err := test.LoadFixture("test/fixtures/patient_event.txt")
+			Expect(err).ToNot(HaveOccurred())
+			fixture = []byte(strings.TrimSuffix(string(fixture), "\n"))
+
+			event := patients.PatientCDCEvent{}
+			Expect(patients.UnmarshalEvent(fixture, &event)).To(Succeed())
+
+			buffer := &bytes.Buffer{}
+			encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+			logger := zap.New(zapcore.NewCore(encoder, zapcore.AddSync(buffer), zapcore.DebugLevel))
+			logger.Info("processing profile update", zap.Any("event", event))
+
+			Expect(buffer.String()).To(ContainSubstring("30e9244c-3963-4867-b2fa-30eab4a96f24"))
+			Expect(buffer.String()).To(ContainSubstring("t***@tidepool.org"))
+			Expect(buffer.String()).ToNot(ContainSubstring("test@tidepool.org"))
+			Expect(buffer.String()).ToNot(ContainSubstring("2001-01-01"))
+			Expect(buffer.String()).ToNot(ContainSubstring(`"P2"`))
+		})
+	})
+
 	Describe("", func() {
 		It("returns only the added provider connection request", func() {
 			fixture, err := test.LoadFixture("test/fixtures/provider_connection_request.txt")
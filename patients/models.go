@@ -1,15 +1,18 @@
 package patients
 
 import (
+	"errors"
 	"time"
 
 	summaries "github.com/tidepool-org/go-common/clients/summary"
 
 	"github.com/tidepool-org/clinic-worker/cdc"
 	"github.com/tidepool-org/clinic-worker/patientsummary"
+	"github.com/tidepool-org/clinic-worker/redact"
 	api "github.com/tidepool-org/clinic/client"
 	clinics "github.com/tidepool-org/clinic/client"
 	"github.com/tidepool-org/go-common/clients"
+	"go.uber.org/zap/zapcore"
 )
 
 type PatientCDCEvent struct {
@@ -68,6 +71,15 @@ func (p PatientCDCEvent) ApplyUpdatesToExistingProfile(profile map[string]interf
 	}
 }
 
+func (p PatientCDCEvent) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
+	encoder.AddInt64("offset", p.Offset)
+	encoder.AddString("operationType", p.OperationType)
+	if err := encoder.AddObject("fullDocument", p.FullDocument); err != nil {
+		return err
+	}
+	return encoder.AddObject("updateDescription", p.UpdateDescription)
+}
+
 type BGMStats struct {
 	Config  summaries.SummaryConfigV1             `json:"config" bson:"config"`
 	Dates   patientsummary.Dates                  `json:"dates" bson:"dates"`
@@ -135,6 +147,46 @@ type PatientDataSource struct {
 	State        *string       `json:"state"`
 }
 
+// MarshalLogObject logs the patient with the name, email, date of birth and MRN redacted
+func (p Patient) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
+	if p.Id != nil {
+		encoder.AddString("_id", p.Id.Value)
+	}
+	if p.ClinicId != nil {
+		encoder.AddString("clinicId", p.ClinicId.Value)
+	}
+	if p.UserId != nil {
+		encoder.AddString("userId", *p.UserId)
+	}
+	if p.BirthDate != nil {
+		encoder.AddString("birthDate", redact.Hash(*p.BirthDate))
+	}
+	if p.Email != nil {
+		encoder.AddString("email", redact.Email(*p.Email))
+	}
+	if p.FullName != nil {
+		encoder.AddString("fullName", redact.Mask(*p.FullName))
+	}
+	if p.Mrn != nil {
+		encoder.AddString("mrn", redact.Hash(*p.Mrn))
+	}
+	if p.InvitedBy != nil {
+		encoder.AddString("invitedBy", *p.InvitedBy)
+	}
+	if p.DiagnosisType != nil {
+		encoder.AddString("diagnosisType", *p.DiagnosisType)
+	}
+	encoder.AddBool("isMigrated", p.IsMigrated)
+	encoder.AddBool("isCustodial", p.IsCustodial())
+	return errors.Join(
+		encoder.AddReflected("targetDevices", p.TargetDevices),
+		encoder.AddReflected("dataSources", p.DataSources),
+		encoder.AddReflected("lastRequestedDexcomConnectTime", p.LastRequestedDexcomConnectTime),
+		encoder.AddReflected("lastUploadReminderTime", p.LastUploadReminderTime),
+		encoder.AddReflected("providerConnectionRequests", p.ProviderConnectionRequests),
+	)
+}
+
 func (p Patient) IsCustodial() bool {
 	return p.Permissions != nil && p.Permissions.Custodian != nil
 }
@@ -150,6 +202,13 @@ type UpdateDescription struct {
 	RemovedFields []string      `json:"removedFields"`
 }
 
+func (u UpdateDescription) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
+	if err := encoder.AddObject("updatedFields", u.UpdatedFields.Patient); err != nil {
+		return err
+	}
+	return encoder.AddReflected("removedFields", u.RemovedFields)
+}
+
 func (u UpdateDescription) applyUpdatesToExistingProfile(profile map[string]interface{}) {
 	ApplyPatientChangesToProfile(u.UpdatedFields.Patient, profile)
 	RemoveFieldsFromProfile(u.RemovedFields, profile)
@@ -0,0 +1,156 @@
+package redact
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	models "github.com/tidepool-org/clinic/redox_models"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// keys are the names of fields and map entries which hold PHI, normalized to lower case
+var keys = map[string]func(string) string{
+	"email":       Email,
+	"emails":      Email,
+	"recipient":   Email,
+	"fullname":    Mask,
+	"firstname":   Mask,
+	"lastname":    Mask,
+	"patientname": Mask,
+	"birthdate":   Hash,
+	"birthday":    Hash,
+	"dob":         Hash,
+	"mrn":         Hash,
+	"phonenumber": Hash,
+}
+
+var metaType = reflect.TypeOf(models.Meta{})
+
+// core redacts the fields of log entries before they are encoded. Fields with PHI keys are masked or hashed, Redox
+// metadata is reduced to an allowlist and maps (e.g. user profiles) are redacted recursively. Types which implement
+// zapcore.ObjectMarshaler are responsible for redacting their own fields.
+type core struct {
+	zapcore.Core
+}
+
+// NewCore wraps the core of a logger, so all log entries are redacted unless break-glass mode is enabled
+func NewCore(c zapcore.Core) zapcore.Core {
+	return &core{Core: c}
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	return &core{Core: c.Core.With(Fields(fields))}
+}
+
+func (c *core) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, Fields(fields))
+}
+
+// Fields returns a copy of the fields with PHI redacted
+func Fields(fields []zapcore.Field) []zapcore.Field {
+	if BreakGlass() {
+		return fields
+	}
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		redacted[i] = redactField(field)
+	}
+	return redacted
+}
+
+func redactField(field zapcore.Field) zapcore.Field {
+	fn, isPHI := keys[strings.ToLower(field.Key)]
+	switch field.Type {
+	case zapcore.StringType:
+		if isPHI {
+			return zap.String(field.Key, fn(field.String))
+		}
+	case zapcore.StringerType:
+		if stringer, ok := field.Interface.(fmt.Stringer); ok && isPHI {
+			return zap.String(field.Key, fn(stringer.String()))
+		}
+	case zapcore.ArrayMarshalerType:
+		// The elements of arrays can't be accessed, so arrays with PHI keys are replaced entirely
+		if isPHI {
+			return zap.String(field.Key, mask)
+		}
+	case zapcore.ReflectType:
+		return redactReflected(field)
+	}
+	return field
+}
+
+func redactReflected(field zapcore.Field) zapcore.Field {
+	switch value := field.Interface.(type) {
+	case nil:
+		return field
+	case map[string]interface{}:
+		return zap.Any(field.Key, Map(value))
+	}
+
+	// The metadata of orders, scheduling messages and queries are anonymous structs with the same fields as Meta
+	v := reflect.ValueOf(field.Interface)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return field
+		}
+		v = v.Elem()
+	}
+	if v.Type().ConvertibleTo(metaType) {
+		return zap.Object(field.Key, Meta(v.Convert(metaType).Interface().(models.Meta)))
+	}
+	return field
+}
+
+// Map returns a copy of the map with the values of PHI keys redacted recursively
+func Map(m map[string]interface{}) map[string]interface{} {
+	if m == nil || BreakGlass() {
+		return m
+	}
+	redacted := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		redacted[key] = redactValue(value, keys[strings.ToLower(key)])
+	}
+	return redacted
+}
+
+func redactValue(value interface{}, fn func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		if fn != nil {
+			return fn(v)
+		}
+		return v
+	case map[string]interface{}:
+		return Map(v)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, element := range v {
+			redacted[i] = redactValue(element, fn)
+		}
+		return redacted
+	case []string:
+		if fn != nil {
+			return redactStrings(v, fn)
+		}
+		return v
+	}
+	return value
+}
+
+func redactStrings(values []string, fn func(string) string) []string {
+	redacted := make([]string, len(values))
+	for i, value := range values {
+		redacted[i] = fn(value)
+	}
+	return redacted
+}
@@ -0,0 +1,84 @@
+package redact_test
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/redact"
+	models "github.com/tidepool-org/clinic/redox_models"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var _ = Describe("Core", func() {
+	var buffer *bytes.Buffer
+	var logger *zap.SugaredLogger
+
+	entry := func() map[string]interface{} {
+		result := map[string]interface{}{}
+		Expect(json.Unmarshal(buffer.Bytes(), &result)).To(Succeed())
+		return result
+	}
+
+	BeforeEach(func() {
+		buffer = &bytes.Buffer{}
+		encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+		logger = zap.New(redact.NewCore(zapcore.NewCore(encoder, zapcore.AddSync(buffer), zapcore.DebugLevel))).Sugar()
+	})
+
+	AfterEach(func() {
+		Expect(redact.Configure(redact.Config{})).To(Succeed())
+	})
+
+	It("redacts fields with PHI keys", func() {
+		logger.Infow("sending email", "userId", "1234", "email", "jane@example.com")
+		Expect(entry()).To(HaveKeyWithValue("email", "j***@example.com"))
+		Expect(entry()).To(HaveKeyWithValue("userId", "1234"))
+	})
+
+	It("redacts fields which were added to the logger", func() {
+		logger.With("mrn", "12345").Infow("processing order")
+		Expect(entry()["mrn"]).To(HavePrefix("hmac:"))
+	})
+
+	It("redacts maps recursively", func() {
+		profile := map[string]interface{}{
+			"fullName": "Jane Doe",
+			"patient": map[string]interface{}{
+				"birthday": "2000-01-01",
+				"emails":   []interface{}{"jane@example.com"},
+			},
+		}
+		logger.Infow("applying profile update", "profile", profile)
+
+		redacted := entry()["profile"].(map[string]interface{})
+		Expect(redacted).To(HaveKeyWithValue("fullName", "J*** D***"))
+		patient := redacted["patient"].(map[string]interface{})
+		Expect(patient["birthday"]).To(HavePrefix("hmac:"))
+		Expect(patient["emails"]).To(Equal([]interface{}{"j***@example.com"}))
+		Expect(profile["fullName"]).To(Equal("Jane Doe"))
+	})
+
+	It("logs only the allowlisted fields of the order metadata", func() {
+		order := models.NewOrder{}
+		order.Meta.DataModel = "Order"
+		order.Meta.EventType = "New"
+		destinations := []struct {
+			ID   *string `json:"ID"`
+			Name *string `json:"Name"`
+		}{{}}
+		order.Meta.Destinations = &destinations
+		logger.Infow("processing new order", "order", order.Meta)
+
+		Expect(entry()["order"]).To(Equal(map[string]interface{}{"DataModel": "Order", "EventType": "New"}))
+	})
+
+	It("doesn't redact fields in break-glass mode", func() {
+		Expect(redact.Configure(redact.Config{Environment: "dev", BreakGlass: true})).To(Succeed())
+		logger.Infow("sending email", "email", "jane@example.com")
+		Expect(entry()).To(HaveKeyWithValue("email", "jane@example.com"))
+	})
+})
@@ -0,0 +1,41 @@
+package redact
+
+import (
+	models "github.com/tidepool-org/clinic/redox_models"
+	"go.uber.org/zap/zapcore"
+)
+
+type meta models.Meta
+
+// Meta returns a marshaler which logs only the fields of the Redox metadata which are needed to trace a message.
+// Free-text fields like destination names are omitted.
+func Meta(m models.Meta) zapcore.ObjectMarshaler {
+	return meta(m)
+}
+
+func (m meta) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
+	encoder.AddString("DataModel", m.DataModel)
+	encoder.AddString("EventType", m.EventType)
+	if m.EventDateTime != nil {
+		encoder.AddString("EventDateTime", *m.EventDateTime)
+	}
+	if m.FacilityCode != nil {
+		encoder.AddString("FacilityCode", *m.FacilityCode)
+	}
+	if m.Test != nil {
+		encoder.AddBool("Test", *m.Test)
+	}
+	if m.Source != nil && m.Source.ID != nil {
+		encoder.AddString("SourceID", *m.Source.ID)
+	}
+	if m.Transmission != nil && m.Transmission.ID != nil {
+		encoder.AddFloat32("TransmissionID", *m.Transmission.ID)
+	}
+	if m.Message != nil && m.Message.ID != nil {
+		encoder.AddFloat32("MessageID", *m.Message.ID)
+	}
+	if m.Logs != nil && len(*m.Logs) > 0 && (*m.Logs)[0].ID != nil {
+		encoder.AddString("LogID", *(*m.Logs)[0].ID)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+const (
+	hashPrefix = "hmac:"
+	hashLength = 16
+	mask       = "***"
+)
+
+// Config controls the redaction of protected health information (PHI) in logs
+type Config struct {
+	Environment string `envconfig:"TIDEPOOL_ENV"`
+	// HashKey is used to hash identifiers, so they can be correlated across log entries and instances. A random key
+	// is generated on startup if it's not set.
+	HashKey string `envconfig:"TIDEPOOL_LOG_PHI_HASH_KEY"`
+	// BreakGlass logs PHI without redaction for debugging. It can't be enabled in production environments.
+	BreakGlass bool `envconfig:"TIDEPOOL_LOG_PHI_BREAK_GLASS" default:"false"`
+}
+
+func NewConfig() (Config, error) {
+	config := Config{}
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+// IsProduction returns true for production environments. Environments which are not set are treated as production.
+func (c Config) IsProduction() bool {
+	switch strings.ToLower(c.Environment) {
+	case "", "prd", "prod", "production":
+		return true
+	}
+	return false
+}
+
+type mode struct {
+	breakGlass bool
+	key        []byte
+}
+
+var current atomic.Pointer[mode]
+
+func init() {
+	current.Store(&mode{key: randomKey()})
+}
+
+// Configure sets the redaction mode of the process. It returns an error if break-glass mode is requested in a
+// production environment.
+func Configure(config Config) error {
+	if config.BreakGlass && config.IsProduction() {
+		return fmt.Errorf("break-glass logging of PHI is not allowed in the production environment %q", config.Environment)
+	}
+
+	key := []byte(config.HashKey)
+	if len(key) == 0 {
+		key = randomKey()
+	}
+	current.Store(&mode{breakGlass: config.BreakGlass, key: key})
+	return nil
+}
+
+// BreakGlass returns true if PHI is logged without redaction
+func BreakGlass() bool {
+	return current.Load().breakGlass
+}
+
+// Hash returns a keyed hash of the value, which allows correlating log entries without revealing identifiers
+// like MRNs, dates of birth and phone numbers
+func Hash(value string) string {
+	m := current.Load()
+	if value == "" || m.breakGlass {
+		return value
+	}
+	h := hmac.New(sha256.New, m.key)
+	h.Write([]byte(value))
+	return hashPrefix + hex.EncodeToString(h.Sum(nil))[:hashLength]
+}
+
+// Mask keeps the first character of each word of the value, e.g. "J*** D***"
+func Mask(value string) string {
+	if value == "" || BreakGlass() {
+		return value
+	}
+	words := strings.Fields(value)
+	for i, word := range words {
+		r, _ := utf8.DecodeRuneInString(word)
+		words[i] = string(r) + mask
+	}
+	return strings.Join(words, " ")
+}
+
+// Email masks the local part of the email address and keeps the domain, e.g. "j***@example.com"
+func Email(value string) string {
+	if value == "" || BreakGlass() {
+		return value
+	}
+	local, domain, found := strings.Cut(value, "@")
+	if !found {
+		return Mask(value)
+	}
+	r, _ := utf8.DecodeRuneInString(local)
+	return string(r) + mask + "@" + domain
+}
+
+// StringPtr applies the redaction to the value if it's not nil
+func StringPtr(value *string, redact func(string) string) *string {
+	if value == nil {
+		return nil
+	}
+	redacted := redact(*value)
+	return &redacted
+}
+
+func randomKey() []byte {
+	return []byte(rand.Text())
+}
@@ -0,0 +1,65 @@
+package redact_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/redact"
+)
+
+var _ = Describe("Redact", func() {
+	AfterEach(func() {
+		Expect(redact.Configure(redact.Config{})).To(Succeed())
+	})
+
+	Describe("Configure", func() {
+		It("doesn't allow break-glass mode in production", func() {
+			Expect(redact.Configure(redact.Config{Environment: "prd", BreakGlass: true})).ToNot(Succeed())
+			Expect(redact.BreakGlass()).To(BeFalse())
+		})
+
+		It("treats an unset environment as production", func() {
+			Expect(redact.Configure(redact.Config{BreakGlass: true})).ToNot(Succeed())
+		})
+
+		It("allows break-glass mode outside of production", func() {
+			Expect(redact.Configure(redact.Config{Environment: "qa1", BreakGlass: true})).To(Succeed())
+			Expect(redact.BreakGlass()).To(BeTrue())
+			Expect(redact.Email("jane@example.com")).To(Equal("jane@example.com"))
+			Expect(redact.Hash("12345")).To(Equal("12345"))
+		})
+	})
+
+	Describe("Hash", func() {
+		It("returns the same hash for the same value and key", func() {
+			Expect(redact.Configure(redact.Config{HashKey: "secret"})).To(Succeed())
+			Expect(redact.Hash("12345")).To(HavePrefix("hmac:"))
+			Expect(redact.Hash("12345")).ToNot(ContainSubstring("12345"))
+			Expect(redact.Hash("12345")).To(Equal(redact.Hash("12345")))
+			Expect(redact.Hash("12345")).ToNot(Equal(redact.Hash("12346")))
+		})
+
+		It("returns a different hash for a different key", func() {
+			Expect(redact.Configure(redact.Config{HashKey: "secret"})).To(Succeed())
+			hash := redact.Hash("12345")
+			Expect(redact.Configure(redact.Config{HashKey: "other"})).To(Succeed())
+			Expect(redact.Hash("12345")).ToNot(Equal(hash))
+		})
+	})
+
+	Describe("Mask", func() {
+		It("keeps the first character of each word", func() {
+			Expect(redact.Mask("Jane Doe")).To(Equal("J*** D***"))
+		})
+	})
+
+	Describe("Email", func() {
+		It("masks the local part of the address", func() {
+			Expect(redact.Email("jane.doe@example.com")).To(Equal("j***@example.com"))
+		})
+
+		It("masks values which are not email addresses", func() {
+			Expect(redact.Email("jane")).To(Equal("j***"))
+		})
+	})
+})
@@ -0,0 +1,166 @@
+package redox
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	clinics "github.com/tidepool-org/clinic/client"
+)
+
+const (
+	AccountCreationDiagnosisTypeCode        = "ACCOUNT_CREATION_DIAGNOSIS_TYPE"
+	AccountCreationDiagnosisTypeDescription = "The diagnosis type which was mapped from the diagnoses of the order"
+	AccountCreationTargetDevicesCode        = "ACCOUNT_CREATION_TARGET_DEVICES"
+	AccountCreationTargetDevicesDescription = "The target devices which were mapped from the clinical info of the order"
+	AccountCreationPhoneNumberCode          = "ACCOUNT_CREATION_PHONE_NUMBER"
+	AccountCreationPhoneNumberDescription   = "The phone number which was stored for the patient"
+	AccountCreationGuardianCode             = "ACCOUNT_CREATION_GUARDIAN"
+	AccountCreationGuardianDescription      = "The guardian contact which was stored for the patient"
+
+	// NotMappedValue is reported for configured mappings which didn't apply to the order
+	NotMappedValue = "NOT_MAPPED"
+)
+
+// AccountCreationSettings define which details of the order are mapped to the account of the patient. Mappings are
+// disabled if they are not configured.
+type AccountCreationSettings struct {
+	// DiagnosisTypes maps ICD-10 codes or code prefixes (e.g. "E10") to diagnosis types. The longest prefix wins.
+	DiagnosisTypes map[string]clinics.DiagnosisTypeV1 `json:"diagnosisTypes,omitempty"`
+	TargetDevices  TargetDeviceSettings               `json:"targetDevices"`
+	// PhoneNumberTypes are the preferred types of the patient phone number, e.g. ["mobile", "home"]. Patient accounts
+	// don't have phone numbers, so the number is stored with the contact of the patient in the worker.
+	PhoneNumberTypes []string `json:"phoneNumberTypes,omitempty"`
+	// Guardian stores the guarantor of the visit as the guardian contact of the patient
+	Guardian bool `json:"guardian,omitempty"`
+}
+
+// TargetDeviceSettings map the values of the clinical info with the given codes to target devices
+type TargetDeviceSettings struct {
+	Codes     []string          `json:"codes,omitempty"`
+	Separator string            `json:"separator,omitempty"`
+	Devices   map[string]string `json:"devices,omitempty"`
+}
+
+// AccountDetails are the details of the order which were mapped with the account creation settings
+type AccountDetails struct {
+	DiagnosisType *clinics.DiagnosisTypeV1
+	TargetDevices *[]string
+	PhoneNumber   string
+	Guardian      *GuardianContact
+}
+
+func (s AccountCreationSettings) GetAccountDetails(order ehr.Order) AccountDetails {
+	details := AccountDetails{
+		DiagnosisType: s.getDiagnosisType(order),
+		TargetDevices: s.getTargetDevices(order),
+	}
+	if len(s.PhoneNumberTypes) > 0 {
+		details.PhoneNumber = ehr.GetPhoneNumber(order.Patient.PhoneNumbers, s.PhoneNumberTypes)
+	}
+	if s.Guardian && order.Visit != nil && order.Visit.Guarantor != nil {
+		guardian := NewGuardianContact(*order.Visit.Guarantor, order.Visit.GuarantorEmailAddresses, s.PhoneNumberTypes)
+		if !guardian.IsEmpty() {
+			details.Guardian = &guardian
+		}
+	}
+	return details
+}
+
+// WithoutContact returns the details without the phone number and the guardian, e.g. because they couldn't be stored
+func (d AccountDetails) WithoutContact() AccountDetails {
+	d.PhoneNumber = ""
+	d.Guardian = nil
+	return d
+}
+
+func (s AccountCreationSettings) getDiagnosisType(order ehr.Order) *clinics.DiagnosisTypeV1 {
+	if len(s.DiagnosisTypes) == 0 {
+		return nil
+	}
+
+	var match string
+	for _, diagnosis := range order.Diagnoses {
+		if !isICD10(diagnosis.Codeset) {
+			continue
+		}
+		code := strings.ToUpper(strings.TrimSpace(diagnosis.Code))
+		for prefix := range s.DiagnosisTypes {
+			if strings.HasPrefix(code, strings.ToUpper(prefix)) && len(prefix) > len(match) {
+				match = prefix
+			}
+		}
+	}
+	if match == "" {
+		return nil
+	}
+
+	diagnosisType := s.DiagnosisTypes[match]
+	return &diagnosisType
+}
+
+func (s AccountCreationSettings) getTargetDevices(order ehr.Order) *[]string {
+	if len(s.TargetDevices.Codes) == 0 {
+		return nil
+	}
+
+	codes := make(map[string]struct{}, len(s.TargetDevices.Codes))
+	for _, code := range s.TargetDevices.Codes {
+		codes[code] = struct{}{}
+	}
+
+	var devices []string
+	for _, value := range order.GetClinicalInfoValues(codes, s.TargetDevices.Separator) {
+		device, ok := s.TargetDevices.Devices[value]
+		if !ok || device == "" {
+			continue
+		}
+		if !slices.Contains(devices, device) {
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+	return &devices
+}
+
+// ResultDetails returns the values of the configured mappings which are reported in the account creation results
+func (s AccountCreationSettings) ResultDetails(details AccountDetails) []ehr.ResultDetail {
+	var result []ehr.ResultDetail
+	if len(s.DiagnosisTypes) > 0 {
+		value := NotMappedValue
+		if details.DiagnosisType != nil {
+			value = string(*details.DiagnosisType)
+		}
+		result = append(result, ehr.ResultDetail{Code: AccountCreationDiagnosisTypeCode, Description: AccountCreationDiagnosisTypeDescription, Value: value})
+	}
+	if len(s.TargetDevices.Codes) > 0 {
+		value := NotMappedValue
+		if details.TargetDevices != nil {
+			value = strings.Join(*details.TargetDevices, ",")
+		}
+		result = append(result, ehr.ResultDetail{Code: AccountCreationTargetDevicesCode, Description: AccountCreationTargetDevicesDescription, Value: value})
+	}
+	if len(s.PhoneNumberTypes) > 0 {
+		value := NotMappedValue
+		if details.PhoneNumber != "" {
+			value = details.PhoneNumber
+		}
+		result = append(result, ehr.ResultDetail{Code: AccountCreationPhoneNumberCode, Description: AccountCreationPhoneNumberDescription, Value: value})
+	}
+	if s.Guardian {
+		value := NotMappedValue
+		if details.Guardian != nil {
+			value = details.Guardian.String()
+		}
+		result = append(result, ehr.ResultDetail{Code: AccountCreationGuardianCode, Description: AccountCreationGuardianDescription, Value: value})
+	}
+	return result
+}
+
+// isICD10 returns true for ICD-10 codesets and for diagnoses without codeset
+func isICD10(codeset string) bool {
+	codeset = strings.ReplaceAll(strings.ToUpper(codeset), "-", "")
+	return codeset == "" || strings.HasPrefix(codeset, "ICD10")
+}
@@ -0,0 +1,111 @@
+package redox_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"github.com/tidepool-org/clinic-worker/redox"
+	clinics "github.com/tidepool-org/clinic/client"
+)
+
+var _ = Describe("AccountCreationSettings", func() {
+	var order ehr.Order
+
+	BeforeEach(func() {
+		order = ehr.Order{
+			Patient: ehr.Patient{
+				PhoneNumbers: []ehr.PhoneNumber{
+					{Type: ehr.PhoneNumberTypeHome, Number: "555-0100"},
+					{Type: ehr.PhoneNumberTypeMobile, Number: "555-0101"},
+				},
+			},
+			Visit: &ehr.Visit{
+				GuarantorEmailAddresses: []string{"", "parent@test.com"},
+				Guarantor: &ehr.Guarantor{
+					FirstName:         "Jane",
+					LastName:          "Doe",
+					RelationToPatient: "Mother",
+					PhoneNumbers:      []ehr.PhoneNumber{{Type: ehr.PhoneNumberTypeWork, Number: "555-0102"}},
+				},
+			},
+			ClinicalInfo: []ehr.ClinicalInfo{{Code: "DEVICES", Value: "CGM; PUMP; OTHER"}},
+			Diagnoses: []ehr.Diagnosis{
+				{Code: "Z31.41", Codeset: "ICD-9"},
+				{Code: "E10.65", Codeset: "ICD-10-CM"},
+			},
+		}
+	})
+
+	Describe("GetAccountDetails", func() {
+		It("doesn't map details which aren't configured", func() {
+			details := redox.AccountCreationSettings{}.GetAccountDetails(order)
+			Expect(details).To(Equal(redox.AccountDetails{}))
+		})
+
+		It("maps the diagnosis type with the longest matching ICD-10 prefix", func() {
+			settings := redox.AccountCreationSettings{
+				DiagnosisTypes: map[string]clinics.DiagnosisTypeV1{
+					"E1":    clinics.DiagnosisTypeV1Other,
+					"E10":   clinics.DiagnosisTypeV1Type1,
+					"Z31.4": clinics.DiagnosisTypeV1Gestational,
+				},
+			}
+			Expect(settings.GetAccountDetails(order).DiagnosisType).To(HaveValue(Equal(clinics.DiagnosisTypeV1Type1)))
+		})
+
+		It("maps target devices from the clinical info", func() {
+			settings := redox.AccountCreationSettings{
+				TargetDevices: redox.TargetDeviceSettings{
+					Codes:     []string{"DEVICES"},
+					Separator: ";",
+					Devices:   map[string]string{"CGM": "dexcom", "PUMP": "omnipod"},
+				},
+			}
+			Expect(settings.GetAccountDetails(order).TargetDevices).To(HaveValue(Equal([]string{"dexcom", "omnipod"})))
+		})
+
+		It("uses the preferred phone number type", func() {
+			settings := redox.AccountCreationSettings{PhoneNumberTypes: []string{ehr.PhoneNumberTypeMobile, ehr.PhoneNumberTypeHome}}
+			Expect(settings.GetAccountDetails(order).PhoneNumber).To(Equal("555-0101"))
+		})
+
+		It("maps the guarantor to the guardian contact", func() {
+			settings := redox.AccountCreationSettings{Guardian: true}
+			Expect(settings.GetAccountDetails(order).Guardian).To(HaveValue(Equal(redox.GuardianContact{
+				Name:              "Jane Doe",
+				RelationToPatient: "Mother",
+				Email:             "parent@test.com",
+				PhoneNumber:       "555-0102",
+			})))
+		})
+	})
+
+	Describe("ResultDetails", func() {
+		It("reports configured mappings which didn't apply as not mapped", func() {
+			settings := redox.AccountCreationSettings{
+				DiagnosisTypes:   map[string]clinics.DiagnosisTypeV1{"E11": clinics.DiagnosisTypeV1Type2},
+				PhoneNumberTypes: []string{ehr.PhoneNumberTypeWork},
+			}
+			details := settings.ResultDetails(settings.GetAccountDetails(order))
+			Expect(details).To(HaveLen(2))
+			Expect(details[0].Code).To(Equal(redox.AccountCreationDiagnosisTypeCode))
+			Expect(details[0].Value).To(Equal(redox.NotMappedValue))
+			Expect(details[1].Code).To(Equal(redox.AccountCreationPhoneNumberCode))
+			Expect(details[1].Value).To(Equal(redox.NotMappedValue))
+		})
+
+		It("reports the contact which isn't included in the details as not mapped", func() {
+			settings := redox.AccountCreationSettings{
+				PhoneNumberTypes: []string{ehr.PhoneNumberTypeMobile},
+				Guardian:         true,
+			}
+			details := settings.ResultDetails(settings.GetAccountDetails(order).WithoutContact())
+			Expect(details).To(HaveLen(2))
+			Expect(details[0].Code).To(Equal(redox.AccountCreationPhoneNumberCode))
+			Expect(details[0].Value).To(Equal(redox.NotMappedValue))
+			Expect(details[1].Code).To(Equal(redox.AccountCreationGuardianCode))
+			Expect(details[1].Value).To(Equal(redox.NotMappedValue))
+		})
+	})
+})
@@ -0,0 +1,382 @@
+package redox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	clinics "github.com/tidepool-org/clinic/client"
+	models "github.com/tidepool-org/clinic/redox_models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/fx"
+)
+
+const AdapterName = "redox"
+
+// NormalizeOrder converts a Redox order to the order model which is shared by all EHR adapters
+func NormalizeOrder(order models.NewOrder) ehr.Order {
+	normalized := ehr.Order{
+		Id:     order.Order.ID,
+		Native: order,
+	}
+	if order.Meta.Source != nil {
+		normalized.SourceId = stringValue(order.Meta.Source.ID)
+	}
+	if order.Meta.EventDateTime != nil {
+		if orderTime, err := time.Parse(time.RFC3339, *order.Meta.EventDateTime); err == nil {
+			normalized.Time = &orderTime
+		}
+	}
+	if procedure := order.Order.Procedure; procedure != nil {
+		normalized.ProcedureCode = stringValue(procedure.Code)
+		normalized.ProcedureCodeset = stringValue(procedure.Codeset)
+		normalized.ProcedureDescription = stringValue(procedure.Description)
+	}
+
+	for _, identifier := range order.Patient.Identifiers {
+		normalized.Patient.Identifiers = append(normalized.Patient.Identifiers, ehr.Identifier{Id: identifier.ID, Type: identifier.IDType})
+	}
+	if demographics := order.Patient.Demographics; demographics != nil {
+		normalized.Patient.FirstName = stringValue(demographics.FirstName)
+		normalized.Patient.MiddleName = stringValue(demographics.MiddleName)
+		normalized.Patient.LastName = stringValue(demographics.LastName)
+		normalized.Patient.BirthDate = stringValue(demographics.DOB)
+		normalized.Patient.Sex = stringValue(demographics.Sex)
+		if demographics.EmailAddresses != nil {
+			normalized.Patient.EmailAddresses = normalizeEmailAddresses(*demographics.EmailAddresses)
+		}
+		if phone := demographics.PhoneNumber; phone != nil {
+			normalized.Patient.PhoneNumbers = normalizePhoneNumbers(map[string]*string{
+				ehr.PhoneNumberTypeHome:   phone.Home,
+				ehr.PhoneNumberTypeMobile: phone.Mobile,
+				ehr.PhoneNumberTypeWork:   phone.Office,
+			})
+		}
+	}
+
+	if visit := order.Visit; visit != nil {
+		normalized.Visit = &ehr.Visit{
+			Number:        stringValue(visit.VisitNumber),
+			AccountNumber: stringValue(visit.AccountNumber),
+		}
+		if visit.VisitDateTime != nil {
+			if visitTime, err := time.Parse(time.RFC3339, *visit.VisitDateTime); err == nil {
+				normalized.Visit.Time = &visitTime
+			}
+		}
+		if location := visit.Location; location != nil {
+			normalized.Visit.Location = ehr.Location{
+				Facility:   stringValue(location.Facility),
+				Department: stringValue(location.Department),
+				Room:       stringValue(location.Room),
+			}
+		}
+		if guarantor := visit.Guarantor; guarantor != nil {
+			if guarantor.EmailAddresses != nil {
+				normalized.Visit.GuarantorEmailAddresses = normalizeEmailAddresses(*guarantor.EmailAddresses)
+			}
+			normalized.Visit.Guarantor = &ehr.Guarantor{
+				FirstName:         stringValue(guarantor.FirstName),
+				LastName:          stringValue(guarantor.LastName),
+				RelationToPatient: stringValue(guarantor.RelationToPatient),
+			}
+			if phone := guarantor.PhoneNumber; phone != nil {
+				normalized.Visit.Guarantor.PhoneNumbers = normalizePhoneNumbers(map[string]*string{
+					ehr.PhoneNumberTypeHome:   phone.Home,
+					ehr.PhoneNumberTypeMobile: phone.Mobile,
+					ehr.PhoneNumberTypeWork:   phone.Business,
+				})
+			}
+		}
+	}
+
+	if provider := order.Order.Provider; provider != nil {
+		normalized.Provider = &ehr.Provider{
+			Id:        stringValue(provider.ID),
+			IdType:    stringValue(provider.IDType),
+			FirstName: stringValue(provider.FirstName),
+			LastName:  stringValue(provider.LastName),
+		}
+	}
+
+	if order.Order.ClinicalInfo != nil && *order.Order.ClinicalInfo != nil {
+		for _, info := range *order.Order.ClinicalInfo {
+			if info.Code == nil || info.Value == nil {
+				continue
+			}
+			normalized.ClinicalInfo = append(normalized.ClinicalInfo, ehr.ClinicalInfo{Code: *info.Code, Value: *info.Value})
+		}
+	}
+
+	if order.Order.Diagnoses != nil {
+		for _, diagnosis := range *order.Order.Diagnoses {
+			if diagnosis.Code == nil {
+				continue
+			}
+			normalized.Diagnoses = append(normalized.Diagnoses, ehr.Diagnosis{
+				Code:    *diagnosis.Code,
+				Codeset: stringValue(diagnosis.Codeset),
+				Name:    stringValue(diagnosis.Name),
+			})
+		}
+	}
+
+	return normalized
+}
+
+// NormalizeMessage normalizes the order of a message which was stored by the clinic service. Stored messages are
+// converted to JSON, which is the format in which all adapters receive orders.
+func NormalizeMessage(adapter ehr.Adapter, envelope models.MessageEnvelope) (ehr.Order, error) {
+	message, err := bson.MarshalExtJSON(envelope.Message, false, false)
+	if err != nil {
+		return ehr.Order{}, fmt.Errorf("unable to convert message %s: %w", envelope.Id.Hex(), err)
+	}
+	return adapter.NormalizeOrder(message)
+}
+
+// normalizeEmailAddresses keeps the position of addresses which aren't strings, so they fail validation if used
+func normalizeEmailAddresses(addresses []interface{}) []string {
+	result := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		email, _ := address.(string)
+		result = append(result, email)
+	}
+	return result
+}
+
+// normalizePhoneNumbers returns the numbers which are set in a stable order of types
+func normalizePhoneNumbers(numbers map[string]*string) []ehr.PhoneNumber {
+	var result []ehr.PhoneNumber
+	for _, phoneType := range []string{ehr.PhoneNumberTypeHome, ehr.PhoneNumberTypeMobile, ehr.PhoneNumberTypeWork} {
+		if number := stringValue(numbers[phoneType]); number != "" {
+			result = append(result, ehr.PhoneNumber{Type: phoneType, Number: number})
+		}
+	}
+	return result
+}
+
+// CodeObservations returns the observations with the codes which are used by the clinic
+func CodeObservations(observations []*Observation, codes ObservationCodeSettings) []ehr.Observation {
+	result := make([]ehr.Observation, 0, len(observations))
+	for _, observation := range observations {
+		code := codes.GetObservationCode(observation)
+		result = append(result, ehr.Observation{
+			Code:        code.Code,
+			Codeset:     code.Codeset,
+			Value:       observation.Value,
+			ValueType:   observation.ValueType,
+			Units:       observation.Units,
+			DateTime:    observation.DateTime,
+			Description: observation.Description,
+			Period:      observation.Period,
+		})
+	}
+	return result
+}
+
+// uncodeObservations returns the observations of a document, which are coded with the Tidepool codes
+func uncodeObservations(observations []ehr.Observation) []*Observation {
+	result := make([]*Observation, 0, len(observations))
+	for _, observation := range observations {
+		result = append(result, &Observation{
+			Code:        observation.Code,
+			Value:       observation.Value,
+			ValueType:   observation.ValueType,
+			Units:       observation.Units,
+			DateTime:    observation.DateTime,
+			Description: observation.Description,
+			Period:      observation.Period,
+		})
+	}
+	return result
+}
+
+type adapter struct {
+	client Client
+}
+
+var _ ehr.Adapter = &adapter{}
+var _ ehr.Uploader = &adapter{}
+
+type EHRAdapterParams struct {
+	fx.In
+
+	Client Client
+	FHIR   ehr.Adapter `name:"fhir" optional:"true"`
+}
+
+// NewEHRAdapter returns the adapter of the order processors, which routes the orders received from a FHIR server to
+// the FHIR adapter if it's enabled and all other orders to Redox
+func NewEHRAdapter(params EHRAdapterParams) ehr.Adapter {
+	var adapters []ehr.Adapter
+	if params.FHIR != nil {
+		adapters = append(adapters, params.FHIR)
+	}
+	return ehr.NewRouter(append(adapters, NewAdapter(params.Client))...)
+}
+
+// NewAdapter returns the EHR adapter which delivers results, flowsheets and notes through Redox
+func NewAdapter(client Client) ehr.Adapter {
+	return &adapter{
+		client: client,
+	}
+}
+
+func (a *adapter) Name() string {
+	return AdapterName
+}
+
+func (a *adapter) NormalizeOrder(message []byte) (ehr.Order, error) {
+	order := models.NewOrder{}
+	if err := json.Unmarshal(message, &order); err != nil {
+		return ehr.Order{}, fmt.Errorf("unable to unmarshal order: %w", err)
+	}
+	if order.Meta.DataModel != DataModelOrder {
+		return ehr.Order{}, fmt.Errorf("unexpected data model %s", order.Meta.DataModel)
+	}
+	return NormalizeOrder(order), nil
+}
+
+func (a *adapter) SendResults(ctx context.Context, destination ehr.Destination, results ehr.Results) error {
+	order, err := getNativeOrder(results.Order)
+	if err != nil {
+		return err
+	}
+
+	client := a.forSource(destination.SourceId)
+	source := client.GetSource()
+	notification := ResultsNotification{
+		IsSuccess:       results.IsSuccess,
+		Code:            results.Code,
+		Message:         results.Message,
+		MatchMethod:     results.MatchMethod,
+		MatchConfidence: results.MatchConfidence,
+		Details:         results.Details,
+	}
+
+	payload := NewResults()
+	payload.Meta.Source = &source
+	SetResultsPatientFromOrder(order, &payload)
+	if results.Operation == ehr.OperationAccountCreation {
+		SetAccountCreationResults(notification, order, &payload)
+	} else {
+		SetMatchingResult(notification, order, &payload)
+	}
+	SetAccountNumberInResult(order, &payload)
+	SetVisitNumberInResult(order, &payload)
+	SetVisitLocationInResult(order, &payload)
+	SetDestinationInResult(destination.Id, &payload)
+
+	return client.Send(ctx, payload)
+}
+
+func (a *adapter) SendObservations(ctx context.Context, destination ehr.Destination, observations ehr.Observations) error {
+	order, err := getNativeOrder(observations.Order)
+	if err != nil {
+		return err
+	}
+
+	client := a.forSource(destination.SourceId)
+	source := client.GetSource()
+
+	flowsheet := NewFlowsheet()
+	flowsheet.Meta.Source = &source
+	SetDestinationInFlowsheet(destination.Id, &flowsheet)
+	flowsheet.Patient.Identifiers = order.Patient.Identifiers
+	flowsheet.Patient.Demographics = order.Patient.Demographics
+
+	SetVisitNumberInFlowsheet(order, &flowsheet)
+	SetVisitLocationInFlowsheet(order, &flowsheet)
+	SetAccountNumberInFlowsheet(order, &flowsheet)
+	SetOrderIdInFlowsheet(order, &flowsheet)
+	SetProviderInFlowsheet(order, &flowsheet)
+	for _, observation := range observations.Observations {
+		AppendCodedObservation(&flowsheet, &Observation{
+			Code:        observation.Code,
+			Value:       observation.Value,
+			ValueType:   observation.ValueType,
+			Units:       observation.Units,
+			DateTime:    observation.DateTime,
+			Description: observation.Description,
+			Period:      observation.Period,
+		}, ObservationCode{Code: observation.Code, Codeset: observation.Codeset})
+	}
+
+	return client.Send(ctx, flowsheet)
+}
+
+// SendDocument sends the document as a note, which replaces the note of the replaced document if set
+func (a *adapter) SendDocument(ctx context.Context, destination ehr.Destination, document ehr.Document) error {
+	order, err := getNativeOrder(document.Order)
+	if err != nil {
+		return err
+	}
+
+	var notes Notes
+	if document.ReplacedId != "" {
+		if notes, err = CreateReplaceNotes(document.ReplacedId); err != nil {
+			return err
+		}
+	} else {
+		notes = CreateNewNotes()
+	}
+
+	client := a.forSource(destination.SourceId)
+	notes.SetSourceFromClient(client)
+	notes.SetDestination(destination.Id)
+	notes.SetOrderId(order)
+	notes.SetVisitLocationFromOrder(order)
+	notes.SetVisitNumberFromOrder(order)
+	notes.SetAccountNumberFromOrder(order)
+	notes.SetReportMetadata(document.Id)
+	notes.SetPatientFromOrder(order)
+	notes.SetProcedureFromOrder(order)
+	notes.SetProviderFromOrder(order)
+	if len(document.Observations) > 0 {
+		notes.SetComponents(ObservationsToGMINoteComponents(uncodeObservations(document.Observations)))
+	}
+
+	switch {
+	case document.Upload != nil:
+		err = notes.SetUploadReference(document.FileName, NoteReportFileType, UploadResult{URI: document.Upload.URI})
+	case document.Content != nil:
+		err = notes.SetEmbeddedFile(document.FileName, NoteReportFileType, bytes.NewReader(document.Content))
+	default:
+		notes.SetPlainTextContents(document.Text)
+	}
+	if err != nil {
+		return err
+	}
+
+	return client.Send(ctx, notes)
+}
+
+// IsUploadRequired returns true if the clinic is configured to upload the files of all notes
+func (a *adapter) IsUploadRequired(destination ehr.Destination) bool {
+	return a.forSource(destination.SourceId).IsUploadFileEnabled()
+}
+
+func (a *adapter) Upload(ctx context.Context, destination ehr.Destination, fileName string, content io.Reader) (ehr.Upload, error) {
+	result, err := a.forSource(destination.SourceId).UploadFile(ctx, fileName, content)
+	if err != nil {
+		return ehr.Upload{}, err
+	}
+	return ehr.Upload{URI: result.URI}, nil
+}
+
+func (a *adapter) forSource(sourceId string) Client {
+	return a.client.ForClinic(clinics.EhrSettingsV1{SourceId: sourceId})
+}
+
+// getNativeOrder returns the Redox order from which the order was normalized
+func getNativeOrder(order ehr.Order) (models.NewOrder, error) {
+	native, ok := order.Native.(models.NewOrder)
+	if !ok {
+		return models.NewOrder{}, fmt.Errorf("the order %s wasn't received from redox", order.Id)
+	}
+	return native, nil
+}
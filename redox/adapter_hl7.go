@@ -0,0 +1,78 @@
+package redox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"github.com/tidepool-org/clinic-worker/hl7"
+)
+
+const HL7AdapterName = "hl7v2"
+
+// ErrHL7Unsupported is returned for the operations which aren't supported by HL7v2 deliveries
+var ErrHL7Unsupported = errors.New("the operation isn't supported by the hl7v2 adapter")
+
+type hl7Adapter struct {
+	settings  HL7v2Settings
+	transport hl7.Transport
+}
+
+var _ ehr.Adapter = &hl7Adapter{}
+
+// NewHL7Adapter returns the EHR adapter which delivers observations and documents of a clinic as HL7v2 ORU^R01
+// messages to the destination selected by the clinic. Orders are still received and results are still sent through
+// the adapter of the integration.
+func NewHL7Adapter(settings HL7v2Settings, destinations hl7.Destinations) (ehr.Adapter, error) {
+	transport, err := destinations.NewTransport(settings.Destination)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create hl7 transport: %w", err)
+	}
+	return &hl7Adapter{
+		settings:  settings,
+		transport: transport,
+	}, nil
+}
+
+func (h *hl7Adapter) Name() string {
+	return HL7AdapterName
+}
+
+func (h *hl7Adapter) NormalizeOrder(message []byte) (ehr.Order, error) {
+	return ehr.Order{}, ErrHL7Unsupported
+}
+
+func (h *hl7Adapter) SendResults(ctx context.Context, destination ehr.Destination, results ehr.Results) error {
+	return ErrHL7Unsupported
+}
+
+func (h *hl7Adapter) SendObservations(ctx context.Context, destination ehr.Destination, observations ehr.Observations) error {
+	return h.send(ctx, observations.Order, observations.Observations, nil)
+}
+
+// SendDocument sends the observations of the document together with the embedded report. Uploaded reports and
+// plain-text documents aren't supported.
+func (h *hl7Adapter) SendDocument(ctx context.Context, destination ehr.Destination, document ehr.Document) error {
+	if document.Content == nil {
+		return fmt.Errorf("%w: documents without embedded reports", ErrHL7Unsupported)
+	}
+	return h.send(ctx, document.Order, document.Observations, document.Content)
+}
+
+func (h *hl7Adapter) send(ctx context.Context, order ehr.Order, observations []ehr.Observation, report []byte) error {
+	header := hl7.Header{
+		SendingApplication:   h.settings.SendingApplication,
+		SendingFacility:      h.settings.SendingFacility,
+		ReceivingApplication: h.settings.ReceivingApplication,
+		ReceivingFacility:    h.settings.ReceivingFacility,
+		ControlId:            NewHL7ControlId(),
+		DateTime:             time.Now(),
+	}
+	message := NewORU(header, order, observations, report)
+	if err := h.transport.Deliver(ctx, message); err != nil {
+		return fmt.Errorf("unable to deliver hl7 message %s: %w", message.ControlId(), err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package redox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/hl7"
+)
+
+// maxSettingsSize is the maximum size of the settings of a clinic in bytes
+const maxSettingsSize = 1 << 20
+
+// API manages the integration state which the worker keeps for clinics. The API must only be exposed to services
+// which are authenticated with a server token.
+type API struct {
+	mux       *http.ServeMux
+	settings  ClinicSettingsStore
+	timelines OrderStatusReader
+	queries   QueryResponseStore
+	contacts  PatientContactStore
+	hl7       hl7.Config
+	logger    *zap.SugaredLogger
+}
+
+var _ http.Handler = &API{}
+
+func NewAPI(settings ClinicSettingsStore, timelines OrderStatusReader, queries QueryResponseStore, contacts PatientContactStore, hl7Config hl7.Config, logger *zap.SugaredLogger) *API {
+	api := &API{
+		mux:       http.NewServeMux(),
+		settings:  settings,
+		timelines: timelines,
+		queries:   queries,
+		contacts:  contacts,
+		hl7:       hl7Config,
+		logger:    logger,
+	}
+	api.mux.HandleFunc("GET /v1/redox/clinics/{clinicId}/settings", api.getClinicSettings)
+	api.mux.HandleFunc("PUT /v1/redox/clinics/{clinicId}/settings", api.putClinicSettings)
+	api.mux.HandleFunc("GET /v1/redox/documents/{documentId}/timeline", api.getDocumentTimeline)
+	api.mux.HandleFunc("GET /v1/redox/queries/{queryId}/response", api.getQueryResponse)
+	api.mux.HandleFunc("GET /v1/redox/clinics/{clinicId}/patients/{patientId}/contact", api.getPatientContact)
+	return api
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *API) getClinicSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := a.settings.GetClinicSettings(r.Context(), r.PathValue("clinicId"))
+	if err != nil {
+		a.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	a.writeJSON(w, http.StatusOK, settings)
+}
+
+func (a *API) putClinicSettings(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSettingsSize))
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	settings, err := ParseClinicSettings(body)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := settings.HL7v2.Validate(a.hl7.Destinations); err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	clinicId := r.PathValue("clinicId")
+	if err := a.settings.SetClinicSettings(r.Context(), clinicId, settings); err != nil {
+		a.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	a.logger.Infow("updated clinic settings", "clinicId", clinicId)
+	a.writeJSON(w, http.StatusOK, settings)
+}
+
+func (a *API) getDocumentTimeline(w http.ResponseWriter, r *http.Request) {
+	timeline, err := a.timelines.GetTimeline(r.Context(), r.PathValue("documentId"))
+	if err != nil {
+		a.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	a.writeJSON(w, http.StatusOK, timeline)
+}
+
+// getQueryResponse returns the response to the stored query message or not found if the query wasn't processed yet
+func (a *API) getQueryResponse(w http.ResponseWriter, r *http.Request) {
+	queryId, err := primitive.ObjectIDFromHex(r.PathValue("queryId"))
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid query id: %w", err))
+		return
+	}
+	response, err := a.queries.Get(r.Context(), queryId)
+	if err != nil {
+		a.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if response == nil {
+		a.writeError(w, http.StatusNotFound, errors.New("the query wasn't processed yet"))
+		return
+	}
+	a.writeJSON(w, http.StatusOK, response)
+}
+
+// getPatientContact returns the phone number and the guardian which were stored when the account of the patient was
+// created from an order
+func (a *API) getPatientContact(w http.ResponseWriter, r *http.Request) {
+	contact, err := a.contacts.Get(r.Context(), r.PathValue("clinicId"), r.PathValue("patientId"))
+	if err != nil {
+		a.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if contact == nil {
+		a.writeError(w, http.StatusNotFound, errors.New("the patient doesn't have a stored contact"))
+		return
+	}
+	a.writeJSON(w, http.StatusOK, contact)
+}
+
+type apiError struct {
+	Message string `json:"message"`
+}
+
+func (a *API) writeError(w http.ResponseWriter, statusCode int, err error) {
+	if statusCode >= http.StatusInternalServerError {
+		a.logger.Errorw("unable to handle api request", zap.Error(err))
+	}
+	a.writeJSON(w, statusCode, apiError{Message: err.Error()})
+}
+
+func (a *API) writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		a.logger.Warnw("unable to encode api response", zap.Error(err))
+	}
+}
@@ -2,25 +2,23 @@ package redox
 
 import (
 	"context"
-	"crypto/rsa"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-resty/resty/v2"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/clinic-worker/smart"
+	clinics "github.com/tidepool-org/clinic/client"
 	"go.uber.org/zap"
 	"io"
+	"slices"
 	"sync"
 	"time"
 )
 
-const (
-	// The period of time before the token expiration when we should refresh it
-	expirationDelta  = 1 * time.Minute
-	redoxBlobUrl     = "https://blob.redoxengine.com/upload"
-	redoxEndpointUrl = "https://api.redoxengine.com/endpoint"
-	redoxTokenUrl    = "https://api.redoxengine.com/v2/auth/token"
-)
+// ErrAssertionRejected is returned when the token endpoint rejects the signed assertion, e.g. because the key
+// was revoked or isn't registered yet
+var ErrAssertionRejected = smart.ErrAssertionRejected
 
 type Client interface {
 	GetSource() (source struct {
@@ -30,33 +28,84 @@ type Client interface {
 	Send(ctx context.Context, payload interface{}) error
 	IsUploadFileEnabled() bool
 	UploadFile(ctx context.Context, fileName string, reader io.Reader) (*UploadResult, error)
+	// ForClinic returns the client of the Redox source selected by the EHR settings of the clinic, or the default
+	// client with a warning if the clinic doesn't have dedicated credentials
+	ForClinic(settings clinics.EhrSettingsV1) Client
+	// Health reports the signing keys of all sources
+	Health() ClientHealth
 }
 
 type client struct {
 	config      ClientConfig
 	restyClient *resty.Client
 	logger      *zap.SugaredLogger
-	privateKey  *rsa.PrivateKey
+	keys        *keyRing
+
+	// sources are shared by the clients of all sources. The default client is keyed by an empty source id.
+	sources map[string]*client
+	// fallbacks are the source ids of clinics which were warned about using the default source
+	fallbacks *sync.Map
 
-	token *Token
-	mu    *sync.RWMutex
+	token *smart.Token
+	// lastKeyId is the id of the key which signed the assertion of the current token
+	lastKeyId string
+	mu        *sync.RWMutex
 }
 
 type ClientConfig struct {
-	ClientId          string `envconfig:"TIDEPOOL_REDOX_CLIENT_ID" required:"true"`
-	KeyId             string `envconfig:"TIDEPOOL_REDOX_KEY_ID" required:"true"`
-	PrivateKeyPem     string `envconfig:"TIDEPOOL_REDOX_PRIVATE_KEY" required:"true"`
-	SourceId          string `envconfig:"TIDEPOOL_REDOX_SOURCE_ID" required:"true"`
-	SourceName        string `envconfig:"TIDEPOOL_REDOX_SOURCE_NAME" required:"true"`
-	TestMode          bool   `envconfig:"TIDEPOOL_REDOX_TEST_MODE"`
-	UploadFileEnabled bool   `envconfig:"TIDEPOOL_REDOX_UPLOAD_FILE_ENABLED" default:"false"`
+	ClientId string `envconfig:"TIDEPOOL_REDOX_CLIENT_ID" required:"true"`
+	// KeyId and PrivateKeyPem are a single key without an activation window. They are ignored if KeysFile is set.
+	KeyId         string `envconfig:"TIDEPOOL_REDOX_KEY_ID"`
+	PrivateKeyPem string `envconfig:"TIDEPOOL_REDOX_PRIVATE_KEY"`
+	// KeysFile is a JSON file with the signing keys and their activation windows
+	KeysFile           string        `envconfig:"TIDEPOOL_REDOX_KEYS_FILE"`
+	KeysReloadInterval time.Duration `envconfig:"TIDEPOOL_REDOX_KEYS_RELOAD_INTERVAL" default:"1m"`
+	SourceId           string        `envconfig:"TIDEPOOL_REDOX_SOURCE_ID" required:"true"`
+	SourceName         string        `envconfig:"TIDEPOOL_REDOX_SOURCE_NAME" required:"true"`
+	TestMode           bool          `envconfig:"TIDEPOOL_REDOX_TEST_MODE"`
+	UploadFileEnabled  bool          `envconfig:"TIDEPOOL_REDOX_UPLOAD_FILE_ENABLED" default:"false"`
+	BlobUrl            string        `envconfig:"TIDEPOOL_REDOX_BLOB_URL" default:"https://blob.redoxengine.com/upload"`
+	EndpointUrl        string        `envconfig:"TIDEPOOL_REDOX_ENDPOINT_URL" default:"https://api.redoxengine.com/endpoint"`
+	TokenUrl           string        `envconfig:"TIDEPOOL_REDOX_TOKEN_URL" default:"https://api.redoxengine.com/v2/auth/token"`
+	// Sources are the credentials of dedicated Redox sources keyed by the source id in the EHR settings of clinics
+	Sources SourceCredentialsMap `envconfig:"TIDEPOOL_REDOX_SOURCES"`
+}
+
+// SourceCredentials are the credentials of a dedicated Redox source
+type SourceCredentials struct {
+	ClientId      string `json:"clientId"`
+	KeyId         string `json:"keyId"`
+	PrivateKeyPem string `json:"privateKey"`
+	KeysFile      string `json:"keysFile"`
+	SourceId      string `json:"sourceId"`
+	SourceName    string `json:"sourceName"`
+}
+
+func (s SourceCredentials) Validate() error {
+	if s.ClientId == "" || s.SourceId == "" || s.SourceName == "" {
+		return fmt.Errorf("client id, source id and source name are required")
+	}
+	if s.KeysFile == "" && (s.KeyId == "" || s.PrivateKeyPem == "") {
+		return fmt.Errorf("either a keys file or a key id and a private key are required")
+	}
+	return nil
+}
+
+// SourceCredentialsMap is decoded from a JSON object
+type SourceCredentialsMap map[string]SourceCredentials
+
+func (s *SourceCredentialsMap) Decode(value string) error {
+	return json.Unmarshal([]byte(value), (*map[string]SourceCredentials)(s))
 }
 
 func NewClient(config ModuleConfig, logger *zap.SugaredLogger) (Client, error) {
 	client := &client{
-		logger: logger,
-		mu:     &sync.RWMutex{},
+		logger:    logger,
+		sources:   map[string]*client{},
+		fallbacks: &sync.Map{},
+		mu:        &sync.RWMutex{},
 	}
+	client.sources[""] = client
 
 	if config.Enabled {
 		config := ClientConfig{}
@@ -67,15 +116,72 @@ func NewClient(config ModuleConfig, logger *zap.SugaredLogger) (Client, error) {
 
 		client.restyClient = resty.New()
 		client.config = config
-		client.privateKey, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(config.PrivateKeyPem))
+		client.keys, err = newKeyRing(config.KeyId, config.PrivateKeyPem, config.KeysFile, config.KeysReloadInterval, logger)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("unable to load redox signing keys: %w", err)
+		}
+
+		for clinicSourceId, credentials := range config.Sources {
+			if err := client.addSource(clinicSourceId, credentials); err != nil {
+				return nil, err
+			}
 		}
 	}
 
 	return client, nil
 }
 
+// addSource adds a client with the credentials of the source. Each client keeps its own token.
+func (c *client) addSource(clinicSourceId string, credentials SourceCredentials) error {
+	if clinicSourceId == "" {
+		return fmt.Errorf("the source id of redox source credentials is required")
+	}
+	if err := credentials.Validate(); err != nil {
+		return fmt.Errorf("invalid credentials of redox source %s: %w", clinicSourceId, err)
+	}
+	logger := c.logger.With("redoxSourceId", credentials.SourceId)
+	keys, err := newKeyRing(credentials.KeyId, credentials.PrivateKeyPem, credentials.KeysFile, c.config.KeysReloadInterval, logger)
+	if err != nil {
+		return fmt.Errorf("invalid signing keys of redox source %s: %w", clinicSourceId, err)
+	}
+
+	config := c.config
+	config.ClientId = credentials.ClientId
+	config.KeyId = credentials.KeyId
+	config.PrivateKeyPem = credentials.PrivateKeyPem
+	config.KeysFile = credentials.KeysFile
+	config.SourceId = credentials.SourceId
+	config.SourceName = credentials.SourceName
+	config.Sources = nil
+
+	c.sources[clinicSourceId] = &client{
+		config:      config,
+		restyClient: c.restyClient,
+		logger:      logger,
+		keys:        keys,
+		sources:     c.sources,
+		fallbacks:   c.fallbacks,
+		mu:          &sync.RWMutex{},
+	}
+	return nil
+}
+
+func (c *client) ForClinic(settings clinics.EhrSettingsV1) Client {
+	if source, ok := c.sources[settings.SourceId]; ok {
+		return source
+	}
+
+	// Clinics without dedicated credentials use the default source. Warn about it once per source when dedicated
+	// sources are configured, because the credentials of a clinic which requires a dedicated source may be missing.
+	defaultClient := c.sources[""]
+	if len(c.sources) > 1 {
+		if _, warned := c.fallbacks.LoadOrStore(settings.SourceId, true); !warned {
+			defaultClient.logger.Warnw("no dedicated credentials for the redox source of the clinic, using the default source", "clinicSourceId", settings.SourceId)
+		}
+	}
+	return defaultClient
+}
+
 func (c *client) GetSource() (source struct {
 	ID   *string `json:"ID"`
 	Name *string `json:"Name"`
@@ -96,7 +202,7 @@ func (c *client) Send(ctx context.Context, payload interface{}) error {
 		SetBody(payload).
 		SetHeader("Content-Type", "application/json").
 		SetError(httpErr).
-		Post(redoxEndpointUrl)
+		Post(c.config.EndpointUrl)
 
 	if err != nil {
 		return fmt.Errorf("error sending payload to redox: %w", err)
@@ -127,7 +233,7 @@ func (c *client) UploadFile(ctx context.Context, fileName string, reader io.Read
 		SetFileReader("file", fileName, reader).
 		SetResult(uploadResult).
 		SetError(httpErr).
-		Post(redoxBlobUrl)
+		Post(c.config.BlobUrl)
 
 	if err != nil {
 		return nil, fmt.Errorf("error uploading redox: %w", err)
@@ -157,99 +263,116 @@ func (c *client) getRequestWithFreshToken(ctx context.Context) (*resty.Request,
 func (c *client) shouldRefreshToken() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.token == nil || c.token.IsExpired(expirationDelta)
+	return c.token == nil || c.token.IsExpired(smart.ExpirationDelta)
 }
 
+// obtainFreshToken requests a token with the most recently activated key and falls back to the other active keys
+// if the assertion is rejected
 func (c *client) obtainFreshToken(ctx context.Context) error {
-	assertion, err := c.getSignedAssertion()
-	if err != nil {
-		return err
+	keys := c.keys.Active(time.Now())
+	if len(keys) == 0 {
+		return ErrNoActiveSigningKey
 	}
 
-	token := &Token{}
-	authErr := &AuthError{}
-
-	data := map[string]string{
-		"grant_type":            "client_credentials",
-		"client_assertion_type": "urn:ietf:params:oauth:client-assertion-type:jwt-bearer",
-		"client_assertion":      assertion,
-	}
+	var errs []error
+	for _, key := range keys {
+		token, err := c.requestToken(ctx, key)
+		if errors.Is(err, ErrAssertionRejected) {
+			c.logger.Warnw("the token endpoint rejected the assertion, trying the next key", "keyId", key.KeyId, zap.Error(err))
+			errs = append(errs, err)
+			continue
+		} else if err != nil {
+			return err
+		}
 
-	c.logger.Debugw("obtaining a fresh token from redox")
+		c.mu.Lock()
+		defer c.mu.Unlock()
 
-	resp, err := c.getRequest(ctx).
-		SetFormData(data).
-		SetResult(token).
-		SetError(authErr).
-		Post(redoxTokenUrl)
+		c.token = token
+		c.lastKeyId = key.KeyId
 
-	if err != nil {
-		return fmt.Errorf("error obtaining token: %w", err)
-	}
-	if resp.IsError() {
-		return fmt.Errorf("error response when obtaining token: %w", authErr)
+		c.logger.Debugw("successfully obtained a fresh token from redox", "keyId", key.KeyId)
+		return nil
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	token.SetExpirationTime()
-	c.token = token
-
-	c.logger.Debugw("successfully obtained a fresh token from redox")
-	return nil
+	return fmt.Errorf("unable to obtain token with any of the active keys: %w", errors.Join(errs...))
 }
 
-func (c *client) getSignedAssertion() (string, error) {
-	now := time.Now()
-	nonce, err := uuid.NewRandom()
+func (c *client) requestToken(ctx context.Context, key SigningKey) (*smart.Token, error) {
+	assertion, err := smart.Assertion{
+		ClientId:   c.config.ClientId,
+		KeyId:      key.KeyId,
+		PrivateKey: key.PrivateKey,
+	}.Sign()
 	if err != nil {
-		return "", err
-	}
-
-	assertion := jwt.New(jwt.SigningMethodRS384)
-	assertion.Header = map[string]interface{}{
-		"alg": "RS384",
-		"kid": c.config.KeyId,
-		"typ": "JWT",
-	}
-	assertion.Claims = jwt.MapClaims{
-		"iss": c.config.ClientId,
-		"sub": c.config.ClientId,
-		"iat": now.Unix(),
-		"exp": now.Add(time.Minute * 5).Unix(),
-		"jti": nonce.String(),
+		return nil, err
 	}
 
-	return assertion.SignedString(c.privateKey)
+	c.logger.Debugw("obtaining a fresh token from redox", "keyId", key.KeyId)
+	return smart.RequestToken(ctx, c.restyClient, c.config.TokenUrl, assertion, "")
 }
 
-type Token struct {
-	AccessToken    string `json:"access_token"`
-	ExpiresIn      int    `json:"expires_in"`
-	ExpirationTime time.Time
+// ClientHealth reports the signing keys of all sources
+type ClientHealth struct {
+	Sources []SourceHealth `json:"sources"`
 }
 
-func (c *Token) SetExpirationTime() {
-	c.ExpirationTime = time.Now().Add(time.Duration(c.ExpiresIn) * time.Second)
+// IsHealthy returns true if all sources have an active signing key
+func (c ClientHealth) IsHealthy() bool {
+	for _, source := range c.Sources {
+		if !source.HasActiveKey() {
+			return false
+		}
+	}
+	return true
 }
 
-func (c *Token) IsExpired(delta time.Duration) bool {
-	return time.Now().After(c.ExpirationTime.Add(-delta))
+// SourceHealth reports the signing keys of a source. The reason why the keys couldn't be reloaded is only logged,
+// because it contains the paths of the key files.
+type SourceHealth struct {
+	SourceId     string      `json:"sourceId"`
+	ReloadFailed bool        `json:"reloadFailed,omitempty"`
+	LastKeyId    string      `json:"lastKeyId,omitempty"`
+	Keys         []KeyHealth `json:"keys"`
 }
 
-type UploadResult struct {
-	URI string `json:"URI"`
+func (s SourceHealth) HasActiveKey() bool {
+	return slices.ContainsFunc(s.Keys, func(key KeyHealth) bool { return key.Active })
 }
 
-type AuthError struct {
-	Err              string `json:"error"`
-	ErrorDescription string `json:"error_description"`
-	ErrorUri         string `json:"error_uri"`
+func (c *client) Health() ClientHealth {
+	health := ClientHealth{Sources: []SourceHealth{}}
+	now := time.Now()
+
+	clinicSourceIds := make([]string, 0, len(c.sources))
+	for clinicSourceId := range c.sources {
+		clinicSourceIds = append(clinicSourceIds, clinicSourceId)
+	}
+	slices.Sort(clinicSourceIds)
+
+	for _, clinicSourceId := range clinicSourceIds {
+		source := c.sources[clinicSourceId]
+		if source.keys == nil {
+			continue
+		}
+
+		keys, err := source.keys.Health(now)
+		sourceHealth := SourceHealth{
+			SourceId:     source.config.SourceId,
+			ReloadFailed: err != nil,
+			Keys:         keys,
+		}
+		source.mu.RLock()
+		sourceHealth.LastKeyId = source.lastKeyId
+		source.mu.RUnlock()
+
+		health.Sources = append(health.Sources, sourceHealth)
+	}
+	return health
 }
 
-func (a AuthError) Error() string {
-	return fmt.Sprintf("%v: %v. URI: %v", a.Err, a.ErrorDescription, a.ErrorUri)
+type UploadResult struct {
+	URI string `json:"URI"`
 }
 
 type ErrorResponse struct {
@@ -0,0 +1,234 @@
+package redox_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+	clinics "github.com/tidepool-org/clinic/client"
+)
+
+var _ = Describe("Client", func() {
+	var privateKeyPem string
+
+	BeforeEach(func() {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).ToNot(HaveOccurred())
+		privateKeyPem = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}))
+
+		GinkgoT().Setenv("TIDEPOOL_REDOX_CLIENT_ID", "defaultClientId")
+		GinkgoT().Setenv("TIDEPOOL_REDOX_KEY_ID", "defaultKeyId")
+		GinkgoT().Setenv("TIDEPOOL_REDOX_PRIVATE_KEY", privateKeyPem)
+		GinkgoT().Setenv("TIDEPOOL_REDOX_SOURCE_ID", "defaultSourceId")
+		GinkgoT().Setenv("TIDEPOOL_REDOX_SOURCE_NAME", "defaultSourceName")
+	})
+
+	setSources := func(sources redox.SourceCredentialsMap) {
+		value, err := json.Marshal(sources)
+		Expect(err).ToNot(HaveOccurred())
+		GinkgoT().Setenv("TIDEPOOL_REDOX_SOURCES", string(value))
+	}
+
+	Describe("ForClinic", func() {
+		var client redox.Client
+
+		BeforeEach(func() {
+			setSources(redox.SourceCredentialsMap{
+				"clinicSourceId": {
+					ClientId:      "dedicatedClientId",
+					KeyId:         "dedicatedKeyId",
+					PrivateKeyPem: privateKeyPem,
+					SourceId:      "dedicatedSourceId",
+					SourceName:    "dedicatedSourceName",
+				},
+			})
+
+			var err error
+			client, err = redox.NewClient(redox.ModuleConfig{Enabled: true}, zap.NewNop().Sugar())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns the source of the clinic", func() {
+			source := client.ForClinic(clinics.EhrSettingsV1{SourceId: "clinicSourceId"}).GetSource()
+			Expect(*source.ID).To(Equal("dedicatedSourceId"))
+			Expect(*source.Name).To(Equal("dedicatedSourceName"))
+		})
+
+		It("returns the default source for clinics without dedicated credentials", func() {
+			source := client.ForClinic(clinics.EhrSettingsV1{SourceId: "otherSourceId"}).GetSource()
+			Expect(*source.ID).To(Equal("defaultSourceId"))
+		})
+
+		It("returns the source of another clinic from a clinic's client", func() {
+			dedicated := client.ForClinic(clinics.EhrSettingsV1{SourceId: "clinicSourceId"})
+			source := dedicated.ForClinic(clinics.EhrSettingsV1{}).GetSource()
+			Expect(*source.ID).To(Equal("defaultSourceId"))
+		})
+	})
+
+	It("returns an error if the credentials of a source are incomplete", func() {
+		setSources(redox.SourceCredentialsMap{
+			"clinicSourceId": {ClientId: "dedicatedClientId", PrivateKeyPem: privateKeyPem},
+		})
+
+		_, err := redox.NewClient(redox.ModuleConfig{Enabled: true}, zap.NewNop().Sugar())
+		Expect(err).To(MatchError(ContainSubstring("invalid credentials of redox source clinicSourceId")))
+	})
+
+	Describe("signing keys", func() {
+		type keyEntry struct {
+			KeyId      string     `json:"keyId"`
+			PrivateKey string     `json:"privateKey"`
+			NotBefore  *time.Time `json:"notBefore,omitempty"`
+			NotAfter   *time.Time `json:"notAfter,omitempty"`
+		}
+
+		var server *httptest.Server
+		var rejected []string
+		var signedWith []string
+		var keysFile string
+		var now time.Time
+
+		writeKeys := func(keys ...keyEntry) {
+			contents, err := json.Marshal(map[string]any{"keys": keys})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.WriteFile(keysFile, contents, 0600)).To(Succeed())
+		}
+
+		newClient := func() redox.Client {
+			client, err := redox.NewClient(redox.ModuleConfig{Enabled: true}, zap.NewNop().Sugar())
+			Expect(err).ToNot(HaveOccurred())
+			return client
+		}
+
+		timePtr := func(t time.Time) *time.Time {
+			return &t
+		}
+
+		BeforeEach(func() {
+			rejected = nil
+			signedWith = nil
+			now = time.Now()
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.ParseForm()).To(Succeed())
+				assertion, _, err := jwt.NewParser().ParseUnverified(r.Form.Get("client_assertion"), jwt.MapClaims{})
+				Expect(err).ToNot(HaveOccurred())
+
+				keyId := assertion.Header["kid"].(string)
+				signedWith = append(signedWith, keyId)
+				w.Header().Set("Content-Type", "application/json")
+				if slices.Contains(rejected, keyId) {
+					w.WriteHeader(http.StatusUnauthorized)
+					_, _ = fmt.Fprint(w, `{"error":"invalid_client","error_description":"unknown key"}`)
+					return
+				}
+				_, _ = fmt.Fprintf(w, `{"access_token":"token-%s","expires_in":3600}`, keyId)
+			})
+			mux.HandleFunc("/endpoint", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			server = httptest.NewServer(mux)
+			DeferCleanup(server.Close)
+
+			keysFile = filepath.Join(GinkgoT().TempDir(), "keys.json")
+			GinkgoT().Setenv("TIDEPOOL_REDOX_TOKEN_URL", server.URL+"/token")
+			GinkgoT().Setenv("TIDEPOOL_REDOX_ENDPOINT_URL", server.URL+"/endpoint")
+			GinkgoT().Setenv("TIDEPOOL_REDOX_KEYS_FILE", keysFile)
+			GinkgoT().Setenv("TIDEPOOL_REDOX_KEYS_RELOAD_INTERVAL", "1ns")
+
+			writeKeys(
+				keyEntry{KeyId: "previous", PrivateKey: privateKeyPem, NotBefore: timePtr(now.Add(-48 * time.Hour)), NotAfter: timePtr(now.Add(24 * time.Hour))},
+				keyEntry{KeyId: "current", PrivateKey: privateKeyPem, NotBefore: timePtr(now.Add(-time.Hour))},
+				keyEntry{KeyId: "next", PrivateKey: privateKeyPem, NotBefore: timePtr(now.Add(24 * time.Hour))},
+			)
+		})
+
+		It("signs the assertion with the most recently activated key", func() {
+			Expect(newClient().Send(context.Background(), map[string]string{})).To(Succeed())
+			Expect(signedWith).To(Equal([]string{"current"}))
+		})
+
+		It("falls back to the next key when the assertion is rejected", func() {
+			rejected = []string{"current"}
+			client := newClient()
+
+			Expect(client.Send(context.Background(), map[string]string{})).To(Succeed())
+			Expect(signedWith).To(Equal([]string{"current", "previous"}))
+			Expect(client.Health().Sources[0].LastKeyId).To(Equal("previous"))
+		})
+
+		It("returns an error when all active keys are rejected", func() {
+			rejected = []string{"current", "previous"}
+
+			err := newClient().Send(context.Background(), map[string]string{})
+			Expect(err).To(MatchError(redox.ErrAssertionRejected))
+		})
+
+		It("reloads the keys when the file changes", func() {
+			client := newClient()
+
+			writeKeys(keyEntry{KeyId: "rotated", PrivateKey: privateKeyPem})
+			modTime := now.Add(time.Minute)
+			Expect(os.Chtimes(keysFile, modTime, modTime)).To(Succeed())
+
+			Expect(client.Send(context.Background(), map[string]string{})).To(Succeed())
+			Expect(signedWith).To(Equal([]string{"rotated"}))
+		})
+
+		It("keeps the previous keys when the file is invalid", func() {
+			client := newClient()
+
+			Expect(os.WriteFile(keysFile, []byte("{"), 0600)).To(Succeed())
+			modTime := now.Add(time.Minute)
+			Expect(os.Chtimes(keysFile, modTime, modTime)).To(Succeed())
+
+			health := client.Health()
+			Expect(health.Sources[0].ReloadFailed).To(BeTrue())
+			Expect(health.Sources[0].Keys).To(HaveLen(3))
+		})
+
+		It("is healthy when all sources have an active key", func() {
+			Expect(newClient().Health().IsHealthy()).To(BeTrue())
+		})
+
+		It("is unhealthy when a source doesn't have an active key", func() {
+			writeKeys(keyEntry{KeyId: "next", PrivateKey: privateKeyPem, NotBefore: timePtr(now.Add(24 * time.Hour))})
+
+			Expect(newClient().Health().IsHealthy()).To(BeFalse())
+		})
+
+		It("reports the age and the expiry of the keys", func() {
+			keys := newClient().Health().Sources[0].Keys
+			Expect(keys).To(HaveLen(3))
+
+			Expect(keys[0].KeyId).To(Equal("previous"))
+			Expect(keys[0].Active).To(BeTrue())
+			Expect(keys[0].AgeSeconds).To(BeNumerically("~", 48*3600, 5))
+			Expect(*keys[0].ExpiresInSeconds).To(BeNumerically("~", 24*3600, 5))
+
+			Expect(keys[1].KeyId).To(Equal("current"))
+			Expect(keys[1].ExpiresInSeconds).To(BeNil())
+
+			Expect(keys[2].KeyId).To(Equal("next"))
+			Expect(keys[2].Active).To(BeFalse())
+		})
+	})
+})
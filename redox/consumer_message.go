@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/IBM/sarama"
+	"github.com/tidepool-org/clinic-worker/audit"
 	"github.com/tidepool-org/clinic-worker/cdc"
 	models "github.com/tidepool-org/clinic/redox_models"
 	"github.com/tidepool-org/go-common/events"
@@ -20,8 +21,10 @@ const (
 type MessageCDCConsumer struct {
 	logger *zap.SugaredLogger
 
-	config         ModuleConfig
-	orderProcessor NewOrderProcessor
+	config              ModuleConfig
+	orderProcessor      NewOrderProcessor
+	schedulingProcessor SchedulingProcessor
+	queryProcessor      QueryProcessor
 }
 
 type MessageCDCConsumerParams struct {
@@ -29,8 +32,10 @@ type MessageCDCConsumerParams struct {
 
 	Logger *zap.SugaredLogger
 
-	Config         ModuleConfig
-	OrderProcessor NewOrderProcessor
+	Config              ModuleConfig
+	OrderProcessor      NewOrderProcessor
+	SchedulingProcessor SchedulingProcessor
+	QueryProcessor      QueryProcessor
 }
 
 func CreateRedoxMessageConsumerGroup(p MessageCDCConsumerParams) (events.EventConsumer, error) {
@@ -60,9 +65,11 @@ func NewRedoxMessageConsumer(p MessageCDCConsumerParams) events.ConsumerFactory
 
 func NewRedoxMessageCDCConsumer(p MessageCDCConsumerParams) (events.MessageConsumer, error) {
 	return &MessageCDCConsumer{
-		logger:         p.Logger,
-		config:         p.Config,
-		orderProcessor: p.OrderProcessor,
+		logger:              p.Logger,
+		config:              p.Config,
+		orderProcessor:      p.OrderProcessor,
+		schedulingProcessor: p.SchedulingProcessor,
+		queryProcessor:      p.QueryProcessor,
 	}, nil
 }
 
@@ -89,7 +96,8 @@ func (m *MessageCDCConsumer) handleMessage(cm *sarama.ConsumerMessage) error {
 		return err
 	}
 
-	if err := m.handleCDCEvent(event); err != nil {
+	ctx := audit.WithTrigger(context.Background(), audit.NewTrigger(cm))
+	if err := m.handleCDCEvent(ctx, event); err != nil {
 		m.logger.Errorw("unable to process cdc event", "offset", cm.Offset, zap.Error(err))
 		return err
 	}
@@ -101,7 +109,7 @@ func (m *MessageCDCConsumer) unmarshalEvent(value []byte, event *cdc.Event[model
 	return bson.UnmarshalExtJSON(value, true, event)
 }
 
-func (m *MessageCDCConsumer) handleCDCEvent(event cdc.Event[models.MessageEnvelope]) error {
+func (m *MessageCDCConsumer) handleCDCEvent(ctx context.Context, event cdc.Event[models.MessageEnvelope]) error {
 	if event.FullDocument == nil {
 		m.logger.Infow("skipping event with no full document", "offset", event.Offset)
 		return nil
@@ -112,30 +120,62 @@ func (m *MessageCDCConsumer) handleCDCEvent(event cdc.Event[models.MessageEnvelo
 		return nil
 	}
 
-	// We only expect orders for now
-	if event.FullDocument.Meta.DataModel != DataModelOrder {
+	switch event.FullDocument.Meta.DataModel {
+	case DataModelOrder:
+		return m.handleOrder(ctx, event)
+	case DataModelScheduling:
+		return m.handleScheduling(ctx, event)
+	case DataModelPatientSearch, DataModelFlowsheet:
+		if event.FullDocument.Meta.EventType != EventTypeQuery {
+			m.logger.Infow("unexpected query event type", "query", event.FullDocument.Meta, "offset", event.Offset)
+			return nil
+		}
+		return m.handleQuery(ctx, event)
+	default:
 		m.logger.Infow("unexpected data model", "order", event.FullDocument.Meta, "offset", event.Offset)
 		return nil
 	}
+}
 
+func (m *MessageCDCConsumer) handleOrder(ctx context.Context, event cdc.Event[models.MessageEnvelope]) error {
 	switch event.FullDocument.Meta.EventType {
 	case EventTypeNewOrder:
-		order := models.NewOrder{}
-		if err := bson.Unmarshal(event.FullDocument.Message, &order); err != nil {
-			m.logger.Errorw("unable to unmarshal order", "offset", event.Offset, zap.Error(err))
-			return err
-		}
-
-		m.logger.Debugw("successfully unmarshalled new order", "offset", event.Offset, "order", order.Meta)
-
-		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 
-		m.logger.Debugw("processing new order", "offset", event.Offset, "order", order.Meta)
-		return m.orderProcessor.ProcessOrder(ctx, *event.FullDocument, order)
+		m.logger.Debugw("processing new order", "offset", event.Offset, "order", event.FullDocument.Meta)
+		return m.orderProcessor.ProcessOrder(ctx, *event.FullDocument)
 	default:
 		m.logger.Infow("unexpected order event type", "order", event.FullDocument.Meta, "offset", event.Offset)
 	}
 
 	return nil
 }
+
+func (m *MessageCDCConsumer) handleScheduling(ctx context.Context, event cdc.Event[models.MessageEnvelope]) error {
+	message := SchedulingMessage{}
+	if err := bson.Unmarshal(event.FullDocument.Message, &message); err != nil {
+		m.logger.Errorw("unable to unmarshal scheduling message", "offset", event.Offset, zap.Error(err))
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	m.logger.Debugw("processing scheduling message", "offset", event.Offset, "scheduling", message.Meta)
+	return m.schedulingProcessor.ProcessScheduling(ctx, *event.FullDocument, message)
+}
+
+func (m *MessageCDCConsumer) handleQuery(ctx context.Context, event cdc.Event[models.MessageEnvelope]) error {
+	query := models.NewOrder{}
+	if err := bson.Unmarshal(event.FullDocument.Message, &query); err != nil {
+		m.logger.Errorw("unable to unmarshal query", "offset", event.Offset, zap.Error(err))
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	m.logger.Debugw("processing query", "offset", event.Offset, "query", query.Meta)
+	return m.queryProcessor.ProcessQuery(ctx, *event.FullDocument, query)
+}
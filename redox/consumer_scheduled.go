@@ -2,8 +2,10 @@ package redox
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/IBM/sarama"
+	"github.com/tidepool-org/clinic-worker/audit"
 	"github.com/tidepool-org/clinic-worker/cdc"
 	"github.com/tidepool-org/go-common/events"
 	"go.mongodb.org/mongo-driver/bson"
@@ -19,8 +21,9 @@ const (
 type ScheduledSummaryAndReportsCDCConsumer struct {
 	logger *zap.SugaredLogger
 
-	config    ModuleConfig
-	processor ScheduledSummaryAndReportProcessor
+	config         ModuleConfig
+	processor      ScheduledSummaryAndReportProcessor
+	clinicSettings ClinicSettingsProvider
 }
 
 type ScheduledSummaryAndReportsCDCConsumerParams struct {
@@ -28,8 +31,9 @@ type ScheduledSummaryAndReportsCDCConsumerParams struct {
 
 	Logger *zap.SugaredLogger
 
-	Config    ModuleConfig
-	Processor ScheduledSummaryAndReportProcessor
+	Config         ModuleConfig
+	Processor      ScheduledSummaryAndReportProcessor
+	ClinicSettings ClinicSettingsProvider
 }
 
 func CreateScheduledSummaryAndReportsConsumerGroup(p ScheduledSummaryAndReportsCDCConsumerParams) (events.EventConsumer, error) {
@@ -59,9 +63,10 @@ func NewScheduledSummaryAndReportsConsumer(p ScheduledSummaryAndReportsCDCConsum
 
 func NewScheduledSummaryAndReportsCDCConsumer(p ScheduledSummaryAndReportsCDCConsumerParams) (events.MessageConsumer, error) {
 	return &ScheduledSummaryAndReportsCDCConsumer{
-		logger:    p.Logger,
-		config:    p.Config,
-		processor: p.Processor,
+		logger:         p.Logger,
+		config:         p.Config,
+		processor:      p.Processor,
+		clinicSettings: p.ClinicSettings,
 	}, nil
 }
 
@@ -88,7 +93,8 @@ func (s *ScheduledSummaryAndReportsCDCConsumer) handleMessage(cm *sarama.Consume
 		return err
 	}
 
-	if err := s.handleCDCEvent(event); err != nil {
+	ctx := audit.WithTrigger(context.Background(), audit.NewTrigger(cm))
+	if err := s.handleCDCEvent(ctx, event); err != nil {
 		s.logger.Errorw("unable to process cdc event", "offset", cm.Offset, zap.Error(err))
 		return err
 	}
@@ -96,7 +102,7 @@ func (s *ScheduledSummaryAndReportsCDCConsumer) handleMessage(cm *sarama.Consume
 	return nil
 }
 
-func (s *ScheduledSummaryAndReportsCDCConsumer) handleCDCEvent(event cdc.Event[ScheduledSummaryAndReport]) error {
+func (s *ScheduledSummaryAndReportsCDCConsumer) handleCDCEvent(ctx context.Context, event cdc.Event[ScheduledSummaryAndReport]) error {
 	if event.FullDocument == nil {
 		s.logger.Errorw("skipping event with no full document", "offset", event.Offset)
 		return nil
@@ -116,17 +122,20 @@ func (s *ScheduledSummaryAndReportsCDCConsumer) handleCDCEvent(event cdc.Event[S
 
 	switch scheduled.LastMatchedOrder.Meta.EventType {
 	case EventTypeNewOrder:
-		if err := bson.Unmarshal(scheduled.LastMatchedOrder.Message, &scheduled.DecodedOrder); err != nil {
-			s.logger.Errorw("unable to unmarshal order", "offset", event.Offset, zap.Error(err))
-			return err
-		}
-
-		s.logger.Debugw("successfully unmarshalled new order", "offset", event.Offset, "order", scheduled.DecodedOrder.Meta)
-
-		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 		defer cancel()
 
-		s.logger.Debugw("processing new order", "offset", event.Offset, "order", scheduled.DecodedOrder.Meta)
+		// The reports of clinics scheduled by the worker are sent by the work item dispatcher
+		settings, err := s.clinicSettings.GetClinicSettings(ctx, scheduled.ClinicId.Hex())
+		if err != nil {
+			return fmt.Errorf("unable to get clinic settings: %w", err)
+		}
+		if settings.Schedule.Enabled {
+			s.logger.Infow("ignoring order scheduled by the clinic service for a clinic scheduled by the worker", "clinicId", scheduled.ClinicId.Hex(), "offset", event.Offset)
+			return nil
+		}
+
+		s.logger.Debugw("processing new order", "offset", event.Offset, "order", scheduled.LastMatchedOrder.Meta)
 		return s.processor.ProcessOrder(ctx, *scheduled)
 	default:
 		s.logger.Infow("unexpected order event type", "order", scheduled.LastMatchedOrder.Meta, "offset", event.Offset)
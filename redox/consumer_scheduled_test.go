@@ -32,9 +32,11 @@ var _ = Describe("Consumer Scheduled", func() {
 	Describe("Handle Kafka Message", func() {
 		var consumer events.MessageConsumer
 		var processor *redoxTest.ScheduledOrderProcessor
+		var clinicSettings *redoxTest.ClinicSettingsProvider
 
 		BeforeEach(func() {
 			processor = &redoxTest.ScheduledOrderProcessor{}
+			clinicSettings = &redoxTest.ClinicSettingsProvider{}
 
 			var err error
 			consumer, err = redox.NewScheduledSummaryAndReportsCDCConsumer(redox.ScheduledSummaryAndReportsCDCConsumerParams{
@@ -42,7 +44,8 @@ var _ = Describe("Consumer Scheduled", func() {
 				Config: redox.ModuleConfig{
 					Enabled: true,
 				},
-				Processor: processor,
+				Processor:      processor,
+				ClinicSettings: clinicSettings,
 			})
 			Expect(err).ToNot(HaveOccurred())
 		})
@@ -60,6 +63,18 @@ var _ = Describe("Consumer Scheduled", func() {
 			Expect(processor.Scheduled[0].Id).To(Equal(expectedId))
 		})
 
+		It("ignores orders of clinics scheduled by the worker", func() {
+			clinicSettings.Default = redox.ClinicSettings{Schedule: redox.ScheduleSettings{Enabled: true}}
+
+			message, err := test.LoadFixture("test/fixtures/scheduledorderevent.json")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(consumer.HandleKafkaMessage(&sarama.ConsumerMessage{
+				Value: message,
+			})).To(Succeed())
+			Expect(processor.Scheduled).To(BeEmpty())
+		})
+
 		It("skips messages with invalid metadata", func() {
 			message, err := test.LoadFixture("test/fixtures/invalidscheduledevent.json")
 			Expect(err).ToNot(HaveOccurred())
@@ -0,0 +1,343 @@
+package redox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+)
+
+const (
+	orderLedgerCollectionName = "redox_order_ledger"
+	// maxOrderTimelineEvents is the maximum number of status events which are kept for an order
+	maxOrderTimelineEvents = 200
+)
+
+type OrderStep string
+
+const (
+	OrderStepMatched        OrderStep = "matched"
+	OrderStepAccountCreated OrderStep = "accountCreated"
+	// OrderStepContactStored is completed when the phone number and the guardian of a new patient were stored
+	OrderStepContactStored OrderStep = "contactStored"
+	OrderStepResultsSent   OrderStep = "resultsSent"
+	OrderStepFlowsheetSent OrderStep = "flowsheetSent"
+	OrderStepNoteSent      OrderStep = "noteSent"
+	// OrderStepFallbackNoteSent is completed when a plain-text note was sent, because the report couldn't be generated
+	OrderStepFallbackNoteSent OrderStep = "fallbackNoteSent"
+	// OrderStepFinalNoteSent is completed when a note was sent, because the order ended the subscription of the patient
+	OrderStepFinalNoteSent OrderStep = "finalNoteSent"
+)
+
+// OrderKey identifies an order in the ledger. The same order can be sent multiple times with different procedure codes.
+type OrderKey struct {
+	OrderId       string `bson:"orderId"`
+	ProcedureCode string `bson:"procedureCode"`
+}
+
+// CompletedStep is a completed step of an order. Steps which track the delivery of a payload are completed for each
+// destination separately.
+type CompletedStep struct {
+	Step          OrderStep `bson:"step"`
+	DestinationId string    `bson:"destinationId,omitempty"`
+	Time          time.Time `bson:"time"`
+}
+
+type OrderLedgerEntry struct {
+	OrderKey      `bson:",inline"`
+	Steps         []CompletedStep    `bson:"steps"`
+	Failures      map[OrderStep]int  `bson:"failures,omitempty"`
+	ReportUpload  *ReportUpload      `bson:"reportUpload,omitempty"`
+	Timeline      []OrderStatusEvent `bson:"timeline,omitempty"`
+	CompletedTime *time.Time         `bson:"completedTime,omitempty"`
+	CreatedTime   time.Time          `bson:"createdTime"`
+	ModifiedTime  time.Time          `bson:"modifiedTime"`
+}
+
+// IsStepCompleted returns true if the step was completed for the destination. The destination is empty for steps which
+// don't track the delivery of a payload.
+func (e OrderLedgerEntry) IsStepCompleted(step OrderStep, destinationId string) bool {
+	return slices.ContainsFunc(e.Steps, func(completed CompletedStep) bool {
+		return completed.Step == step && completed.DestinationId == destinationId
+	})
+}
+
+// OrderLedger records the outcome of each step of the processing of an order, so reprocessing of the same order
+// can resume from the first incomplete step. It also keeps the status timeline of the documents of the order.
+type OrderLedger interface {
+	OrderStatusRecorder
+	OrderStatusReader
+
+	// GetEntry returns the entry of the order or nil if the order wasn't processed before
+	GetEntry(ctx context.Context, key OrderKey) (*OrderLedgerEntry, error)
+	// CompleteStep records the completion of the step for the destination. The destination is empty for steps which
+	// don't track the delivery of a payload.
+	CompleteStep(ctx context.Context, key OrderKey, step OrderStep, destinationId string) error
+	// RecordFailure increments the number of failures of the step and returns the total number of failures
+	RecordFailure(ctx context.Context, key OrderKey, step OrderStep) (int, error)
+	// RecordReportUpload keeps the upload of the report, so it can be referenced when the note is sent again
+	RecordReportUpload(ctx context.Context, key OrderKey, upload ReportUpload) error
+	CompleteOrder(ctx context.Context, key OrderKey) error
+}
+
+type MongoOrderLedger struct {
+	collection *mongo.Collection
+	retention  time.Duration
+}
+
+var _ OrderLedger = &MongoOrderLedger{}
+
+func NewOrderLedger(db *mongo.Database, config ModuleConfig, lifecycle fx.Lifecycle) OrderLedger {
+	ledger := &MongoOrderLedger{
+		collection: db.Collection(orderLedgerCollectionName),
+		retention:  config.OrderLedgerRetention,
+	}
+	if config.Enabled {
+		lifecycle.Append(fx.Hook{
+			OnStart: ledger.CreateIndexes,
+		})
+	}
+	return ledger
+}
+
+func (m *MongoOrderLedger) CreateIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "orderId", Value: 1}, {Key: "procedureCode", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "timeline.documentId", Value: 1}},
+		},
+		{
+			// Entries are removed after the retention period, unless the order was processed again in the meantime
+			Keys:    bson.D{{Key: "modifiedTime", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(m.retention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create order ledger indexes: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoOrderLedger) GetEntry(ctx context.Context, key OrderKey) (*OrderLedgerEntry, error) {
+	entry := &OrderLedgerEntry{}
+	err := m.collection.FindOne(ctx, key).Decode(entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get order ledger entry: %w", err)
+	}
+	return entry, nil
+}
+
+func (m *MongoOrderLedger) CompleteStep(ctx context.Context, key OrderKey, step OrderStep, destinationId string) error {
+	now := time.Now()
+	update := bson.M{
+		"$push":        bson.M{"steps": CompletedStep{Step: step, DestinationId: destinationId, Time: now}},
+		"$set":         bson.M{"modifiedTime": now},
+		"$setOnInsert": bson.M{"createdTime": now},
+	}
+	if _, err := m.collection.UpdateOne(ctx, key, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("unable to complete order step: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoOrderLedger) RecordFailure(ctx context.Context, key OrderKey, step OrderStep) (int, error) {
+	update := bson.M{
+		"$inc":         bson.M{fmt.Sprintf("failures.%s", step): 1},
+		"$set":         bson.M{"modifiedTime": time.Now()},
+		"$setOnInsert": bson.M{"createdTime": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	entry := &OrderLedgerEntry{}
+	if err := m.collection.FindOneAndUpdate(ctx, key, update, opts).Decode(entry); err != nil {
+		return 0, fmt.Errorf("unable to record order step failure: %w", err)
+	}
+	return entry.Failures[step], nil
+}
+
+func (m *MongoOrderLedger) RecordReportUpload(ctx context.Context, key OrderKey, upload ReportUpload) error {
+	return m.upsert(ctx, key, bson.M{
+		"reportUpload": upload,
+		"modifiedTime": time.Now(),
+	})
+}
+
+func (m *MongoOrderLedger) CompleteOrder(ctx context.Context, key OrderKey) error {
+	now := time.Now()
+	return m.upsert(ctx, key, bson.M{
+		"completedTime": now,
+		"modifiedTime":  now,
+	})
+}
+
+func (m *MongoOrderLedger) RecordStatus(ctx context.Context, event OrderStatusEvent) error {
+	if event.OrderId == "" {
+		return fmt.Errorf("unable to record status of document %s without order id", event.DocumentId)
+	}
+
+	key := OrderKey{OrderId: event.OrderId, ProcedureCode: event.ProcedureCode}
+	now := time.Now()
+	update := bson.M{
+		"$push": bson.M{"timeline": bson.M{
+			"$each":  []OrderStatusEvent{event},
+			"$slice": -maxOrderTimelineEvents,
+		}},
+		"$set":         bson.M{"modifiedTime": now},
+		"$setOnInsert": bson.M{"createdTime": now},
+	}
+	if _, err := m.collection.UpdateOne(ctx, key, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("unable to record order status: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoOrderLedger) GetTimeline(ctx context.Context, documentId string) ([]OrderStatusEvent, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{"timeline.documentId": documentId})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get order timeline: %w", err)
+	}
+
+	var entries []OrderLedgerEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("unable to decode order timeline: %w", err)
+	}
+	return GetDocumentTimeline(entries, documentId), nil
+}
+
+// GetDocumentTimeline returns the status events of the document from the ledger entries in chronological order
+func GetDocumentTimeline(entries []OrderLedgerEntry, documentId string) []OrderStatusEvent {
+	timeline := make([]OrderStatusEvent, 0)
+	for _, entry := range entries {
+		for _, event := range entry.Timeline {
+			if event.DocumentId == documentId {
+				timeline = append(timeline, event)
+			}
+		}
+	}
+	slices.SortStableFunc(timeline, func(a, b OrderStatusEvent) int {
+		return a.Time.Compare(b.Time)
+	})
+	return timeline
+}
+
+func (m *MongoOrderLedger) upsert(ctx context.Context, key OrderKey, set bson.M) error {
+	update := bson.M{
+		"$set":         set,
+		"$setOnInsert": bson.M{"createdTime": time.Now()},
+	}
+	if _, err := m.collection.UpdateOne(ctx, key, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("unable to update order ledger entry: %w", err)
+	}
+	return nil
+}
+
+// OrderProgress tracks the completed steps of the order which is being processed.
+// All methods are safe to call on a nil progress, which is used when the order can't be identified.
+type OrderProgress struct {
+	ledger OrderLedger
+	key    OrderKey
+	entry  OrderLedgerEntry
+}
+
+func NewOrderProgress(ctx context.Context, ledger OrderLedger, key OrderKey) (*OrderProgress, error) {
+	if key.OrderId == "" {
+		return nil, nil
+	}
+
+	entry, err := ledger.GetEntry(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		entry = &OrderLedgerEntry{OrderKey: key}
+	}
+	return &OrderProgress{
+		ledger: ledger,
+		key:    key,
+		entry:  *entry,
+	}, nil
+}
+
+func (p *OrderProgress) IsStepCompleted(step OrderStep) bool {
+	return p.IsDestinationStepCompleted(step, "")
+}
+
+// IsDestinationStepCompleted returns true if the payload of the step was delivered to the destination
+func (p *OrderProgress) IsDestinationStepCompleted(step OrderStep, destinationId string) bool {
+	return p != nil && p.entry.IsStepCompleted(step, destinationId)
+}
+
+func (p *OrderProgress) CompleteStep(ctx context.Context, step OrderStep) error {
+	return p.CompleteDestinationStep(ctx, step, "")
+}
+
+// CompleteDestinationStep records the delivery of the payload of the step to the destination
+func (p *OrderProgress) CompleteDestinationStep(ctx context.Context, step OrderStep, destinationId string) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.ledger.CompleteStep(ctx, p.key, step, destinationId); err != nil {
+		return err
+	}
+	p.entry.Steps = append(p.entry.Steps, CompletedStep{Step: step, DestinationId: destinationId, Time: time.Now()})
+	return nil
+}
+
+// RecordFailure returns the total number of failures of the step or zero if the order can't be identified
+func (p *OrderProgress) RecordFailure(ctx context.Context, step OrderStep) (int, error) {
+	if p == nil {
+		return 0, nil
+	}
+	return p.ledger.RecordFailure(ctx, p.key, step)
+}
+
+// GetReportUpload returns the report which was uploaded in a previous attempt or nil if there isn't one
+func (p *OrderProgress) GetReportUpload() *ReportUpload {
+	if p == nil {
+		return nil
+	}
+	return p.entry.ReportUpload
+}
+
+func (p *OrderProgress) RecordReportUpload(ctx context.Context, upload ReportUpload) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.ledger.RecordReportUpload(ctx, p.key, upload); err != nil {
+		return err
+	}
+	p.entry.ReportUpload = &upload
+	return nil
+}
+
+// IsReportPending returns true if a fallback note was sent instead of the report, and the report wasn't sent yet
+func (p *OrderProgress) IsReportPending() bool {
+	return p.IsStepCompleted(OrderStepFallbackNoteSent) && !p.IsStepCompleted(OrderStepNoteSent)
+}
+
+func (p *OrderProgress) IsCompleted() bool {
+	return p != nil && p.entry.CompletedTime != nil
+}
+
+func (p *OrderProgress) Complete(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.ledger.CompleteOrder(ctx, p.key); err != nil {
+		return err
+	}
+	now := time.Now()
+	p.entry.CompletedTime = &now
+	return nil
+}
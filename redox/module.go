@@ -6,6 +6,7 @@ import (
 	"github.com/avast/retry-go"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tidepool-org/clinic-worker/cdc"
+	"github.com/tidepool-org/clinic-worker/hl7"
 	"github.com/tidepool-org/clinic-worker/report"
 	"go.uber.org/fx"
 )
@@ -13,7 +14,25 @@ import (
 var Module = fx.Provide(
 	NewConfig,
 	NewClient,
+	NewEHRAdapter,
+	NewClinicSettingsStore,
+	NewClinicSettingsProvider,
+	NewAPI,
+	hl7.NewConfig,
+	NewOrderLedger,
+	NewOrderStatusRecorder,
+	NewOrderStatusReader,
+	NewReportFingerprintStore,
+	NewReportAttachments,
+	NewSubscriptionStore,
+	NewPatientContactStore,
+	NewQueryConfig,
+	NewQueryResponseStore,
+	NewWorkItemConfig,
+	NewWorkItemStore,
 	NewNewOrderProcessor,
+	NewSchedulingProcessor,
+	NewQueryProcessor,
 	NewScheduledSummaryAndReportProcessor,
 	report.NewReportGenerator,
 	fx.Annotated{
@@ -24,6 +43,14 @@ var Module = fx.Provide(
 		Group:  "consumers",
 		Target: CreateScheduledSummaryAndReportsConsumerGroup,
 	},
+	fx.Annotated{
+		Group:  "consumers",
+		Target: CreateScheduler,
+	},
+	fx.Annotated{
+		Group:  "consumers",
+		Target: CreateWorkItemDispatcher,
+	},
 )
 
 const (
@@ -38,6 +65,8 @@ var retryOptions = cdc.RetryOptions{
 
 type ModuleConfig struct {
 	Enabled bool `envconfig:"TIDEPOOL_REDOX_ENABLED" default:"false"`
+	// OrderLedgerRetention is the duration for which the processing state of an order is kept after its last update
+	OrderLedgerRetention time.Duration `envconfig:"TIDEPOOL_REDOX_ORDER_LEDGER_RETENTION" default:"2160h"`
 }
 
 func NewConfig() (ModuleConfig, error) {
@@ -0,0 +1,72 @@
+package redox
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	CodesetLOINC    = "LOINC"
+	CodesetTidepool = "Tidepool"
+)
+
+// standardObservationCodes maps Tidepool observation codes to LOINC codes as used by the HL7 CGM Implementation Guide.
+// Observations without a published LOINC code keep the Tidepool code.
+var standardObservationCodes = map[string]ObservationCode{
+	"TIME_IN_RANGE_CGM":              {Code: "97510-2", Codeset: CodesetLOINC},
+	"TIME_BELOW_RANGE_VERY_LOW_CGM":  {Code: "104643-2", Codeset: CodesetLOINC},
+	"TIME_BELOW_RANGE_LOW_CGM":       {Code: "104642-4", Codeset: CodesetLOINC},
+	"TIME_ABOVE_RANGE_HIGH_CGM":      {Code: "104640-8", Codeset: CodesetLOINC},
+	"TIME_ABOVE_RANGE_VERY_HIGH_CGM": {Code: "104639-0", Codeset: CodesetLOINC},
+	"GLUCOSE_MANAGEMENT_INDICATOR":   {Code: "97506-0", Codeset: CodesetLOINC},
+	"AVERAGE_CGM":                    {Code: "97507-8", Codeset: CodesetLOINC},
+}
+
+type ObservationCode struct {
+	Code    string `json:"code"`
+	Codeset string `json:"codeset,omitempty"`
+}
+
+type ObservationCodeSettings struct {
+	// UseStandardCodes replaces Tidepool codes with standard codes where one is defined and sets the codeset of all observations
+	UseStandardCodes bool `json:"useStandardCodes"`
+	// Overrides maps Tidepool observation codes to clinic specific codes and take precedence over standard codes
+	Overrides map[string]ObservationCode `json:"overrides,omitempty"`
+}
+
+// GetCode returns the code that should be used for the observation with the given Tidepool code.
+// Clinics which don't use standard codes and don't have overrides get the Tidepool code without a codeset.
+func (s ObservationCodeSettings) GetCode(code string) ObservationCode {
+	if override, ok := s.Overrides[code]; ok && override.Code != "" {
+		return override
+	}
+	if !s.UseStandardCodes {
+		return ObservationCode{Code: code}
+	}
+	if standard, ok := standardObservationCodes[code]; ok {
+		return standard
+	}
+	return ObservationCode{Code: code, Codeset: CodesetTidepool}
+}
+
+// GetObservationCode returns the code that should be used for the observation. Observations of periods other than the
+// default period have a distinct code for each period, e.g. TIME_IN_RANGE_CGM_7D, so flowsheet rows of different periods
+// don't overwrite each other. Standard codes don't distinguish periods, so clinics map these codes with overrides.
+func (s ObservationCodeSettings) GetObservationCode(o *Observation) ObservationCode {
+	if o.Period == "" {
+		return s.GetCode(o.Code)
+	}
+	code := GetPeriodCode(o.Code, o.Period)
+	if override, ok := s.Overrides[code]; ok && override.Code != "" {
+		return override
+	}
+	if !s.UseStandardCodes {
+		return ObservationCode{Code: code}
+	}
+	return ObservationCode{Code: code, Codeset: CodesetTidepool}
+}
+
+// GetPeriodCode returns the Tidepool code of an observation which is calculated over the period
+func GetPeriodCode(code string, period string) string {
+	return fmt.Sprintf("%s_%s", code, strings.ToUpper(period))
+}
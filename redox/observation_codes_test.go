@@ -0,0 +1,82 @@
+package redox_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+)
+
+var _ = Describe("ObservationCodeSettings", func() {
+	Describe("GetCode", func() {
+		It("returns the tidepool code without a codeset by default", func() {
+			settings := redox.ObservationCodeSettings{}
+			Expect(settings.GetCode("TIME_IN_RANGE_CGM")).To(Equal(redox.ObservationCode{Code: "TIME_IN_RANGE_CGM"}))
+		})
+
+		It("returns the loinc code when standard codes are used", func() {
+			settings := redox.ObservationCodeSettings{UseStandardCodes: true}
+			Expect(settings.GetCode("TIME_IN_RANGE_CGM")).To(Equal(redox.ObservationCode{Code: "97510-2", Codeset: redox.CodesetLOINC}))
+		})
+
+		It("returns the tidepool code and codeset when there is no standard code", func() {
+			settings := redox.ObservationCodeSettings{UseStandardCodes: true}
+			Expect(settings.GetCode("DAYS_WITH_DATA_CGM")).To(Equal(redox.ObservationCode{Code: "DAYS_WITH_DATA_CGM", Codeset: redox.CodesetTidepool}))
+		})
+
+		DescribeTable("returns the loinc code of time below and above range observations when standard codes are used",
+			func(code string, loinc string) {
+				settings := redox.ObservationCodeSettings{UseStandardCodes: true}
+				Expect(settings.GetCode(code)).To(Equal(redox.ObservationCode{Code: loinc, Codeset: redox.CodesetLOINC}))
+			},
+			Entry("TBR-VL", "TIME_BELOW_RANGE_VERY_LOW_CGM", "104643-2"),
+			Entry("TBR-L", "TIME_BELOW_RANGE_LOW_CGM", "104642-4"),
+			Entry("TAR-H", "TIME_ABOVE_RANGE_HIGH_CGM", "104640-8"),
+			Entry("TAR-VH", "TIME_ABOVE_RANGE_VERY_HIGH_CGM", "104639-0"),
+		)
+
+		It("returns the clinic override of time below and above range observations", func() {
+			settings := redox.ObservationCodeSettings{
+				UseStandardCodes: true,
+				Overrides: map[string]redox.ObservationCode{
+					"TIME_BELOW_RANGE_LOW_CGM": {Code: "5678", Codeset: redox.CodesetLOINC},
+				},
+			}
+			Expect(settings.GetCode("TIME_BELOW_RANGE_LOW_CGM")).To(Equal(redox.ObservationCode{Code: "5678", Codeset: redox.CodesetLOINC}))
+		})
+
+		It("returns the clinic override", func() {
+			settings := redox.ObservationCodeSettings{
+				UseStandardCodes: true,
+				Overrides: map[string]redox.ObservationCode{
+					"TIME_IN_RANGE_CGM": {Code: "1234"},
+				},
+			}
+			Expect(settings.GetCode("TIME_IN_RANGE_CGM")).To(Equal(redox.ObservationCode{Code: "1234"}))
+		})
+	})
+
+	Describe("GetObservationCode", func() {
+		It("returns the code of the observation of the default period", func() {
+			settings := redox.ObservationCodeSettings{UseStandardCodes: true}
+			Expect(settings.GetObservationCode(&redox.Observation{Code: "TIME_IN_RANGE_CGM"})).To(Equal(redox.ObservationCode{Code: "97510-2", Codeset: redox.CodesetLOINC}))
+		})
+
+		It("returns distinct codes for the observations of other periods", func() {
+			settings := redox.ObservationCodeSettings{UseStandardCodes: true}
+			Expect(settings.GetObservationCode(&redox.Observation{Code: "TIME_IN_RANGE_CGM", Period: "7d"})).To(Equal(redox.ObservationCode{Code: "TIME_IN_RANGE_CGM_7D", Codeset: redox.CodesetTidepool}))
+			Expect(settings.GetObservationCode(&redox.Observation{Code: "TIME_IN_RANGE_CGM", Period: "30d"})).To(Equal(redox.ObservationCode{Code: "TIME_IN_RANGE_CGM_30D", Codeset: redox.CodesetTidepool}))
+		})
+
+		It("returns the clinic override of the period", func() {
+			settings := redox.ObservationCodeSettings{
+				Overrides: map[string]redox.ObservationCode{
+					"TIME_IN_RANGE_CGM":    {Code: "1234"},
+					"TIME_IN_RANGE_CGM_7D": {Code: "1235"},
+				},
+			}
+			Expect(settings.GetObservationCode(&redox.Observation{Code: "TIME_IN_RANGE_CGM", Period: "7d"})).To(Equal(redox.ObservationCode{Code: "1235"}))
+			Expect(settings.GetObservationCode(&redox.Observation{Code: "TIME_IN_RANGE_CGM", Period: "30d"})).To(Equal(redox.ObservationCode{Code: "TIME_IN_RANGE_CGM_30D"}))
+		})
+	})
+})
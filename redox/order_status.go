@@ -0,0 +1,113 @@
+package redox
+
+import (
+	"context"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"go.uber.org/zap"
+)
+
+type OrderStatus string
+
+const (
+	OrderStatusReceived              OrderStatus = "RECEIVED"
+	OrderStatusMatched               OrderStatus = "MATCHED"
+	OrderStatusNoMatch               OrderStatus = "NO_MATCH"
+	OrderStatusMultipleMatches       OrderStatus = "MULTIPLE_MATCHES"
+	OrderStatusAccountCreated        OrderStatus = "ACCOUNT_CREATED"
+	OrderStatusAccountCreationFailed OrderStatus = "ACCOUNT_CREATION_FAILED"
+	OrderStatusReportsEnabled        OrderStatus = "REPORTS_ENABLED"
+	OrderStatusReportsDisabled       OrderStatus = "REPORTS_DISABLED"
+	OrderStatusFlowsheetSent         OrderStatus = "FLOWSHEET_SENT"
+	OrderStatusNoteSent              OrderStatus = "NOTE_SENT"
+	OrderStatusFallbackNoteSent      OrderStatus = "FALLBACK_NOTE_SENT"
+	OrderStatusFinalNoteSent         OrderStatus = "FINAL_NOTE_SENT"
+	OrderStatusReportSkipped         OrderStatus = "REPORT_SKIPPED"
+	OrderStatusReportCancelled       OrderStatus = "REPORT_CANCELLED"
+	OrderStatusDeliveryFailed        OrderStatus = "DELIVERY_FAILED"
+	OrderStatusError                 OrderStatus = "ERROR"
+)
+
+// OrderStatusEvent is a single entry in the status timeline of a Redox message document. The timeline is kept in
+// the order ledger entry of the order.
+type OrderStatusEvent struct {
+	DocumentId    string      `json:"documentId" bson:"documentId"`
+	OrderId       string      `json:"orderId,omitempty" bson:"orderId,omitempty"`
+	ProcedureCode string      `json:"procedureCode,omitempty" bson:"procedureCode,omitempty"`
+	ClinicId      *string     `json:"clinicId,omitempty" bson:"clinicId,omitempty"`
+	PatientId     *string     `json:"patientId,omitempty" bson:"patientId,omitempty"`
+	DestinationId string      `json:"destinationId,omitempty" bson:"destinationId,omitempty"`
+	Status        OrderStatus `json:"status" bson:"status"`
+	Code          ResultCode  `json:"code" bson:"code"`
+	Message       string      `json:"message,omitempty" bson:"message,omitempty"`
+	Time          time.Time   `json:"time" bson:"time"`
+}
+
+// NewOrderStatusErrorEvent returns an event with the result code and the message of the error
+func NewOrderStatusErrorEvent(status OrderStatus, err error) OrderStatusEvent {
+	return OrderStatusEvent{
+		Status:  status,
+		Code:    GetResultCode(err),
+		Message: err.Error(),
+	}
+}
+
+type OrderStatusRecorder interface {
+	RecordStatus(ctx context.Context, event OrderStatusEvent) error
+}
+
+type OrderStatusReader interface {
+	// GetTimeline returns the status timeline of the document in chronological order
+	GetTimeline(ctx context.Context, documentId string) ([]OrderStatusEvent, error)
+}
+
+// NewOrderStatusRecorder returns the recorder which keeps the status timeline of orders in the order ledger
+func NewOrderStatusRecorder(ledger OrderLedger) OrderStatusRecorder {
+	return ledger
+}
+
+func NewOrderStatusReader(ledger OrderLedger) OrderStatusReader {
+	return ledger
+}
+
+// OrderTimeline records the status changes of the order which is being processed. Recording is best-effort,
+// because the timeline is only informational and must not block the processing of orders. All methods are safe
+// to call on a nil timeline, which is used when summaries and reports are sent outside the processing of an order.
+type OrderTimeline struct {
+	recorder      OrderStatusRecorder
+	documentId    string
+	orderId       string
+	procedureCode string
+	logger        *zap.SugaredLogger
+}
+
+func NewOrderTimeline(recorder OrderStatusRecorder, documentId string, order ehr.Order, logger *zap.SugaredLogger) *OrderTimeline {
+	return &OrderTimeline{
+		recorder:      recorder,
+		documentId:    documentId,
+		orderId:       order.Id,
+		procedureCode: order.ProcedureCode,
+		logger:        logger,
+	}
+}
+
+func (t *OrderTimeline) Record(ctx context.Context, event OrderStatusEvent) {
+	if t == nil || t.documentId == "" {
+		return
+	}
+
+	event.DocumentId = t.documentId
+	event.OrderId = t.orderId
+	event.ProcedureCode = t.procedureCode
+	if event.Code == "" {
+		event.Code = ResultCodeSuccess
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	if err := t.recorder.RecordStatus(ctx, event); err != nil {
+		t.logger.Warnw("unable to record order status", "documentId", t.documentId, "status", event.Status, "error", err)
+	}
+}
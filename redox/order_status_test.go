@@ -0,0 +1,79 @@
+package redox_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"github.com/tidepool-org/clinic-worker/hl7"
+	"github.com/tidepool-org/clinic-worker/redox"
+	testRedox "github.com/tidepool-org/clinic-worker/redox/test"
+)
+
+var _ = Describe("OrderTimeline", func() {
+	var ledger *testRedox.OrderLedger
+	var order ehr.Order
+
+	BeforeEach(func() {
+		ledger = testRedox.NewOrderLedger()
+		order = ehr.Order{Id: "order", ProcedureCode: "SUMMARY_AND_REPORTS"}
+	})
+
+	It("keeps the status timeline of the document in the order ledger", func() {
+		timeline := redox.NewOrderTimeline(redox.NewOrderStatusRecorder(ledger), "document", order, zap.NewNop().Sugar())
+		timeline.Record(context.Background(), redox.OrderStatusEvent{Status: redox.OrderStatusReceived})
+		timeline.Record(context.Background(), redox.OrderStatusEvent{Status: redox.OrderStatusMatched})
+
+		key := redox.OrderKey{OrderId: "order", ProcedureCode: "SUMMARY_AND_REPORTS"}
+		Expect(ledger.Entries).To(HaveKey(key))
+		Expect(ledger.Entries[key].Timeline).To(HaveLen(2))
+		Expect(ledger.Entries[key].Timeline[1]).To(MatchFields(IgnoreExtras, Fields{
+			"DocumentId": Equal("document"),
+			"OrderId":    Equal("order"),
+			"Status":     Equal(redox.OrderStatusMatched),
+			"Code":       Equal(redox.ResultCodeSuccess),
+		}))
+	})
+
+	It("returns the events of the document in chronological order", func() {
+		now := time.Now()
+		entries := []redox.OrderLedgerEntry{{
+			Timeline: []redox.OrderStatusEvent{
+				{DocumentId: "resent", Status: redox.OrderStatusReceived, Time: now},
+				{DocumentId: "document", Status: redox.OrderStatusNoteSent, Time: now.Add(-time.Minute)},
+				{DocumentId: "document", Status: redox.OrderStatusReceived, Time: now.Add(-time.Hour)},
+			},
+		}}
+		Expect(redox.GetDocumentTimeline(entries, "document")).To(HaveExactElements(
+			HaveField("Status", redox.OrderStatusReceived),
+			HaveField("Status", redox.OrderStatusNoteSent),
+		))
+	})
+
+	It("returns the timeline of a document from the api", func() {
+		timeline := redox.NewOrderTimeline(redox.NewOrderStatusRecorder(ledger), "document", order, zap.NewNop().Sugar())
+		timeline.Record(context.Background(), redox.OrderStatusEvent{Status: redox.OrderStatusReceived})
+
+		api := redox.NewAPI(&testRedox.ClinicSettingsProvider{}, redox.NewOrderStatusReader(ledger), testRedox.NewQueryResponseStore(), &testRedox.PatientContactStore{}, hl7.Config{}, zap.NewNop().Sugar())
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/redox/documents/document/timeline", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		var events []redox.OrderStatusEvent
+		Expect(json.Unmarshal(rec.Body.Bytes(), &events)).To(Succeed())
+		Expect(events).To(HaveExactElements(HaveField("Status", redox.OrderStatusReceived)))
+
+		rec = httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/redox/documents/unknown/timeline", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchJSON("[]"))
+	})
+})
@@ -0,0 +1,145 @@
+package redox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+)
+
+const (
+	patientContactsCollectionName = "redox_patient_contacts"
+)
+
+// PatientContact keeps the contact details of a patient which are not part of the patient record of the clinic
+// service. The guardian is stored separately from the email address of the patient account. Contacts are read with
+// the worker API.
+type PatientContact struct {
+	ClinicId     string           `json:"clinicId" bson:"clinicId"`
+	PatientId    string           `json:"patientId" bson:"patientId"`
+	PhoneNumber  string           `json:"phoneNumber,omitempty" bson:"phoneNumber,omitempty"`
+	Guardian     *GuardianContact `json:"guardian,omitempty" bson:"guardian,omitempty"`
+	CreatedTime  time.Time        `json:"createdTime" bson:"createdTime"`
+	ModifiedTime time.Time        `json:"modifiedTime" bson:"modifiedTime"`
+}
+
+type GuardianContact struct {
+	Name              string `json:"name,omitempty" bson:"name,omitempty"`
+	RelationToPatient string `json:"relationToPatient,omitempty" bson:"relationToPatient,omitempty"`
+	Email             string `json:"email,omitempty" bson:"email,omitempty"`
+	PhoneNumber       string `json:"phoneNumber,omitempty" bson:"phoneNumber,omitempty"`
+}
+
+// NewGuardianContact returns the contact of the guarantor with the first valid email address and the preferred phone number
+func NewGuardianContact(guarantor ehr.Guarantor, emailAddresses []string, phoneNumberTypes []string) GuardianContact {
+	contact := GuardianContact{
+		Name:              guarantor.GetFullName(),
+		RelationToPatient: guarantor.RelationToPatient,
+	}
+	for _, address := range emailAddresses {
+		if parsed, err := mail.ParseAddress(address); err == nil {
+			contact.Email = parsed.Address
+			break
+		}
+	}
+	if len(phoneNumberTypes) == 0 {
+		phoneNumberTypes = []string{ehr.PhoneNumberTypeMobile, ehr.PhoneNumberTypeHome, ehr.PhoneNumberTypeWork}
+	}
+	contact.PhoneNumber = ehr.GetPhoneNumber(guarantor.PhoneNumbers, phoneNumberTypes)
+	return contact
+}
+
+func (g GuardianContact) IsEmpty() bool {
+	return g.Name == "" && g.Email == "" && g.PhoneNumber == ""
+}
+
+// String returns the non-empty fields of the contact separated by semicolons
+func (g GuardianContact) String() string {
+	var fields []string
+	for _, field := range []string{g.Name, g.RelationToPatient, g.Email, g.PhoneNumber} {
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return strings.Join(fields, "; ")
+}
+
+type PatientContactStore interface {
+	// Upsert creates the contact or replaces the phone number and guardian of an existing one
+	Upsert(ctx context.Context, contact PatientContact) error
+	Get(ctx context.Context, clinicId string, patientId string) (*PatientContact, error)
+}
+
+type MongoPatientContactStore struct {
+	collection *mongo.Collection
+}
+
+var _ PatientContactStore = &MongoPatientContactStore{}
+
+func NewPatientContactStore(db *mongo.Database, config ModuleConfig, lifecycle fx.Lifecycle) PatientContactStore {
+	store := &MongoPatientContactStore{
+		collection: db.Collection(patientContactsCollectionName),
+	}
+	if config.Enabled {
+		lifecycle.Append(fx.Hook{
+			OnStart: store.CreateIndexes,
+		})
+	}
+	return store
+}
+
+func (m *MongoPatientContactStore) CreateIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "clinicId", Value: 1}, {Key: "patientId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create patient contact indexes: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoPatientContactStore) Upsert(ctx context.Context, contact PatientContact) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"phoneNumber":  contact.PhoneNumber,
+			"guardian":     contact.Guardian,
+			"modifiedTime": now,
+		},
+		"$setOnInsert": bson.M{"createdTime": now},
+	}
+	_, err := m.collection.UpdateOne(ctx, patientContactFilter(contact.ClinicId, contact.PatientId), update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("unable to upsert patient contact: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoPatientContactStore) Get(ctx context.Context, clinicId string, patientId string) (*PatientContact, error) {
+	contact := &PatientContact{}
+	err := m.collection.FindOne(ctx, patientContactFilter(clinicId, patientId)).Decode(contact)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get patient contact: %w", err)
+	}
+	return contact, nil
+}
+
+func patientContactFilter(clinicId string, patientId string) bson.M {
+	return bson.M{
+		"clinicId":  clinicId,
+		"patientId": patientId,
+	}
+}
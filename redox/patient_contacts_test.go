@@ -0,0 +1,53 @@
+package redox_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/hl7"
+	"github.com/tidepool-org/clinic-worker/redox"
+	testRedox "github.com/tidepool-org/clinic-worker/redox/test"
+)
+
+var _ = Describe("PatientContact API", func() {
+	var contacts *testRedox.PatientContactStore
+	var api *redox.API
+
+	BeforeEach(func() {
+		contacts = &testRedox.PatientContactStore{}
+		api = redox.NewAPI(&testRedox.ClinicSettingsProvider{}, testRedox.NewOrderLedger(), testRedox.NewQueryResponseStore(), contacts, hl7.Config{}, zap.NewNop().Sugar())
+	})
+
+	get := func(clinicId, patientId string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/redox/clinics/"+clinicId+"/patients/"+patientId+"/contact", nil))
+		return recorder
+	}
+
+	It("returns the stored contact of the patient", func() {
+		Expect(contacts.Upsert(context.Background(), redox.PatientContact{
+			ClinicId:    "clinic-1",
+			PatientId:   "patient-1",
+			PhoneNumber: "+18088675301",
+			Guardian:    &redox.GuardianContact{Name: "Kent Bixby", RelationToPatient: "Father"},
+		})).To(Succeed())
+
+		recorder := get("clinic-1", "patient-1")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+
+		contact := redox.PatientContact{}
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &contact)).To(Succeed())
+		Expect(contact.PhoneNumber).To(Equal("+18088675301"))
+		Expect(contact.Guardian).To(HaveValue(Equal(redox.GuardianContact{Name: "Kent Bixby", RelationToPatient: "Father"})))
+	})
+
+	It("returns not found if the patient doesn't have a stored contact", func() {
+		Expect(get("clinic-1", "patient-2").Code).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,175 @@
+package redox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	codegentypes "github.com/oapi-codegen/runtime/types"
+	"github.com/tidepool-org/clinic-worker/ehr"
+	clinics "github.com/tidepool-org/clinic/client"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	MatchMethodMrnDob       = "MRN_DOB"
+	MatchMethodNameDob      = "NAME_DOB"
+	MatchMethodNameDobEmail = "NAME_DOB_EMAIL"
+
+	DefaultPatientMatchingMinimumConfidence = 0.9
+	DefaultPatientMatchingReviewTag         = "EHR_MATCH_REVIEW"
+
+	MatchedMrnConfidence       = 1.0
+	fullNameDobConfidence      = 0.9
+	partialNameDobConfidence   = 0.7
+	emailConfidenceIncrement   = 0.1
+	patientMatchingSearchLimit = 100
+)
+
+type PatientMatchingSettings struct {
+	// FallbackEnabled searches clinic patients by name and date of birth when the order can't be matched by MRN
+	FallbackEnabled bool `json:"fallbackEnabled"`
+	// AutoLinkMrn sets the MRN of a single high confidence candidate. Otherwise, the candidate must be confirmed by a clinician.
+	AutoLinkMrn       bool    `json:"autoLinkMrn"`
+	MinimumConfidence float64 `json:"minimumConfidence,omitempty"`
+	// ReviewTag is the patient tag used to queue candidates for review by clinicians
+	ReviewTag string `json:"reviewTag,omitempty"`
+}
+
+func (p PatientMatchingSettings) GetMinimumConfidence() float64 {
+	if p.MinimumConfidence <= 0 {
+		return DefaultPatientMatchingMinimumConfidence
+	}
+	return p.MinimumConfidence
+}
+
+func (p PatientMatchingSettings) GetReviewTag() string {
+	if p.ReviewTag == "" {
+		return DefaultPatientMatchingReviewTag
+	}
+	return p.ReviewTag
+}
+
+type PatientCandidate struct {
+	Patient    clinics.PatientV1
+	Method     string
+	Confidence float64
+}
+
+// FindPatientCandidates searches the patients of the clinic by the name, date of birth and email address of the order patient.
+// The candidates are sorted by confidence in descending order.
+func FindPatientCandidates(ctx context.Context, client clinics.ClientWithResponsesInterface, clinicId string, order ehr.Order) ([]PatientCandidate, error) {
+	// Orders without a usable birth date or name can't be matched by demographics and get the no-match result
+	birthDate, err := order.GetBirthDate()
+	if err != nil {
+		return nil, nil
+	}
+	if order.Patient.FirstName == "" || order.Patient.LastName == "" {
+		return nil, nil
+	}
+
+	// Email addresses are optional and only used to increase the confidence
+	email, _ := order.GetEmailAddress()
+
+	search := order.Patient.LastName
+	limit := patientMatchingSearchLimit
+	response, err := client.ListPatientsWithResponse(ctx, clinicId, &clinics.ListPatientsParams{
+		Search: &search,
+		Limit:  &limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to search patients: %w", err)
+	}
+	if response.StatusCode() != http.StatusOK || response.JSON200 == nil {
+		return nil, fmt.Errorf("unexpected status code %v when searching patients of clinic %s", response.StatusCode(), clinicId)
+	}
+	if response.JSON200.Data == nil {
+		return nil, nil
+	}
+
+	var candidates []PatientCandidate
+	for _, patient := range *response.JSON200.Data {
+		if candidate, ok := ScorePatientCandidate(order.Patient.FirstName, order.Patient.LastName, birthDate, email, patient); ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b PatientCandidate) int {
+		if a.Confidence > b.Confidence {
+			return -1
+		} else if a.Confidence < b.Confidence {
+			return 1
+		}
+		return 0
+	})
+
+	return candidates, nil
+}
+
+// ScorePatientCandidate returns the candidate with the confidence of the match, or false if the patient doesn't match.
+// The date of birth must always match. An exact match of the normalized full name has a higher confidence than a match
+// of the last name and the initial of the first name. A matching email address increases the confidence.
+func ScorePatientCandidate(firstName, lastName string, birthDate codegentypes.Date, email *string, patient clinics.PatientV1) (PatientCandidate, bool) {
+	if !patient.BirthDate.Equal(birthDate.Time) {
+		return PatientCandidate{}, false
+	}
+
+	first := NormalizeName(firstName)
+	last := NormalizeName(lastName)
+	patientName := NormalizeName(patient.FullName)
+	if len(first) == 0 || len(last) == 0 || len(patientName) == 0 {
+		return PatientCandidate{}, false
+	}
+
+	candidate := PatientCandidate{
+		Patient: patient,
+		Method:  MatchMethodNameDob,
+	}
+	if slices.Equal(patientName, slices.Concat(first, last)) {
+		candidate.Confidence = fullNameDobConfidence
+	} else if containsAll(patientName, last) && firstRune(patientName[0]) == firstRune(first[0]) {
+		candidate.Confidence = partialNameDobConfidence
+	} else {
+		return PatientCandidate{}, false
+	}
+
+	if email != nil && patient.Email != nil && strings.EqualFold(*email, *patient.Email) {
+		candidate.Method = MatchMethodNameDobEmail
+		candidate.Confidence = min(candidate.Confidence+emailConfidenceIncrement, 1.0)
+	}
+
+	return candidate, true
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+var nameNormalizer = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// NormalizeName returns the lower case parts of a name without diacritics and punctuation
+func NormalizeName(name string) []string {
+	normalized, _, err := transform.String(nameNormalizer, name)
+	if err != nil {
+		normalized = name
+	}
+	return strings.FieldsFunc(strings.ToLower(normalized), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func containsAll(values []string, elements []string) bool {
+	for _, element := range elements {
+		if !slices.Contains(values, element) {
+			return false
+		}
+	}
+	return true
+}
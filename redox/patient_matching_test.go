@@ -0,0 +1,95 @@
+package redox_test
+
+import (
+	"context"
+	"time"
+
+	codegentypes "github.com/oapi-codegen/runtime/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"github.com/tidepool-org/clinic-worker/redox"
+	clinics "github.com/tidepool-org/clinic/client"
+)
+
+var _ = Describe("PatientMatching", func() {
+	Describe("NormalizeName", func() {
+		It("removes diacritics and punctuation", func() {
+			Expect(redox.NormalizeName(" José  O'Brien-Núñez ")).To(Equal([]string{"jose", "o", "brien", "nunez"}))
+		})
+	})
+
+	Describe("ScorePatientCandidate", func() {
+		var birthDate codegentypes.Date
+		var patient clinics.PatientV1
+
+		BeforeEach(func() {
+			birthDate = codegentypes.Date{Time: time.Date(2008, 1, 6, 0, 0, 0, 0, time.UTC)}
+			patient = clinics.PatientV1{
+				BirthDate: birthDate,
+				FullName:  "Timothy Bixby",
+			}
+		})
+
+		It("matches the full name and date of birth", func() {
+			candidate, ok := redox.ScorePatientCandidate("TIMOTHY", "Bixby", birthDate, nil, patient)
+			Expect(ok).To(BeTrue())
+			Expect(candidate.Method).To(Equal(redox.MatchMethodNameDob))
+			Expect(candidate.Confidence).To(BeNumerically("~", 0.9))
+		})
+
+		It("matches the last name and initial with lower confidence", func() {
+			patient.FullName = "Tim Bixby"
+			candidate, ok := redox.ScorePatientCandidate("Timothy", "Bixby", birthDate, nil, patient)
+			Expect(ok).To(BeTrue())
+			Expect(candidate.Confidence).To(BeNumerically("~", 0.7))
+		})
+
+		It("increases the confidence when the email matches", func() {
+			email := "tim@example.com"
+			patient.Email = &email
+			orderEmail := "TIM@example.com"
+			candidate, ok := redox.ScorePatientCandidate("Timothy", "Bixby", birthDate, &orderEmail, patient)
+			Expect(ok).To(BeTrue())
+			Expect(candidate.Method).To(Equal(redox.MatchMethodNameDobEmail))
+			Expect(candidate.Confidence).To(BeNumerically("~", 1.0))
+		})
+
+		It("doesn't match a different date of birth", func() {
+			patient.BirthDate = codegentypes.Date{Time: time.Date(2008, 1, 7, 0, 0, 0, 0, time.UTC)}
+			_, ok := redox.ScorePatientCandidate("Timothy", "Bixby", birthDate, nil, patient)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("doesn't match a different name", func() {
+			patient.FullName = "Paul Bixby"
+			_, ok := redox.ScorePatientCandidate("Timothy", "Bixby", birthDate, nil, patient)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("compares the first letter of multibyte initials", func() {
+			patient.FullName = "Ścibor Nowak"
+			_, ok := redox.ScorePatientCandidate("Łukasz", "Nowak", birthDate, nil, patient)
+			Expect(ok).To(BeFalse())
+
+			patient.FullName = "Łuk Nowak"
+			candidate, ok := redox.ScorePatientCandidate("Łukasz", "Nowak", birthDate, nil, patient)
+			Expect(ok).To(BeTrue())
+			Expect(candidate.Confidence).To(BeNumerically("~", 0.7))
+		})
+	})
+
+	Describe("FindPatientCandidates", func() {
+		DescribeTable("returns no candidates without a usable date of birth",
+			func(birthDate string) {
+				order := ehr.Order{Patient: ehr.Patient{FirstName: "Timothy", LastName: "Bixby", BirthDate: birthDate}}
+				candidates, err := redox.FindPatientCandidates(context.Background(), nil, "clinic", order)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(candidates).To(BeEmpty())
+			},
+			Entry("missing", ""),
+			Entry("invalid", "2008-13-45"),
+		)
+	})
+})
@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"net/mail"
+	"slices"
 	"strings"
 	"time"
 
-	codegentypes "github.com/oapi-codegen/runtime/types"
+	"github.com/tidepool-org/clinic-worker/audit"
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"github.com/tidepool-org/clinic-worker/hl7"
 	"github.com/tidepool-org/clinic-worker/report"
 	clinics "github.com/tidepool-org/clinic/client"
 	models "github.com/tidepool-org/clinic/redox_models"
@@ -21,20 +24,32 @@ import (
 const (
 	EventTypeNewOrder               = "New"
 	DataModelOrder                  = "Order"
-	MinimumAgeSelfOwnedAccountYears = 13
+	MinimumAgeSelfOwnedAccountYears = ehr.MinimumAgeSelfOwnedAccountYears
 	NoteReplacementDuration         = -5 * time.Minute
 )
 
 type NewOrderProcessor interface {
-	ProcessOrder(ctx context.Context, envelope models.MessageEnvelope, order models.NewOrder) error
+	// ProcessOrder normalizes the order of the message with the EHR adapter and processes it
+	ProcessOrder(ctx context.Context, envelope models.MessageEnvelope) error
 	SendSummaryAndReport(ctx context.Context, params SummaryAndReportParameters) error
 }
 
 type SummaryAndReportParameters struct {
 	Match             clinics.EhrMatchResponseV1
-	Order             models.NewOrder
+	Order             ehr.Order
 	DocumentId        string
 	PrecedingDocument *PrecedingDocument
+	// PatientMatch is set when the patient was matched by demographics, because the order couldn't be matched by MRN
+	PatientMatch *PatientCandidate
+	// Progress is set when an order is processed and is used to skip the steps which were completed in a previous attempt
+	Progress *OrderProgress
+	// Timeline is set when an order is processed and is used to record the status changes of the order
+	Timeline *OrderTimeline
+	// SkipUnchanged is set for scheduled summaries and reports, so they are only sent to the destinations which didn't
+	// receive the same summary and report already
+	SkipUnchanged bool
+	// Transition is set when the order enabled or disabled reports and is reported in the matching results
+	Transition *SubscriptionTransition
 }
 
 func (s SummaryAndReportParameters) ShouldReplacePrecedingReport() bool {
@@ -47,10 +62,22 @@ func (s SummaryAndReportParameters) ShouldReplacePrecedingReport() bool {
 }
 
 var (
-	ErrNoMatchingPatients       = fmt.Errorf("no matching patient")
-	ErrMultipleMatchingPatients = fmt.Errorf("multiple matching patients")
+	ErrNoMatchingPatients       = NewResultError(ResultCodeNoMatches, "no matching patient")
+	ErrMultipleMatchingPatients = NewResultError(ResultCodeMultipleMatches, "multiple matching patients")
+	ErrPatientExists            = NewResultError(ResultCodePatientExists, "patient already exists")
+	ErrEmailInUse               = NewResultError(ResultCodeEmailInUse, "the email address is already in use")
+	ErrEmailInvalid             = ehr.ErrEmailInvalid
+	ErrDateOfBirthMissing       = ehr.ErrDateOfBirthMissing
+	ErrMrnMissing               = ehr.ErrMrnMissing
 )
 
+func (s SummaryAndReportParameters) GetClinicId() string {
+	if s.Match.Clinic.Id == nil {
+		return ""
+	}
+	return *s.Match.Clinic.Id
+}
+
 func (s SummaryAndReportParameters) GetMatchingPatient() (p clinics.PatientV1, err error) {
 	if s.Match.Patients == nil || len(*s.Match.Patients) == 0 {
 		err = ErrNoMatchingPatients
@@ -63,81 +90,159 @@ func (s SummaryAndReportParameters) GetMatchingPatient() (p clinics.PatientV1, e
 }
 
 type newOrderProcessor struct {
-	logger *zap.SugaredLogger
+	logger  *zap.SugaredLogger
+	auditor audit.Auditor
 
 	clinics         clinics.ClientWithResponsesInterface
-	client          Client
+	adapter         ehr.Adapter
 	reportGenerator report.Generator
 	shorelineClient shoreline.Client
+	clinicSettings  ClinicSettingsProvider
+	ledger          OrderLedger
+	statusRecorder  OrderStatusRecorder
+	fingerprints    ReportFingerprintStore
+	attachments     ReportAttachments
+	subscriptions   SubscriptionStore
+	contacts        PatientContactStore
+	workItems       WorkItemStore
+	hl7             hl7.Config
 }
 
-func NewNewOrderProcessor(clinics clinics.ClientWithResponsesInterface, redox Client, reportGenerator report.Generator, shorelineClient shoreline.Client, logger *zap.SugaredLogger) NewOrderProcessor {
+func NewNewOrderProcessor(clinics clinics.ClientWithResponsesInterface, adapter ehr.Adapter, reportGenerator report.Generator, shorelineClient shoreline.Client, clinicSettings ClinicSettingsProvider, ledger OrderLedger, statusRecorder OrderStatusRecorder, fingerprints ReportFingerprintStore, attachments ReportAttachments, subscriptions SubscriptionStore, contacts PatientContactStore, workItems WorkItemStore, hl7Config hl7.Config, auditor audit.Auditor, logger *zap.SugaredLogger) NewOrderProcessor {
 	return &newOrderProcessor{
 		logger:          logger,
+		auditor:         auditor,
 		clinics:         clinics,
-		client:          redox,
+		adapter:         adapter,
 		reportGenerator: reportGenerator,
 		shorelineClient: shorelineClient,
+		clinicSettings:  clinicSettings,
+		ledger:          ledger,
+		statusRecorder:  statusRecorder,
+		fingerprints:    fingerprints,
+		attachments:     attachments,
+		subscriptions:   subscriptions,
+		contacts:        contacts,
+		workItems:       workItems,
+		hl7:             hl7Config,
 	}
 }
 
-func (o *newOrderProcessor) ProcessOrder(ctx context.Context, envelope models.MessageEnvelope, order models.NewOrder) error {
-	documentId := envelope.Id.Hex()
-	procedureCode := GetProcedureCode(order)
-	matchRequest := NewMatchRequest(documentId, order)
-	match, err := o.matchOrder(ctx, matchRequest, order)
+func (o *newOrderProcessor) ProcessOrder(ctx context.Context, envelope models.MessageEnvelope) error {
+	order, err := NormalizeMessage(o.adapter, envelope)
+	if err != nil {
+		return err
+	}
+
+	timeline := NewOrderTimeline(o.statusRecorder, envelope.Id.Hex(), order, o.logger)
+	timeline.Record(ctx, OrderStatusEvent{Status: OrderStatusReceived})
+
+	if err := o.handleOrder(ctx, envelope, order, timeline); err != nil {
+		timeline.Record(ctx, NewOrderStatusErrorEvent(OrderStatusError, err))
+		return err
+	}
+	return nil
+}
+
+func (o *newOrderProcessor) handleOrder(ctx context.Context, envelope models.MessageEnvelope, order ehr.Order, timeline *OrderTimeline) error {
+	match, err := o.matchOrder(ctx, NewMatchRequest(envelope.Id.Hex()), order)
 	if err != nil {
 		return err
 	}
 
+	key := OrderKey{OrderId: order.Id, ProcedureCode: order.ProcedureCode}
+	progress, err := NewOrderProgress(ctx, o.ledger, key)
+	if err != nil {
+		return err
+	}
+	if progress.IsReportPending() {
+		o.logger.Infow("resuming order to send the report which was previously unavailable", "orderId", order.Id)
+	} else if progress.IsCompleted() {
+		return o.handleDuplicateOrder(ctx, order, *match)
+	}
+
+	if err := o.processOrder(ctx, envelope, order, *match, progress, timeline); err != nil {
+		return err
+	}
+
+	// The order is processed again later to replace the fallback note with the report
+	if progress.IsReportPending() {
+		if err := o.workItems.Enqueue(ctx, NewOrderReportRetry(envelope, key)); err != nil {
+			return err
+		}
+	}
+
+	// Orders are completed only if a successful result was sent, so orders which failed (e.g. because the patient
+	// couldn't be matched) are processed again when they are resent
+	if progress.IsStepCompleted(OrderStepResultsSent) {
+		return progress.Complete(ctx)
+	}
+	return nil
+}
+
+func (o *newOrderProcessor) processOrder(ctx context.Context, envelope models.MessageEnvelope, order ehr.Order, match clinics.EhrMatchResponseV1, progress *OrderProgress, timeline *OrderTimeline) error {
+	documentId := envelope.Id.Hex()
+	procedureCode := order.ProcedureCode
 	if ProcedureCodesMatch(procedureCode, match.Settings.ProcedureCodes.EnableSummaryReports) {
 		enable := EnableReports{
 			DocumentId: documentId,
+			Envelope:   envelope,
 			Order:      order,
 			OnSuccess:  o.handleSuccessfulPatientMatch,
+			Progress:   progress,
+			Timeline:   timeline,
 		}
 		return o.handleEnableSummaryReports(ctx, enable)
 	} else if ProcedureCodesMatch(procedureCode, match.Settings.ProcedureCodes.DisableSummaryReports) {
 		disable := DisableReports{
 			DocumentId: documentId,
+			Envelope:   envelope,
 			Order:      order,
+			Progress:   progress,
+			Timeline:   timeline,
 		}
 		return o.handleDisableSummaryReports(ctx, disable)
 	} else if ProcedureCodesMatch(procedureCode, match.Settings.ProcedureCodes.CreateAccount) {
 		create := CreateAccount{
 			DocumentId: documentId,
 			Order:      order,
+			Progress:   progress,
+			Timeline:   timeline,
 		}
-		_, err = o.handleCreateAccount(ctx, create)
+		_, err := o.handleCreateAccount(ctx, create)
 		return err
 	} else if ProcedureCodesMatch(procedureCode, match.Settings.ProcedureCodes.CreateAccountAndEnableReports) {
 		createAndEnable := CreateAccountEnableReports{
 			DocumentId: documentId,
+			Envelope:   envelope,
 			Order:      order,
+			Progress:   progress,
+			Timeline:   timeline,
 		}
 		return o.handleCreateAccountAndEnableSummaryReports(ctx, createAndEnable)
 	}
 
-	return o.handleUnknownProcedure(ctx, order, *match)
+	return o.handleUnknownProcedure(ctx, order, match)
 }
 
-func (o *newOrderProcessor) matchOrder(ctx context.Context, matchRequest clinics.EhrMatchRequestV1, order models.NewOrder) (*clinics.EhrMatchResponseV1, error) {
+// matchOrder matches the clinic and patient of the order
+func (o *newOrderProcessor) matchOrder(ctx context.Context, matchRequest clinics.EhrMatchRequestV1, order ehr.Order) (*clinics.EhrMatchResponseV1, error) {
 	response, err := o.clinics.MatchClinicAndPatientWithResponse(ctx, matchRequest)
 	if err != nil {
-		o.logger.Warnw("unable to match", "order", order.Meta, zap.Error(err))
+		o.logger.Warnw("unable to match", "orderId", order.Id, zap.Error(err))
 		// Return an error so we can retry the request
 		return nil, err
 	}
 
 	if response.StatusCode() != http.StatusOK {
-		o.logger.Warnw("unable to match clinic and patient", "order", order.Meta, "status", response.StatusCode())
+		o.logger.Warnw("unable to match clinic and patient", "orderId", order.Id, "status", response.StatusCode())
 		// Return an error so we can retry the request
 		return nil, fmt.Errorf("unable to match clinic and patient. unexpected response: %d", response.StatusCode())
 	}
 
 	if response.JSON200 == nil {
 		// Return an error so we can retry the request
-		return nil, fmt.Errorf("unable to match clinic and patient: %d", errors.New("response body is nil"))
+		return nil, fmt.Errorf("unable to match clinic and patient: %w", errors.New("response body is nil"))
 	}
 
 	return response.JSON200, nil
@@ -153,6 +258,21 @@ func (o *newOrderProcessor) handleEnableSummaryReports(ctx context.Context, enab
 		Match:      *match,
 		Order:      order,
 		DocumentId: enableReports.DocumentId,
+		Progress:   enableReports.Progress,
+		Timeline:   enableReports.Timeline,
+	}
+
+	if match.Patients == nil || len(*match.Patients) == 0 {
+		candidate, err := o.matchPatientByDemographics(ctx, params)
+		if err != nil || candidate == nil {
+			return err
+		}
+		// Match the order again, so the clinic service applies the action to the linked patient
+		if match, err = o.matchOrder(ctx, enableReports.GetMatchRequest(), order); err != nil {
+			return err
+		}
+		params.Match = *match
+		params.PatientMatch = candidate
 	}
 
 	if match.Patients == nil || len(*match.Patients) == 0 {
@@ -162,12 +282,31 @@ func (o *newOrderProcessor) handleEnableSummaryReports(ctx context.Context, enab
 	}
 
 	patient := (*match.Patients)[0]
-	o.logger.Infow("successfully matched clinic and patient", "order", params.Order.Meta, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+	o.logger.Infow("successfully matched clinic and patient", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
 
-	err = o.updatePatient(ctx, order, *match)
+	if !params.Progress.IsStepCompleted(OrderStepMatched) {
+		if err := o.updatePatient(ctx, order, *match); err != nil {
+			return err
+		}
+		if err := params.Progress.CompleteStep(ctx, OrderStepMatched); err != nil {
+			return err
+		}
+		params.Timeline.Record(ctx, OrderStatusEvent{Status: OrderStatusMatched, ClinicId: match.Clinic.Id, PatientId: patient.Id})
+		params.Timeline.Record(ctx, OrderStatusEvent{Status: OrderStatusReportsEnabled, ClinicId: match.Clinic.Id, PatientId: patient.Id})
+	}
+
+	// Keep the order, so the scheduler can send summaries and reports of the patient
+	subscription := NewReportSubscription(params.GetClinicId(), *patient.Id, enableReports.Envelope, order, match.Settings.MrnIdType)
+	existing, err := o.subscriptions.Find(ctx, subscription.ClinicId, subscription.PatientId)
 	if err != nil {
 		return err
 	}
+	transition := NewSubscriptionTransition(existing, params.DocumentId, SubscriptionStateActive)
+	subscription.LastTransition = &transition
+	params.Transition = &transition
+	if err := o.subscriptions.Upsert(ctx, subscription); err != nil {
+		return err
+	}
 
 	if enableReports.OnSuccess != nil {
 		if err := enableReports.OnSuccess(ctx, params); err != nil {
@@ -188,6 +327,21 @@ func (o *newOrderProcessor) handleDisableSummaryReports(ctx context.Context, dis
 		Match:      *match,
 		Order:      order,
 		DocumentId: disableReports.DocumentId,
+		Progress:   disableReports.Progress,
+		Timeline:   disableReports.Timeline,
+	}
+
+	if match.Patients == nil || len(*match.Patients) == 0 {
+		candidate, err := o.matchPatientByDemographics(ctx, params)
+		if err != nil || candidate == nil {
+			return err
+		}
+		// Match the order again, so the clinic service applies the action to the linked patient
+		if match, err = o.matchOrder(ctx, disableReports.GetMatchRequest(), order); err != nil {
+			return err
+		}
+		params.Match = *match
+		params.PatientMatch = candidate
 	}
 
 	patient, err := params.GetMatchingPatient()
@@ -199,7 +353,31 @@ func (o *newOrderProcessor) handleDisableSummaryReports(ctx context.Context, dis
 		return err
 	}
 
-	o.logger.Infow("successfully matched clinic and patient", "order", params.Order.Meta, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+	o.logger.Infow("successfully matched clinic and patient", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+	subscription := NewReportSubscription(params.GetClinicId(), *patient.Id, disableReports.Envelope, order, match.Settings.MrnIdType)
+	existing, err := o.subscriptions.Find(ctx, subscription.ClinicId, subscription.PatientId)
+	if err != nil {
+		return err
+	}
+	transition := NewSubscriptionTransition(existing, params.DocumentId, SubscriptionStateInactive)
+	subscription.LastTransition = &transition
+	params.Transition = &transition
+	if err := o.subscriptions.Disable(ctx, subscription); err != nil {
+		return err
+	}
+	if err := o.removeTagsFromPatient(ctx, params, patient); err != nil {
+		return err
+	}
+	if err := params.Progress.CompleteStep(ctx, OrderStepMatched); err != nil {
+		return err
+	}
+	params.Timeline.Record(ctx, OrderStatusEvent{Status: OrderStatusMatched, ClinicId: match.Clinic.Id, PatientId: patient.Id})
+	params.Timeline.Record(ctx, OrderStatusEvent{Status: OrderStatusReportsDisabled, ClinicId: match.Clinic.Id, PatientId: patient.Id})
+	if transition.From == SubscriptionStateActive {
+		if err := o.sendFinalNote(ctx, params, patient); err != nil {
+			return err
+		}
+	}
 	return o.handleSuccessfulPatientMatch(ctx, params)
 }
 
@@ -209,6 +387,20 @@ func (o *newOrderProcessor) handleCreateAccount(ctx context.Context, create Crea
 	if err != nil {
 		return false, err
 	}
+	clinicSettings, err := o.clinicSettings.GetClinicSettings(ctx, *match.Clinic.Id)
+	if err != nil {
+		return false, err
+	}
+	details := clinicSettings.AccountCreation.GetAccountDetails(order)
+
+	if create.Progress.IsStepCompleted(OrderStepAccountCreated) {
+		// The account was created in a previous attempt, but the result might not have been sent
+		o.logger.Infow("patient account was already created", "orderId", order.Id, "clinicId", match.Clinic.Id)
+		if !create.Progress.IsStepCompleted(OrderStepContactStored) {
+			details = details.WithoutContact()
+		}
+		return true, o.handleAccountCreationSuccess(ctx, create, *match, clinicSettings.AccountCreation.ResultDetails(details))
+	}
 
 	if match.Patients != nil && len(*match.Patients) > 0 {
 		ids := make([]string, len(*match.Patients))
@@ -218,13 +410,12 @@ func (o *newOrderProcessor) handleCreateAccount(ctx context.Context, create Crea
 
 		o.logger.Infow(
 			"unable to create new patient account, because matching patients were found",
-			"order", order.Meta,
+			"orderId", order.Id,
 			"clinicId", match.Clinic.Id,
 			"patientIds", strings.Join(ids, ","),
 		)
 
-		err = fmt.Errorf("patient already exists")
-		return false, o.handleAccountCreationError(ctx, err, order, *match)
+		return false, o.handleAccountCreationError(ctx, ErrPatientExists, create, *match)
 	}
 
 	permission := make(map[string]interface{})
@@ -237,53 +428,87 @@ func (o *newOrderProcessor) handleCreateAccount(ctx context.Context, create Crea
 		},
 	}
 
-	createPatient.Email, err = GetEmailAddressFromOrder(order)
+	createPatient.Email, err = order.GetEmailAddress()
 	if err != nil {
-		return false, o.handleAccountCreationError(ctx, err, order, *match)
+		return false, o.handleAccountCreationError(ctx, err, create, *match)
 	}
-	createPatient.BirthDate, err = GetBirthDateFromOrder(order)
+	createPatient.BirthDate, err = order.GetBirthDate()
 	if err != nil {
-		return false, o.handleAccountCreationError(ctx, err, order, *match)
+		return false, o.handleAccountCreationError(ctx, err, create, *match)
 	}
-	createPatient.FullName, err = GetFullNameFromOrder(order)
+	createPatient.FullName, err = order.GetFullName()
 	if err != nil {
-		return false, o.handleAccountCreationError(ctx, err, order, *match)
+		return false, o.handleAccountCreationError(ctx, err, create, *match)
 	}
-	createPatient.Mrn, err = GetMrnFromOrder(order, match.Settings.MrnIdType)
+	createPatient.Mrn, err = order.GetMrn(match.Settings.MrnIdType)
 	if err != nil {
-		return false, o.handleAccountCreationError(ctx, err, order, *match)
+		return false, o.handleAccountCreationError(ctx, err, create, *match)
 	}
 
 	if createPatient.Email != nil {
 		if exists, err := o.emailExists(*createPatient.Email); err != nil {
-			o.logger.Errorw("unexpected error when checking for duplicate emails", "order", order.Meta, "error", err)
+			o.logger.Errorw("unexpected error when checking for duplicate emails", "orderId", order.Id, "error", err)
 			return false, err
 		} else if exists {
-			err = fmt.Errorf("the email address is already in use")
-			return false, o.handleAccountCreationError(ctx, err, order, *match)
+			return false, o.handleAccountCreationError(ctx, ErrEmailInUse, create, *match)
 		}
 	}
 
-	createPatient.Tags, err = o.createTagsForPatient(ctx, order, *match)
+	createPatient.Tags, err = o.createTagsForPatient(ctx, order, *match, clinicSettings.Tags)
 	if err != nil {
-		o.logger.Errorw("unexpected error when creating tags for patient", "order", order.Meta, "error", err)
+		o.logger.Errorw("unexpected error when creating tags for patient", "orderId", order.Id, "error", err)
 		return false, err
 	}
+	createPatient.DiagnosisType = details.DiagnosisType
+	createPatient.TargetDevices = details.TargetDevices
 
 	resp, err := o.clinics.CreatePatientAccountWithResponse(ctx, *match.Clinic.Id, createPatient)
 	if err != nil {
 		// Retry in case of unexpected failure
-		o.logger.Errorw("unable to create patient account", "order", order.Meta, "error", err)
+		o.logger.Errorw("unable to create patient account", "orderId", order.Id, "error", err)
 		return false, err
 	}
 	if (resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusConflict) || resp.JSON200 == nil {
 		// Retry in case of failure
-		o.logger.Errorw("unexpected response when creating patient account", "order", order.Meta, "statusCode", resp.StatusCode())
+		o.logger.Errorw("unexpected response when creating patient account", "orderId", order.Id, "statusCode", resp.StatusCode())
 		return false, err
 	}
 
-	o.logger.Infow("patient account was successfully created", "order", order.Meta, "clinicId", match.Clinic.Id, "patientId", resp.JSON200.Id)
-	return true, o.handleAccountCreationSuccess(ctx, order, *match)
+	o.logger.Infow("patient account was successfully created", "orderId", order.Id, "clinicId", match.Clinic.Id, "patientId", resp.JSON200.Id)
+	if err := create.Progress.CompleteStep(ctx, OrderStepAccountCreated); err != nil {
+		return false, err
+	}
+	create.Timeline.Record(ctx, OrderStatusEvent{Status: OrderStatusAccountCreated, ClinicId: match.Clinic.Id, PatientId: resp.JSON200.Id})
+	if details, err = o.storePatientContact(ctx, create.Progress, *match.Clinic.Id, resp.JSON200.Id, details); err != nil {
+		return false, err
+	}
+	return true, o.handleAccountCreationSuccess(ctx, create, *match, clinicSettings.AccountCreation.ResultDetails(details))
+}
+
+// storePatientContact stores the phone number and the guardian of a new patient. The account doesn't depend on the
+// contact, so failures are logged and the contact is reported as not mapped instead of failing the order.
+func (o *newOrderProcessor) storePatientContact(ctx context.Context, progress *OrderProgress, clinicId string, patientId *string, details AccountDetails) (AccountDetails, error) {
+	if details.PhoneNumber == "" && details.Guardian == nil {
+		return details, nil
+	}
+	if patientId == nil {
+		return details.WithoutContact(), nil
+	}
+
+	contact := PatientContact{
+		ClinicId:    clinicId,
+		PatientId:   *patientId,
+		PhoneNumber: details.PhoneNumber,
+		Guardian:    details.Guardian,
+	}
+	if err := o.contacts.Upsert(ctx, contact); err != nil {
+		o.logger.Errorw("unable to store patient contact", "clinicId", clinicId, "patientId", *patientId, "error", err)
+		return details.WithoutContact(), nil
+	}
+	if err := progress.CompleteStep(ctx, OrderStepContactStored); err != nil {
+		return details, err
+	}
+	return details, nil
 }
 
 func (o *newOrderProcessor) handleCreateAccountAndEnableSummaryReports(ctx context.Context, createAndEnable CreateAccountEnableReports) error {
@@ -293,9 +518,14 @@ func (o *newOrderProcessor) handleCreateAccountAndEnableSummaryReports(ctx conte
 		return err
 	}
 
-	accountCreated := false
-	if match.Patients == nil || len(*match.Patients) == 0 {
-		create := CreateAccount(createAndEnable)
+	accountCreated := createAndEnable.Progress.IsStepCompleted(OrderStepAccountCreated)
+	if !accountCreated && (match.Patients == nil || len(*match.Patients) == 0) {
+		create := CreateAccount{
+			DocumentId: createAndEnable.DocumentId,
+			Order:      createAndEnable.Order,
+			Progress:   createAndEnable.Progress,
+			Timeline:   createAndEnable.Timeline,
+		}
 		if successfullyCreated, err := o.handleCreateAccount(ctx, create); err != nil {
 			return err
 		} else if !successfullyCreated {
@@ -307,7 +537,10 @@ func (o *newOrderProcessor) handleCreateAccountAndEnableSummaryReports(ctx conte
 
 	enable := EnableReports{
 		DocumentId: createAndEnable.DocumentId,
+		Envelope:   createAndEnable.Envelope,
 		Order:      createAndEnable.Order,
+		Progress:   createAndEnable.Progress,
+		Timeline:   createAndEnable.Timeline,
 	}
 	if !accountCreated {
 		enable.OnSuccess = o.handleSuccessfulPatientMatch
@@ -316,8 +549,11 @@ func (o *newOrderProcessor) handleCreateAccountAndEnableSummaryReports(ctx conte
 	return o.handleEnableSummaryReports(ctx, enable)
 }
 
-func (o *newOrderProcessor) createTagsForPatient(ctx context.Context, order models.NewOrder, match clinics.EhrMatchResponseV1) (*clinics.PatientTagIdsV1, error) {
-	tagNames := o.getTagNamesFromOrder(order, match)
+func (o *newOrderProcessor) createTagsForPatient(ctx context.Context, order ehr.Order, match clinics.EhrMatchResponseV1, tagSettings TagSettings) (*clinics.PatientTagIdsV1, error) {
+	tagNames, err := o.getTagNamesFromOrder(order, match, tagSettings)
+	if err != nil {
+		return nil, err
+	}
 	if tagNames == nil {
 		return nil, nil
 	}
@@ -337,7 +573,7 @@ func (o *newOrderProcessor) createTagsForPatient(ctx context.Context, order mode
 				o.logger.Warnw(
 					"ignoring tag because it doesn't conform to tag schema",
 					"tag", tagName,
-					"order", order.Meta,
+					"orderId", order.Id,
 					"clinicId", match.Clinic.Id,
 				)
 				continue
@@ -371,18 +607,31 @@ func (o *newOrderProcessor) createTagsForPatient(ctx context.Context, order mode
 	return &patientTagIds, nil
 }
 
-func (o *newOrderProcessor) updatePatient(ctx context.Context, order models.NewOrder, match clinics.EhrMatchResponseV1) error {
+func (o *newOrderProcessor) updatePatient(ctx context.Context, order ehr.Order, match clinics.EhrMatchResponseV1) error {
 	patient := (*match.Patients)[0]
 
-	tags, err := o.createTagsForPatient(ctx, order, match)
+	clinicSettings, err := o.clinicSettings.GetClinicSettings(ctx, *match.Clinic.Id)
+	if err != nil {
+		return err
+	}
+	tags, err := o.createTagsForPatient(ctx, order, match, clinicSettings.Tags)
 	if err != nil {
 		return err
 	}
+	if tags != nil {
+		merged := clinicSettings.Tags.MergeTagIds(patient.Tags, *tags)
+		if clinicSettings.Tags.GetMode() == TagModeAdditive && patient.Tags != nil && len(merged) == len(*patient.Tags) {
+			// All tags derived from the order are already assigned to the patient
+			tags = nil
+		} else {
+			tags = &merged
+		}
+	}
 
 	// Update email addresses of custodian users if they don't have an email address and the email address isn't already taken
 	var email *string
 	if patient.Permissions != nil && patient.Permissions.Custodian != nil && patient.Email == nil {
-		email, err = GetEmailAddressFromOrder(order)
+		email, err = order.GetEmailAddress()
 		if err != nil {
 			return err
 		}
@@ -425,49 +674,53 @@ func (o *newOrderProcessor) updatePatient(ctx context.Context, order models.NewO
 	return nil
 }
 
-func (o *newOrderProcessor) getPatientTagCodes(match clinics.EhrMatchResponseV1) map[string]struct{} {
-	result := make(map[string]struct{})
-	if match.Settings.Tags.Codes != nil {
-		for _, code := range *match.Settings.Tags.Codes {
-			result[code] = struct{}{}
-		}
-	}
-	return result
-}
-
-func (o *newOrderProcessor) getPatientTagsSeparator(match clinics.EhrMatchResponseV1) *string {
-	return match.Settings.Tags.Separator
+func (o *newOrderProcessor) getTagNamesFromOrder(order ehr.Order, match clinics.EhrMatchResponseV1, tagSettings TagSettings) ([]string, error) {
+	return tagSettings.GetTagNames(order, order.SourceId, match.Settings.Tags)
 }
 
-func (o *newOrderProcessor) getTagNamesFromOrder(order models.NewOrder, match clinics.EhrMatchResponseV1) []string {
-	separator := o.getPatientTagsSeparator(match)
-	codes := o.getPatientTagCodes(match)
-	if len(codes) == 0 {
+// removeTagsFromPatient removes the tags derived from a disable order if the clinic settings require it
+func (o *newOrderProcessor) removeTagsFromPatient(ctx context.Context, params SummaryAndReportParameters, patient clinics.PatientV1) error {
+	clinicSettings, err := o.clinicSettings.GetClinicSettings(ctx, params.GetClinicId())
+	if err != nil {
+		return err
+	}
+	if !clinicSettings.Tags.RemoveOnDisable || patient.Tags == nil {
 		return nil
 	}
 
-	if order.Order.ClinicalInfo == nil || *order.Order.ClinicalInfo == nil {
-		return nil
+	tagNames, err := o.getTagNamesFromOrder(params.Order, params.Match, clinicSettings.Tags)
+	if err != nil {
+		return err
 	}
 
-	tagNames := make([]string, 0)
-	for _, info := range *order.Order.ClinicalInfo {
-		if info.Code == nil || info.Value == nil {
-			continue
-		}
-		if _, found := codes[*info.Code]; !found {
-			continue
-		}
-		if separator == nil || *separator == "" {
-			tagNames = append(tagNames, strings.TrimSpace(*info.Value))
-			continue
-		}
-		for _, tag := range strings.Split(*info.Value, *separator) {
-			tagNames = append(tagNames, strings.TrimSpace(tag))
+	existingTags := o.getExistingTags(params.Match.Clinic)
+	removed := clinics.PatientTagIdsV1{}
+	for _, tagName := range tagNames {
+		if tag, ok := existingTags[tagName]; ok {
+			removed = append(removed, *tag.Id)
 		}
 	}
+	tags := RemoveTagIds(patient.Tags, removed)
+	if len(tags) == len(*patient.Tags) {
+		return nil
+	}
 
-	return tagNames
+	update := clinics.UpdatePatientJSONRequestBody{
+		Email:         patient.Email,
+		BirthDate:     patient.BirthDate,
+		FullName:      patient.FullName,
+		Mrn:           patient.Mrn,
+		TargetDevices: patient.TargetDevices,
+		Tags:          &tags,
+	}
+	resp, err := o.clinics.UpdatePatientWithResponse(ctx, params.GetClinicId(), *patient.Id, update)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("unexpected status code %v removing tags of patient %s", resp.StatusCode(), *patient.Id)
+	}
+	return nil
 }
 
 func (o *newOrderProcessor) getExistingTags(clinic clinics.ClinicV1) map[string]clinics.PatientTagV1 {
@@ -501,415 +754,863 @@ func (o *newOrderProcessor) SendSummaryAndReport(ctx context.Context, params Sum
 	if err != nil {
 		return err
 	}
-	flowsheet, observations, err := o.createSummaryStatisticsFlowsheet(params)
+	clinicSettings, err := o.clinicSettings.GetClinicSettings(ctx, params.GetClinicId())
+	if err != nil {
+		return fmt.Errorf("unable to get clinic settings: %w", err)
+	}
+	observations, err := o.calculateSummaryStatistics(params, clinicSettings)
 	if err != nil {
 		return err
 	}
 
-	if len(flowsheet.Observations) == 0 {
-		o.logger.Infow("the patient has no observations", "order", params.Order.Meta, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+	if len(observations) == 0 {
+		o.logger.Infow("the patient has no observations", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
 		return nil
 	}
 
-	notes, err := o.createReportNote(ctx, params, observations)
+	var fingerprint string
+	if params.SkipUnchanged {
+		fingerprint, err = o.computeReportFingerprint(params, patient, clinicSettings)
+		if err != nil {
+			return err
+		}
+	}
+
+	if clinicSettings.HL7v2.Enabled {
+		if params.Progress.IsStepCompleted(OrderStepFlowsheetSent) {
+			return nil
+		}
+		destinationId := GetHL7DestinationId(clinicSettings.HL7v2)
+		destinations, err := o.getChangedDestinations(ctx, params, patient, PayloadTypeHL7, []string{destinationId}, fingerprint)
+		if err != nil {
+			return err
+		}
+		if len(destinations) == 0 {
+			o.handleUnchangedReport(ctx, params, patient)
+			return nil
+		}
+		// The step isn't tracked per destination, because the message is delivered to a single destination
+		hl7Delivery := newDelivery(params, patient, PayloadTypeHL7, destinations, "", OrderStatusFlowsheetSent)
+		hl7Delivery.Fingerprint = fingerprint
+		err = o.deliver(ctx, hl7Delivery, func(destinationId string) error {
+			return o.sendHL7SummaryAndReport(ctx, params, observations, clinicSettings)
+		})
+		if err != nil {
+			return err
+		}
+		return params.Progress.CompleteStep(ctx, OrderStepFlowsheetSent)
+	}
+
+	flowsheetDestinations, err := o.getChangedDestinations(ctx, params, patient, PayloadTypeFlowsheet, clinicSettings.Routing.GetDestinations(PayloadTypeFlowsheet, params.Order, params.Match.Settings.DestinationIds.Flowsheet), fingerprint)
+	if err != nil {
+		return err
+	}
+	notesDestinations, err := o.getChangedDestinations(ctx, params, patient, PayloadTypeNotes, clinicSettings.Routing.GetDestinations(PayloadTypeNotes, params.Order, params.Match.Settings.DestinationIds.Notes), fingerprint)
 	if err != nil {
-		// return the error so we can retry the request
 		return err
 	}
+	if len(flowsheetDestinations) == 0 && len(notesDestinations) == 0 {
+		o.handleUnchangedReport(ctx, params, patient)
+		return nil
+	}
+
+	if !params.Progress.IsStepCompleted(OrderStepFlowsheetSent) {
+		o.logger.Infow("sending flowsheet", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+		flowsheetDelivery := newDelivery(params, patient, PayloadTypeFlowsheet, flowsheetDestinations, OrderStepFlowsheetSent, OrderStatusFlowsheetSent)
+		flowsheetDelivery.Fingerprint = fingerprint
+		payload := ehr.Observations{
+			Order:        params.Order,
+			Observations: CodeObservations(observations, clinicSettings.Flowsheets.Codes),
+		}
+		err := o.deliver(ctx, flowsheetDelivery, func(destinationId string) error {
+			destination := ehr.Destination{SourceId: params.Match.Settings.SourceId, Id: destinationId}
+			if err := o.adapter.SendObservations(ctx, destination, payload); err != nil {
+				return fmt.Errorf("unable to send flowsheet: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			// Return an error so we can retry the request
+			return err
+		}
+		if err := params.Progress.CompleteStep(ctx, OrderStepFlowsheetSent); err != nil {
+			return err
+		}
+	}
 
-	o.logger.Infow("sending flowsheet", "order", params.Order.Meta, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
-	if err := o.client.Send(ctx, flowsheet); err != nil {
+	if params.Progress.IsStepCompleted(OrderStepNoteSent) {
+		o.logger.Infow("the note was already sent", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+		return nil
+	}
+	if len(notesDestinations) == 0 {
+		o.logger.Infow("the report didn't change since it was last sent", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+		return params.Progress.CompleteStep(ctx, OrderStepNoteSent)
+	}
+
+	// The flowsheet is delivered independently of the report, so a failure to create the report doesn't delay it
+	document, err := o.createReportDocument(ctx, params, observations, clinicSettings)
+	if err != nil {
+		return o.handleReportFailure(ctx, params, patient, observations, notesDestinations, clinicSettings, err)
+	}
+	if document == nil {
+		o.logger.Infow("the patient has no summary data", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+		return nil
+	}
+
+	o.logger.Infow("sending note", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+	notesDelivery := newDelivery(params, patient, PayloadTypeNotes, notesDestinations, OrderStepNoteSent, OrderStatusNoteSent)
+	notesDelivery.Fingerprint = fingerprint
+	if err := o.sendDocument(ctx, params, notesDelivery, *document); err != nil {
 		// Return an error so we can retry the request
-		return fmt.Errorf("unable to send flowsheet: %w", err)
+		return err
 	}
+	return params.Progress.CompleteStep(ctx, OrderStepNoteSent)
+}
 
-	if notes != nil {
-		o.logger.Infow("sending note", "order", params.Order.Meta, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
-		if err := o.client.Send(ctx, notes); err != nil {
-			// Return an error so we can retry the request
-			return fmt.Errorf("unable to send notes: %w", err)
+func (o *newOrderProcessor) computeReportFingerprint(params SummaryAndReportParameters, patient clinics.PatientV1, clinicSettings ClinicSettings) (string, error) {
+	profile := clinicSettings.Reports.GetProfile(params.Order.ProcedureCode)
+	reportingPeriod := report.GetReportingPeriodBounds(patient, profile.GetPeriodDuration())
+	return ComputeReportFingerprint(patient, params.Match.Clinic, reportingPeriod, profile, clinicSettings.Flowsheets)
+}
+
+// getChangedDestinations returns the destinations which didn't receive the summary and report with the same
+// fingerprint. All destinations are returned if the fingerprint is empty.
+func (o *newOrderProcessor) getChangedDestinations(ctx context.Context, params SummaryAndReportParameters, patient clinics.PatientV1, payloadType PayloadType, destinations []string, fingerprint string) ([]string, error) {
+	if fingerprint == "" {
+		return destinations, nil
+	}
+
+	var changed []string
+	for _, destinationId := range destinations {
+		previous, err := o.fingerprints.GetFingerprint(ctx, newReportFingerprintKey(params.Match.Clinic.Id, patient.Id, payloadType, destinationId))
+		if err != nil {
+			return nil, err
+		}
+		if previous != fingerprint {
+			changed = append(changed, destinationId)
 		}
-	} else {
-		o.logger.Infow("the patient has no summary data", "order", params.Order.Meta, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
 	}
+	return changed, nil
+}
 
-	return nil
+// setFingerprint stores the fingerprint of the summary and report which was delivered. Failures are only logged,
+// because the worst outcome is that an unchanged summary and report is sent again.
+func (o *newOrderProcessor) setFingerprint(ctx context.Context, key ReportFingerprintKey, fingerprint string) {
+	if fingerprint == "" {
+		return
+	}
+	if err := o.fingerprints.SetFingerprint(ctx, key, fingerprint); err != nil {
+		o.logger.Warnw("unable to store report fingerprint", "key", key, "error", err)
+	}
+}
+
+func (o *newOrderProcessor) handleUnchangedReport(ctx context.Context, params SummaryAndReportParameters, patient clinics.PatientV1) {
+	o.logger.Infow("the summary and report didn't change since they were last sent", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+	params.Timeline.Record(ctx, OrderStatusEvent{
+		Status:    OrderStatusReportSkipped,
+		ClinicId:  params.Match.Clinic.Id,
+		PatientId: patient.Id,
+		Message:   ReportUnchangedMessage,
+	})
+}
+
+func newReportFingerprintKey(clinicId *string, patientId *string, payloadType PayloadType, destinationId string) ReportFingerprintKey {
+	key := ReportFingerprintKey{
+		PayloadType:   payloadType,
+		DestinationId: destinationId,
+	}
+	if clinicId != nil {
+		key.ClinicId = *clinicId
+	}
+	if patientId != nil {
+		key.PatientId = *patientId
+	}
+	return key
+}
+
+// handleReportFailure returns the error, so the order is retried, until the report creation fails the maximum number
+// of times. Then a plain-text note with the summary statistics is sent instead of the report together with a result
+// which explains why. The report replaces the fallback note when the order is processed again.
+func (o *newOrderProcessor) handleReportFailure(ctx context.Context, params SummaryAndReportParameters, patient clinics.PatientV1, observations []*Observation, destinations []string, clinicSettings ClinicSettings, reportErr error) error {
+	if params.Progress == nil || params.Progress.IsStepCompleted(OrderStepFallbackNoteSent) {
+		return reportErr
+	}
+
+	failures, err := params.Progress.RecordFailure(ctx, OrderStepNoteSent)
+	if err != nil {
+		return err
+	}
+	if failures < clinicSettings.Notes.GetMaxReportFailures() {
+		o.logger.Warnw("unable to create report note", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id, "failures", failures, "error", reportErr)
+		return reportErr
+	}
+
+	o.logger.Warnw("sending fallback note, because the report couldn't be created", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id, "failures", failures, "error", reportErr)
+	document := o.createDocument(params, patient)
+	document.Observations = GMIObservations(observations)
+	document.Text = NewFallbackNoteContents(ObservationsToGMINoteComponents(observations))
+
+	err = o.sendMatchingResultsNotification(ctx, ResultsNotification{
+		IsSuccess: true,
+		Code:      ResultCodeReportUnavailable,
+		Message:   ReportUnavailableMessage,
+	}, params)
+	if err != nil {
+		return err
+	}
+
+	notesDelivery := newDelivery(params, patient, PayloadTypeNotes, destinations, OrderStepFallbackNoteSent, OrderStatusFallbackNoteSent)
+	if err := o.sendDocument(ctx, params, notesDelivery, document); err != nil {
+		return err
+	}
+	return params.Progress.CompleteStep(ctx, OrderStepFallbackNoteSent)
+}
+
+// sendFinalNote sends a plain-text note when a subscription ends if the clinic settings require it
+func (o *newOrderProcessor) sendFinalNote(ctx context.Context, params SummaryAndReportParameters, patient clinics.PatientV1) error {
+	clinicSettings, err := o.clinicSettings.GetClinicSettings(ctx, params.GetClinicId())
+	if err != nil {
+		return err
+	}
+	if !clinicSettings.Subscriptions.FinalNote {
+		return nil
+	}
+	if clinicSettings.HL7v2.Enabled {
+		o.logger.Infow("skipping final note, because notes are delivered as HL7v2 reports", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+		return nil
+	}
+
+	document := o.createDocument(params, patient)
+	document.Text = clinicSettings.Subscriptions.GetFinalNoteText()
+
+	destinations := clinicSettings.Routing.GetDestinations(PayloadTypeNotes, params.Order, params.Match.Settings.DestinationIds.Notes)
+	notesDelivery := newDelivery(params, patient, PayloadTypeNotes, destinations, OrderStepFinalNoteSent, OrderStatusFinalNoteSent)
+	return o.sendDocument(ctx, params, notesDelivery, document)
 }
 
-func (o *newOrderProcessor) createSummaryStatisticsFlowsheet(params SummaryAndReportParameters) (models.NewFlowsheet, []*Observation, error) {
+func (o *newOrderProcessor) sendDocument(ctx context.Context, params SummaryAndReportParameters, notesDelivery delivery, document ehr.Document) error {
+	return o.deliver(ctx, notesDelivery, func(destinationId string) error {
+		destination := ehr.Destination{SourceId: params.Match.Settings.SourceId, Id: destinationId}
+		if err := o.adapter.SendDocument(ctx, destination, document); err != nil {
+			return fmt.Errorf("unable to send notes: %w", err)
+		}
+		return nil
+	})
+}
+
+// sendHL7SummaryAndReport sends the summary statistics and the report with the HL7v2 adapter, which replaces the
+// flowsheets and notes of the integration for the clinic. It must be called by deliver, so the delivery is audited.
+func (o *newOrderProcessor) sendHL7SummaryAndReport(ctx context.Context, params SummaryAndReportParameters, observations []*Observation, clinicSettings ClinicSettings) error {
 	patient, err := params.GetMatchingPatient()
 	if err != nil {
-		return models.NewFlowsheet{}, nil, err
+		return err
+	}
+	adapter, err := NewHL7Adapter(clinicSettings.HL7v2, o.hl7.Destinations)
+	if err != nil {
+		return err
 	}
 
-	source := o.client.GetSource()
-	destinationId := params.Match.Settings.DestinationIds.Flowsheet
-	destinations := []struct {
-		ID   *string `json:"ID"`
-		Name *string `json:"Name"`
-	}{{
-		ID: &destinationId,
-	}}
+	destination := ehr.Destination{SourceId: params.Match.Settings.SourceId, Id: GetHL7DestinationId(clinicSettings.HL7v2)}
+	coded := CodeObservations(observations, clinicSettings.Flowsheets.Codes)
+	profile := clinicSettings.Reports.GetProfile(params.Order.ProcedureCode)
+	reportingPeriod := report.GetReportingPeriodBounds(patient, profile.GetPeriodDuration())
+	if reportingPeriod == nil {
+		o.logger.Infow("sending hl7 oru message without report", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+		// Return an error so we can retry the request
+		return adapter.SendObservations(ctx, destination, ehr.Observations{Order: params.Order, Observations: coded})
+	}
 
-	settings := FlowsheetSettings{
-		PreferredBGUnits: string(params.Match.Clinic.PreferredBgUnits),
-		ICode:            params.Match.Settings.Flowsheets.Icode,
+	buffered, err := o.generateBufferedReport(ctx, params, patient, *reportingPeriod, profile)
+	if err != nil {
+		// return the error so we can retry the request
+		return err
 	}
+	defer o.closeBufferedReport(buffered)
 
-	flowsheet := NewFlowsheet()
-	flowsheet.Meta.Source = &source
-	flowsheet.Meta.Destinations = &destinations
-	flowsheet.Patient.Identifiers = params.Order.Patient.Identifiers
-	flowsheet.Patient.Demographics = params.Order.Patient.Demographics
+	content, err := io.ReadAll(buffered.Reader())
+	if err != nil {
+		return fmt.Errorf("unable to read report: %w", err)
+	}
+	document := o.createDocument(params, patient)
+	document.FileName = NoteReportFileName
+	document.Content = content
+	document.Observations = coded
 
-	SetVisitNumberInFlowsheet(params.Order, &flowsheet)
-	SetVisitLocationInFlowsheet(params.Order, &flowsheet)
-	SetAccountNumberInFlowsheet(params.Order, &flowsheet)
-	SetOrderIdInFlowsheet(params.Order, &flowsheet)
-	SetProviderInFlowsheet(params.Order, &flowsheet)
-	observations := PopulateSummaryStatistics(patient, settings, &flowsheet)
+	o.logger.Infow("sending hl7 oru message", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id)
+	// Return an error so we can retry the request
+	return adapter.SendDocument(ctx, destination, document)
+}
 
-	return flowsheet, observations, nil
+func (o *newOrderProcessor) calculateSummaryStatistics(params SummaryAndReportParameters, clinicSettings ClinicSettings) ([]*Observation, error) {
+	patient, err := params.GetMatchingPatient()
+	if err != nil {
+		return nil, err
+	}
+	return CalculateSummaryStatistics(patient, NewFlowsheetSettings(params.Match, clinicSettings)), nil
 }
 
-func (o *newOrderProcessor) createReportNote(ctx context.Context, params SummaryAndReportParameters, observations []*Observation) (Notes, error) {
+func (o *newOrderProcessor) createReportDocument(ctx context.Context, params SummaryAndReportParameters, observations []*Observation, clinicSettings ClinicSettings) (*ehr.Document, error) {
 	patient, err := params.GetMatchingPatient()
 	if err != nil {
 		return nil, err
 	}
 
-	reportingPeriod := report.GetReportingPeriodBounds(patient, days14)
+	profile := clinicSettings.Reports.GetProfile(params.Order.ProcedureCode)
+	reportingPeriod := report.GetReportingPeriodBounds(patient, profile.GetPeriodDuration())
 	if reportingPeriod == nil {
 		return nil, nil
 	}
 
-	var notes Notes
-	if params.ShouldReplacePrecedingReport() {
+	document := o.createDocument(params, patient)
+	if params.Match.Settings.Notes.IncludeGMI {
+		document.Observations = GMIObservations(observations)
+	}
+
+	// Reference the report which was uploaded in a previous attempt instead of generating it again
+	if upload := params.Progress.GetReportUpload(); upload != nil {
+		o.logger.Infow("reusing uploaded report", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id, "checksum", upload.Checksum)
+		document.FileName = NoteReportFileName
+		document.Upload = upload.Reference()
+		return &document, nil
+	}
+
+	buffered, err := o.generateBufferedReport(ctx, params, patient, *reportingPeriod, profile)
+	if err != nil {
+		return nil, err
+	}
+	defer o.closeBufferedReport(buffered)
+
+	upload, err := o.attachments.Attach(ctx, ehr.Destination{SourceId: params.Match.Settings.SourceId}, newAuditTarget(params.Match.Clinic.Id, patient.Id), &document, buffered)
+	if err != nil {
+		return nil, err
+	}
+	if upload != nil {
+		if err := params.Progress.RecordReportUpload(ctx, *upload); err != nil {
+			return nil, err
+		}
+	}
+
+	return &document, nil
+}
+
+// createDocument returns a new document, or a document which replaces the preceding report or the fallback note of
+// the order
+func (o *newOrderProcessor) createDocument(params SummaryAndReportParameters, patient clinics.PatientV1) ehr.Document {
+	document := ehr.Document{
+		Order: params.Order,
+		Id:    params.DocumentId,
+	}
+	if document.Id == "" {
+		document.Id = GenerateReportDocumentId(*params.Match.Clinic.Id, *patient.Id)
+	}
+
+	// The fallback note already replaced the preceding report, so the report replaces the fallback note
+	if params.Progress.IsReportPending() {
+		o.logger.Infow("creating replacement of the fallback note",
+			"orderId", params.Order.Id,
+			"clinicId", params.Match.Clinic.Id,
+			"patientId", patient.Id,
+		)
+		document.ReplacedId = document.Id
+	} else if params.ShouldReplacePrecedingReport() {
 		o.logger.Infow("creating replacement note",
-			"order", params.Order.Meta,
+			"orderId", params.Order.Id,
 			"clinicId", params.Match.Clinic.Id,
 			"patientId", patient.Id,
 			"precedingDocumentId", params.PrecedingDocument.Id.Hex(),
 		)
-		notes, err = CreateReplaceNotes(params.PrecedingDocument.Id.Hex())
-		if err != nil {
-			return nil, err
-		}
+		document.ReplacedId = params.PrecedingDocument.Id.Hex()
 	} else {
 		o.logger.Infow("creating new note",
-			"order", params.Order.Meta,
+			"orderId", params.Order.Id,
 			"clinicId", params.Match.Clinic.Id,
 			"patientId", patient.Id,
 		)
-		notes = CreateNewNotes()
-	}
-
-	notes.SetSourceFromClient(o.client)
-	notes.SetDestination(params.Match.Settings.DestinationIds.Notes)
-
-	notes.SetOrderId(params.Order)
-	notes.SetVisitLocationFromOrder(params.Order)
-	notes.SetVisitNumberFromOrder(params.Order)
-	notes.SetAccountNumberFromOrder(params.Order)
-
-	documentId := params.DocumentId
-	if documentId == "" {
-		documentId = GenerateReportDocumentId(*params.Match.Clinic.Id, *patient.Id)
 	}
 
-	notes.SetReportMetadata(documentId)
-	notes.SetPatientFromOrder(params.Order)
-	notes.SetProcedureFromOrder(params.Order)
-	notes.SetProviderFromOrder(params.Order)
-
-	if params.Match.Settings.Notes.IncludeGMI {
-		notecomponents := ObservationsToGMINoteComponents(observations)
-		notes.SetComponents(notecomponents)
-	}
+	return document
+}
 
+func (o *newOrderProcessor) generateReport(ctx context.Context, params SummaryAndReportParameters, patient clinics.PatientV1, reportingPeriod report.PeriodBounds, profile ReportProfile) (*report.Report, error) {
 	reportParameters := report.Parameters{
 		UserDetail: report.UserDetail{
 			UserId:      *patient.Id,
 			FullName:    patient.FullName,
 			DateOfBirth: patient.BirthDate.String(),
 		},
-		ReportDetail: report.ReportDetail{
-			Reports: []string{"all"},
-		},
+		ReportDetail: profile.ToReportDetail(params.Match.Clinic, reportingPeriod),
 	}
 	if params.Match.Clinic.Id != nil {
 		reportParameters.ClinicId = *params.Match.Clinic.Id
 	}
-	if params.Match.Clinic.Timezone != nil {
-		reportParameters.ReportDetail.TimezoneName = string(*params.Match.Clinic.Timezone)
-	}
 	if patient.Mrn != nil {
 		reportParameters.UserDetail.MRN = *patient.Mrn
 	}
-	if reportingPeriod != nil {
-		if !reportingPeriod.Start.IsZero() {
-			reportParameters.ReportDetail.StartDate = reportingPeriod.Start.Format(time.RFC3339)
-		}
-		if !reportingPeriod.End.IsZero() {
-			reportParameters.ReportDetail.EndDate = reportingPeriod.End.Format(time.RFC3339)
-		}
-	}
-	if params.Match.Clinic.PreferredBgUnits != "" {
-		reportParameters.ReportDetail.BgUnits = string(params.Match.Clinic.PreferredBgUnits)
-	}
 
 	rprt, err := o.reportGenerator.GenerateReport(ctx, reportParameters)
 	if err != nil {
 		return nil, fmt.Errorf("unable to generate report: %w", err)
 	}
 
-	if o.client.IsUploadFileEnabled() {
-		upload, err := o.client.UploadFile(ctx, NoteReportFileName, rprt.Document)
-		if err != nil {
-			return nil, fmt.Errorf("unable to upload report: %w", err)
-		}
-		if err := notes.SetUploadReference(NoteReportFileName, NoteReportFileType, *upload); err != nil {
-			return nil, fmt.Errorf("unable to set upload reference in notes: %w", err)
-		}
-	} else {
-		err = notes.SetEmbeddedFile(NoteReportFileName, NoteReportFileType, rprt.Document)
-		if err != nil {
-			return nil, fmt.Errorf("unable to embed report in notes: %w", err)
-		}
+	return rprt, nil
+}
+
+// generateBufferedReport generates the report and buffers it, so the size is checked and the document can be read
+// multiple times
+func (o *newOrderProcessor) generateBufferedReport(ctx context.Context, params SummaryAndReportParameters, patient clinics.PatientV1, reportingPeriod report.PeriodBounds, profile ReportProfile) (*BufferedReport, error) {
+	rprt, err := o.generateReport(ctx, params, patient, reportingPeriod, profile)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := rprt.Document.(io.Closer); ok {
+		defer closer.Close()
 	}
 
-	return notes, nil
+	buffered, err := o.attachments.Buffer(rprt.Document)
+	if err != nil {
+		return nil, err
+	}
+	o.logger.Infow("generated report", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", patient.Id, "size", buffered.Size, "checksum", buffered.Checksum)
+	return buffered, nil
+}
+
+func (o *newOrderProcessor) closeBufferedReport(buffered *BufferedReport) {
+	if err := buffered.Close(); err != nil {
+		o.logger.Warnw("unable to close buffered report", "error", err)
+	}
 }
 
-func (o *newOrderProcessor) handleUnknownProcedure(ctx context.Context, order models.NewOrder, match clinics.EhrMatchResponseV1) error {
-	o.logger.Infow("Unknown procedure code. Ignoring order.", "order", order.Meta, "settings", match.Settings)
+func (o *newOrderProcessor) handleUnknownProcedure(ctx context.Context, order ehr.Order, match clinics.EhrMatchResponseV1) error {
+	o.logger.Infow("Unknown procedure code. Ignoring order.", "orderId", order.Id, "settings", match.Settings)
 	return nil
 }
 
 func (o *newOrderProcessor) handleNoMatchingPatients(ctx context.Context, params SummaryAndReportParameters) error {
-	o.logger.Infow("No patients matched.", "order", params.Order.Meta)
+	o.logger.Infow("No patients matched.", "orderId", params.Order.Id)
+	event := NewOrderStatusErrorEvent(OrderStatusNoMatch, ErrNoMatchingPatients)
+	event.ClinicId = params.Match.Clinic.Id
+	params.Timeline.Record(ctx, event)
 	return o.sendMatchingResultsNotification(ctx, ResultsNotification{
 		IsSuccess: false,
+		Code:      ResultCodeNoMatches,
 		Message:   NoMatchingPatientsMessage,
 	}, params)
 }
 
 func (o *newOrderProcessor) handleMultipleMatchingPatients(ctx context.Context, params SummaryAndReportParameters) error {
-	o.logger.Infow("Multiple patients matched.", "order", params.Order.Meta)
+	o.logger.Infow("Multiple patients matched.", "orderId", params.Order.Id)
+	event := NewOrderStatusErrorEvent(OrderStatusMultipleMatches, ErrMultipleMatchingPatients)
+	event.ClinicId = params.Match.Clinic.Id
+	params.Timeline.Record(ctx, event)
 	return o.sendMatchingResultsNotification(ctx, ResultsNotification{
 		IsSuccess: false,
+		Code:      ResultCodeMultipleMatches,
 		Message:   MultipleMatchingPatientsMessage,
 	}, params)
 }
 
 func (o *newOrderProcessor) handleSuccessfulPatientMatch(ctx context.Context, params SummaryAndReportParameters) error {
-	o.logger.Infow("Found matching patient.", "order", params.Order.Meta)
+	o.logger.Infow("Found matching patient.", "orderId", params.Order.Id)
+	notification := ResultsNotification{
+		IsSuccess:       true,
+		Code:            ResultCodeSuccess,
+		Message:         SuccessfulMatchingMessage,
+		MatchMethod:     MatchMethodMrnDob,
+		MatchConfidence: MatchedMrnConfidence,
+	}
+	if params.PatientMatch != nil {
+		notification.Message = SuccessfulDemographicsMatchingMessage
+		notification.MatchMethod = params.PatientMatch.Method
+		notification.MatchConfidence = params.PatientMatch.Confidence
+	}
+	if params.Transition != nil {
+		notification.Details = params.Transition.ResultDetails()
+	}
+	if params.Progress.IsStepCompleted(OrderStepResultsSent) {
+		o.logger.Infow("the matching results were already sent", "orderId", params.Order.Id)
+		return nil
+	}
+	if err := o.sendMatchingResultsNotification(ctx, notification, params); err != nil {
+		return err
+	}
+	return params.Progress.CompleteStep(ctx, OrderStepResultsSent)
+}
+
+func (o *newOrderProcessor) handleDuplicateOrder(ctx context.Context, order ehr.Order, match clinics.EhrMatchResponseV1) error {
+	o.logger.Infow("order was already processed", "orderId", order.Id)
+	params := SummaryAndReportParameters{
+		Match: match,
+		Order: order,
+	}
 	return o.sendMatchingResultsNotification(ctx, ResultsNotification{
 		IsSuccess: true,
-		Message:   SuccessfulMatchingMessage,
+		Code:      ResultCodeDuplicateOrder,
+		Message:   DuplicateOrderMessage,
 	}, params)
 }
 
-func (o *newOrderProcessor) handleAccountCreationSuccess(ctx context.Context, order models.NewOrder, match clinics.EhrMatchResponseV1) error {
-	o.logger.Infow("account was successfully created", "order", order.Meta)
-	return o.sendAccountCreationResultsNotification(ctx, ResultsNotification{
-		IsSuccess: true,
-		Message:   SuccessfulAccountCreationMessage,
-	}, order, match)
-}
+// matchPatientByDemographics is used as a fallback when the order couldn't be matched by MRN. If there's a single
+// high confidence candidate and the clinic allows it, the MRN of the order is linked to the candidate and the candidate
+// is returned, so the order can be matched again. Otherwise, the candidates are queued for review by a clinician and
+// the result is sent back to the EHR.
+func (o *newOrderProcessor) matchPatientByDemographics(ctx context.Context, params SummaryAndReportParameters) (*PatientCandidate, error) {
+	clinicSettings, err := o.clinicSettings.GetClinicSettings(ctx, params.GetClinicId())
+	if err != nil {
+		return nil, fmt.Errorf("unable to get clinic settings: %w", err)
+	}
+	settings := clinicSettings.PatientMatching
+	if !settings.FallbackEnabled || params.Match.Clinic.Id == nil {
+		return nil, o.handleNoMatchingPatients(ctx, params)
+	}
 
-func (o *newOrderProcessor) handleAccountCreationError(ctx context.Context, err error, order models.NewOrder, match clinics.EhrMatchResponseV1) error {
-	o.logger.Warnw("unable to create account", "order", order.Meta, "error", err)
-	return o.sendAccountCreationResultsNotification(ctx, ResultsNotification{
-		IsSuccess: false,
-		Message:   err.Error(),
-	}, order, match)
-}
+	candidates, err := FindPatientCandidates(ctx, o.clinics, *params.Match.Clinic.Id, params.Order)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, o.handleNoMatchingPatients(ctx, params)
+	}
 
-func (o *newOrderProcessor) sendMatchingResultsNotification(ctx context.Context, notification ResultsNotification, params SummaryAndReportParameters) error {
-	o.logger.Infow("Sending matching results notification", "order", params.Order.Meta)
-	source := o.client.GetSource()
-	destinationId := params.Match.Settings.DestinationIds.Results
-	destinations := []struct {
-		ID   *string `json:"ID"`
-		Name *string `json:"Name"`
-	}{{
-		ID: &destinationId,
-	}}
-
-	results := NewResults()
-	results.Meta.Source = &source
-	results.Meta.Destinations = &destinations
-	SetResultsPatientFromOrder(params.Order, &results)
-	SetMatchingResult(notification, params.Order, &results)
-	SetAccountNumberInResult(params.Order, &results)
-	SetVisitNumberInResult(params.Order, &results)
-	SetVisitLocationInResult(params.Order, &results)
-
-	if err := o.client.Send(ctx, results); err != nil {
-		// Return an error so we can retry the request
-		return fmt.Errorf("unable to send results: %w", err)
+	// Orders without MRN can't be linked, but the candidates are still queued for review
+	mrn, err := params.Order.GetMrn(params.Match.Settings.MrnIdType)
+	if err != nil && !errors.Is(err, ehr.ErrMrnMissing) {
+		return nil, err
 	}
 
-	return nil
-}
+	var confident []PatientCandidate
+	for _, candidate := range candidates {
+		if candidate.Confidence >= settings.GetMinimumConfidence() {
+			confident = append(confident, candidate)
+		}
+	}
 
-func (o *newOrderProcessor) sendAccountCreationResultsNotification(ctx context.Context, notification ResultsNotification, order models.NewOrder, match clinics.EhrMatchResponseV1) error {
-	o.logger.Infow("Sending account creation results notification", "order", order.Meta)
-	source := o.client.GetSource()
-	destinationId := match.Settings.DestinationIds.Results
-	destinations := []struct {
-		ID   *string `json:"ID"`
-		Name *string `json:"Name"`
-	}{{
-		ID: &destinationId,
-	}}
-
-	results := NewResults()
-	results.Meta.Source = &source
-	results.Meta.Destinations = &destinations
-	SetResultsPatientFromOrder(order, &results)
-	SetAccountCreationResults(notification, order, &results)
-	SetAccountNumberInResult(order, &results)
-	SetVisitNumberInResult(order, &results)
-	SetVisitLocationInResult(order, &results)
-
-	if err := o.client.Send(ctx, results); err != nil {
-		// Return an error so we can retry the request
-		return fmt.Errorf("unable to send results: %w", err)
+	// The MRN of a patient which is already linked to a different MRN is never replaced automatically, because the
+	// patient is likely a different person with the same demographics
+	if len(confident) == 1 && settings.AutoLinkMrn && mrn != nil && !HasConflictingMrn(confident[0].Patient, mrn) {
+		candidate := confident[0]
+		if err := o.linkPatientMrn(ctx, params, candidate.Patient, mrn); err != nil {
+			return nil, err
+		}
+		o.logger.Infow("linked mrn to patient matched by demographics", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "patientId", candidate.Patient.Id, "method", candidate.Method, "confidence", candidate.Confidence)
+		return &candidate, nil
 	}
 
-	return nil
-}
+	code := ResultCodeMatchReviewRequired
+	message := PossibleMatchingPatientsMessage
+	review := candidates
+	if len(confident) == 1 {
+		message = ConfirmMatchingPatientMessage
+		if HasConflictingMrn(confident[0].Patient, mrn) {
+			message = ConflictingMrnMessage
+		}
+		review = confident
+	}
 
-func GetBirthDateFromOrder(order models.NewOrder) (codegentypes.Date, error) {
-	if order.Patient.Demographics == nil || order.Patient.Demographics.DOB == nil {
-		return codegentypes.Date{}, fmt.Errorf("date of birth is missing")
+	if err := o.tagPatientsForReview(ctx, params, review, settings.GetReviewTag()); err != nil {
+		return nil, err
 	}
 
-	birthDate := &codegentypes.Date{}
-	err := birthDate.UnmarshalText([]byte(*order.Patient.Demographics.DOB))
-	if err != nil {
-		return *birthDate, err
+	o.logger.Infow("queued patients matched by demographics for review", "orderId", params.Order.Id, "clinicId", params.Match.Clinic.Id, "candidates", len(review))
+	return nil, o.sendMatchingResultsNotification(ctx, ResultsNotification{
+		IsSuccess:       false,
+		Code:            code,
+		Message:         message,
+		MatchMethod:     review[0].Method,
+		MatchConfidence: review[0].Confidence,
+	}, params)
+}
+
+// HasConflictingMrn returns true if the patient is already linked to an MRN which is different from the MRN of the order
+func HasConflictingMrn(patient clinics.PatientV1, mrn *string) bool {
+	if patient.Mrn == nil || *patient.Mrn == "" {
+		return false
 	}
-	return *birthDate, nil
+	return mrn == nil || *patient.Mrn != *mrn
 }
 
-func GetEmailAddressFromOrder(order models.NewOrder) (*string, error) {
-	birthDate, err := GetBirthDateFromOrder(order)
+func (o *newOrderProcessor) linkPatientMrn(ctx context.Context, params SummaryAndReportParameters, patient clinics.PatientV1, mrn *string) error {
+	update := clinics.UpdatePatientJSONRequestBody{
+		Email:         patient.Email,
+		BirthDate:     patient.BirthDate,
+		FullName:      patient.FullName,
+		Mrn:           mrn,
+		TargetDevices: patient.TargetDevices,
+		Tags:          patient.Tags,
+	}
+	resp, err := o.clinics.UpdatePatientWithResponse(ctx, *params.Match.Clinic.Id, *patient.Id, update)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("unexpected status code %v linking mrn of patient %s", resp.StatusCode(), *patient.Id)
+	}
+	return nil
+}
 
-	var email *string
-	if shouldUseGuarantorEmail(birthDate) {
-		email, err = GetGuarantorEmailAddressFromOrder(order)
+func (o *newOrderProcessor) tagPatientsForReview(ctx context.Context, params SummaryAndReportParameters, candidates []PatientCandidate, tagName string) error {
+	clinicId := *params.Match.Clinic.Id
+	tag, ok := o.getExistingTags(params.Match.Clinic)[tagName]
+	if !ok {
+		resp, err := o.clinics.CreatePatientTagWithResponse(ctx, clinicId, clinics.CreatePatientTagJSONRequestBody{Name: tagName})
 		if err != nil {
-			return nil, err
+			return err
 		}
-	} else {
-		email, err = GetPatientEmailAddressFromOrder(order)
+		if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusCreated {
+			return fmt.Errorf("unexpected status code %v when creating tag %s", resp.StatusCode(), tagName)
+		}
+
+		clinic, err := o.clinics.GetClinicWithResponse(ctx, clinicId)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if clinic.StatusCode() != http.StatusOK {
+			return fmt.Errorf("unexpected status code %v when fetching clinic with id %s", clinic.StatusCode(), clinicId)
+		}
+		if tag, ok = o.getExistingTags(*clinic.JSON200)[tagName]; !ok {
+			return fmt.Errorf("unable to find tag %s after creation", tagName)
 		}
 	}
 
-	if email == nil {
-		return nil, nil
+	for _, candidate := range candidates {
+		patient := candidate.Patient
+		var tags clinics.PatientTagIdsV1
+		if patient.Tags != nil {
+			tags = *patient.Tags
+		}
+		if slices.Contains(tags, *tag.Id) {
+			continue
+		}
+		tags = append(tags, *tag.Id)
+
+		update := clinics.UpdatePatientJSONRequestBody{
+			Email:         patient.Email,
+			BirthDate:     patient.BirthDate,
+			FullName:      patient.FullName,
+			Mrn:           patient.Mrn,
+			TargetDevices: patient.TargetDevices,
+			Tags:          &tags,
+		}
+		resp, err := o.clinics.UpdatePatientWithResponse(ctx, clinicId, *patient.Id, update)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode() != http.StatusOK {
+			return fmt.Errorf("unexpected status code %v tagging patient %s for review", resp.StatusCode(), *patient.Id)
+		}
 	}
 
-	addr, err := mail.ParseAddress(*email)
+	return nil
+}
+
+func (o *newOrderProcessor) handleAccountCreationSuccess(ctx context.Context, create CreateAccount, match clinics.EhrMatchResponseV1, details []ehr.ResultDetail) error {
+	o.logger.Infow("account was successfully created", "orderId", create.Order.Id)
+	if create.Progress.IsStepCompleted(OrderStepResultsSent) {
+		o.logger.Infow("the account creation results were already sent", "orderId", create.Order.Id)
+		return nil
+	}
+	err := o.sendAccountCreationResultsNotification(ctx, ResultsNotification{
+		IsSuccess: true,
+		Code:      ResultCodeSuccess,
+		Message:   SuccessfulAccountCreationMessage,
+		Details:   details,
+	}, create, match)
 	if err != nil {
-		return nil, fmt.Errorf("email address is invalid")
+		return err
 	}
+	return create.Progress.CompleteStep(ctx, OrderStepResultsSent)
+}
 
-	return &addr.Address, nil
+func (o *newOrderProcessor) handleAccountCreationError(ctx context.Context, err error, create CreateAccount, match clinics.EhrMatchResponseV1) error {
+	o.logger.Warnw("unable to create account", "orderId", create.Order.Id, "error", err)
+	event := NewOrderStatusErrorEvent(OrderStatusAccountCreationFailed, err)
+	event.ClinicId = match.Clinic.Id
+	create.Timeline.Record(ctx, event)
+	return o.sendAccountCreationResultsNotification(ctx, ResultsNotification{
+		IsSuccess: false,
+		Code:      GetResultCode(err),
+		Message:   err.Error(),
+	}, create, match)
 }
 
-func shouldUseGuarantorEmail(birthDate codegentypes.Date) bool {
-	now := time.Now()
-	cutoff := birthDate.AddDate(MinimumAgeSelfOwnedAccountYears, 0, 0)
-	return !cutoff.Before(now)
+func (o *newOrderProcessor) sendMatchingResultsNotification(ctx context.Context, notification ResultsNotification, params SummaryAndReportParameters) error {
+	o.logger.Infow("Sending matching results notification", "orderId", params.Order.Id)
+	results := newResults(notification, ehr.OperationMatching, params.Order)
+	return o.sendResults(ctx, notification, results, params.Order, params.Match, params.Progress, params.Timeline)
 }
 
-func GetPatientEmailAddressFromOrder(order models.NewOrder) (*string, error) {
-	if order.Patient.Demographics == nil || order.Patient.Demographics.EmailAddresses == nil || len(*order.Patient.Demographics.EmailAddresses) == 0 {
-		return nil, nil
-	}
+func (o *newOrderProcessor) sendAccountCreationResultsNotification(ctx context.Context, notification ResultsNotification, create CreateAccount, match clinics.EhrMatchResponseV1) error {
+	o.logger.Infow("Sending account creation results notification", "orderId", create.Order.Id)
+	results := newResults(notification, ehr.OperationAccountCreation, create.Order)
+	return o.sendResults(ctx, notification, results, create.Order, match, create.Progress, create.Timeline)
+}
 
-	email, ok := (*order.Patient.Demographics.EmailAddresses)[0].(string)
-	if !ok {
-		return nil, fmt.Errorf("patient email address is not a string")
+func newResults(notification ResultsNotification, operation ehr.Operation, order ehr.Order) ehr.Results {
+	return ehr.Results{
+		Order:           order,
+		Operation:       operation,
+		IsSuccess:       notification.IsSuccess,
+		Code:            notification.Code,
+		Message:         notification.Message,
+		MatchMethod:     notification.MatchMethod,
+		MatchConfidence: notification.MatchConfidence,
+		Details:         notification.Details,
 	}
-
-	return &email, nil
 }
 
-func GetGuarantorEmailAddressFromOrder(order models.NewOrder) (*string, error) {
-	if order.Visit == nil || order.Visit.Guarantor == nil || order.Visit.Guarantor.EmailAddresses == nil || len(*order.Visit.Guarantor.EmailAddresses) == 0 {
-		return nil, nil
+func (o *newOrderProcessor) sendResults(ctx context.Context, notification ResultsNotification, results ehr.Results, order ehr.Order, match clinics.EhrMatchResponseV1, progress *OrderProgress, timeline *OrderTimeline) error {
+	var clinicId string
+	if match.Clinic.Id != nil {
+		clinicId = *match.Clinic.Id
 	}
-
-	email, ok := (*order.Visit.Guarantor.EmailAddresses)[0].(string)
-	if !ok {
-		return nil, fmt.Errorf("guarantor email address is not a string")
+	clinicSettings, err := o.clinicSettings.GetClinicSettings(ctx, clinicId)
+	if err != nil {
+		return fmt.Errorf("unable to get clinic settings: %w", err)
 	}
 
-	return &email, nil
-}
-
-func GetFullNameFromOrder(order models.NewOrder) (string, error) {
-	if order.Patient.Demographics == nil {
-		return "", fmt.Errorf("patient demographics is missing")
+	resultsDelivery := delivery{
+		PayloadType:  PayloadTypeResults,
+		Destinations: clinicSettings.Routing.GetDestinations(PayloadTypeResults, order, match.Settings.DestinationIds.Results),
+		Progress:     progress,
+		Timeline:     timeline,
+		ClinicId:     match.Clinic.Id,
 	}
-	if order.Patient.Demographics.FirstName == nil || len(*order.Patient.Demographics.FirstName) == 0 {
-		return "", fmt.Errorf("first name is missing")
+	if match.Patients != nil && len(*match.Patients) == 1 {
+		resultsDelivery.PatientId = (*match.Patients)[0].Id
 	}
-	if order.Patient.Demographics.LastName == nil || len(*order.Patient.Demographics.LastName) == 0 {
-		return "", fmt.Errorf("last name is missing")
+	// Only the delivery of successful results is tracked, because failures are reported again when the order is retried
+	if notification.Code == ResultCodeSuccess {
+		resultsDelivery.Step = OrderStepResultsSent
 	}
-	name := strings.Join([]string{*order.Patient.Demographics.FirstName, *order.Patient.Demographics.LastName}, " ")
-	return name, nil
+
+	return o.deliver(ctx, resultsDelivery, func(destinationId string) error {
+		destination := ehr.Destination{SourceId: match.Settings.SourceId, Id: destinationId}
+		if err := o.adapter.SendResults(ctx, destination, results); err != nil {
+			// Return an error so we can retry the request
+			return fmt.Errorf("unable to send results: %w", err)
+		}
+		return nil
+	})
 }
 
-func GetMrnFromOrder(order models.NewOrder, mrnIDType string) (*string, error) {
-	if len(order.Patient.Identifiers) == 0 {
-		return nil, fmt.Errorf("mrn is missing")
+// delivery describes how a payload is sent to the destinations of a clinic
+type delivery struct {
+	PayloadType  PayloadType
+	Destinations []string
+	// Step is used to skip the destinations to which the payload was delivered in a previous attempt.
+	// The delivery isn't tracked if the step is empty.
+	Step OrderStep
+	// Status is recorded in the timeline of the order after each successful delivery if set
+	Status    OrderStatus
+	Progress  *OrderProgress
+	Timeline  *OrderTimeline
+	ClinicId  *string
+	PatientId *string
+	// Fingerprint of the summary and report is stored for each destination after a successful delivery if set
+	Fingerprint string
+}
+
+func newDelivery(params SummaryAndReportParameters, patient clinics.PatientV1, payloadType PayloadType, destinations []string, step OrderStep, status OrderStatus) delivery {
+	return delivery{
+		PayloadType:  payloadType,
+		Destinations: destinations,
+		Step:         step,
+		Status:       status,
+		Progress:     params.Progress,
+		Timeline:     params.Timeline,
+		ClinicId:     params.Match.Clinic.Id,
+		PatientId:    patient.Id,
 	}
-	var mrn *string
-	for _, identifier := range order.Patient.Identifiers {
-		if strings.EqualFold(identifier.IDType, mrnIDType) {
-			mrn = &identifier.ID
-			break
+}
+
+// deliver sends the payload to each destination. The payload is delivered to the remaining destinations even if
+// the delivery to one of them fails. The errors of all failed deliveries are returned, so the order can be retried.
+func (o *newOrderProcessor) deliver(ctx context.Context, d delivery, send func(destinationId string) error) error {
+	var errs []error
+	for _, destinationId := range d.Destinations {
+		if d.Step != "" && d.Progress.IsDestinationStepCompleted(d.Step, destinationId) {
+			o.logger.Infow("the payload was already delivered", "payloadType", d.PayloadType, "destinationId", destinationId)
+			continue
+		}
+
+		err := send(destinationId)
+		o.auditor.Record(ctx, d.auditEvent(destinationId, err))
+		if err != nil {
+			o.logger.Warnw("unable to deliver payload", "payloadType", d.PayloadType, "destinationId", destinationId, "error", err)
+			event := NewOrderStatusErrorEvent(OrderStatusDeliveryFailed, err)
+			event.ClinicId = d.ClinicId
+			event.PatientId = d.PatientId
+			event.DestinationId = destinationId
+			d.Timeline.Record(ctx, event)
+			errs = append(errs, err)
+			continue
+		}
+
+		if d.Step != "" {
+			if err := d.Progress.CompleteDestinationStep(ctx, d.Step, destinationId); err != nil {
+				return err
+			}
+		}
+		o.setFingerprint(ctx, newReportFingerprintKey(d.ClinicId, d.PatientId, d.PayloadType, destinationId), d.Fingerprint)
+		if d.Status != "" {
+			d.Timeline.Record(ctx, OrderStatusEvent{
+				Status:        d.Status,
+				ClinicId:      d.ClinicId,
+				PatientId:     d.PatientId,
+				DestinationId: destinationId,
+			})
 		}
 	}
+	return errors.Join(errs...)
+}
+
+func (d delivery) auditEvent(destinationId string, err error) audit.Event {
+	return NewPHISentEvent(newAuditTarget(d.ClinicId, d.PatientId), d.PayloadType, destinationId, err)
+}
 
-	if mrn == nil {
-		return nil, fmt.Errorf("mrn is missing")
+func newAuditTarget(clinicId *string, patientId *string) audit.Target {
+	target := audit.Target{}
+	if clinicId != nil {
+		target.ClinicId = *clinicId
 	}
+	if patientId != nil {
+		target.PatientId = *patientId
+	}
+	return target
+}
 
-	return mrn, nil
+// NewPHISentEvent returns the audit event which is recorded for each attempt to send a payload with PHI to the EHR
+func NewPHISentEvent(target audit.Target, payloadType PayloadType, destinationId string, err error) audit.Event {
+	event := audit.NewEvent(audit.ActionPHISent, target, err)
+	event.Details = map[string]string{
+		"payloadType":   string(payloadType),
+		"destinationId": destinationId,
+	}
+	return event
 }
 
-func NewMatchRequest(documentId string, order models.NewOrder) clinics.EhrMatchRequestV1 {
+func NewMatchRequest(documentId string) clinics.EhrMatchRequestV1 {
 	return clinics.EhrMatchRequestV1{
 		MessageRef: &clinics.EhrMatchMessageRefV1{
 			DocumentId: documentId,
-			DataModel:  clinics.EhrMatchMessageRefV1DataModel(order.Meta.DataModel),
-			EventType:  clinics.EhrMatchMessageRefV1EventType(order.Meta.EventType),
+			DataModel:  clinics.EhrMatchMessageRefV1DataModel(DataModelOrder),
+			EventType:  clinics.EhrMatchMessageRefV1EventType(EventTypeNewOrder),
 		},
 	}
 }
 
 type EnableReports struct {
 	DocumentId string
-	Order      models.NewOrder
-	OnSuccess  func(context.Context, SummaryAndReportParameters) error
+	// Envelope is the message of the order, which is kept by the subscription
+	Envelope  models.MessageEnvelope
+	Order     ehr.Order
+	OnSuccess func(context.Context, SummaryAndReportParameters) error
+	Progress  *OrderProgress
+	Timeline  *OrderTimeline
 }
 
 func (e EnableReports) GetMatchRequest() clinics.EhrMatchRequestV1 {
 	action := clinics.ENABLEREPORTS
-	request := NewMatchRequest(e.DocumentId, e.Order)
+	request := NewMatchRequest(e.DocumentId)
 	request.Patients = &clinics.EhrMatchRequestPatientsOptionsV1{
 		Criteria: []clinics.EhrMatchRequestPatientsOptionsV1Criteria{clinics.MRNDOB},
 	}
@@ -919,12 +1620,16 @@ func (e EnableReports) GetMatchRequest() clinics.EhrMatchRequestV1 {
 
 type DisableReports struct {
 	DocumentId string
-	Order      models.NewOrder
+	// Envelope is the message of the order, which is kept by the subscription if it didn't exist
+	Envelope models.MessageEnvelope
+	Order    ehr.Order
+	Progress *OrderProgress
+	Timeline *OrderTimeline
 }
 
 func (d DisableReports) GetMatchRequest() clinics.EhrMatchRequestV1 {
 	action := clinics.DISABLEREPORTS
-	request := NewMatchRequest(d.DocumentId, d.Order)
+	request := NewMatchRequest(d.DocumentId)
 	request.Patients = &clinics.EhrMatchRequestPatientsOptionsV1{
 		Criteria: []clinics.EhrMatchRequestPatientsOptionsV1Criteria{clinics.MRNDOB},
 	}
@@ -934,11 +1639,13 @@ func (d DisableReports) GetMatchRequest() clinics.EhrMatchRequestV1 {
 
 type CreateAccount struct {
 	DocumentId string
-	Order      models.NewOrder
+	Order      ehr.Order
+	Progress   *OrderProgress
+	Timeline   *OrderTimeline
 }
 
 func (c CreateAccount) GetMatchRequest() clinics.EhrMatchRequestV1 {
-	request := NewMatchRequest(c.DocumentId, c.Order)
+	request := NewMatchRequest(c.DocumentId)
 	request.Patients = &clinics.EhrMatchRequestPatientsOptionsV1{
 		Criteria: []clinics.EhrMatchRequestPatientsOptionsV1Criteria{clinics.MRN, clinics.DOBFULLNAME},
 	}
@@ -947,25 +1654,20 @@ func (c CreateAccount) GetMatchRequest() clinics.EhrMatchRequestV1 {
 
 type CreateAccountEnableReports struct {
 	DocumentId string
-	Order      models.NewOrder
+	Envelope   models.MessageEnvelope
+	Order      ehr.Order
+	Progress   *OrderProgress
+	Timeline   *OrderTimeline
 }
 
 func (c CreateAccountEnableReports) GetMatchRequest() clinics.EhrMatchRequestV1 {
-	request := NewMatchRequest(c.DocumentId, c.Order)
+	request := NewMatchRequest(c.DocumentId)
 	request.Patients = &clinics.EhrMatchRequestPatientsOptionsV1{
 		Criteria: []clinics.EhrMatchRequestPatientsOptionsV1Criteria{clinics.MRNDOB},
 	}
 	return request
 }
 
-func GetProcedureCode(order models.NewOrder) string {
-	var procedureCode string
-	if order.Order.Procedure != nil && order.Order.Procedure.Code != nil {
-		procedureCode = *order.Order.Procedure.Code
-	}
-	return procedureCode
-}
-
 func ProcedureCodesMatch(code string, configuration *string) bool {
 	if code == "" || configuration == nil || *configuration == "" {
 		return false
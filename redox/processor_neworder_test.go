@@ -1,9 +1,14 @@
 package redox_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -14,9 +19,16 @@ import (
 	"go.uber.org/mock/gomock"
 	"go.uber.org/zap"
 
+	"github.com/tidepool-org/clinic-worker/audit"
+	testAudit "github.com/tidepool-org/clinic-worker/audit/test"
+	"github.com/tidepool-org/clinic-worker/ehr"
+	ehrTest "github.com/tidepool-org/clinic-worker/ehr/test"
+	"github.com/tidepool-org/clinic-worker/fhir"
+	testFhir "github.com/tidepool-org/clinic-worker/fhir/test"
+	"github.com/tidepool-org/clinic-worker/hl7"
 	"github.com/tidepool-org/clinic-worker/redox"
 	testRedox "github.com/tidepool-org/clinic-worker/redox/test"
-	"github.com/tidepool-org/clinic-worker/report"
+	testStore "github.com/tidepool-org/clinic-worker/store/test"
 	"github.com/tidepool-org/clinic-worker/test"
 	clinics "github.com/tidepool-org/clinic/client"
 	models "github.com/tidepool-org/clinic/redox_models"
@@ -28,15 +40,52 @@ var _ = Describe("NewOrderProcessor", func() {
 	var clinicCtrl *gomock.Controller
 	var clinicClient *clinics.MockClientWithResponsesInterface
 	var processor redox.NewOrderProcessor
+	var clinicSettings *testRedox.ClinicSettingsProvider
+	var ledger *testRedox.OrderLedger
+	var statusRecorder *testRedox.OrderStatusRecorder
+	var reportGenerator *testRedox.ReportGenerator
+	var subscriptions *testRedox.SubscriptionStore
+	var contacts *testRedox.PatientContactStore
+	var auditor *testAudit.Auditor
+	var workItems *testRedox.WorkItemStore
+	var shorelineClient shoreline.Client
+	var hl7Dir string
+
+	// newProcessor returns a processor which delivers the payloads of orders with the adapter
+	newProcessor := func(adapter ehr.Adapter) redox.NewOrderProcessor {
+		hl7Config := hl7.Config{Destinations: hl7.Destinations{
+			"drop": {Type: hl7.TransportTypeFile, Directory: hl7Dir},
+		}}
+		attachments, err := redox.NewReportAttachments(adapter, auditor, zap.NewNop().Sugar())
+		Expect(err).ToNot(HaveOccurred())
+		return redox.NewNewOrderProcessor(clinicClient, adapter, reportGenerator, shorelineClient, clinicSettings, ledger, statusRecorder, testRedox.NewReportFingerprintStore(), attachments, subscriptions, contacts, workItems, hl7Config, auditor, zap.NewNop().Sugar())
+	}
 
 	BeforeEach(func() {
 		redoxClient = testRedox.NewTestRedoxClient("testSourceId", "testSourceName")
 		clinicCtrl = gomock.NewController(GinkgoT())
 		clinicClient = clinics.NewMockClientWithResponsesInterface(clinicCtrl)
-		shorelineClient := &testRedox.ShorelineNoUser{Client: shoreline.NewMock("test")}
-		processor = redox.NewNewOrderProcessor(clinicClient, redoxClient, report.NewSampleReportGenerator(), shorelineClient, zap.NewNop().Sugar())
+		shorelineClient = &testRedox.ShorelineNoUser{Client: shoreline.NewMock("test")}
+		clinicSettings = &testRedox.ClinicSettingsProvider{}
+		ledger = testRedox.NewOrderLedger()
+		statusRecorder = &testRedox.OrderStatusRecorder{}
+		reportGenerator = &testRedox.ReportGenerator{}
+		subscriptions = &testRedox.SubscriptionStore{}
+		contacts = &testRedox.PatientContactStore{}
+		auditor = &testAudit.Auditor{}
+		workItems = testRedox.NewWorkItemStore()
+		hl7Dir = GinkgoT().TempDir()
+		processor = newProcessor(redox.NewAdapter(redoxClient))
 	})
 
+	// process encodes the order in the message of the envelope, so the changes of the order made by a test are processed
+	process := func(envelope models.MessageEnvelope, order models.NewOrder) error {
+		message, err := bson.Marshal(order)
+		Expect(err).ToNot(HaveOccurred())
+		envelope.Message = message
+		return processor.ProcessOrder(context.Background(), envelope)
+	}
+
 	Describe("ProcessOrder", func() {
 		BeforeEach(func() {
 			response := &clinics.EhrMatchResponseV1{}
@@ -132,7 +181,7 @@ var _ = Describe("NewOrderProcessor", func() {
 						JSON200: &(*matchResponse.JSON200.Patients)[0],
 					}, nil)
 
-					Expect(processor.ProcessOrder(context.Background(), envelope, order)).To(Succeed())
+					Expect(process(envelope, order)).To(Succeed())
 				})
 
 				It("creates missing tags", func() {
@@ -186,7 +235,7 @@ var _ = Describe("NewOrderProcessor", func() {
 						JSON200: &(*matchResponse.JSON200.Patients)[0],
 					}, nil)
 
-					Expect(processor.ProcessOrder(context.Background(), envelope, order)).To(Succeed())
+					Expect(process(envelope, order)).To(Succeed())
 				})
 
 				It("ignores tags if creation fails with bad request", func() {
@@ -238,7 +287,95 @@ var _ = Describe("NewOrderProcessor", func() {
 						JSON200: &(*matchResponse.JSON200.Patients)[0],
 					}, nil)
 
-					Expect(processor.ProcessOrder(context.Background(), envelope, order)).To(Succeed())
+					Expect(process(envelope, order)).To(Succeed())
+				})
+
+				It("adds tags to the existing patient tags in additive mode", func() {
+					clinicSettings.Default.Tags = redox.TagSettings{Mode: redox.TagModeAdditive}
+					(*matchResponse.JSON200.Patients)[0].Tags = &clinics.PatientTagIdsV1{"5", "1"}
+
+					clinicClient.EXPECT().
+						GetClinicWithResponse(gomock.Any(), *matchResponse.JSON200.Clinic.Id).
+						Return(&clinics.GetClinicResponse{
+							HTTPResponse: &http.Response{
+								StatusCode: http.StatusOK,
+							},
+							JSON200: &matchResponse.JSON200.Clinic,
+						}, nil)
+
+					clinicClient.EXPECT().UpdatePatientWithResponse(gomock.Any(),
+						gomock.Eq(*matchResponse.JSON200.Clinic.Id),
+						gomock.Eq(*((*matchResponse.JSON200.Patients)[0]).Id),
+						testRedox.MatchArg(func(body clinics.UpdatePatientJSONRequestBody) bool {
+							return body.Tags != nil && len(*body.Tags) == 3 && testRedox.PatientHasTags(body.Tags, []string{"5", "1", "2"})
+						}),
+					).Return(&clinics.UpdatePatientResponse{
+						HTTPResponse: &http.Response{
+							StatusCode: http.StatusOK,
+						},
+						JSON200: &(*matchResponse.JSON200.Patients)[0],
+					}, nil)
+
+					Expect(process(envelope, order)).To(Succeed())
+				})
+
+				It("maps the values of the clinical info to tag names with the clinic rules", func() {
+					clinicSettings.Default.Tags = redox.TagSettings{
+						Rules: []redox.TagRule{{
+							Codes:     []string{"TIDEPOOL_TAGS"},
+							Separator: ",",
+							Pattern:   "^(T1D)$",
+							Names:     map[string]string{"T1D": "Type 1"},
+						}},
+					}
+					typeOneId := "4"
+					matchResponse.JSON200.Clinic.PatientTags = &[]clinics.PatientTagV1{{Id: &typeOneId, Name: "Type 1"}}
+
+					clinicClient.EXPECT().
+						GetClinicWithResponse(gomock.Any(), *matchResponse.JSON200.Clinic.Id).
+						Return(&clinics.GetClinicResponse{
+							HTTPResponse: &http.Response{
+								StatusCode: http.StatusOK,
+							},
+							JSON200: &matchResponse.JSON200.Clinic,
+						}, nil)
+
+					clinicClient.EXPECT().UpdatePatientWithResponse(gomock.Any(),
+						gomock.Eq(*matchResponse.JSON200.Clinic.Id),
+						gomock.Eq(*((*matchResponse.JSON200.Patients)[0]).Id),
+						testRedox.MatchArg(func(body clinics.UpdatePatientJSONRequestBody) bool {
+							return body.Tags != nil && len(*body.Tags) == 1 && testRedox.PatientHasTags(body.Tags, []string{"4"})
+						}),
+					).Return(&clinics.UpdatePatientResponse{
+						HTTPResponse: &http.Response{
+							StatusCode: http.StatusOK,
+						},
+						JSON200: &(*matchResponse.JSON200.Patients)[0],
+					}, nil)
+
+					Expect(process(envelope, order)).To(Succeed())
+				})
+
+				It("removes the tags of disable orders when configured", func() {
+					clinicSettings.Default.Tags = redox.TagSettings{RemoveOnDisable: true}
+					disableCode := "PRO1091"
+					order.Order.Procedure.Code = &disableCode
+					(*matchResponse.JSON200.Patients)[0].Tags = &clinics.PatientTagIdsV1{"1", "5", "2"}
+
+					clinicClient.EXPECT().UpdatePatientWithResponse(gomock.Any(),
+						gomock.Eq(*matchResponse.JSON200.Clinic.Id),
+						gomock.Eq(*((*matchResponse.JSON200.Patients)[0]).Id),
+						testRedox.MatchArg(func(body clinics.UpdatePatientJSONRequestBody) bool {
+							return body.Tags != nil && len(*body.Tags) == 1 && testRedox.PatientHasTags(body.Tags, []string{"5"})
+						}),
+					).Return(&clinics.UpdatePatientResponse{
+						HTTPResponse: &http.Response{
+							StatusCode: http.StatusOK,
+						},
+						JSON200: &(*matchResponse.JSON200.Patients)[0],
+					}, nil)
+
+					Expect(process(envelope, order)).To(Succeed())
 				})
 			})
 
@@ -249,8 +386,22 @@ var _ = Describe("NewOrderProcessor", func() {
 						Return(matchResponse, nil)
 				})
 
+				It("sends results, flowsheet and notes with the source of the clinic", func() {
+					source := testRedox.NewTestRedoxClient("dedicatedSourceId", "dedicatedSourceName")
+					redoxClient.Sources = map[string]*testRedox.RedoxClient{matchResponse.JSON200.Settings.SourceId: source}
+
+					Expect(process(envelope, order)).To(Succeed())
+					Expect(redoxClient.Sent).To(BeEmpty())
+					Expect(source.Sent).To(HaveLen(3))
+					for _, payload := range source.Sent {
+						if flowsheet, ok := payload.(models.NewFlowsheet); ok {
+							Expect(*flowsheet.Meta.Source.ID).To(Equal("dedicatedSourceId"))
+						}
+					}
+				})
+
 				It("send results, flowsheet and notes when patient and clinic successfully matched", func() {
-					Expect(processor.ProcessOrder(context.Background(), envelope, order)).To(Succeed())
+					Expect(process(envelope, order)).To(Succeed())
 					Expect(redoxClient.Sent).To(HaveLen(3))
 
 					var results models.NewResults
@@ -295,9 +446,340 @@ var _ = Describe("NewOrderProcessor", func() {
 					Expect(redoxClient.Uploaded).To(BeEmpty())
 				})
 
+				It("records the status timeline of the order", func() {
+					Expect(process(envelope, order)).To(Succeed())
+					Expect(statusRecorder.Statuses()).To(Equal([]redox.OrderStatus{
+						redox.OrderStatusReceived,
+						redox.OrderStatusMatched,
+						redox.OrderStatusReportsEnabled,
+						redox.OrderStatusFlowsheetSent,
+						redox.OrderStatusNoteSent,
+					}))
+					for _, event := range statusRecorder.Events {
+						Expect(event.DocumentId).To(Equal(envelope.Id.Hex()))
+						Expect(event.OrderId).To(Equal(order.Order.ID))
+						Expect(event.Code).To(Equal(redox.ResultCodeSuccess))
+					}
+					Expect(statusRecorder.Events[1].PatientId).To(Equal((*matchResponse.JSON200.Patients)[0].Id))
+				})
+
+				It("subscribes the patient to scheduled summaries and reports", func() {
+					Expect(process(envelope, order)).To(Succeed())
+
+					patient := (*matchResponse.JSON200.Patients)[0]
+					subscription := subscriptions.Get(*matchResponse.JSON200.Clinic.Id, *patient.Id)
+					Expect(subscription).ToNot(BeNil())
+					Expect(subscription.LastMatchedOrder.Id).To(Equal(envelope.Id))
+
+					decoded := models.NewOrder{}
+					Expect(bson.Unmarshal(subscription.LastMatchedOrder.Message, &decoded)).To(Succeed())
+					Expect(decoded.Order.ID).To(Equal(order.Order.ID))
+				})
+
+				It("reports the state of the subscription before and after enabling reports in the results", func() {
+					Expect(process(envelope, order)).To(Succeed())
+
+					results, ok := redoxClient.Sent[0].(models.NewResults)
+					Expect(ok).To(BeTrue())
+					values := map[string]string{}
+					for _, result := range results.Orders[0].Results {
+						values[result.Code] = result.Value
+					}
+					Expect(values).To(HaveKeyWithValue(redox.SubscriptionStateBeforeCode, "INACTIVE"))
+					Expect(values).To(HaveKeyWithValue(redox.SubscriptionStateAfterCode, "ACTIVE"))
+				})
+
+				When("the order disables reports", func() {
+					var patient clinics.PatientV1
+
+					BeforeEach(func() {
+						disableCode := "PRO1091"
+						order.Order.Procedure.Code = &disableCode
+						patient = (*matchResponse.JSON200.Patients)[0]
+						subscriptions.Subscriptions = []redox.ReportSubscription{{
+							ClinicId:  *matchResponse.JSON200.Clinic.Id,
+							PatientId: *patient.Id,
+							State:     redox.SubscriptionStateActive,
+						}}
+					})
+
+					It("disables the subscription and reports its state before and after in the results", func() {
+						Expect(process(envelope, order)).To(Succeed())
+
+						subscription := subscriptions.Get(*matchResponse.JSON200.Clinic.Id, *patient.Id)
+						Expect(subscription).ToNot(BeNil())
+						Expect(subscription.State).To(Equal(redox.SubscriptionStateInactive))
+						Expect(subscription.DisabledTime).ToNot(BeNil())
+
+						Expect(redoxClient.Sent).To(HaveLen(1))
+						results, ok := redoxClient.Sent[0].(models.NewResults)
+						Expect(ok).To(BeTrue())
+						values := map[string]string{}
+						for _, result := range results.Orders[0].Results {
+							values[result.Code] = result.Value
+						}
+						Expect(values).To(HaveKeyWithValue(redox.SubscriptionStateBeforeCode, "ACTIVE"))
+						Expect(values).To(HaveKeyWithValue(redox.SubscriptionStateAfterCode, "INACTIVE"))
+					})
+
+					It("sends a final note when configured", func() {
+						clinicSettings.Default.Subscriptions = redox.SubscriptionSettings{FinalNote: true, FinalNoteText: "Reports ended"}
+
+						Expect(process(envelope, order)).To(Succeed())
+						Expect(redoxClient.Sent).To(HaveLen(2))
+
+						notes, ok := redoxClient.Sent[0].(redox.Notes)
+						Expect(ok).To(BeTrue())
+						Expect(notes).To(PointTo(MatchFields(IgnoreExtras, Fields{
+							"Note": MatchFields(IgnoreExtras, Fields{
+								"ContentType":  Equal(redox.NoteContentTypePlainText),
+								"FileContents": PointTo(Equal("Reports ended")),
+							}),
+						})))
+						Expect(statusRecorder.Statuses()).To(ContainElement(redox.OrderStatusFinalNoteSent))
+					})
+
+					It("doesn't send a final note if the subscription was already inactive", func() {
+						clinicSettings.Default.Subscriptions = redox.SubscriptionSettings{FinalNote: true}
+						subscriptions.Subscriptions[0].State = redox.SubscriptionStateInactive
+
+						Expect(process(envelope, order)).To(Succeed())
+						Expect(redoxClient.Sent).To(HaveLen(1))
+						_, ok := redoxClient.Sent[0].(models.NewResults)
+						Expect(ok).To(BeTrue())
+					})
+				})
+
+				It("sends the flowsheet and notes to each destination of the matching routing rules", func() {
+					clinicSettings.Default.Routing = redox.RoutingSettings{
+						Rules: []redox.RoutingRule{{
+							Facilities: []string{"RES General Hospital"},
+							Destinations: redox.RoutingDestinations{
+								Flowsheet: []string{"ehr", "warehouse"},
+								Notes:     []string{"ehr"},
+							},
+						}},
+					}
+
+					Expect(process(envelope, order)).To(Succeed())
+					Expect(redoxClient.Sent).To(HaveLen(4))
+
+					var flowsheetDestinations []string
+					var notesDestinations []string
+					for _, payload := range redoxClient.Sent {
+						switch p := payload.(type) {
+						case models.NewFlowsheet:
+							flowsheetDestinations = append(flowsheetDestinations, *(*p.Meta.Destinations)[0].ID)
+						case *redox.NewNotes:
+							notesDestinations = append(notesDestinations, *(*p.Meta.Destinations)[0].ID)
+						}
+					}
+					Expect(flowsheetDestinations).To(Equal([]string{"ehr", "warehouse"}))
+					Expect(notesDestinations).To(Equal([]string{"ehr"}))
+
+					key := redox.OrderKey{OrderId: order.Order.ID, ProcedureCode: redox.NormalizeOrder(order).ProcedureCode}
+					Expect(ledger.Entries[key].IsStepCompleted(redox.OrderStepFlowsheetSent, "warehouse")).To(BeTrue())
+				})
+
+				It("audits each delivery of phi to a destination", func() {
+					clinicSettings.Default.Routing = redox.RoutingSettings{
+						Rules: []redox.RoutingRule{{
+							Facilities: []string{"RES General Hospital"},
+							Destinations: redox.RoutingDestinations{
+								Flowsheet: []string{"ehr", "warehouse"},
+								Notes:     []string{"ehr"},
+							},
+						}},
+					}
+
+					Expect(process(envelope, order)).To(Succeed())
+
+					var delivered []string
+					for _, event := range auditor.Events {
+						Expect(event.Action).To(Equal(audit.ActionPHISent))
+						Expect(event.Outcome).To(Equal(audit.OutcomeSuccess))
+						Expect(event.Target.ClinicId).To(Equal(*matchResponse.JSON200.Clinic.Id))
+						Expect(event.Target.PatientId).To(Equal(*(*matchResponse.JSON200.Patients)[0].Id))
+						if event.Details["payloadType"] != string(redox.PayloadTypeResults) {
+							delivered = append(delivered, event.Details["payloadType"]+"/"+event.Details["destinationId"])
+						}
+					}
+					Expect(delivered).To(Equal([]string{"flowsheet/ehr", "flowsheet/warehouse", "notes/ehr"}))
+				})
+
+				It("requests the report of the profile selected by the procedure code", func() {
+					clinicSettings.Default.Reports = redox.ReportClinicSettings{
+						Profiles: map[string]redox.ReportProfile{
+							"agp": {Reports: []string{redox.ReportTypeAGPCGM}, Period: "7d", TimezoneSource: redox.TimezoneSourcePatient},
+						},
+						ProcedureProfiles: map[string]string{redox.NormalizeOrder(order).ProcedureCode: "agp"},
+					}
+
+					Expect(process(envelope, order)).To(Succeed())
+					Expect(reportGenerator.Requests).To(HaveLen(1))
+
+					detail := reportGenerator.Requests[0].ReportDetail
+					Expect(detail.Reports).To(Equal([]string{redox.ReportTypeAGPCGM}))
+					Expect(detail.TimezoneName).To(BeEmpty())
+
+					start, err := time.Parse(time.RFC3339, detail.StartDate)
+					Expect(err).ToNot(HaveOccurred())
+					end, err := time.Parse(time.RFC3339, detail.EndDate)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(end.Sub(start)).To(Equal(7 * 24 * time.Hour))
+				})
+
+				When("the report can't be generated", func() {
+					BeforeEach(func() {
+						reportGenerator.Err = errors.New("export service is unavailable")
+						clinicSettings.Default.Notes.MaxReportFailures = 2
+					})
+
+					It("sends the flowsheet and returns an error so the order is retried", func() {
+						Expect(process(envelope, order)).ToNot(Succeed())
+						Expect(redoxClient.Sent).To(HaveLen(2))
+						Expect(redoxClient.Sent[0]).To(BeAssignableToTypeOf(models.NewResults{}))
+						Expect(redoxClient.Sent[1]).To(BeAssignableToTypeOf(models.NewFlowsheet{}))
+					})
+
+					It("sends a plain-text note and a result after the maximum number of failures", func() {
+						Expect(process(envelope, order)).ToNot(Succeed())
+
+						clinicClient.EXPECT().
+							MatchClinicAndPatientWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+							Return(matchResponse, nil).
+							Times(2)
+						Expect(process(envelope, order)).To(Succeed())
+						Expect(redoxClient.Sent).To(HaveLen(4))
+
+						results := redoxClient.Sent[2].(models.NewResults)
+						Expect(results.Orders[0].Results[1].Value).To(Equal(redox.ReportUnavailableMessage))
+						Expect(results.Orders[0].Results[2].Value).To(Equal(string(redox.ResultCodeReportUnavailable)))
+
+						notes := redoxClient.Sent[3].(*redox.NewNotes)
+						Expect(notes.Note.ContentType).To(Equal(redox.NoteContentTypePlainText))
+						Expect(*notes.Note.FileContents).To(HavePrefix(redox.FallbackNoteExplanation))
+						Expect(*notes.Note.FileContents).To(ContainSubstring("Glucose Management Indicator"))
+						Expect(notes.Note.Components).ToNot(BeNil())
+
+						key := redox.OrderKey{OrderId: order.Order.ID, ProcedureCode: redox.NormalizeOrder(order).ProcedureCode}
+						Expect(ledger.Entries[key].CompletedTime).ToNot(BeNil())
+						Expect(ledger.Entries[key].IsStepCompleted(redox.OrderStepFallbackNoteSent, "")).To(BeTrue())
+						Expect(ledger.Entries[key].IsStepCompleted(redox.OrderStepNoteSent, "")).To(BeFalse())
+
+						retry := redox.NewOrderReportRetry(envelope, key)
+						Expect(workItems.Items).To(HaveKey(retry.Id))
+						Expect(workItems.Items[retry.Id].Type).To(Equal(redox.WorkItemTypeOrderReport))
+						Expect(workItems.Items[retry.Id].Order.Id).To(Equal(envelope.Id))
+						Expect(workItems.Items[retry.Id].Order.Message.Lookup("order", "id").StringValue()).To(Equal(order.Order.ID))
+					})
+
+					It("replaces the fallback note with the report when the retry is dispatched", func() {
+						clinicClient.EXPECT().
+							MatchClinicAndPatientWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+							Return(matchResponse, nil).
+							Times(4)
+						Expect(process(envelope, order)).ToNot(Succeed())
+						Expect(process(envelope, order)).To(Succeed())
+
+						config := redox.WorkItemConfig{Interval: time.Minute, BatchSize: 10, RetryDelay: time.Minute, MaxAttempts: 3}
+						dispatcher := redox.NewWorkItemDispatcher(config, workItems, subscriptions, testStore.NewLeases(), processor, &testRedox.ScheduledOrderProcessor{}, zap.NewNop().Sugar())
+
+						reportGenerator.Err = nil
+						Expect(dispatcher.RunOnce(context.Background(), time.Now())).To(Succeed())
+						Expect(redoxClient.Sent).To(HaveLen(5))
+
+						notes := redoxClient.Sent[4].(*redox.ReplaceNotes)
+						Expect(notes.Note.OriginalDocumentID).To(Equal(envelope.Id.Hex()))
+
+						key := redox.OrderKey{OrderId: order.Order.ID, ProcedureCode: redox.NormalizeOrder(order).ProcedureCode}
+						retry := redox.NewOrderReportRetry(envelope, key)
+						Expect(workItems.Items[retry.Id].Status).To(Equal(redox.WorkItemStatusCompleted))
+						Expect(ledger.Entries[key].IsStepCompleted(redox.OrderStepNoteSent, "")).To(BeTrue())
+					})
+
+					It("retries the report with a backoff while it can't be generated", func() {
+						clinicClient.EXPECT().
+							MatchClinicAndPatientWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+							Return(matchResponse, nil).
+							Times(4)
+						Expect(process(envelope, order)).ToNot(Succeed())
+						Expect(process(envelope, order)).To(Succeed())
+
+						config := redox.WorkItemConfig{Interval: time.Minute, BatchSize: 10, RetryDelay: time.Minute, MaxAttempts: 3}
+						dispatcher := redox.NewWorkItemDispatcher(config, workItems, subscriptions, testStore.NewLeases(), processor, &testRedox.ScheduledOrderProcessor{}, zap.NewNop().Sugar())
+
+						now := time.Now()
+						Expect(dispatcher.RunOnce(context.Background(), now)).To(Succeed())
+						Expect(redoxClient.Sent).To(HaveLen(4))
+
+						key := redox.OrderKey{OrderId: order.Order.ID, ProcedureCode: redox.NormalizeOrder(order).ProcedureCode}
+						retry := workItems.Items[redox.NewOrderReportRetry(envelope, key).Id]
+						Expect(retry.Status).To(Equal(redox.WorkItemStatusPending))
+						Expect(retry.Attempts).To(Equal(1))
+						Expect(retry.NextAttemptTime).To(Equal(now.Add(time.Minute)))
+					})
+
+					It("replaces the fallback note with the report when the order is processed again", func() {
+						clinicClient.EXPECT().
+							MatchClinicAndPatientWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+							Return(matchResponse, nil).
+							Times(4)
+						Expect(process(envelope, order)).ToNot(Succeed())
+						Expect(process(envelope, order)).To(Succeed())
+
+						reportGenerator.Err = nil
+						Expect(process(envelope, order)).To(Succeed())
+						Expect(redoxClient.Sent).To(HaveLen(5))
+
+						notes := redoxClient.Sent[4].(*redox.ReplaceNotes)
+						Expect(notes.Note.OriginalDocumentID).To(Equal(envelope.Id.Hex()))
+						Expect(notes.Note.ContentType).To(Equal(redox.NoteContentTypeBase64))
+
+						key := redox.OrderKey{OrderId: order.Order.ID, ProcedureCode: redox.NormalizeOrder(order).ProcedureCode}
+						Expect(ledger.Entries[key].IsStepCompleted(redox.OrderStepNoteSent, "")).To(BeTrue())
+					})
+				})
+
+				It("sends a duplicate order result when the order was already processed", func() {
+					Expect(process(envelope, order)).To(Succeed())
+					Expect(redoxClient.Sent).To(HaveLen(3))
+
+					key := redox.OrderKey{OrderId: order.Order.ID, ProcedureCode: redox.NormalizeOrder(order).ProcedureCode}
+					Expect(ledger.Entries).To(HaveKey(key))
+					Expect(ledger.Entries[key].CompletedTime).ToNot(BeNil())
+
+					clinicClient.EXPECT().
+						MatchClinicAndPatientWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+						Return(matchResponse, nil)
+
+					Expect(process(envelope, order)).To(Succeed())
+					Expect(redoxClient.Sent).To(HaveLen(4))
+
+					results := redoxClient.Sent[3].(models.NewResults)
+					Expect(results.Orders[0].Results[0].Value).To(Equal("SUCCESS"))
+					Expect(results.Orders[0].Results[1].Value).To(Equal(redox.DuplicateOrderMessage))
+					Expect(results.Orders[0].Results[2].Value).To(Equal(string(redox.ResultCodeDuplicateOrder)))
+				})
+
+				It("resumes processing from the first incomplete step", func() {
+					key := redox.OrderKey{OrderId: order.Order.ID, ProcedureCode: redox.NormalizeOrder(order).ProcedureCode}
+					Expect(ledger.CompleteStep(context.Background(), key, redox.OrderStepMatched, "")).To(Succeed())
+					Expect(ledger.CompleteStep(context.Background(), key, redox.OrderStepResultsSent, "")).To(Succeed())
+					Expect(ledger.CompleteStep(context.Background(), key, redox.OrderStepFlowsheetSent, "")).To(Succeed())
+
+					Expect(process(envelope, order)).To(Succeed())
+					Expect(redoxClient.Sent).To(HaveLen(1))
+					_, isNote := redoxClient.Sent[0].(redox.Notes)
+					Expect(isNote).To(BeTrue())
+
+					Expect(ledger.Entries[key].IsStepCompleted(redox.OrderStepNoteSent, "")).To(BeTrue())
+					Expect(ledger.Entries[key].CompletedTime).ToNot(BeNil())
+				})
+
 				It("uploads a file and references it in the note when upload api is enabled", func() {
 					redoxClient.SetUploadFileEnabled(true)
-					Expect(processor.ProcessOrder(context.Background(), envelope, order)).To(Succeed())
+					Expect(process(envelope, order)).To(Succeed())
 					Expect(redoxClient.Sent).To(HaveLen(3))
 
 					var notes redox.Notes
@@ -320,6 +802,292 @@ var _ = Describe("NewOrderProcessor", func() {
 						}),
 					})))
 
+					key := redox.OrderKey{OrderId: order.Order.ID, ProcedureCode: redox.NormalizeOrder(order).ProcedureCode}
+					Expect(ledger.Entries[key].ReportUpload).To(PointTo(MatchFields(IgnoreExtras, Fields{
+						"URI":      Equal("https://blob.redoxengine.com/upload/report.pdf"),
+						"Checksum": Not(BeEmpty()),
+						"Size":     BeNumerically(">", 0),
+					})))
+				})
+
+				It("references the report which was uploaded in a previous attempt when the note is sent again", func() {
+					key := redox.OrderKey{OrderId: order.Order.ID, ProcedureCode: redox.NormalizeOrder(order).ProcedureCode}
+					Expect(ledger.CompleteStep(context.Background(), key, redox.OrderStepMatched, "")).To(Succeed())
+					Expect(ledger.CompleteStep(context.Background(), key, redox.OrderStepResultsSent, "")).To(Succeed())
+					Expect(ledger.CompleteStep(context.Background(), key, redox.OrderStepFlowsheetSent, "")).To(Succeed())
+					Expect(ledger.RecordReportUpload(context.Background(), key, redox.ReportUpload{URI: "https://blob.redoxengine.com/upload/previous.pdf"})).To(Succeed())
+
+					Expect(process(envelope, order)).To(Succeed())
+					Expect(redoxClient.Uploaded).To(BeEmpty())
+					Expect(reportGenerator.Requests).To(BeEmpty())
+					Expect(redoxClient.Sent).To(HaveLen(1))
+					Expect(redoxClient.Sent[0]).To(PointTo(MatchFields(IgnoreExtras, Fields{
+						"Note": MatchFields(IgnoreExtras, Fields{
+							"FileContents": PointTo(Equal("https://blob.redoxengine.com/upload/previous.pdf")),
+						}),
+					})))
+				})
+
+				It("delivers an hl7 oru message instead of the flowsheet and notes when hl7v2 is enabled", func() {
+					clinicSettings.Default.HL7v2 = redox.HL7v2Settings{
+						Enabled:            true,
+						SendingApplication: "Tidepool",
+						Destination:        "drop",
+					}
+
+					Expect(process(envelope, order)).To(Succeed())
+					Expect(redoxClient.Sent).To(HaveLen(1))
+					Expect(redoxClient.Sent[0]).To(BeAssignableToTypeOf(models.NewResults{}))
+
+					files, err := filepath.Glob(filepath.Join(hl7Dir, "*.hl7"))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(files).To(HaveLen(1))
+
+					contents, err := os.ReadFile(files[0])
+					Expect(err).ToNot(HaveOccurred())
+
+					segmentIds := make([]string, 0)
+					for _, segment := range hl7.ParseSegments(contents) {
+						segmentIds = append(segmentIds, segment.Id())
+					}
+					Expect(segmentIds).To(ContainElements("MSH", "PID", "OBR", "OBX"))
+					Expect(string(contents)).To(ContainSubstring("|ED|TIDEPOOL_REPORT^Tidepool Report^L||^AP^PDF^Base64^"))
+				})
+
+				It("audits the delivery of the hl7 oru message", func() {
+					clinicSettings.Default.HL7v2 = redox.HL7v2Settings{
+						Enabled:     true,
+						Destination: "drop",
+					}
+
+					Expect(process(envelope, order)).To(Succeed())
+
+					var delivered []audit.Event
+					for _, event := range auditor.Events {
+						if event.Details["payloadType"] == string(redox.PayloadTypeHL7) {
+							delivered = append(delivered, event)
+						}
+					}
+					Expect(delivered).To(HaveLen(1))
+					Expect(delivered[0].Action).To(Equal(audit.ActionPHISent))
+					Expect(delivered[0].Outcome).To(Equal(audit.OutcomeSuccess))
+					Expect(delivered[0].Target.PatientId).To(Equal(*(*matchResponse.JSON200.Patients)[0].Id))
+					Expect(delivered[0].Details).To(HaveKeyWithValue("destinationId", redox.GetHL7DestinationId(clinicSettings.Default.HL7v2)))
+				})
+			})
+
+			When("the patient can't be matched by mrn", func() {
+				var candidate clinics.PatientV1
+
+				BeforeEach(func() {
+					matchResponse.JSON200.Settings.MrnIdType = "MRN"
+					noMatch := *matchResponse.JSON200
+					noMatch.Patients = &[]clinics.PatientV1{}
+					clinicClient.EXPECT().
+						MatchClinicAndPatientWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+						Return(&clinics.MatchClinicAndPatientResponse{
+							HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+							JSON200:      &noMatch,
+						}, nil)
+
+					candidate = (*matchResponse.JSON200.Patients)[0]
+					candidate.FullName = "Timothy Bixby"
+					candidate.Mrn = nil
+				})
+
+				It("sends a failure result when the fallback is disabled", func() {
+					Expect(process(envelope, order)).To(Succeed())
+					Expect(redoxClient.Sent).To(HaveLen(1))
+
+					results := redoxClient.Sent[0].(models.NewResults)
+					Expect(results.Orders[0].Results[1].Value).To(Equal(redox.NoMatchingPatientsMessage))
+					Expect(results.Orders[0].Results[2].Code).To(Equal(redox.MatchingResultCodeCode))
+					Expect(results.Orders[0].Results[2].Value).To(Equal(string(redox.ResultCodeNoMatches)))
+
+					Expect(statusRecorder.Statuses()).To(Equal([]redox.OrderStatus{redox.OrderStatusReceived, redox.OrderStatusNoMatch}))
+					Expect(statusRecorder.Events[1].Code).To(Equal(redox.ResultCodeNoMatches))
+				})
+
+				When("the demographics fallback is enabled", func() {
+					BeforeEach(func() {
+						clinicClient.EXPECT().
+							ListPatientsWithResponse(gomock.Any(), gomock.Eq(*matchResponse.JSON200.Clinic.Id), gomock.Any()).
+							Return(&clinics.ListPatientsResponse{
+								HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+								JSON200:      &clinics.PatientsResponseV1{Data: &[]clinics.PatientV1{candidate}},
+							}, nil)
+					})
+
+					It("links the mrn and sends the summary when auto linking is enabled", func() {
+						clinicSettings.Default.PatientMatching = redox.PatientMatchingSettings{
+							FallbackEnabled: true,
+							AutoLinkMrn:     true,
+						}
+						clinicClient.EXPECT().UpdatePatientWithResponse(gomock.Any(),
+							gomock.Eq(*matchResponse.JSON200.Clinic.Id),
+							gomock.Eq(*candidate.Id),
+							testRedox.MatchArg(func(body clinics.UpdatePatientJSONRequestBody) bool {
+								return body.Mrn != nil && *body.Mrn == "0000000001"
+							}),
+						).Return(&clinics.UpdatePatientResponse{
+							HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+						}, nil)
+						clinicClient.EXPECT().
+							MatchClinicAndPatientWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+							Return(matchResponse, nil)
+
+						Expect(process(envelope, order)).To(Succeed())
+						Expect(redoxClient.Sent).To(HaveLen(3))
+
+						results := redoxClient.Sent[0].(models.NewResults)
+						Expect(results.Orders[0].Results[0].Value).To(Equal("SUCCESS"))
+						Expect(results.Orders[0].Results[2].Value).To(Equal(string(redox.ResultCodeSuccess)))
+						Expect(results.Orders[0].Results[3].Value).To(Equal(redox.MatchMethodNameDob))
+						Expect(results.Orders[0].Results[4].Value).To(Equal("0.90"))
+					})
+
+					It("subscribes the linked patient and reports the state of the subscription before and after", func() {
+						clinicSettings.Default.PatientMatching = redox.PatientMatchingSettings{
+							FallbackEnabled: true,
+							AutoLinkMrn:     true,
+						}
+						clinicClient.EXPECT().
+							UpdatePatientWithResponse(gomock.Any(), gomock.Eq(*matchResponse.JSON200.Clinic.Id), gomock.Eq(*candidate.Id), gomock.Any()).
+							Return(&clinics.UpdatePatientResponse{
+								HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+							}, nil)
+						clinicClient.EXPECT().
+							MatchClinicAndPatientWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+							Return(matchResponse, nil)
+
+						Expect(process(envelope, order)).To(Succeed())
+
+						subscription := subscriptions.Get(*matchResponse.JSON200.Clinic.Id, *candidate.Id)
+						Expect(subscription).ToNot(BeNil())
+						Expect(subscription.State).To(Equal(redox.SubscriptionStateActive))
+						Expect(subscription.LastTransition).To(PointTo(MatchFields(IgnoreExtras, Fields{
+							"DocumentId": Equal(envelope.Id.Hex()),
+							"From":       Equal(redox.SubscriptionStateInactive),
+							"To":         Equal(redox.SubscriptionStateActive),
+						})))
+
+						results := redoxClient.Sent[0].(models.NewResults)
+						values := map[string]string{}
+						for _, result := range results.Orders[0].Results {
+							values[result.Code] = result.Value
+						}
+						Expect(values).To(HaveKeyWithValue(redox.SubscriptionStateBeforeCode, "INACTIVE"))
+						Expect(values).To(HaveKeyWithValue(redox.SubscriptionStateAfterCode, "ACTIVE"))
+					})
+
+					It("queues the candidate for review when auto linking is disabled", func() {
+						clinicSettings.Default.PatientMatching = redox.PatientMatchingSettings{
+							FallbackEnabled: true,
+						}
+						tagId := "3"
+						clinic := matchResponse.JSON200.Clinic
+						clinic.PatientTags = &[]clinics.PatientTagV1{{Id: &tagId, Name: redox.DefaultPatientMatchingReviewTag}}
+
+						clinicClient.EXPECT().
+							CreatePatientTagWithResponse(gomock.Any(), gomock.Eq(*clinic.Id), gomock.Any()).
+							Return(&clinics.CreatePatientTagResponse{
+								HTTPResponse: &http.Response{StatusCode: http.StatusCreated},
+							}, nil)
+						clinicClient.EXPECT().
+							GetClinicWithResponse(gomock.Any(), gomock.Eq(*clinic.Id)).
+							Return(&clinics.GetClinicResponse{
+								HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+								JSON200:      &clinic,
+							}, nil)
+						clinicClient.EXPECT().UpdatePatientWithResponse(gomock.Any(),
+							gomock.Eq(*clinic.Id),
+							gomock.Eq(*candidate.Id),
+							testRedox.MatchArg(func(body clinics.UpdatePatientJSONRequestBody) bool {
+								return body.Mrn == nil && testRedox.PatientHasTags(body.Tags, []string{tagId})
+							}),
+						).Return(&clinics.UpdatePatientResponse{
+							HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+						}, nil)
+
+						Expect(process(envelope, order)).To(Succeed())
+						Expect(redoxClient.Sent).To(HaveLen(1))
+
+						results := redoxClient.Sent[0].(models.NewResults)
+						Expect(results.Orders[0].Results[0].Value).To(Equal("FAILURE"))
+						Expect(results.Orders[0].Results[1].Value).To(Equal(redox.ConfirmMatchingPatientMessage))
+						Expect(results.Orders[0].Results[2].Value).To(Equal(string(redox.ResultCodeMatchReviewRequired)))
+						Expect(results.Orders[0].Results[4].Value).To(Equal("0.90"))
+					})
+				})
+
+				When("the candidate is already linked to a different mrn", func() {
+					BeforeEach(func() {
+						existingMrn := "9999999999"
+						candidate.Mrn = &existingMrn
+						clinicClient.EXPECT().
+							ListPatientsWithResponse(gomock.Any(), gomock.Eq(*matchResponse.JSON200.Clinic.Id), gomock.Any()).
+							Return(&clinics.ListPatientsResponse{
+								HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+								JSON200:      &clinics.PatientsResponseV1{Data: &[]clinics.PatientV1{candidate}},
+							}, nil)
+					})
+
+					It("keeps the existing mrn and queues the candidate for review even when auto linking is enabled", func() {
+						clinicSettings.Default.PatientMatching = redox.PatientMatchingSettings{
+							FallbackEnabled: true,
+							AutoLinkMrn:     true,
+						}
+						tagId := "3"
+						clinic := matchResponse.JSON200.Clinic
+						clinic.PatientTags = &[]clinics.PatientTagV1{{Id: &tagId, Name: redox.DefaultPatientMatchingReviewTag}}
+
+						clinicClient.EXPECT().
+							CreatePatientTagWithResponse(gomock.Any(), gomock.Eq(*clinic.Id), gomock.Any()).
+							Return(&clinics.CreatePatientTagResponse{
+								HTTPResponse: &http.Response{StatusCode: http.StatusCreated},
+							}, nil)
+						clinicClient.EXPECT().
+							GetClinicWithResponse(gomock.Any(), gomock.Eq(*clinic.Id)).
+							Return(&clinics.GetClinicResponse{
+								HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+								JSON200:      &clinic,
+							}, nil)
+						clinicClient.EXPECT().UpdatePatientWithResponse(gomock.Any(),
+							gomock.Eq(*clinic.Id),
+							gomock.Eq(*candidate.Id),
+							testRedox.MatchArg(func(body clinics.UpdatePatientJSONRequestBody) bool {
+								return body.Mrn != nil && *body.Mrn == "9999999999" && testRedox.PatientHasTags(body.Tags, []string{tagId})
+							}),
+						).Return(&clinics.UpdatePatientResponse{
+							HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+						}, nil)
+
+						Expect(process(envelope, order)).To(Succeed())
+						Expect(redoxClient.Sent).To(HaveLen(1))
+
+						results := redoxClient.Sent[0].(models.NewResults)
+						Expect(results.Orders[0].Results[0].Value).To(Equal("FAILURE"))
+						Expect(results.Orders[0].Results[1].Value).To(Equal(redox.ConflictingMrnMessage))
+						Expect(results.Orders[0].Results[2].Value).To(Equal(string(redox.ResultCodeMatchReviewRequired)))
+					})
+				})
+
+				When("the birth date of the order is invalid", func() {
+					BeforeEach(func() {
+						invalid := "not a date"
+						order.Patient.Demographics.DOB = &invalid
+					})
+
+					It("sends the no matches result instead of retrying the order", func() {
+						clinicSettings.Default.PatientMatching = redox.PatientMatchingSettings{FallbackEnabled: true}
+
+						Expect(process(envelope, order)).To(Succeed())
+						Expect(redoxClient.Sent).To(HaveLen(1))
+
+						results := redoxClient.Sent[0].(models.NewResults)
+						Expect(results.Orders[0].Results[1].Value).To(Equal(redox.NoMatchingPatientsMessage))
+						Expect(results.Orders[0].Results[2].Value).To(Equal(string(redox.ResultCodeNoMatches)))
+					})
 				})
 			})
 		})
@@ -376,7 +1144,7 @@ var _ = Describe("NewOrderProcessor", func() {
 					JSON200: &(*matchResponse.JSON200.Patients)[0],
 				}, nil)
 
-				Expect(processor.ProcessOrder(context.Background(), envelope, order)).To(Succeed())
+				Expect(process(envelope, order)).To(Succeed())
 			})
 
 		})
@@ -422,7 +1190,7 @@ var _ = Describe("NewOrderProcessor", func() {
 				})
 
 				It("send results, flowsheet and notes when patient and clinic successfully matched", func() {
-					Expect(processor.ProcessOrder(context.Background(), envelope, order)).To(Succeed())
+					Expect(process(envelope, order)).To(Succeed())
 					Expect(redoxClient.Sent).To(HaveLen(3))
 
 					var results models.NewResults
@@ -523,7 +1291,7 @@ var _ = Describe("NewOrderProcessor", func() {
 						JSON200: &patient,
 					}, nil)
 
-					Expect(processor.ProcessOrder(context.Background(), envelope, order)).To(Succeed())
+					Expect(process(envelope, order)).To(Succeed())
 					Expect(redoxClient.Sent).To(HaveLen(3))
 
 					var results models.NewResults
@@ -616,6 +1384,17 @@ var _ = Describe("NewOrderProcessor", func() {
 					}, nil).AnyTimes()
 			})
 
+			getResultValues := func() map[string]string {
+				Expect(redoxClient.Sent).To(HaveLen(1))
+				results, ok := redoxClient.Sent[0].(models.NewResults)
+				Expect(ok).To(BeTrue())
+				values := map[string]string{}
+				for _, result := range results.Orders[0].Results {
+					values[result.Code] = result.Value
+				}
+				return values
+			}
+
 			It("creates the patient in the clinic service", func() {
 				patientBody := testRedox.MatchArg(func(body clinics.CreatePatientAccountJSONRequestBody) bool {
 					return testRedox.PatientHasTags(body.Tags, []string{"1", "2"}) // The tag ids defined in the match fixture
@@ -630,12 +1409,250 @@ var _ = Describe("NewOrderProcessor", func() {
 						},
 						JSON200: &clinics.PatientV1{},
 					}, nil)
-				Expect(processor.ProcessOrder(context.Background(), envelope, order)).To(Succeed())
+				Expect(process(envelope, order)).To(Succeed())
+			})
+
+			It("maps the account details configured by the clinic and reports them in the results", func() {
+				clinicSettings.Default.AccountCreation = redox.AccountCreationSettings{
+					DiagnosisTypes: map[string]clinics.DiagnosisTypeV1{"Z31": clinics.DiagnosisTypeV1Other, "E10": clinics.DiagnosisTypeV1Type1},
+					TargetDevices: redox.TargetDeviceSettings{
+						Codes:   []string{"QUESTION010"},
+						Devices: map[string]string{"Singleton": "dexcom"},
+					},
+					PhoneNumberTypes: []string{"mobile", "home"},
+					Guardian:         true,
+				}
+				patientId := "patient-1"
+
+				patientBody := testRedox.MatchArg(func(body clinics.CreatePatientAccountJSONRequestBody) bool {
+					return body.DiagnosisType != nil && *body.DiagnosisType == clinics.DiagnosisTypeV1Other &&
+						body.TargetDevices != nil && len(*body.TargetDevices) == 1 && (*body.TargetDevices)[0] == "dexcom"
+				})
+				clinicClient.EXPECT().
+					CreatePatientAccountWithResponse(gomock.Any(), gomock.Any(), patientBody).
+					Return(&clinics.CreatePatientAccountResponse{
+						HTTPResponse: &http.Response{
+							StatusCode: http.StatusOK,
+						},
+						JSON200: &clinics.PatientV1{Id: &patientId},
+					}, nil)
+				Expect(process(envelope, order)).To(Succeed())
+
+				contact, err := contacts.Get(context.Background(), *matchResponse.JSON200.Clinic.Id, patientId)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(contact).ToNot(BeNil())
+				Expect(contact.PhoneNumber).To(Equal("+18088675301"))
+				Expect(contact.Guardian).ToNot(BeNil())
+				Expect(contact.Guardian.Name).To(Equal("Kent Bixby"))
+				Expect(contact.Guardian.Email).To(Equal("kent@test.com"))
+
+				key := redox.OrderKey{OrderId: order.Order.ID, ProcedureCode: redox.NormalizeOrder(order).ProcedureCode}
+				Expect(ledger.Entries[key].IsStepCompleted(redox.OrderStepContactStored, "")).To(BeTrue())
+
+				values := getResultValues()
+				Expect(values).To(HaveKeyWithValue(redox.AccountCreationDiagnosisTypeCode, "other"))
+				Expect(values).To(HaveKeyWithValue(redox.AccountCreationTargetDevicesCode, "dexcom"))
+				Expect(values).To(HaveKeyWithValue(redox.AccountCreationPhoneNumberCode, "+18088675301"))
+				Expect(values).To(HaveKeyWithValue(redox.AccountCreationGuardianCode, "Kent Bixby; Father; kent@test.com"))
+			})
+
+			It("reports the contact as not mapped if it couldn't be stored", func() {
+				clinicSettings.Default.AccountCreation = redox.AccountCreationSettings{
+					PhoneNumberTypes: []string{"mobile", "home"},
+					Guardian:         true,
+				}
+				contacts.Err = errors.New("unavailable")
+				patientId := "patient-1"
+
+				clinicClient.EXPECT().
+					CreatePatientAccountWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(&clinics.CreatePatientAccountResponse{
+						HTTPResponse: &http.Response{
+							StatusCode: http.StatusOK,
+						},
+						JSON200: &clinics.PatientV1{Id: &patientId},
+					}, nil)
+				Expect(process(envelope, order)).To(Succeed())
+
+				Expect(contacts.Contacts).To(BeEmpty())
+				values := getResultValues()
+				Expect(values).To(HaveKeyWithValue(redox.AccountCreationPhoneNumberCode, redox.NotMappedValue))
+				Expect(values).To(HaveKeyWithValue(redox.AccountCreationGuardianCode, redox.NotMappedValue))
+			})
+
+			It("doesn't report the contact when the account was created in a previous attempt which didn't store it", func() {
+				clinicSettings.Default.AccountCreation = redox.AccountCreationSettings{
+					PhoneNumberTypes: []string{"mobile", "home"},
+					Guardian:         true,
+				}
+				key := redox.OrderKey{OrderId: order.Order.ID, ProcedureCode: redox.NormalizeOrder(order).ProcedureCode}
+				Expect(ledger.CompleteStep(context.Background(), key, redox.OrderStepAccountCreated, "")).To(Succeed())
+
+				// The account isn't created again
+				Expect(process(envelope, order)).To(Succeed())
+
+				values := getResultValues()
+				Expect(values).To(HaveKeyWithValue(redox.AccountCreationPhoneNumberCode, redox.NotMappedValue))
+				Expect(values).To(HaveKeyWithValue(redox.AccountCreationGuardianCode, redox.NotMappedValue))
 			})
 		})
 	})
 
-	Describe("GetEmailAddressFromOrder", func() {
+	// The same orders of the fixture patient are received from each EHR, so the outcome of processing them mustn't
+	// depend on the adapter
+	Describe("ProcessOrder with each EHR adapter", func() {
+		type orderHarness struct {
+			// envelope returns the envelope of an order of the fixture patient with the procedure code
+			envelope  func(procedureCode string) models.MessageEnvelope
+			delivered func() []ehrTest.Delivery
+		}
+
+		var fhirServer *testFhir.Server
+
+		BeforeEach(func() {
+			var err error
+			fhirServer, err = testFhir.NewServer()
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(fhirServer.Close)
+
+			fhirAdapter, err := fhir.NewAdapter(fhirServer.Config(), zap.NewNop().Sugar())
+			Expect(err).ToNot(HaveOccurred())
+			processor = newProcessor(redox.NewEHRAdapter(redox.EHRAdapterParams{Client: redoxClient, FHIR: fhirAdapter}))
+		})
+
+		matchResponse := func(fixture string) *clinics.MatchClinicAndPatientResponse {
+			response := &clinics.EhrMatchResponseV1{}
+			matchFixture, err := test.LoadFixture(fixture)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(json.Unmarshal(matchFixture, response)).To(Succeed())
+			return &clinics.MatchClinicAndPatientResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      response,
+			}
+		}
+
+		harnesses := map[string]func() orderHarness{
+			redox.AdapterName: func() orderHarness {
+				return orderHarness{
+					envelope: func(procedureCode string) models.MessageEnvelope {
+						fixture, err := test.LoadFixture("test/fixtures/accountcreationorder.json")
+						Expect(err).ToNot(HaveOccurred())
+						order := models.NewOrder{}
+						Expect(json.Unmarshal(fixture, &order)).To(Succeed())
+						order.Order.Procedure.Code = &procedureCode
+
+						message, err := bson.Marshal(order)
+						Expect(err).ToNot(HaveOccurred())
+						return models.MessageEnvelope{Id: primitive.NewObjectID(), Meta: order.Meta, Message: message}
+					},
+					delivered: redoxClient.Delivered,
+				}
+			},
+			fhir.AdapterName: func() orderHarness {
+				return orderHarness{
+					envelope: func(procedureCode string) models.MessageEnvelope {
+						fixture, err := test.LoadFixture("../fhir/test/fixtures/servicerequestbundle.json")
+						Expect(err).ToNot(HaveOccurred())
+						fixture = bytes.ReplaceAll(fixture, []byte(`"PRO1092"`), []byte(strconv.Quote(procedureCode)))
+
+						message := bson.Raw{}
+						Expect(bson.UnmarshalExtJSON(fixture, false, &message)).To(Succeed())
+						return models.MessageEnvelope{Id: primitive.NewObjectID(), Message: message}
+					},
+					delivered: fhirServer.Delivered,
+				}
+			},
+		}
+
+		for _, name := range []string{redox.AdapterName, fhir.AdapterName} {
+			setup := harnesses[name]
+
+			Context("with orders received from "+name, func() {
+				var harness orderHarness
+
+				BeforeEach(func() {
+					harness = setup()
+				})
+
+				It("delivers the results, observations and report of subscription orders", func() {
+					response := matchResponse("test/fixtures/subscriptionmatchresponse.json")
+					clinicClient.EXPECT().
+						MatchClinicAndPatientWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+						Return(response, nil).
+						AnyTimes()
+
+					Expect(processor.ProcessOrder(context.Background(), harness.envelope("PRO1090"))).To(Succeed())
+
+					delivered := harness.delivered()
+					Expect(delivered).To(HaveLen(3))
+					Expect(delivered).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+						"Type":      Equal(ehrTest.DeliveryResults),
+						"IsSuccess": BeTrue(),
+					})))
+					Expect(delivered).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+						"Type":         Equal(ehrTest.DeliveryObservations),
+						"Observations": Not(BeEmpty()),
+					})))
+					Expect(delivered).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+						"Type":    Equal(ehrTest.DeliveryDocument),
+						"Content": HavePrefix("%PDF"),
+					})))
+
+					Expect(subscriptions.Subscriptions).To(HaveLen(1))
+					Expect(statusRecorder.Statuses()).To(ContainElement(redox.OrderStatusNoteSent))
+				})
+
+				It("delivers a failure result when the patient can't be matched", func() {
+					response := matchResponse("test/fixtures/subscriptionmatchresponse.json")
+					response.JSON200.Patients = &[]clinics.PatientV1{}
+					clinicClient.EXPECT().
+						MatchClinicAndPatientWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+						Return(response, nil).
+						AnyTimes()
+
+					Expect(processor.ProcessOrder(context.Background(), harness.envelope("PRO1090"))).To(Succeed())
+					Expect(harness.delivered()).To(ConsistOf(MatchFields(IgnoreExtras, Fields{
+						"Type":      Equal(ehrTest.DeliveryResults),
+						"IsSuccess": BeFalse(),
+						"Code":      Equal(string(redox.ResultCodeNoMatches)),
+						"Message":   Equal(redox.NoMatchingPatientsMessage),
+					})))
+				})
+
+				It("creates the account of account creation orders and delivers the results", func() {
+					response := matchResponse("test/fixtures/accountcreationmatchresponse.json")
+					clinicClient.EXPECT().
+						MatchClinicAndPatientWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+						Return(response, nil).
+						AnyTimes()
+					clinicClient.EXPECT().
+						GetClinicWithResponse(gomock.Any(), *response.JSON200.Clinic.Id).
+						Return(&clinics.GetClinicResponse{
+							HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+							JSON200:      &response.JSON200.Clinic,
+						}, nil).AnyTimes()
+
+					patientBody := testRedox.MatchArg(func(body clinics.CreatePatientAccountJSONRequestBody) bool {
+						return body.FullName == "Timothy Bixby" && body.Mrn != nil && *body.Mrn == "0000000001"
+					})
+					clinicClient.EXPECT().
+						CreatePatientAccountWithResponse(gomock.Any(), gomock.Any(), patientBody).
+						Return(&clinics.CreatePatientAccountResponse{
+							HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+							JSON200:      &clinics.PatientV1{},
+						}, nil)
+
+					Expect(processor.ProcessOrder(context.Background(), harness.envelope("PRO1092"))).To(Succeed())
+					Expect(harness.delivered()).To(ConsistOf(MatchFields(IgnoreExtras, Fields{
+						"Type":      Equal(ehrTest.DeliveryResults),
+						"IsSuccess": BeTrue(),
+					})))
+				})
+			})
+		}
+	})
+
+	Describe("GetEmailAddress", func() {
 		var order models.NewOrder
 
 		BeforeEach(func() {
@@ -645,7 +1662,7 @@ var _ = Describe("NewOrderProcessor", func() {
 		})
 
 		It("returns the patient email address if the patient is over 13", func() {
-			email, err := redox.GetEmailAddressFromOrder(order)
+			email, err := redox.NormalizeOrder(order).GetEmailAddress()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(email).ToNot(BeNil())
 			Expect(email).To(PointTo(Equal("tim@test.com")))
@@ -655,14 +1672,14 @@ var _ = Describe("NewOrderProcessor", func() {
 			almostThirteenYearsAgo := time.Now().AddDate(-12, 11, 13).Format("2006-01-02")
 			order.Patient.Demographics.DOB = &almostThirteenYearsAgo
 
-			email, err := redox.GetEmailAddressFromOrder(order)
+			email, err := redox.NormalizeOrder(order).GetEmailAddress()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(email).ToNot(BeNil())
 			Expect(email).To(PointTo(Equal("kent@test.com")))
 		})
 	})
 
-	Describe("GetFullNameFromOrder", func() {
+	Describe("GetFullName", func() {
 		var order models.NewOrder
 
 		BeforeEach(func() {
@@ -672,14 +1689,14 @@ var _ = Describe("NewOrderProcessor", func() {
 		})
 
 		It("returns the concatenated first and last names", func() {
-			name, err := redox.GetFullNameFromOrder(order)
+			name, err := redox.NormalizeOrder(order).GetFullName()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(name).ToNot(BeNil())
 			Expect(name).To(Equal("Timothy Bixby"))
 		})
 	})
 
-	Describe("GetBirthDateFromOrder", func() {
+	Describe("GetBirthDate", func() {
 		var order models.NewOrder
 
 		BeforeEach(func() {
@@ -689,13 +1706,13 @@ var _ = Describe("NewOrderProcessor", func() {
 		})
 
 		It("returns the date of birth of the patient", func() {
-			dob, err := redox.GetBirthDateFromOrder(order)
+			dob, err := redox.NormalizeOrder(order).GetBirthDate()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(dob.Format("2006-01-02")).To(Equal("2008-01-06"))
 		})
 	})
 
-	Describe("GetMrnFromOrder", func() {
+	Describe("GetMrn", func() {
 		var order models.NewOrder
 
 		BeforeEach(func() {
@@ -705,7 +1722,7 @@ var _ = Describe("NewOrderProcessor", func() {
 		})
 
 		It("returns the mrn of the patient", func() {
-			mrn, err := redox.GetMrnFromOrder(order, "mrn")
+			mrn, err := redox.NormalizeOrder(order).GetMrn("mrn")
 			Expect(err).ToNot(HaveOccurred())
 			Expect(mrn).ToNot(BeNil())
 			Expect(mrn).To(PointTo(Equal("0000000001")))
@@ -6,13 +6,19 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/tidepool-org/clinic-worker/ehr"
 	clinics "github.com/tidepool-org/clinic/client"
 	models "github.com/tidepool-org/clinic/redox_models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
 )
 
-const recentDataCutoff = 14 * 24 * time.Hour
+const (
+	recentDataCutoff = 14 * 24 * time.Hour
+
+	// ScheduledProcedureCode identifies scheduled summaries and reports in the order ledger
+	ScheduledProcedureCode = "SCHEDULED_SUMMARY_AND_REPORT"
+)
 
 type ScheduledSummaryAndReport struct {
 	Id                primitive.ObjectID     `json:"_id" bson:"_id"`
@@ -21,7 +27,8 @@ type ScheduledSummaryAndReport struct {
 	LastMatchedOrder  models.MessageEnvelope `json:"lastMatchedOrder"`
 	PrecedingDocument *PrecedingDocument     `json:"precedingDocument"`
 	CreatedTime       time.Time              `json:"createdTime"`
-	DecodedOrder      models.NewOrder        `json:"-"`
+	// Appointment is the visit which the summary and report is tied to if it's sent before a visit
+	Appointment *Appointment `json:"appointment,omitempty" bson:"appointment,omitempty"`
 }
 
 type PrecedingDocument struct {
@@ -36,13 +43,23 @@ type ScheduledSummaryAndReportProcessor interface {
 type scheduledSummaryAndReportProcessor struct {
 	clinics        clinics.ClientWithResponsesInterface
 	orderProcessor NewOrderProcessor
+	adapter        ehr.Adapter
+	ledger         OrderLedger
+	statusRecorder OrderStatusRecorder
+	subscriptions  SubscriptionStore
+	workItems      WorkItemStore
 	logger         *zap.SugaredLogger
 }
 
-func NewScheduledSummaryAndReportProcessor(orderProcessor NewOrderProcessor, clinics clinics.ClientWithResponsesInterface, logger *zap.SugaredLogger) ScheduledSummaryAndReportProcessor {
+func NewScheduledSummaryAndReportProcessor(orderProcessor NewOrderProcessor, adapter ehr.Adapter, clinics clinics.ClientWithResponsesInterface, ledger OrderLedger, statusRecorder OrderStatusRecorder, subscriptions SubscriptionStore, workItems WorkItemStore, logger *zap.SugaredLogger) ScheduledSummaryAndReportProcessor {
 	return &scheduledSummaryAndReportProcessor{
 		clinics:        clinics,
 		orderProcessor: orderProcessor,
+		adapter:        adapter,
+		ledger:         ledger,
+		statusRecorder: statusRecorder,
+		subscriptions:  subscriptions,
+		workItems:      workItems,
 		logger:         logger,
 	}
 }
@@ -79,7 +96,32 @@ func (r *scheduledSummaryAndReportProcessor) ProcessOrder(ctx context.Context, s
 		return nil
 	}
 
-	cutoffTime := getOrderTime(scheduled.DecodedOrder)
+	order, err := NormalizeMessage(r.adapter, scheduled.LastMatchedOrder)
+	if err != nil {
+		return err
+	}
+	if scheduled.Appointment != nil {
+		if err := ApplyAppointment(&order, *scheduled.Appointment); err != nil {
+			return err
+		}
+	}
+
+	subscription, err := r.subscriptions.Find(ctx, clinicId, scheduled.UserId)
+	if err != nil {
+		return fmt.Errorf("unable to get report subscription: %w", err)
+	}
+	// The subscription may have been disabled after the message was produced
+	if subscription != nil && subscription.State == SubscriptionStateInactive {
+		r.logger.Infow("the report subscription is inactive, cancelling scheduled order", "clinicId", clinicId, "userId", scheduled.UserId)
+		timeline := NewOrderTimeline(r.statusRecorder, scheduled.Id.Hex(), order, r.logger)
+		timeline.Record(ctx, OrderStatusEvent{Status: OrderStatusReportCancelled, ClinicId: &clinicId, PatientId: &scheduled.UserId})
+		return nil
+	}
+
+	var cutoffTime time.Time
+	if order.Time != nil {
+		cutoffTime = *order.Time
+	}
 	if scheduled.PrecedingDocument != nil {
 		// Check that there is new data uploaded after the previous scheduled message if one exists
 		cutoffTime = scheduled.PrecedingDocument.CreatedTime
@@ -100,14 +142,37 @@ func (r *scheduledSummaryAndReportProcessor) ProcessOrder(ctx context.Context, s
 		Settings: *settings,
 	}
 
+	// Track the progress, so the flowsheet isn't sent again if the report fails and the request is retried
+	progress, err := NewOrderProgress(ctx, r.ledger, OrderKey{OrderId: scheduled.Id.Hex(), ProcedureCode: ScheduledProcedureCode})
+	if err != nil {
+		return err
+	}
+	if progress.IsCompleted() && !progress.IsReportPending() {
+		r.logger.Infow("the scheduled summary and report was already sent", "clinicId", clinicId, "userId", scheduled.UserId)
+		return nil
+	}
+
 	params := SummaryAndReportParameters{
 		Match:             match,
-		Order:             scheduled.DecodedOrder,
+		Order:             order,
 		DocumentId:        scheduled.Id.Hex(),
 		PrecedingDocument: scheduled.PrecedingDocument,
+		Progress:          progress,
+		Timeline:          NewOrderTimeline(r.statusRecorder, scheduled.Id.Hex(), order, r.logger),
+		SkipUnchanged:     true,
+	}
+
+	if err := r.orderProcessor.SendSummaryAndReport(ctx, params); err != nil {
+		return err
 	}
 
-	return r.orderProcessor.SendSummaryAndReport(ctx, params)
+	// The summary and report is processed again later to replace the fallback note with the report
+	if progress.IsReportPending() {
+		if err := r.workItems.Enqueue(ctx, NewScheduledReportRetry(scheduled)); err != nil {
+			return err
+		}
+	}
+	return progress.Complete(ctx)
 }
 
 func (r *scheduledSummaryAndReportProcessor) getPatient(ctx context.Context, clinicId, userId string) (*clinics.PatientV1, error) {
@@ -167,13 +232,3 @@ func getMostRecentUploadDate(patient clinics.PatientV1) time.Time {
 	}
 	return mostRecentUpload
 }
-
-func getOrderTime(order models.NewOrder) (result time.Time) {
-	if order.Meta.EventDateTime == nil {
-		return
-	}
-
-	// result will be zero if parsing fails, which is what we want to fallback to
-	result, _ = time.Parse(time.RFC3339, *order.Meta.EventDateTime)
-	return
-}
@@ -3,6 +3,7 @@ package redox_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"math/rand/v2"
 	"net/http"
 	"time"
@@ -10,9 +11,10 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gstruct"
+	testAudit "github.com/tidepool-org/clinic-worker/audit/test"
+	"github.com/tidepool-org/clinic-worker/hl7"
 	"github.com/tidepool-org/clinic-worker/redox"
 	testRedox "github.com/tidepool-org/clinic-worker/redox/test"
-	"github.com/tidepool-org/clinic-worker/report"
 	"github.com/tidepool-org/clinic-worker/test"
 	clinics "github.com/tidepool-org/clinic/client"
 	models "github.com/tidepool-org/clinic/redox_models"
@@ -27,6 +29,13 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 	var redoxClient *testRedox.RedoxClient
 	var clinicCtrl *gomock.Controller
 	var clinicClient *clinics.MockClientWithResponsesInterface
+	var statusRecorder *testRedox.OrderStatusRecorder
+	var fingerprints *testRedox.ReportFingerprintStore
+	var subscriptions *testRedox.SubscriptionStore
+	var workItems *testRedox.WorkItemStore
+	var reportGenerator *testRedox.ReportGenerator
+	var clinicSettings *testRedox.ClinicSettingsProvider
+	var ledger *testRedox.OrderLedger
 	var scheduledProcessor redox.ScheduledSummaryAndReportProcessor
 
 	BeforeEach(func() {
@@ -34,28 +43,36 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 		clinicCtrl = gomock.NewController(GinkgoT())
 		clinicClient = clinics.NewMockClientWithResponsesInterface(clinicCtrl)
 		shorelineClient := shoreline.NewMock("test")
-		processor := redox.NewNewOrderProcessor(clinicClient, redoxClient, report.NewSampleReportGenerator(), shorelineClient, zap.NewNop().Sugar())
-		scheduledProcessor = redox.NewScheduledSummaryAndReportProcessor(processor, clinicClient, zap.NewNop().Sugar())
+		ledger = testRedox.NewOrderLedger()
+		statusRecorder = &testRedox.OrderStatusRecorder{}
+		fingerprints = testRedox.NewReportFingerprintStore()
+		subscriptions = &testRedox.SubscriptionStore{}
+		workItems = testRedox.NewWorkItemStore()
+		reportGenerator = &testRedox.ReportGenerator{}
+		clinicSettings = &testRedox.ClinicSettingsProvider{}
+		adapter := redox.NewAdapter(redoxClient)
+		auditor := &testAudit.Auditor{}
+		attachments, err := redox.NewReportAttachments(adapter, auditor, zap.NewNop().Sugar())
+		Expect(err).ToNot(HaveOccurred())
+		processor := redox.NewNewOrderProcessor(clinicClient, adapter, reportGenerator, shorelineClient, clinicSettings, ledger, statusRecorder, fingerprints, attachments, subscriptions, &testRedox.PatientContactStore{}, workItems, hl7.Config{}, auditor, zap.NewNop().Sugar())
+		scheduledProcessor = redox.NewScheduledSummaryAndReportProcessor(processor, adapter, clinicClient, ledger, statusRecorder, subscriptions, workItems, zap.NewNop().Sugar())
 	})
 
 	Describe("ProcessOrder", func() {
 		var order models.NewOrder
 		var scheduled redox.ScheduledSummaryAndReport
 		var patient *clinics.PatientV1
+		var response *clinics.EhrMatchResponseV1
 
-		BeforeEach(func() {
-			response := &clinics.EhrMatchResponseV1{}
-			matchFixture, err := test.LoadFixture("test/fixtures/subscriptionmatchresponse.json")
+		// setEventDateTime changes the time of the last matched order
+		setEventDateTime := func(eventDateTime *string) {
+			order.Meta.EventDateTime = eventDateTime
+			message, err := bson.Marshal(order)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(json.Unmarshal(matchFixture, response)).To(Succeed())
-
-			patient = &(*response.Patients)[0]
-			// Make sure we're not ignoring the scheduled order when
-			// the user's last upload data is too far back
-			now := time.Now()
-			patient.Summary.CgmStats.Dates.LastUploadDate = &now
-			patient.Summary.BgmStats.Dates.LastUploadDate = &now
+			scheduled.LastMatchedOrder.Message = message
+		}
 
+		expectClinicRequests := func() {
 			clinicClient.EXPECT().
 				GetClinicWithResponse(gomock.Any(), gomock.Any(), gomock.Any()).
 				Return(&clinics.GetClinicResponse{
@@ -79,6 +96,22 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 					HTTPResponse: &http.Response{StatusCode: http.StatusOK},
 					JSON200:      &response.Settings,
 				}, nil)
+		}
+
+		BeforeEach(func() {
+			response = &clinics.EhrMatchResponseV1{}
+			matchFixture, err := test.LoadFixture("test/fixtures/subscriptionmatchresponse.json")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(json.Unmarshal(matchFixture, response)).To(Succeed())
+
+			patient = &(*response.Patients)[0]
+			// Make sure we're not ignoring the scheduled order when
+			// the user's last upload data is too far back
+			now := time.Now()
+			patient.Summary.CgmStats.Dates.LastUploadDate = &now
+			patient.Summary.BgmStats.Dates.LastUploadDate = &now
+
+			expectClinicRequests()
 
 			newOrderFixture, err := test.LoadFixture("test/fixtures/subscriptionorder.json")
 			Expect(err).ToNot(HaveOccurred())
@@ -101,7 +134,6 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 				UserId:           *patient.Id,
 				ClinicId:         clinicObjectId,
 				LastMatchedOrder: envelope,
-				DecodedOrder:     order,
 			}
 		})
 
@@ -141,6 +173,23 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 			Expect(redoxClient.Uploaded).To(BeEmpty())
 		})
 
+		It("ties the flowsheet and notes to the appointment of a pre-visit summary and report", func() {
+			scheduled.Appointment = &redox.Appointment{
+				VisitNumber: "5678",
+				Time:        time.Now().Add(12 * time.Hour),
+				Facility:    "RES Diabetes Clinic",
+			}
+
+			Expect(scheduledProcessor.ProcessOrder(context.Background(), scheduled)).To(Succeed())
+			Expect(redoxClient.Sent).To(HaveLen(2))
+
+			flowsheet := redoxClient.Sent[0].(models.NewFlowsheet)
+			Expect(flowsheet.Visit.VisitNumber).To(PointTo(Equal("5678")))
+			notes := redoxClient.Sent[1].(*redox.NewNotes)
+			Expect(notes.Visit.VisitNumber).To(PointTo(Equal("5678")))
+			Expect(notes.Visit.Location.Facility).To(PointTo(Equal("RES Diabetes Clinic")))
+		})
+
 		It("it sends a new flowsheet and replaces notes when there is a preceding document and clinic settings are configured for note replacement", func() {
 			scheduled.Id = primitive.NewObjectID()
 			scheduled.PrecedingDocument = &redox.PrecedingDocument{
@@ -213,7 +262,7 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 		})
 
 		It("sends documents if the original order doesn't have event date time", func() {
-			scheduled.DecodedOrder.Meta.EventDateTime = nil
+			setEventDateTime(nil)
 
 			afterOrderTime := time.Now().Add(-10 * 24 * time.Hour)
 			patient.Summary.CgmStats.Dates.LastUploadDate = &afterOrderTime
@@ -225,7 +274,7 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 
 		It("sends documents if the original order's event date time can't be parsed", func() {
 			orderTime := "2099-AA"
-			scheduled.DecodedOrder.Meta.EventDateTime = &orderTime
+			setEventDateTime(&orderTime)
 
 			afterOrderTime := time.Now().Add(-10 * 24 * time.Hour)
 			patient.Summary.CgmStats.Dates.LastUploadDate = &afterOrderTime
@@ -237,7 +286,7 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 
 		It("sends documents if last upload date is after the original order time", func() {
 			orderTime := time.Now().Add(-15 * 24 * time.Hour).UTC().Format(time.RFC3339)
-			scheduled.DecodedOrder.Meta.EventDateTime = &orderTime
+			setEventDateTime(&orderTime)
 
 			afterOrderTime := time.Now().Add(-10 * 24 * time.Hour)
 			patient.Summary.CgmStats.Dates.LastUploadDate = &afterOrderTime
@@ -288,6 +337,95 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 			Expect(redoxClient.Sent).To(HaveLen(2))
 		})
 
+		It("doesn't send the summary and report again if they didn't change", func() {
+			scheduled.Id = primitive.NewObjectID()
+			Expect(scheduledProcessor.ProcessOrder(context.Background(), scheduled)).To(Succeed())
+			Expect(redoxClient.Sent).To(HaveLen(2))
+			Expect(fingerprints.Fingerprints).To(HaveLen(2))
+
+			expectClinicRequests()
+			scheduled.Id = primitive.NewObjectID()
+			Expect(scheduledProcessor.ProcessOrder(context.Background(), scheduled)).To(Succeed())
+			Expect(redoxClient.Sent).To(HaveLen(2))
+			Expect(statusRecorder.Statuses()).To(HaveExactElements(
+				redox.OrderStatusFlowsheetSent,
+				redox.OrderStatusNoteSent,
+				redox.OrderStatusReportSkipped,
+			))
+		})
+
+		It("sends the summary and report again if the summary changed", func() {
+			scheduled.Id = primitive.NewObjectID()
+			Expect(scheduledProcessor.ProcessOrder(context.Background(), scheduled)).To(Succeed())
+			Expect(redoxClient.Sent).To(HaveLen(2))
+
+			expectClinicRequests()
+			timeInTarget := 0.5
+			period := patient.Summary.CgmStats.Periods["14d"]
+			period.TimeInTargetPercent = &timeInTarget
+			patient.Summary.CgmStats.Periods["14d"] = period
+			scheduled.Id = primitive.NewObjectID()
+			Expect(scheduledProcessor.ProcessOrder(context.Background(), scheduled)).To(Succeed())
+			Expect(redoxClient.Sent).To(HaveLen(4))
+		})
+
+		It("cancels the scheduled summary and report if the subscription was disabled", func() {
+			scheduled.Id = primitive.NewObjectID()
+			subscriptions.Subscriptions = []redox.ReportSubscription{{
+				ClinicId:  *response.Clinic.Id,
+				PatientId: *patient.Id,
+				State:     redox.SubscriptionStateInactive,
+			}}
+
+			Expect(scheduledProcessor.ProcessOrder(context.Background(), scheduled)).To(Succeed())
+			Expect(redoxClient.Sent).To(BeEmpty())
+			Expect(statusRecorder.Statuses()).To(HaveExactElements(redox.OrderStatusReportCancelled))
+		})
+
+		It("sends the summary and report if the subscription is active", func() {
+			subscriptions.Subscriptions = []redox.ReportSubscription{{
+				ClinicId:  *response.Clinic.Id,
+				PatientId: *patient.Id,
+				State:     redox.SubscriptionStateActive,
+			}}
+
+			Expect(scheduledProcessor.ProcessOrder(context.Background(), scheduled)).To(Succeed())
+			Expect(redoxClient.Sent).To(HaveLen(2))
+		})
+
+		It("retries the report later when a fallback note was sent instead", func() {
+			scheduled.Id = primitive.NewObjectID()
+			reportGenerator.Err = errors.New("export service is unavailable")
+			clinicSettings.Default.Notes.MaxReportFailures = 1
+
+			Expect(scheduledProcessor.ProcessOrder(context.Background(), scheduled)).To(Succeed())
+			Expect(redoxClient.Sent).To(HaveLen(3))
+			Expect(redoxClient.Sent[2].(*redox.NewNotes).Note.ContentType).To(Equal(redox.NoteContentTypePlainText))
+
+			retry := redox.NewScheduledReportRetry(scheduled)
+			Expect(workItems.Items).To(HaveKey(retry.Id))
+			item := workItems.Items[retry.Id]
+			Expect(item.Type).To(Equal(redox.WorkItemTypeScheduledReport))
+
+			restored, err := item.ScheduledSummaryAndReport()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(restored.Id).To(Equal(scheduled.Id))
+			Expect(restored.UserId).To(Equal(scheduled.UserId))
+			Expect(restored.ClinicId).To(Equal(scheduled.ClinicId))
+
+			expectClinicRequests()
+			reportGenerator.Err = nil
+			Expect(scheduledProcessor.ProcessOrder(context.Background(), restored)).To(Succeed())
+			Expect(redoxClient.Sent).To(HaveLen(4))
+
+			notes := redoxClient.Sent[3].(*redox.ReplaceNotes)
+			Expect(notes.Note.OriginalDocumentID).To(Equal(scheduled.Id.Hex()))
+			Expect(notes.Note.ContentType).To(Equal(redox.NoteContentTypeBase64))
+
+			key := redox.OrderKey{OrderId: scheduled.Id.Hex(), ProcedureCode: redox.ScheduledProcedureCode}
+			Expect(ledger.Entries[key].IsStepCompleted(redox.OrderStepNoteSent, "")).To(BeTrue())
+		})
+
 		It("succeeds if cgm stats is nil", func() {
 			now := time.Now()
 			patient.Summary.CgmStats = nil
@@ -323,7 +461,7 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 		It("Should be false when there's no preceding document and clinic is not configured for replacement", func() {
 			params := redox.SummaryAndReportParameters{
 				Match:      *response,
-				Order:      *order,
+				Order:      redox.NormalizeOrder(*order),
 				DocumentId: "1234567",
 			}
 			Expect(params.ShouldReplacePrecedingReport()).To(BeFalse())
@@ -334,7 +472,7 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 			response.Settings.ScheduledReports.OnUploadNoteEventType = &eventType
 			params := redox.SummaryAndReportParameters{
 				Match:      *response,
-				Order:      *order,
+				Order:      redox.NormalizeOrder(*order),
 				DocumentId: "1234567",
 				PrecedingDocument: &redox.PrecedingDocument{
 					Id:          primitive.NewObjectID(),
@@ -350,7 +488,7 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 
 			params := redox.SummaryAndReportParameters{
 				Match:      *response,
-				Order:      *order,
+				Order:      redox.NormalizeOrder(*order),
 				DocumentId: "1234567",
 				PrecedingDocument: &redox.PrecedingDocument{
 					Id:          primitive.NewObjectID(),
@@ -367,7 +505,7 @@ var _ = Describe("ScheduledSummaryAndReportProcessor", func() {
 			offset := rand.IntN(int((time.Minute*5 - time.Second*10).Seconds())) + 1
 			params := redox.SummaryAndReportParameters{
 				Match:      *response,
-				Order:      *order,
+				Order:      redox.NormalizeOrder(*order),
 				DocumentId: "1234567",
 				PrecedingDocument: &redox.PrecedingDocument{
 					Id:          primitive.NewObjectID(),
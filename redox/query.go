@@ -0,0 +1,304 @@
+package redox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/clinic-worker/ehr"
+	clinics "github.com/tidepool-org/clinic/client"
+	models "github.com/tidepool-org/clinic/redox_models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	DataModelPatientSearch = "PatientSearch"
+	EventTypeQuery         = "Query"
+	EventTypeQueryResponse = "QueryResponse"
+
+	QueryStatusFound    QueryStatus = "found"
+	QueryStatusNotFound QueryStatus = "notFound"
+	QueryStatusExpired  QueryStatus = "expired"
+
+	queryResponsesCollectionName = "redox_query_responses"
+
+	// queryResponseRetention is how long responses are kept after the query timed out
+	queryResponseRetention = 24 * time.Hour
+)
+
+type QueryStatus string
+
+type QueryConfig struct {
+	// Timeout is how long Redox waits for the response to a query, starting when the query is stored
+	Timeout time.Duration `envconfig:"TIDEPOOL_REDOX_QUERY_TIMEOUT" default:"25s"`
+}
+
+func NewQueryConfig() (QueryConfig, error) {
+	config := QueryConfig{}
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+// QueryResponse is the response to a query message. It's correlated to the query by the id of the stored query
+// message. The service which received the query from Redox polls the worker API for the response until the query
+// times out.
+type QueryResponse struct {
+	QueryId   primitive.ObjectID `json:"queryId" bson:"_id"`
+	DataModel string             `json:"dataModel" bson:"dataModel"`
+	Status    QueryStatus        `json:"status" bson:"status"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	// Payload is the JSON body of the response returned to Redox
+	Payload        json.RawMessage `json:"payload,omitempty" bson:"payload,omitempty"`
+	CreatedTime    time.Time       `json:"createdTime" bson:"createdTime"`
+	ExpirationTime time.Time       `json:"expirationTime" bson:"expirationTime"`
+}
+
+type QueryResponseStore interface {
+	// Put stores the response unless a response to the query already exists
+	Put(ctx context.Context, response QueryResponse) error
+	// Get returns the response to the query or nil if the query wasn't processed yet
+	Get(ctx context.Context, queryId primitive.ObjectID) (*QueryResponse, error)
+}
+
+type MongoQueryResponseStore struct {
+	collection *mongo.Collection
+}
+
+var _ QueryResponseStore = &MongoQueryResponseStore{}
+
+func NewQueryResponseStore(db *mongo.Database, config ModuleConfig, lifecycle fx.Lifecycle) QueryResponseStore {
+	store := &MongoQueryResponseStore{
+		collection: db.Collection(queryResponsesCollectionName),
+	}
+	if config.Enabled {
+		lifecycle.Append(fx.Hook{
+			OnStart: store.CreateIndexes,
+		})
+	}
+	return store
+}
+
+func (m *MongoQueryResponseStore) CreateIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expirationTime", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create query response indexes: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoQueryResponseStore) Put(ctx context.Context, response QueryResponse) error {
+	update := bson.M{"$setOnInsert": response}
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": response.QueryId}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("unable to store query response: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoQueryResponseStore) Get(ctx context.Context, queryId primitive.ObjectID) (*QueryResponse, error) {
+	response := QueryResponse{}
+	err := m.collection.FindOne(ctx, bson.M{"_id": queryId}).Decode(&response)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get query response: %w", err)
+	}
+	return &response, nil
+}
+
+type QueryProcessor interface {
+	// ProcessQuery responds to the query with the summary statistics of the patient. Query messages have the same
+	// meta and patient as orders, so they are decoded as orders.
+	ProcessQuery(ctx context.Context, envelope models.MessageEnvelope, query models.NewOrder) error
+}
+
+type queryProcessor struct {
+	config         QueryConfig
+	clinics        clinics.ClientWithResponsesInterface
+	client         Client
+	clinicSettings ClinicSettingsProvider
+	subscriptions  SubscriptionStore
+	responses      QueryResponseStore
+	logger         *zap.SugaredLogger
+}
+
+func NewQueryProcessor(config QueryConfig, clinics clinics.ClientWithResponsesInterface, client Client, clinicSettings ClinicSettingsProvider, subscriptions SubscriptionStore, responses QueryResponseStore, logger *zap.SugaredLogger) QueryProcessor {
+	return &queryProcessor{
+		config:         config,
+		clinics:        clinics,
+		client:         client,
+		clinicSettings: clinicSettings,
+		subscriptions:  subscriptions,
+		responses:      responses,
+		logger:         logger,
+	}
+}
+
+func (q *queryProcessor) ProcessQuery(ctx context.Context, envelope models.MessageEnvelope, query models.NewOrder) error {
+	deadline := envelope.Id.Timestamp().Add(q.config.Timeout)
+	if !time.Now().Before(deadline) {
+		q.logger.Warnw("the query expired before it was processed", "query", query.Meta, "queryId", envelope.Id.Hex())
+		return q.responses.Put(ctx, q.newResponse(envelope, deadline, QueryStatusExpired))
+	}
+
+	queryCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	response, err := q.respond(queryCtx, envelope, query, deadline)
+	if err != nil {
+		if errors.Is(queryCtx.Err(), context.DeadlineExceeded) {
+			q.logger.Warnw("the query timed out", "query", query.Meta, "queryId", envelope.Id.Hex(), zap.Error(err))
+			return q.responses.Put(ctx, q.newResponse(envelope, deadline, QueryStatusExpired))
+		}
+		// Return an error so we can retry the request
+		return err
+	}
+
+	q.logger.Infow("responding to query", "query", query.Meta, "queryId", envelope.Id.Hex(), "status", response.Status)
+	return q.responses.Put(ctx, response)
+}
+
+// respond returns the summary statistics of the patient with reports enabled who has the mrn of the query in the
+// source of the query. The summary statistics of patients without reports enabled aren't shared with the EHR.
+func (q *queryProcessor) respond(ctx context.Context, envelope models.MessageEnvelope, query models.NewOrder, deadline time.Time) (QueryResponse, error) {
+	response := q.newResponse(envelope, deadline, QueryStatusNotFound)
+
+	order := NormalizeOrder(query)
+	subscriptions, err := q.findSubscriptions(ctx, order.SourceId, order.Patient.Identifiers)
+	if err != nil {
+		return response, err
+	}
+	if len(subscriptions) == 0 {
+		response.Reason = "patient not found"
+		return response, nil
+	}
+	if len(subscriptions) > 1 {
+		response.Reason = "multiple matching patients"
+		return response, nil
+	}
+	subscription := subscriptions[0]
+
+	match, err := q.getMatch(ctx, subscription)
+	if err != nil {
+		return response, err
+	}
+	if match == nil {
+		response.Reason = "patient not found"
+		return response, nil
+	}
+	patient := (*match.Patients)[0]
+
+	// The mrn may have been reassigned, so the date of birth must match if the query includes it
+	if birthDate, err := order.GetBirthDate(); err == nil && birthDate.String() != patient.BirthDate.String() {
+		response.Reason = "patient not found"
+		return response, nil
+	}
+
+	clinicSettings, err := q.clinicSettings.GetClinicSettings(ctx, subscription.ClinicId)
+	if err != nil {
+		return response, fmt.Errorf("unable to get clinic settings: %w", err)
+	}
+
+	source := q.client.ForClinic(match.Settings).GetSource()
+	flowsheet := NewFlowsheet()
+	flowsheet.Meta.EventType = EventTypeQueryResponse
+	flowsheet.Meta.Source = &source
+	flowsheet.Patient.Identifiers = query.Patient.Identifiers
+	flowsheet.Patient.Demographics = query.Patient.Demographics
+	PopulateSummaryStatistics(patient, NewFlowsheetSettings(*match, clinicSettings), &flowsheet)
+
+	payload, err := json.Marshal(flowsheet)
+	if err != nil {
+		return response, fmt.Errorf("unable to encode query response: %w", err)
+	}
+
+	response.Status = QueryStatusFound
+	response.Payload = payload
+	return response, nil
+}
+
+func (q *queryProcessor) findSubscriptions(ctx context.Context, sourceId string, identifiers []ehr.Identifier) ([]ReportSubscription, error) {
+	if sourceId == "" {
+		return nil, nil
+	}
+
+	var result []ReportSubscription
+	for _, identifier := range identifiers {
+		subscriptions, err := q.subscriptions.FindByMrn(ctx, sourceId, identifier.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, subscription := range subscriptions {
+			if strings.EqualFold(subscription.MrnIdType, identifier.Type) {
+				result = append(result, subscription)
+			}
+		}
+	}
+	return result, nil
+}
+
+// getMatch returns the clinic, the EHR settings and the patient of the subscription or nil if any of them doesn't
+// exist anymore
+func (q *queryProcessor) getMatch(ctx context.Context, subscription ReportSubscription) (*clinics.EhrMatchResponseV1, error) {
+	clinic, err := q.clinics.GetClinicWithResponse(ctx, subscription.ClinicId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get clinic: %w", err)
+	}
+	if clinic.StatusCode() == http.StatusNotFound {
+		return nil, nil
+	} else if clinic.StatusCode() != http.StatusOK || clinic.JSON200 == nil {
+		return nil, fmt.Errorf("unexpected status code when getting clinic %s: %d", subscription.ClinicId, clinic.StatusCode())
+	}
+
+	settings, err := q.clinics.GetEHRSettingsWithResponse(ctx, subscription.ClinicId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get clinic ehr settings: %w", err)
+	}
+	if settings.StatusCode() == http.StatusNotFound {
+		return nil, nil
+	} else if settings.StatusCode() != http.StatusOK || settings.JSON200 == nil {
+		return nil, fmt.Errorf("unexpected status code when getting ehr settings of clinic %s: %d", subscription.ClinicId, settings.StatusCode())
+	}
+	if !settings.JSON200.Enabled {
+		return nil, nil
+	}
+
+	patient, err := q.clinics.GetPatientWithResponse(ctx, subscription.ClinicId, subscription.PatientId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get patient: %w", err)
+	}
+	if patient.StatusCode() == http.StatusNotFound {
+		return nil, nil
+	} else if patient.StatusCode() != http.StatusOK || patient.JSON200 == nil {
+		return nil, fmt.Errorf("unexpected status code when getting patient %s: %d", subscription.PatientId, patient.StatusCode())
+	}
+
+	return &clinics.EhrMatchResponseV1{
+		Clinic:   *clinic.JSON200,
+		Settings: *settings.JSON200,
+		Patients: &clinics.PatientsV1{*patient.JSON200},
+	}, nil
+}
+
+func (q *queryProcessor) newResponse(envelope models.MessageEnvelope, deadline time.Time, status QueryStatus) QueryResponse {
+	return QueryResponse{
+		QueryId:        envelope.Id,
+		DataModel:      envelope.Meta.DataModel,
+		Status:         status,
+		CreatedTime:    time.Now(),
+		ExpirationTime: deadline.Add(queryResponseRetention),
+	}
+}
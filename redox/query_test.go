@@ -0,0 +1,196 @@
+package redox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/hl7"
+	"github.com/tidepool-org/clinic-worker/redox"
+	testRedox "github.com/tidepool-org/clinic-worker/redox/test"
+	"github.com/tidepool-org/clinic-worker/test"
+	clinics "github.com/tidepool-org/clinic/client"
+	models "github.com/tidepool-org/clinic/redox_models"
+)
+
+var _ = Describe("QueryProcessor", func() {
+	var clinicClient *clinics.MockClientWithResponsesInterface
+	var subscriptions *testRedox.SubscriptionStore
+	var responses *testRedox.QueryResponseStore
+	var processor redox.QueryProcessor
+	var query models.NewOrder
+	var envelope models.MessageEnvelope
+	var match *clinics.EhrMatchResponseV1
+
+	BeforeEach(func() {
+		clinicClient = clinics.NewMockClientWithResponsesInterface(gomock.NewController(GinkgoT()))
+		subscriptions = &testRedox.SubscriptionStore{}
+		responses = testRedox.NewQueryResponseStore()
+		redoxClient := testRedox.NewTestRedoxClient("testSourceId", "testSourceName")
+		config := redox.QueryConfig{Timeout: 25 * time.Second}
+		processor = redox.NewQueryProcessor(config, clinicClient, redoxClient, &testRedox.ClinicSettingsProvider{}, subscriptions, responses, zap.NewNop().Sugar())
+
+		queryFixture, err := test.LoadFixture("test/fixtures/patientsearchquery.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(json.Unmarshal(queryFixture, &query)).To(Succeed())
+		envelope = models.MessageEnvelope{
+			Id:   primitive.NewObjectID(),
+			Meta: query.Meta,
+		}
+
+		match = &clinics.EhrMatchResponseV1{}
+		matchFixture, err := test.LoadFixture("test/fixtures/subscriptionmatchresponse.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(json.Unmarshal(matchFixture, match)).To(Succeed())
+
+		Expect(subscriptions.Upsert(context.Background(), redox.ReportSubscription{
+			ClinicId:  *match.Clinic.Id,
+			PatientId: *(*match.Patients)[0].Id,
+			SourceId:  *query.Meta.Source.ID,
+			Mrn:       "0000000001",
+			MrnIdType: "MRN",
+		})).To(Succeed())
+	})
+
+	expectClinicRequests := func() {
+		clinicClient.EXPECT().
+			GetClinicWithResponse(gomock.Any(), *match.Clinic.Id).
+			Return(&clinics.GetClinicResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &match.Clinic,
+			}, nil)
+		clinicClient.EXPECT().
+			GetEHRSettingsWithResponse(gomock.Any(), *match.Clinic.Id).
+			Return(&clinics.GetEHRSettingsResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &match.Settings,
+			}, nil)
+		clinicClient.EXPECT().
+			GetPatientWithResponse(gomock.Any(), *match.Clinic.Id, *(*match.Patients)[0].Id).
+			Return(&clinics.GetPatientResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &(*match.Patients)[0],
+			}, nil)
+	}
+
+	It("responds with the flowsheet of the patient with reports enabled", func() {
+		expectClinicRequests()
+
+		Expect(processor.ProcessQuery(context.Background(), envelope, query)).To(Succeed())
+		Expect(responses.Responses).To(HaveKey(envelope.Id))
+
+		response := responses.Responses[envelope.Id]
+		Expect(response.Status).To(Equal(redox.QueryStatusFound))
+		Expect(response.DataModel).To(Equal(redox.DataModelPatientSearch))
+
+		flowsheet := models.NewFlowsheet{}
+		Expect(json.Unmarshal(response.Payload, &flowsheet)).To(Succeed())
+		Expect(flowsheet.Meta.EventType).To(Equal(redox.EventTypeQueryResponse))
+		Expect(flowsheet.Observations).ToNot(BeEmpty())
+		Expect(flowsheet.Patient.Identifiers).To(Equal(query.Patient.Identifiers))
+	})
+
+	It("responds with not found if the patient doesn't have reports enabled", func() {
+		subscriptions.Subscriptions = nil
+
+		Expect(processor.ProcessQuery(context.Background(), envelope, query)).To(Succeed())
+		Expect(responses.Responses[envelope.Id].Status).To(Equal(redox.QueryStatusNotFound))
+		Expect(responses.Responses[envelope.Id].Payload).To(BeEmpty())
+	})
+
+	It("responds with not found if the query is from another source", func() {
+		otherSource := "other-source"
+		query.Meta.Source.ID = &otherSource
+
+		Expect(processor.ProcessQuery(context.Background(), envelope, query)).To(Succeed())
+		Expect(responses.Responses[envelope.Id].Status).To(Equal(redox.QueryStatusNotFound))
+	})
+
+	It("responds with not found if the date of birth doesn't match", func() {
+		expectClinicRequests()
+		dob := "2001-02-03"
+		query.Patient.Demographics.DOB = &dob
+
+		Expect(processor.ProcessQuery(context.Background(), envelope, query)).To(Succeed())
+		Expect(responses.Responses[envelope.Id].Status).To(Equal(redox.QueryStatusNotFound))
+	})
+
+	It("responds with not found if the patient was deleted", func() {
+		clinicClient.EXPECT().
+			GetClinicWithResponse(gomock.Any(), *match.Clinic.Id).
+			Return(&clinics.GetClinicResponse{HTTPResponse: &http.Response{StatusCode: http.StatusOK}, JSON200: &match.Clinic}, nil)
+		clinicClient.EXPECT().
+			GetEHRSettingsWithResponse(gomock.Any(), *match.Clinic.Id).
+			Return(&clinics.GetEHRSettingsResponse{HTTPResponse: &http.Response{StatusCode: http.StatusOK}, JSON200: &match.Settings}, nil)
+		clinicClient.EXPECT().
+			GetPatientWithResponse(gomock.Any(), *match.Clinic.Id, gomock.Any()).
+			Return(&clinics.GetPatientResponse{HTTPResponse: &http.Response{StatusCode: http.StatusNotFound}}, nil)
+
+		Expect(processor.ProcessQuery(context.Background(), envelope, query)).To(Succeed())
+		Expect(responses.Responses[envelope.Id].Status).To(Equal(redox.QueryStatusNotFound))
+	})
+
+	It("doesn't respond to expired queries", func() {
+		envelope.Id = primitive.NewObjectIDFromTimestamp(time.Now().Add(-time.Minute))
+
+		Expect(processor.ProcessQuery(context.Background(), envelope, query)).To(Succeed())
+		Expect(responses.Responses[envelope.Id].Status).To(Equal(redox.QueryStatusExpired))
+	})
+
+	It("returns an error so the query is retried if the clinic service is unavailable", func() {
+		clinicClient.EXPECT().
+			GetClinicWithResponse(gomock.Any(), gomock.Any()).
+			Return(nil, errors.New("unavailable"))
+
+		Expect(processor.ProcessQuery(context.Background(), envelope, query)).ToNot(Succeed())
+		Expect(responses.Responses).To(BeEmpty())
+	})
+
+	Describe("API", func() {
+		var api *redox.API
+
+		BeforeEach(func() {
+			api = redox.NewAPI(&testRedox.ClinicSettingsProvider{}, testRedox.NewOrderLedger(), responses, &testRedox.PatientContactStore{}, hl7.Config{}, zap.NewNop().Sugar())
+		})
+
+		get := func(queryId string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			api.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/redox/queries/"+queryId+"/response", nil))
+			return recorder
+		}
+
+		It("returns the response to the query", func() {
+			expectClinicRequests()
+			Expect(processor.ProcessQuery(context.Background(), envelope, query)).To(Succeed())
+
+			recorder := get(envelope.Id.Hex())
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			response := redox.QueryResponse{}
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.QueryId).To(Equal(envelope.Id))
+			Expect(response.Status).To(Equal(redox.QueryStatusFound))
+
+			flowsheet := models.NewFlowsheet{}
+			Expect(json.Unmarshal(response.Payload, &flowsheet)).To(Succeed())
+			Expect(flowsheet.Meta.EventType).To(Equal(redox.EventTypeQueryResponse))
+		})
+
+		It("returns not found if the query wasn't processed yet", func() {
+			Expect(get(envelope.Id.Hex()).Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("rejects invalid query ids", func() {
+			Expect(get("invalid").Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -0,0 +1,191 @@
+package redox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/avast/retry-go"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/clinic-worker/audit"
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"go.uber.org/zap"
+)
+
+const (
+	reportFilePattern = "redox-report-*.pdf"
+
+	// PayloadTypeReportUpload is audited for the reports which are uploaded to the EHR before they are referenced by
+	// notes
+	PayloadTypeReportUpload PayloadType = "report_upload"
+)
+
+var ErrReportTooLarge = errors.New("report exceeds the maximum size")
+
+type ReportFilesConfig struct {
+	// TempDir is the directory where reports are buffered before they are sent. Defaults to the system temp directory.
+	TempDir string `envconfig:"TIDEPOOL_REDOX_REPORT_TEMP_DIR"`
+	// MaxSize is the maximum size of reports in bytes. Larger reports are rejected.
+	MaxSize int64 `envconfig:"TIDEPOOL_REDOX_REPORT_MAX_SIZE" default:"52428800"`
+	// MaxEmbeddedSize is the maximum size of reports in bytes which are embedded in notes. Larger reports are uploaded.
+	MaxEmbeddedSize int64         `envconfig:"TIDEPOOL_REDOX_REPORT_MAX_EMBEDDED_SIZE" default:"5242880"`
+	UploadAttempts  uint          `envconfig:"TIDEPOOL_REDOX_REPORT_UPLOAD_ATTEMPTS" default:"3"`
+	UploadDelay     time.Duration `envconfig:"TIDEPOOL_REDOX_REPORT_UPLOAD_DELAY" default:"5s"`
+}
+
+// BufferedReport is a report which was written to a temporary file, so it can be read multiple times without
+// keeping the whole document in memory
+type BufferedReport struct {
+	file     *os.File
+	Size     int64
+	Checksum string
+}
+
+// BufferReport writes the document to a temporary file and computes its SHA-256 checksum. The file must be removed
+// by closing the buffered report.
+func BufferReport(document io.Reader, tempDir string, maxSize int64) (*BufferedReport, error) {
+	file, err := os.CreateTemp(tempDir, reportFilePattern)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create report file: %w", err)
+	}
+
+	buffered := &BufferedReport{file: file}
+	hash := sha256.New()
+	// Read one byte more than the maximum size to detect reports which are too large
+	size, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(document, maxSize+1))
+	if err != nil {
+		buffered.Close()
+		return nil, fmt.Errorf("unable to buffer report: %w", err)
+	}
+	if size > maxSize {
+		buffered.Close()
+		return nil, fmt.Errorf("%w of %d bytes", ErrReportTooLarge, maxSize)
+	}
+
+	buffered.Size = size
+	buffered.Checksum = hex.EncodeToString(hash.Sum(nil))
+	return buffered, nil
+}
+
+// Reader returns a new reader of the whole document
+func (b *BufferedReport) Reader() io.Reader {
+	return io.NewSectionReader(b.file, 0, b.Size)
+}
+
+func (b *BufferedReport) Close() error {
+	closeErr := b.file.Close()
+	if err := os.Remove(b.file.Name()); err != nil {
+		return fmt.Errorf("unable to remove report file: %w", err)
+	}
+	return closeErr
+}
+
+// ReportUpload is a report which was uploaded to the EHR and can be referenced by documents
+type ReportUpload struct {
+	URI      string    `bson:"uri"`
+	Checksum string    `bson:"checksum"`
+	Size     int64     `bson:"size"`
+	Time     time.Time `bson:"time"`
+}
+
+// Reference returns the reference to the upload which is included in documents
+func (u ReportUpload) Reference() *ehr.Upload {
+	return &ehr.Upload{URI: u.URI}
+}
+
+// ReportAttachments attach reports to documents either by embedding them or by uploading them with the EHR adapter
+type ReportAttachments interface {
+	// Buffer returns the buffered document or ErrReportTooLarge if the document exceeds the maximum size
+	Buffer(document io.Reader) (*BufferedReport, error)
+	// Attach embeds the report in the document if it's small enough and uploads aren't required, otherwise it uploads
+	// the report and references the upload in the document. The upload is returned if the report was uploaded.
+	// Reports are always embedded if the adapter doesn't support uploads. Uploads are audited for the target.
+	Attach(ctx context.Context, destination ehr.Destination, target audit.Target, document *ehr.Document, report *BufferedReport) (*ReportUpload, error)
+}
+
+type reportAttachments struct {
+	config  ReportFilesConfig
+	adapter ehr.Adapter
+	auditor audit.Auditor
+	logger  *zap.SugaredLogger
+}
+
+var _ ReportAttachments = &reportAttachments{}
+
+func NewReportAttachments(adapter ehr.Adapter, auditor audit.Auditor, logger *zap.SugaredLogger) (ReportAttachments, error) {
+	config := ReportFilesConfig{}
+	if err := envconfig.Process("", &config); err != nil {
+		return nil, err
+	}
+
+	return &reportAttachments{
+		config:  config,
+		adapter: adapter,
+		auditor: auditor,
+		logger:  logger,
+	}, nil
+}
+
+func (r *reportAttachments) Buffer(document io.Reader) (*BufferedReport, error) {
+	return BufferReport(document, r.config.TempDir, r.config.MaxSize)
+}
+
+func (r *reportAttachments) Attach(ctx context.Context, destination ehr.Destination, target audit.Target, document *ehr.Document, report *BufferedReport) (*ReportUpload, error) {
+	document.FileName = NoteReportFileName
+	adapter, err := ehr.AdapterFor(r.adapter, document.Order)
+	if err != nil {
+		return nil, err
+	}
+	uploader, ok := adapter.(ehr.Uploader)
+	if !ok || (!uploader.IsUploadRequired(destination) && report.Size <= r.config.MaxEmbeddedSize) {
+		content, err := io.ReadAll(report.Reader())
+		if err != nil {
+			return nil, fmt.Errorf("unable to read report: %w", err)
+		}
+		document.Content = content
+		return nil, nil
+	}
+
+	upload, err := r.upload(ctx, uploader, destination, target, report)
+	if err != nil {
+		return nil, err
+	}
+	document.Upload = upload.Reference()
+	return upload, nil
+}
+
+// upload retries the upload independently of the order, because a failed upload can be retried without generating
+// the report again. Each attempt is audited, because the report may have been received even if the upload failed.
+func (r *reportAttachments) upload(ctx context.Context, uploader ehr.Uploader, destination ehr.Destination, target audit.Target, report *BufferedReport) (*ReportUpload, error) {
+	var result ehr.Upload
+	err := retry.Do(
+		func() (err error) {
+			result, err = uploader.Upload(ctx, destination, NoteReportFileName, report.Reader())
+			r.auditor.Record(ctx, NewPHISentEvent(target, PayloadTypeReportUpload, destination.Id, err))
+			return err
+		},
+		retry.Attempts(r.config.UploadAttempts),
+		retry.Delay(r.config.UploadDelay),
+		retry.DelayType(retry.BackOffDelay),
+		retry.LastErrorOnly(true),
+		retry.Context(ctx),
+		retry.OnRetry(func(attempt uint, err error) {
+			r.logger.Warnw("unable to upload report", "attempt", attempt+1, "checksum", report.Checksum, "error", err)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to upload report: %w", err)
+	}
+
+	return &ReportUpload{
+		URI:      result.URI,
+		Checksum: report.Checksum,
+		Size:     report.Size,
+		Time:     time.Now(),
+	}, nil
+}
@@ -0,0 +1,163 @@
+package redox_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/audit"
+	testAudit "github.com/tidepool-org/clinic-worker/audit/test"
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"github.com/tidepool-org/clinic-worker/redox"
+	testRedox "github.com/tidepool-org/clinic-worker/redox/test"
+)
+
+var _ = Describe("ReportFiles", func() {
+	document := []byte("%PDF-1.7 sample report")
+
+	Describe("BufferReport", func() {
+		It("computes the size and the checksum of the report", func() {
+			buffered, err := redox.BufferReport(bytes.NewReader(document), GinkgoT().TempDir(), 1024)
+			Expect(err).ToNot(HaveOccurred())
+			defer buffered.Close()
+
+			checksum := sha256.Sum256(document)
+			Expect(buffered.Size).To(BeEquivalentTo(len(document)))
+			Expect(buffered.Checksum).To(Equal(hex.EncodeToString(checksum[:])))
+		})
+
+		It("can read the report multiple times", func() {
+			buffered, err := redox.BufferReport(bytes.NewReader(document), GinkgoT().TempDir(), 1024)
+			Expect(err).ToNot(HaveOccurred())
+			defer buffered.Close()
+
+			for i := 0; i < 2; i++ {
+				contents, err := io.ReadAll(buffered.Reader())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(contents).To(Equal(document))
+			}
+		})
+
+		It("returns an error and removes the file if the report is too large", func() {
+			tempDir := GinkgoT().TempDir()
+			_, err := redox.BufferReport(bytes.NewReader(document), tempDir, int64(len(document)-1))
+			Expect(err).To(MatchError(redox.ErrReportTooLarge))
+			Expect(os.ReadDir(tempDir)).To(BeEmpty())
+		})
+
+		It("removes the file when it's closed", func() {
+			tempDir := GinkgoT().TempDir()
+			buffered, err := redox.BufferReport(bytes.NewReader(document), tempDir, 1024)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buffered.Close()).To(Succeed())
+			Expect(os.ReadDir(tempDir)).To(BeEmpty())
+		})
+	})
+
+	Describe("Attach", func() {
+		var redoxClient *testRedox.RedoxClient
+		var auditor *testAudit.Auditor
+		var attachments redox.ReportAttachments
+		var buffered *redox.BufferedReport
+		var report *ehr.Document
+		target := audit.Target{ClinicId: "clinic-1", PatientId: "patient-1"}
+
+		BeforeEach(func() {
+			GinkgoT().Setenv("TIDEPOOL_REDOX_REPORT_MAX_EMBEDDED_SIZE", "16")
+			GinkgoT().Setenv("TIDEPOOL_REDOX_REPORT_UPLOAD_DELAY", "1ms")
+
+			var err error
+			redoxClient = testRedox.NewTestRedoxClient("testSourceId", "testSourceName")
+			auditor = &testAudit.Auditor{}
+			attachments, err = redox.NewReportAttachments(redox.NewAdapter(redoxClient), auditor, zap.NewNop().Sugar())
+			Expect(err).ToNot(HaveOccurred())
+			report = &ehr.Document{}
+		})
+
+		AfterEach(func() {
+			Expect(buffered.Close()).To(Succeed())
+		})
+
+		It("embeds small reports", func() {
+			var err error
+			buffered, err = attachments.Buffer(bytes.NewReader(document[:8]))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(attachments.Attach(context.Background(), ehr.Destination{}, target, report, buffered)).To(BeNil())
+			Expect(redoxClient.Uploaded).To(BeEmpty())
+			Expect(report.FileName).To(Equal(redox.NoteReportFileName))
+			Expect(report.Content).To(Equal(document[:8]))
+			Expect(report.Upload).To(BeNil())
+			Expect(auditor.Events).To(BeEmpty())
+		})
+
+		It("uploads reports which are too large to be embedded", func() {
+			var err error
+			buffered, err = attachments.Buffer(bytes.NewReader(document))
+			Expect(err).ToNot(HaveOccurred())
+
+			upload, err := attachments.Attach(context.Background(), ehr.Destination{}, target, report, buffered)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(upload.Checksum).To(Equal(buffered.Checksum))
+			Expect(redoxClient.Uploaded).To(HaveKeyWithValue(redox.NoteReportFileName, document))
+			Expect(report.Content).To(BeNil())
+			Expect(report.Upload).To(PointTo(MatchFields(IgnoreExtras, Fields{"URI": Equal(upload.URI)})))
+
+			Expect(auditor.Events).To(HaveLen(1))
+			Expect(auditor.Events[0].Action).To(Equal(audit.ActionPHISent))
+			Expect(auditor.Events[0].Outcome).To(Equal(audit.OutcomeSuccess))
+			Expect(auditor.Events[0].Target).To(Equal(target))
+			Expect(auditor.Events[0].Details).To(HaveKeyWithValue("payloadType", string(redox.PayloadTypeReportUpload)))
+		})
+
+		It("retries failed uploads", func() {
+			var err error
+			buffered, err = attachments.Buffer(bytes.NewReader(document))
+			Expect(err).ToNot(HaveOccurred())
+
+			redoxClient.UploadFailures = 2
+			upload, err := attachments.Attach(context.Background(), ehr.Destination{}, target, report, buffered)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(upload.URI).ToNot(BeEmpty())
+			Expect(redoxClient.Uploaded).To(HaveKeyWithValue(redox.NoteReportFileName, document))
+
+			var outcomes []audit.Outcome
+			for _, event := range auditor.Events {
+				outcomes = append(outcomes, event.Outcome)
+			}
+			Expect(outcomes).To(Equal([]audit.Outcome{audit.OutcomeFailure, audit.OutcomeFailure, audit.OutcomeSuccess}))
+		})
+
+		It("uploads reports with the client of the clinic's source", func() {
+			var err error
+			buffered, err = attachments.Buffer(bytes.NewReader(document))
+			Expect(err).ToNot(HaveOccurred())
+
+			source := testRedox.NewTestRedoxClient("dedicatedSourceId", "dedicatedSourceName")
+			redoxClient.Sources = map[string]*testRedox.RedoxClient{"clinicSourceId": source}
+			_, err = attachments.Attach(context.Background(), ehr.Destination{SourceId: "clinicSourceId"}, target, report, buffered)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(redoxClient.Uploaded).To(BeEmpty())
+			Expect(source.Uploaded).To(HaveKeyWithValue(redox.NoteReportFileName, document))
+		})
+
+		It("returns an error when all upload attempts fail", func() {
+			var err error
+			buffered, err = attachments.Buffer(bytes.NewReader(document))
+			Expect(err).ToNot(HaveOccurred())
+
+			redoxClient.UploadFailures = 3
+			_, err = attachments.Attach(context.Background(), ehr.Destination{}, target, report, buffered)
+			Expect(err).To(HaveOccurred())
+			Expect(redoxClient.Uploaded).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,134 @@
+package redox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/report"
+	clinics "github.com/tidepool-org/clinic/client"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+)
+
+const (
+	reportFingerprintsCollectionName = "redox_report_fingerprints"
+
+	// PayloadTypeHL7 is used to keep the fingerprints of summaries and reports delivered as HL7v2 messages
+	PayloadTypeHL7 PayloadType = "hl7"
+)
+
+// ReportFingerprintKey identifies the last summary and report sent for a patient to a destination
+type ReportFingerprintKey struct {
+	ClinicId      string      `bson:"clinicId"`
+	PatientId     string      `bson:"patientId"`
+	PayloadType   PayloadType `bson:"payloadType"`
+	DestinationId string      `bson:"destinationId"`
+}
+
+type ReportFingerprintStore interface {
+	// GetFingerprint returns the last fingerprint or an empty string if there isn't one
+	GetFingerprint(ctx context.Context, key ReportFingerprintKey) (string, error)
+	SetFingerprint(ctx context.Context, key ReportFingerprintKey, fingerprint string) error
+}
+
+type MongoReportFingerprintStore struct {
+	collection *mongo.Collection
+}
+
+var _ ReportFingerprintStore = &MongoReportFingerprintStore{}
+
+func NewReportFingerprintStore(db *mongo.Database, config ModuleConfig, lifecycle fx.Lifecycle) ReportFingerprintStore {
+	store := &MongoReportFingerprintStore{
+		collection: db.Collection(reportFingerprintsCollectionName),
+	}
+	if config.Enabled {
+		lifecycle.Append(fx.Hook{
+			OnStart: store.CreateIndexes,
+		})
+	}
+	return store
+}
+
+func (m *MongoReportFingerprintStore) CreateIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "clinicId", Value: 1},
+			{Key: "patientId", Value: 1},
+			{Key: "payloadType", Value: 1},
+			{Key: "destinationId", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create report fingerprint indexes: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoReportFingerprintStore) GetFingerprint(ctx context.Context, key ReportFingerprintKey) (string, error) {
+	var result struct {
+		Fingerprint string `bson:"fingerprint"`
+	}
+	err := m.collection.FindOne(ctx, key).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("unable to get report fingerprint: %w", err)
+	}
+	return result.Fingerprint, nil
+}
+
+func (m *MongoReportFingerprintStore) SetFingerprint(ctx context.Context, key ReportFingerprintKey, fingerprint string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"fingerprint":  fingerprint,
+			"modifiedTime": time.Now(),
+		},
+	}
+	if _, err := m.collection.UpdateOne(ctx, key, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("unable to set report fingerprint: %w", err)
+	}
+	return nil
+}
+
+type reportFingerprintInputs struct {
+	CgmPeriods   *clinics.CgmPeriodsV1   `json:"cgmPeriods,omitempty"`
+	BgmPeriods   *clinics.BgmPeriodsV1   `json:"bgmPeriods,omitempty"`
+	ReportDetail *report.ReportDetail    `json:"reportDetail,omitempty"`
+	Profile      ReportProfile           `json:"profile"`
+	Flowsheets   FlowsheetClinicSettings `json:"flowsheets"`
+}
+
+// ComputeReportFingerprint returns a hash of the inputs of the summary and report of the patient. The reporting period
+// is nil if the patient doesn't have enough data for a report.
+func ComputeReportFingerprint(patient clinics.PatientV1, clinic clinics.ClinicV1, reportingPeriod *report.PeriodBounds, profile ReportProfile, flowsheets FlowsheetClinicSettings) (string, error) {
+	inputs := reportFingerprintInputs{
+		Profile:    profile,
+		Flowsheets: flowsheets,
+	}
+	if patient.Summary != nil && patient.Summary.CgmStats != nil {
+		inputs.CgmPeriods = &patient.Summary.CgmStats.Periods
+	}
+	if patient.Summary != nil && patient.Summary.BgmStats != nil {
+		inputs.BgmPeriods = &patient.Summary.BgmStats.Periods
+	}
+	if reportingPeriod != nil {
+		detail := profile.ToReportDetail(clinic, *reportingPeriod)
+		inputs.ReportDetail = &detail
+	}
+
+	// The keys of maps are sorted when encoding, so the result is deterministic
+	encoded, err := json.Marshal(inputs)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode report fingerprint inputs: %w", err)
+	}
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:]), nil
+}
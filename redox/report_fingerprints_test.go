@@ -0,0 +1,60 @@
+package redox_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+	"github.com/tidepool-org/clinic-worker/report"
+	"github.com/tidepool-org/clinic-worker/test"
+	clinics "github.com/tidepool-org/clinic/client"
+)
+
+var _ = Describe("ComputeReportFingerprint", func() {
+	var response clinics.EhrMatchResponseV1
+	var patient clinics.PatientV1
+	var reportingPeriod *report.PeriodBounds
+	var profile redox.ReportProfile
+
+	BeforeEach(func() {
+		matchFixture, err := test.LoadFixture("test/fixtures/subscriptionmatchresponse.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(json.Unmarshal(matchFixture, &response)).To(Succeed())
+
+		patient = (*response.Patients)[0]
+		end := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		reportingPeriod = &report.PeriodBounds{Start: end.Add(-14 * 24 * time.Hour), End: end}
+		profile = redox.ReportProfile{Period: "14d"}
+	})
+
+	compute := func() string {
+		fingerprint, err := redox.ComputeReportFingerprint(patient, response.Clinic, reportingPeriod, profile, redox.FlowsheetClinicSettings{})
+		Expect(err).ToNot(HaveOccurred())
+		return fingerprint
+	}
+
+	It("returns the same fingerprint for the same inputs", func() {
+		Expect(compute()).To(Equal(compute()))
+	})
+
+	It("returns a different fingerprint when the reporting period changes", func() {
+		fingerprint := compute()
+		reportingPeriod.End = reportingPeriod.End.Add(24 * time.Hour)
+		Expect(compute()).ToNot(Equal(fingerprint))
+	})
+
+	It("returns a different fingerprint when the report profile changes", func() {
+		fingerprint := compute()
+		profile.BgUnits = string(clinics.ClinicV1PreferredBgUnitsMmolL)
+		Expect(compute()).ToNot(Equal(fingerprint))
+	})
+
+	It("returns a different fingerprint when there isn't enough data for a report", func() {
+		fingerprint := compute()
+		reportingPeriod = nil
+		Expect(compute()).ToNot(Equal(fingerprint))
+	})
+})
@@ -0,0 +1,87 @@
+package redox
+
+import (
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/report"
+	clinics "github.com/tidepool-org/clinic/client"
+)
+
+const (
+	ReportTypeAll      = "all"
+	ReportTypeAGPCGM   = "agpCGM"
+	ReportTypeAGPBGM   = "agpBGM"
+	ReportTypeBasics   = "basics"
+	ReportTypeDaily    = "daily"
+	ReportTypeBGLog    = "bgLog"
+	ReportTypeSettings = "settings"
+
+	TimezoneSourceClinic  = "clinic"
+	TimezoneSourcePatient = "patient"
+
+	DefaultReportPeriod = DefaultFlowsheetPeriod
+)
+
+// ReportClinicSettings select the report profile of an order by its procedure code
+type ReportClinicSettings struct {
+	// Default is the profile of procedure codes which aren't mapped to a profile
+	Default  ReportProfile            `json:"default"`
+	Profiles map[string]ReportProfile `json:"profiles,omitempty"`
+	// ProcedureProfiles maps procedure codes to profile names
+	ProcedureProfiles map[string]string `json:"procedureProfiles,omitempty"`
+}
+
+func (r ReportClinicSettings) GetProfile(procedureCode string) ReportProfile {
+	if name, ok := r.ProcedureProfiles[procedureCode]; ok {
+		if profile, ok := r.Profiles[name]; ok {
+			return profile
+		}
+	}
+	return r.Default
+}
+
+// ReportProfile defines the contents and the layout of the report attached to notes
+type ReportProfile struct {
+	Reports []string `json:"reports,omitempty"`
+	Period  string   `json:"period,omitempty"`
+	// TimezoneSource is either the timezone of the clinic (default) or the timezone of the patient. The export service
+	// uses the timezone of the patient's data when the timezone isn't set in the report request.
+	TimezoneSource string `json:"timezoneSource,omitempty"`
+	// BgUnits overrides the preferred units of the clinic
+	BgUnits string `json:"bgUnits,omitempty"`
+}
+
+func (r ReportProfile) GetReports() []string {
+	if len(r.Reports) == 0 {
+		return []string{ReportTypeAll}
+	}
+	return r.Reports
+}
+
+func (r ReportProfile) GetPeriodDuration() time.Duration {
+	if duration, ok := flowsheetPeriodDurations[r.Period]; ok {
+		return duration
+	}
+	return flowsheetPeriodDurations[DefaultReportPeriod]
+}
+
+func (r ReportProfile) ToReportDetail(clinic clinics.ClinicV1, reportingPeriod report.PeriodBounds) report.ReportDetail {
+	detail := report.ReportDetail{
+		Reports: r.GetReports(),
+	}
+	if r.TimezoneSource != TimezoneSourcePatient && clinic.Timezone != nil {
+		detail.TimezoneName = string(*clinic.Timezone)
+	}
+	if !reportingPeriod.Start.IsZero() {
+		detail.StartDate = reportingPeriod.Start.Format(time.RFC3339)
+	}
+	if !reportingPeriod.End.IsZero() {
+		detail.EndDate = reportingPeriod.End.Format(time.RFC3339)
+	}
+	if r.BgUnits != "" {
+		detail.BgUnits = r.BgUnits
+	} else if clinic.PreferredBgUnits != "" {
+		detail.BgUnits = string(clinic.PreferredBgUnits)
+	}
+	return detail
+}
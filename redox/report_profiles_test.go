@@ -0,0 +1,89 @@
+package redox_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+	"github.com/tidepool-org/clinic-worker/report"
+	clinics "github.com/tidepool-org/clinic/client"
+)
+
+var _ = Describe("ReportProfiles", func() {
+	Describe("GetProfile", func() {
+		var settings redox.ReportClinicSettings
+
+		BeforeEach(func() {
+			settings = redox.ReportClinicSettings{
+				Default: redox.ReportProfile{Period: "14d"},
+				Profiles: map[string]redox.ReportProfile{
+					"agp": {Reports: []string{redox.ReportTypeAGPCGM}, Period: "30d"},
+				},
+				ProcedureProfiles: map[string]string{
+					"PRO1090": "agp",
+					"PRO1091": "missing",
+				},
+			}
+		})
+
+		It("returns the profile of the procedure code", func() {
+			Expect(settings.GetProfile("PRO1090").Reports).To(Equal([]string{redox.ReportTypeAGPCGM}))
+		})
+
+		It("returns the default profile if the procedure code isn't mapped", func() {
+			Expect(settings.GetProfile("PRO1092").Period).To(Equal("14d"))
+		})
+
+		It("returns the default profile if the mapped profile doesn't exist", func() {
+			Expect(settings.GetProfile("PRO1091").Period).To(Equal("14d"))
+		})
+	})
+
+	Describe("ToReportDetail", func() {
+		var clinic clinics.ClinicV1
+		var bounds report.PeriodBounds
+
+		BeforeEach(func() {
+			timezone := clinics.ClinicTimezoneV1("America/New_York")
+			clinic = clinics.ClinicV1{
+				Timezone:         &timezone,
+				PreferredBgUnits: clinics.ClinicV1PreferredBgUnitsMgdL,
+			}
+			end := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+			bounds = report.PeriodBounds{Start: end.Add(-30 * 24 * time.Hour), End: end}
+		})
+
+		It("requests all reports in the timezone and units of the clinic by default", func() {
+			detail := redox.ReportProfile{}.ToReportDetail(clinic, bounds)
+			Expect(detail.Reports).To(Equal([]string{redox.ReportTypeAll}))
+			Expect(detail.TimezoneName).To(Equal("America/New_York"))
+			Expect(detail.BgUnits).To(Equal("mg/dL"))
+			Expect(detail.StartDate).To(Equal("2024-02-14T00:00:00Z"))
+			Expect(detail.EndDate).To(Equal("2024-03-15T00:00:00Z"))
+		})
+
+		It("applies the options of the profile", func() {
+			profile := redox.ReportProfile{
+				Reports:        []string{redox.ReportTypeDaily, redox.ReportTypeBasics},
+				TimezoneSource: redox.TimezoneSourcePatient,
+				BgUnits:        "mmol/L",
+			}
+			detail := profile.ToReportDetail(clinic, bounds)
+			Expect(detail.Reports).To(Equal([]string{redox.ReportTypeDaily, redox.ReportTypeBasics}))
+			Expect(detail.TimezoneName).To(BeEmpty())
+			Expect(detail.BgUnits).To(Equal("mmol/L"))
+		})
+	})
+
+	Describe("GetPeriodDuration", func() {
+		It("returns the duration of the period", func() {
+			Expect(redox.ReportProfile{Period: "30d"}.GetPeriodDuration()).To(Equal(30 * 24 * time.Hour))
+		})
+
+		It("returns the default duration for unknown periods", func() {
+			Expect(redox.ReportProfile{Period: "1y"}.GetPeriodDuration()).To(Equal(14 * 24 * time.Hour))
+		})
+	})
+})
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/tidepool-org/clinic-worker/ehr"
 	"github.com/tidepool-org/clinic-worker/types"
 	clinics "github.com/tidepool-org/clinic/client"
 	models "github.com/tidepool-org/clinic/redox_models"
@@ -30,6 +31,8 @@ const (
 	percentage   = "%"
 	day          = "day"
 	hour         = "hour"
+
+	DefaultFlowsheetPeriod = "14d"
 )
 
 type AdditionalIdentifierExtension struct {
@@ -68,9 +71,74 @@ func NewFlowsheet() models.NewFlowsheet {
 	return flowsheet
 }
 
+var flowsheetPeriodDurations = map[string]time.Duration{
+	"7d":  7 * 24 * time.Hour,
+	"14d": days14,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+}
+
 type FlowsheetSettings struct {
 	PreferredBGUnits string
 	ICode            bool
+	Codes            ObservationCodeSettings
+	// Periods are the summary periods for which observations are sent. Defaults to 14d.
+	Periods []string
+	// Observations is the list of Tidepool observation codes which are sent. All observations are sent if empty.
+	Observations []string
+}
+
+// NewFlowsheetSettings returns the flowsheet settings of the matched clinic
+func NewFlowsheetSettings(match clinics.EhrMatchResponseV1, clinicSettings ClinicSettings) FlowsheetSettings {
+	return FlowsheetSettings{
+		PreferredBGUnits: string(match.Clinic.PreferredBgUnits),
+		ICode:            match.Settings.Flowsheets.Icode,
+		Codes:            clinicSettings.Flowsheets.Codes,
+		Periods:          clinicSettings.Flowsheets.Periods,
+		Observations:     clinicSettings.Flowsheets.Observations,
+	}
+}
+
+// GetPeriods returns the supported periods from the settings, or the default period if none are selected
+func (f FlowsheetSettings) GetPeriods() []string {
+	var periods []string
+	for _, period := range f.Periods {
+		if _, ok := flowsheetPeriodDurations[period]; ok && !slices.Contains(periods, period) {
+			periods = append(periods, period)
+		}
+	}
+	if len(periods) == 0 {
+		periods = []string{DefaultFlowsheetPeriod}
+	}
+	return periods
+}
+
+// getPeriodQualifier returns the period of observations which are calculated over the given summary period. The
+// observations of the default period are not qualified for backwards compatibility.
+func getPeriodQualifier(period string) string {
+	if period == DefaultFlowsheetPeriod {
+		return ""
+	}
+	return period
+}
+
+// selectObservations removes the observations which were not selected by the clinic. The reporting period markers
+// are always kept, so each group can be identified in the flowsheet.
+func (f FlowsheetSettings) selectObservations(period string, observations []*Observation) []*Observation {
+	observations = slices.DeleteFunc(observations, func(o *Observation) bool {
+		if len(f.Observations) == 0 || strings.HasPrefix(o.Code, "REPORTING_PERIOD_") {
+			return false
+		}
+		return !slices.Contains(f.Observations, o.Code)
+	})
+
+	if period != DefaultFlowsheetPeriod {
+		for _, observation := range observations {
+			observation.Description = fmt.Sprintf("%s (%s days)", observation.Description, strings.TrimSuffix(period, "d"))
+		}
+	}
+
+	return observations
 }
 
 type Observation struct {
@@ -80,11 +148,22 @@ type Observation struct {
 	Units       *string
 	DateTime    string
 	Description string
+	// Period qualifies the observations of summary periods other than the default period, e.g. 7d
+	Period string
 }
 
 // PopulateSummaryStatistics populates a flowsheet with patient summary statistics. If summary statistics are not available,
 // the flowsheet items will be populated with 'NOT AVAILABLE'.
 func PopulateSummaryStatistics(patient clinics.PatientV1, settings FlowsheetSettings, flowsheet *models.NewFlowsheet) []*Observation {
+	observations := CalculateSummaryStatistics(patient, settings)
+	for _, observation := range observations {
+		AppendCodedObservation(flowsheet, observation, settings.Codes.GetObservationCode(observation))
+	}
+	return observations
+}
+
+// CalculateSummaryStatistics returns the CGM and BGM observations of the patient with the Tidepool codes
+func CalculateSummaryStatistics(patient clinics.PatientV1, settings FlowsheetSettings) []*Observation {
 	if patient.Summary == nil {
 		return nil
 	}
@@ -93,31 +172,39 @@ func PopulateSummaryStatistics(patient clinics.PatientV1, settings FlowsheetSett
 	cgmStats := patient.Summary.CgmStats
 	if cgmStats != nil && cgmStats.Dates.LastUpdatedDate != nil && cgmStats.Dates.LastData != nil {
 		if !cgmStats.Dates.LastUpdatedDate.IsZero() && !cgmStats.Dates.LastData.IsZero() {
-			observations = append(observations, PopulateCGMObservations(cgmStats, settings, flowsheet)...)
+			observations = append(observations, CalculateCGMObservations(cgmStats, settings)...)
 		}
 	}
 
 	bgmStats := patient.Summary.BgmStats
 	if bgmStats != nil && bgmStats.Dates.LastUpdatedDate != nil && bgmStats.Dates.LastData != nil {
 		if !bgmStats.Dates.LastUpdatedDate.IsZero() && !bgmStats.Dates.LastData.IsZero() {
-			observations = append(observations, PopulateBGMObservations(bgmStats, settings, flowsheet)...)
+			observations = append(observations, CalculateBGMObservations(bgmStats, settings)...)
 		}
 	}
 	return observations
 }
 
 func CalculateCGMObservations(stats *clinics.CgmStatsV1, settings FlowsheetSettings) []*Observation {
+	var observations []*Observation
+	for _, period := range settings.GetPeriods() {
+		observations = append(observations, settings.selectObservations(period, calculateCGMPeriodObservations(stats, settings, period))...)
+	}
+	return observations
+}
+
+func calculateCGMPeriodObservations(stats *clinics.CgmStatsV1, settings FlowsheetSettings, periodName string) []*Observation {
 	now := time.Now()
 
 	var period *clinics.CgmPeriodV1
-	periodDuration := days14
+	periodDuration := flowsheetPeriodDurations[periodName]
 	reportingTime := formatTime(&now)
 	var firstData, periodEnd, periodStart *time.Time
 
 	if stats != nil {
 		reportingTime = formatTime(stats.Dates.LastUpdatedDate)
 		if stats.Periods != nil {
-			if v, ok := stats.Periods["14d"]; ok {
+			if v, ok := stats.Periods[periodName]; ok {
 				period = &v
 			}
 		}
@@ -175,22 +262,28 @@ func CalculateCGMObservations(stats *clinics.CgmStatsV1, settings FlowsheetSetti
 		timeInVeryHigh = period.TimeInVeryHighPercent
 	}
 
+	qualifier := getPeriodQualifier(periodName)
+	gri, griHypo, griHyper := glycemiaRiskIndex(timeInVeryLow, timeInLow, timeInHigh, timeInVeryHigh)
+
 	observations := []*Observation{
-		{"REPORTING_PERIOD_START_CGM", formatTime(periodStart), "DateTime", nil, reportingTime, "CGM Reporting Period Start"},
-		{"REPORTING_PERIOD_END_CGM", formatTime(periodEnd), "DateTime", nil, reportingTime, "CGM Reporting Period End"},
-		{"REPORTING_PERIOD_START_CGM_DATA", formatTime(firstData), "DateTime", nil, reportingTime, "CGM Reporting Period Start Date of actual Data"},
-		{"TIME_ABOVE_RANGE_VERY_HIGH_CGM", formatFloat(unitIntervalToPercent(timeInVeryHigh)), "Numeric", &unitsPercentage, reportingTime, "CGM Level 2 Hyperglycemia: Time above range (TAR-VH): % of readings and time >250 mg/dL (>13.9 mmol/L)"},
-		{"TIME_ABOVE_RANGE_HIGH_CGM", formatFloat(unitIntervalToPercent(timeInHigh)), "Numeric", &unitsPercentage, reportingTime, "CGM Time in Level 1 Hyperglycemia: Time above range (TAR-H): % of readings and time 181–250 mg/dL (10.1–13.9 mmol/L)"},
-		{"TIME_IN_RANGE_CGM", formatFloat(unitIntervalToPercent(timeInTarget)), "Numeric", &unitsPercentage, reportingTime, "CGM Time in Range: Time in range (TIR): % of readings and time 70–180 mg/dL (3.9–10.0 mmol/L)"},
-		{"TIME_BELOW_RANGE_LOW_CGM", formatFloat(unitIntervalToPercent(timeInLow)), "Numeric", &unitsPercentage, reportingTime, "CGM Time in Level 1 Hypoglycemia: Time below range (TBR-L): % of readings and time 54–69 mg/dL (3.0–3.8 mmol/L)"},
-		{"TIME_BELOW_RANGE_VERY_LOW_CGM", formatFloat(unitIntervalToPercent(timeInVeryLow)), "Numeric", &unitsPercentage, reportingTime, "CGM Time in Level 2 Hypoglycemia: <Time below range (TBR-VL): % of readings and time <54 mg/dL (<3.0 mmol/L)"},
-		{"GLUCOSE_MANAGEMENT_INDICATOR", formatFloat(gmi), "Numeric", nil, reportingTime, "CGM Glucose Management Indicator during reporting period"},
-		{"AVERAGE_CGM", formatFloat(averageGlucose), "Numeric", &destGlucoseUnits, reportingTime, "CGM Average Glucose during reporting period"},
-		{"STANDARD_DEVIATION_CGM", formatFloat(cgmStdDev), "Numeric", &destGlucoseUnits, reportingTime, "The standard deviation of CGM measurements during the reporting period"},
-		{"COEFFICIENT_OF_VARIATION_CGM", formatFloat(cgmCoeffVar), "Numeric", nil, reportingTime, "The coefficient of variation (standard deviation * 100 / mean) of CGM measurements during the reporting period"},
-		{"ACTIVE_WEAR_TIME_CGM", formatFloat(unitIntervalToPercent(cgmUsePercent)), "Numeric", &unitsPercentage, reportingTime, "Percentage of time CGM worn during reporting period"},
-		{"DAYS_WITH_DATA_CGM", formatInt(cgmDaysWithData), "Numeric", &unitsDay, reportingTime, "Number of days with at least one CGM datum during the reporting period"},
-		{"HOURS_WITH_DATA_CGM", formatInt(cgmHoursWithData), "Numeric", &unitsHour, reportingTime, "Number of hours with at least one CGM datum during the reporting period"},
+		{"REPORTING_PERIOD_START_CGM", formatTime(periodStart), "DateTime", nil, reportingTime, "CGM Reporting Period Start", qualifier},
+		{"REPORTING_PERIOD_END_CGM", formatTime(periodEnd), "DateTime", nil, reportingTime, "CGM Reporting Period End", qualifier},
+		{"REPORTING_PERIOD_START_CGM_DATA", formatTime(firstData), "DateTime", nil, reportingTime, "CGM Reporting Period Start Date of actual Data", qualifier},
+		{"TIME_ABOVE_RANGE_VERY_HIGH_CGM", formatFloat(unitIntervalToPercent(timeInVeryHigh)), "Numeric", &unitsPercentage, reportingTime, "CGM Level 2 Hyperglycemia: Time above range (TAR-VH): % of readings and time >250 mg/dL (>13.9 mmol/L)", qualifier},
+		{"TIME_ABOVE_RANGE_HIGH_CGM", formatFloat(unitIntervalToPercent(timeInHigh)), "Numeric", &unitsPercentage, reportingTime, "CGM Time in Level 1 Hyperglycemia: Time above range (TAR-H): % of readings and time 181–250 mg/dL (10.1–13.9 mmol/L)", qualifier},
+		{"TIME_IN_RANGE_CGM", formatFloat(unitIntervalToPercent(timeInTarget)), "Numeric", &unitsPercentage, reportingTime, "CGM Time in Range: Time in range (TIR): % of readings and time 70–180 mg/dL (3.9–10.0 mmol/L)", qualifier},
+		{"TIME_BELOW_RANGE_LOW_CGM", formatFloat(unitIntervalToPercent(timeInLow)), "Numeric", &unitsPercentage, reportingTime, "CGM Time in Level 1 Hypoglycemia: Time below range (TBR-L): % of readings and time 54–69 mg/dL (3.0–3.8 mmol/L)", qualifier},
+		{"TIME_BELOW_RANGE_VERY_LOW_CGM", formatFloat(unitIntervalToPercent(timeInVeryLow)), "Numeric", &unitsPercentage, reportingTime, "CGM Time in Level 2 Hypoglycemia: <Time below range (TBR-VL): % of readings and time <54 mg/dL (<3.0 mmol/L)", qualifier},
+		{"GLUCOSE_MANAGEMENT_INDICATOR", formatFloat(gmi), "Numeric", nil, reportingTime, "CGM Glucose Management Indicator during reporting period", qualifier},
+		{"GLYCEMIA_RISK_INDEX_CGM", formatFloat(gri), "Numeric", nil, reportingTime, "CGM Glycemia Risk Index (GRI) during reporting period", qualifier},
+		{"GLYCEMIA_RISK_INDEX_HYPO_COMPONENT_CGM", formatFloat(griHypo), "Numeric", &unitsPercentage, reportingTime, "CGM Glycemia Risk Index Hypoglycemia Component: TBR-VL + (0.8 × TBR-L)", qualifier},
+		{"GLYCEMIA_RISK_INDEX_HYPER_COMPONENT_CGM", formatFloat(griHyper), "Numeric", &unitsPercentage, reportingTime, "CGM Glycemia Risk Index Hyperglycemia Component: TAR-VH + (0.5 × TAR-H)", qualifier},
+		{"AVERAGE_CGM", formatFloat(averageGlucose), "Numeric", &destGlucoseUnits, reportingTime, "CGM Average Glucose during reporting period", qualifier},
+		{"STANDARD_DEVIATION_CGM", formatFloat(cgmStdDev), "Numeric", &destGlucoseUnits, reportingTime, "The standard deviation of CGM measurements during the reporting period", qualifier},
+		{"COEFFICIENT_OF_VARIATION_CGM", formatFloat(cgmCoeffVar), "Numeric", nil, reportingTime, "The coefficient of variation (standard deviation * 100 / mean) of CGM measurements during the reporting period", qualifier},
+		{"ACTIVE_WEAR_TIME_CGM", formatFloat(unitIntervalToPercent(cgmUsePercent)), "Numeric", &unitsPercentage, reportingTime, "Percentage of time CGM worn during reporting period", qualifier},
+		{"DAYS_WITH_DATA_CGM", formatInt(cgmDaysWithData), "Numeric", &unitsDay, reportingTime, "Number of days with at least one CGM datum during the reporting period", qualifier},
+		{"HOURS_WITH_DATA_CGM", formatInt(cgmHoursWithData), "Numeric", &unitsHour, reportingTime, "Number of hours with at least one CGM datum during the reporting period", qualifier},
 	}
 
 	observationsMap := map[string]*Observation{}
@@ -211,6 +304,7 @@ func CalculateCGMObservations(stats *clinics.CgmStatsV1, settings FlowsheetSetti
 		}
 
 		observationsMap["GLUCOSE_MANAGEMENT_INDICATOR"].Value = formatFloatWithPrecision(gmi, 1)
+		observationsMap["GLYCEMIA_RISK_INDEX_CGM"].Value = formatFloatWithPrecision(gri, 1)
 		observationsMap["ACTIVE_WEAR_TIME_CGM"].Value = formatFloatWithPrecision(unitIntervalToPercent(cgmUsePercent), 2)
 		observationsMap["STANDARD_DEVIATION_CGM"].Value = formatFloatWithPrecision(cgmStdDev, 1)
 		observationsMap["TIME_BELOW_RANGE_VERY_LOW_CGM"].Value = formatFloatConditionalPrecision(unitIntervalToPercent(timeInVeryLow))
@@ -228,23 +322,31 @@ func CalculateCGMObservations(stats *clinics.CgmStatsV1, settings FlowsheetSetti
 func PopulateCGMObservations(stats *clinics.CgmStatsV1, settings FlowsheetSettings, f *models.NewFlowsheet) []*Observation {
 	observations := CalculateCGMObservations(stats, settings)
 	for _, observation := range observations {
-		AppendObservation(f, observation)
+		AppendCodedObservation(f, observation, settings.Codes.GetObservationCode(observation))
 	}
 	return observations
 }
 
 func CalculateBGMObservations(stats *clinics.BgmStatsV1, settings FlowsheetSettings) []*Observation {
+	var observations []*Observation
+	for _, period := range settings.GetPeriods() {
+		observations = append(observations, settings.selectObservations(period, calculateBGMPeriodObservations(stats, settings, period))...)
+	}
+	return observations
+}
+
+func calculateBGMPeriodObservations(stats *clinics.BgmStatsV1, settings FlowsheetSettings, periodName string) []*Observation {
 	now := time.Now()
 
 	var period *clinics.BgmPeriodV1
-	periodDuration := days14
+	periodDuration := flowsheetPeriodDurations[periodName]
 	reportingTime := formatTime(&now)
 
 	var firstData, periodEnd, periodStart *time.Time
 	if stats != nil {
 		reportingTime = formatTime(stats.Dates.LastUpdatedDate)
 		if stats.Periods != nil {
-			if v, ok := stats.Periods["14d"]; ok {
+			if v, ok := stats.Periods[periodName]; ok {
 				period = &v
 			}
 		}
@@ -316,25 +418,26 @@ func CalculateBGMObservations(stats *clinics.BgmStatsV1, settings FlowsheetSetti
 		timeInVeryHighPercent = period.TimeInVeryHighPercent
 	}
 
+	qualifier := getPeriodQualifier(periodName)
 	observations := []*Observation{
-		{"REPORTING_PERIOD_START_SMBG", formatTime(periodStart), "DateTime", nil, reportingTime, "SMBG Reporting Period Start"},
-		{"REPORTING_PERIOD_END_SMBG", formatTime(periodEnd), "DateTime", nil, reportingTime, "SMBG Reporting Period End"},
-		{"REPORTING_PERIOD_START_SMBG_DATA", formatTime(firstData), "DateTime", nil, reportingTime, "SMBG Reporting Period Start Date of actual Data"},
-		{"TIME_ABOVE_RANGE_VERY_HIGH_SMBG", formatFloat(unitIntervalToPercent(timeInVeryHighPercent)), "Numeric", &unitsPercentage, reportingTime, "% of readings > 250 mg/dL (>13.9 mmol/L)"},
-		{"TIME_ABOVE_RANGE_HIGH_SMBG", formatFloat(unitIntervalToPercent(timeInHighPercent)), "Numeric", &unitsPercentage, reportingTime, "% of readings between 181–250 mg/dL (10.1–13.9 mmol/L)"},
-		{"TIME_IN_RANGE_SMBG", formatFloat(unitIntervalToPercent(timeInTargetPercent)), "Numeric", &unitsPercentage, reportingTime, "% of readings between 70–180 mg/dL (3.9–10.0 mmol/L)"},
-		{"TIME_BELOW_RANGE_LOW_SMBG", formatFloat(unitIntervalToPercent(timeInLowPercent)), "Numeric", &unitsPercentage, reportingTime, "% of readings between 54–69 mg/dL (3.0–3.8 mmol/L)"},
-		{"TIME_BELOW_RANGE_VERY_LOW_SMBG", formatFloat(unitIntervalToPercent(timeInVeryLowPercent)), "Numeric", &unitsPercentage, reportingTime, "% of readings < 54 mg/dL (<3.0 mmol/L)"},
-		{"READINGS_ABOVE_RANGE_VERY_HIGH_SMBG", formatInt(timeInVeryHighRecords), "Numeric", nil, reportingTime, "SMBG Level 2 Hyperglycemia: Number of readings above range (TAR-VH) time >250 mg/dL (>13.9 mmol/L) during reporting period"},
-		{"READINGS_BELOW_RANGE_VERY_LOW_SMBG", formatInt(timeInVeryLowRecords), "Numeric", nil, reportingTime, "SMBG Level 2 Hypoglycemia Events: Number of readings <54 mg/dL (<3.0 mmol/L) during reporting period"},
-		{"MAX_SMBG", formatFloat(maxGlucose), "Numeric", &destGlucoseUnits, reportingTime, "Maximum blood glucose reading over the time period"},
-		{"MIN_SMBG", formatFloat(minGlucose), "Numeric", &destGlucoseUnits, reportingTime, "Minimum blood glucose reading over the time period"},
-		{"AVERAGE_SMBG", formatFloat(averageGlucose), "Numeric", &destGlucoseUnits, reportingTime, "SMBG Average Glucose during reporting period"},
-		{"STANDARD_DEVIATION_SMBG", formatFloat(bgmStdDev), "Numeric", &destGlucoseUnits, reportingTime, "The standard deviation of SMBG measurements during the reporting period"},
-		{"COEFFICIENT_OF_VARIATION_SMBG", formatFloat(bgmCoeffVar), "Numeric", nil, reportingTime, "The coefficient of variation (standard deviation * 100 / mean) of SMBG measurements during the reporting period"},
-		{"TOTAL_READING_COUNT_SMBG", formatInt(bgmTotalRecords), "Numeric", nil, reportingTime, "The total number of SMBG readings taken during the SMBG Reporting Period"},
-		{"CHECK_RATE_READINGS_DAY_SMBG", formatFloat(averageDailyRecords), "Numeric", nil, reportingTime, "Average Numeric of SMBG readings per day during reporting period"},
-		{"DAYS_WITH_DATA_SMBG", formatInt(bgmDaysWithData), "Numeric", &unitsDay, reportingTime, "The total number of days with at least 1 SMBG reading over the reporting period"},
+		{"REPORTING_PERIOD_START_SMBG", formatTime(periodStart), "DateTime", nil, reportingTime, "SMBG Reporting Period Start", qualifier},
+		{"REPORTING_PERIOD_END_SMBG", formatTime(periodEnd), "DateTime", nil, reportingTime, "SMBG Reporting Period End", qualifier},
+		{"REPORTING_PERIOD_START_SMBG_DATA", formatTime(firstData), "DateTime", nil, reportingTime, "SMBG Reporting Period Start Date of actual Data", qualifier},
+		{"TIME_ABOVE_RANGE_VERY_HIGH_SMBG", formatFloat(unitIntervalToPercent(timeInVeryHighPercent)), "Numeric", &unitsPercentage, reportingTime, "% of readings > 250 mg/dL (>13.9 mmol/L)", qualifier},
+		{"TIME_ABOVE_RANGE_HIGH_SMBG", formatFloat(unitIntervalToPercent(timeInHighPercent)), "Numeric", &unitsPercentage, reportingTime, "% of readings between 181–250 mg/dL (10.1–13.9 mmol/L)", qualifier},
+		{"TIME_IN_RANGE_SMBG", formatFloat(unitIntervalToPercent(timeInTargetPercent)), "Numeric", &unitsPercentage, reportingTime, "% of readings between 70–180 mg/dL (3.9–10.0 mmol/L)", qualifier},
+		{"TIME_BELOW_RANGE_LOW_SMBG", formatFloat(unitIntervalToPercent(timeInLowPercent)), "Numeric", &unitsPercentage, reportingTime, "% of readings between 54–69 mg/dL (3.0–3.8 mmol/L)", qualifier},
+		{"TIME_BELOW_RANGE_VERY_LOW_SMBG", formatFloat(unitIntervalToPercent(timeInVeryLowPercent)), "Numeric", &unitsPercentage, reportingTime, "% of readings < 54 mg/dL (<3.0 mmol/L)", qualifier},
+		{"READINGS_ABOVE_RANGE_VERY_HIGH_SMBG", formatInt(timeInVeryHighRecords), "Numeric", nil, reportingTime, "SMBG Level 2 Hyperglycemia: Number of readings above range (TAR-VH) time >250 mg/dL (>13.9 mmol/L) during reporting period", qualifier},
+		{"READINGS_BELOW_RANGE_VERY_LOW_SMBG", formatInt(timeInVeryLowRecords), "Numeric", nil, reportingTime, "SMBG Level 2 Hypoglycemia Events: Number of readings <54 mg/dL (<3.0 mmol/L) during reporting period", qualifier},
+		{"MAX_SMBG", formatFloat(maxGlucose), "Numeric", &destGlucoseUnits, reportingTime, "Maximum blood glucose reading over the time period", qualifier},
+		{"MIN_SMBG", formatFloat(minGlucose), "Numeric", &destGlucoseUnits, reportingTime, "Minimum blood glucose reading over the time period", qualifier},
+		{"AVERAGE_SMBG", formatFloat(averageGlucose), "Numeric", &destGlucoseUnits, reportingTime, "SMBG Average Glucose during reporting period", qualifier},
+		{"STANDARD_DEVIATION_SMBG", formatFloat(bgmStdDev), "Numeric", &destGlucoseUnits, reportingTime, "The standard deviation of SMBG measurements during the reporting period", qualifier},
+		{"COEFFICIENT_OF_VARIATION_SMBG", formatFloat(bgmCoeffVar), "Numeric", nil, reportingTime, "The coefficient of variation (standard deviation * 100 / mean) of SMBG measurements during the reporting period", qualifier},
+		{"TOTAL_READING_COUNT_SMBG", formatInt(bgmTotalRecords), "Numeric", nil, reportingTime, "The total number of SMBG readings taken during the SMBG Reporting Period", qualifier},
+		{"CHECK_RATE_READINGS_DAY_SMBG", formatFloat(averageDailyRecords), "Numeric", nil, reportingTime, "Average Numeric of SMBG readings per day during reporting period", qualifier},
+		{"DAYS_WITH_DATA_SMBG", formatInt(bgmDaysWithData), "Numeric", &unitsDay, reportingTime, "The total number of days with at least 1 SMBG reading over the reporting period", qualifier},
 	}
 
 	observationsMap := map[string]*Observation{}
@@ -374,22 +477,38 @@ func CalculateBGMObservations(stats *clinics.BgmStatsV1, settings FlowsheetSetti
 func PopulateBGMObservations(stats *clinics.BgmStatsV1, settings FlowsheetSettings, f *models.NewFlowsheet) []*Observation {
 	observations := CalculateBGMObservations(stats, settings)
 	for _, observation := range observations {
-		AppendObservation(f, observation)
+		AppendCodedObservation(f, observation, settings.Codes.GetObservationCode(observation))
 	}
 	return observations
 }
 
 func AppendObservation(f *models.NewFlowsheet, o *Observation) {
+	AppendCodedObservation(f, o, ObservationCode{Code: o.Code})
+}
+
+// AppendCodedObservation appends the observation to the flowsheet using the provided code instead of the Tidepool code
+func AppendCodedObservation(f *models.NewFlowsheet, o *Observation, code ObservationCode) {
 	observation := types.NewItemForSlice(f.Observations)
-	observation.Code = o.Code
+	observation.Code = code.Code
+	if code.Codeset != "" {
+		observation.Codeset = &code.Codeset
+	}
 	observation.Value = o.Value
 	observation.ValueType = o.ValueType
 	observation.Units = o.Units
 	observation.Description = &o.Description
 	observation.DateTime = o.DateTime
+	if o.Period != "" {
+		observation.Notes = &[]interface{}{GetPeriodNote(o.Period)}
+	}
 	f.Observations = append(f.Observations, observation)
 }
 
+func SetDestinationInFlowsheet(destinationId string, flowsheet *models.NewFlowsheet) {
+	flowsheet.Meta.Destinations = types.NewSlicePtr(flowsheet.Meta.Destinations, 1)
+	(*flowsheet.Meta.Destinations)[0].ID = &destinationId
+}
+
 func SetVisitNumberInFlowsheet(order models.NewOrder, flowsheet *models.NewFlowsheet) {
 	if order.Visit != nil && order.Visit.VisitNumber != nil {
 		if flowsheet.Visit == nil {
@@ -523,6 +642,19 @@ func formatFloatConditionalPrecision(val *float64) string {
 	return formatFloatWithPrecision(val, 0)
 }
 
+// glycemiaRiskIndex calculates the Glycemia Risk Index (GRI) and its hypoglycemia and hyperglycemia components
+// as defined by Klonoff et al. (2023) from the time in range unit intervals. The index is capped at 100.
+func glycemiaRiskIndex(veryLow, low, high, veryHigh *float64) (gri *float64, hypo *float64, hyper *float64) {
+	if veryLow == nil || low == nil || high == nil || veryHigh == nil {
+		return nil, nil, nil
+	}
+
+	hypoVal := *unitIntervalToPercent(veryLow) + 0.8*(*unitIntervalToPercent(low))
+	hyperVal := *unitIntervalToPercent(veryHigh) + 0.5*(*unitIntervalToPercent(high))
+	griVal := min(3.0*hypoVal+1.6*hyperVal, 100.0)
+	return &griVal, &hypoVal, &hyperVal
+}
+
 func bgInUnits(val float64, sourceUnits string, targetUnits string) (float64, string) {
 	if strings.ToLower(sourceUnits) == "mmol/l" && strings.ToLower(targetUnits) == "mg/dl" {
 		intValue := int(val*MmolLToMgdLConversionFactor*MmolLToMgdLPrecisionFactor + 0.5)
@@ -533,19 +665,43 @@ func bgInUnits(val float64, sourceUnits string, targetUnits string) (float64, st
 	return val, sourceUnits
 }
 
-func ObservationsToGMINoteComponents(observations []*Observation) []NoteComponent {
-	gmiObservations := slices.DeleteFunc(slices.Clone(observations), func(o *Observation) bool {
-		return o.Code != "GLUCOSE_MANAGEMENT_INDICATOR"
+// GMIObservations returns the observations which are included in notes if GMI is enabled. The observations are
+// coded with the Tidepool codes.
+func GMIObservations(observations []*Observation) []ehr.Observation {
+	return CodeObservations(filterGMIObservations(observations), ObservationCodeSettings{})
+}
+
+func filterGMIObservations(observations []*Observation) []*Observation {
+	return slices.DeleteFunc(slices.Clone(observations), func(o *Observation) bool {
+		return !slices.Contains(gmiNoteObservationCodes, o.Code)
 	})
+}
+
+var gmiNoteObservationCodes = []string{
+	"GLUCOSE_MANAGEMENT_INDICATOR",
+	"GLYCEMIA_RISK_INDEX_CGM",
+	"GLYCEMIA_RISK_INDEX_HYPO_COMPONENT_CGM",
+	"GLYCEMIA_RISK_INDEX_HYPER_COMPONENT_CGM",
+}
+
+func ObservationsToGMINoteComponents(observations []*Observation) []NoteComponent {
 	var components []NoteComponent
-	for _, observation := range gmiObservations {
+	for _, observation := range filterGMIObservations(observations) {
 		components = append(components, ObservationToGMINoteComponent(observation))
 	}
 	return components
 }
 
+// GetPeriodNote returns the note which identifies the summary period of an observation
+func GetPeriodNote(period string) string {
+	return fmt.Sprintf("Reporting Period: %s", period)
+}
+
 func ObservationToGMINoteComponent(o *Observation) NoteComponent {
 	dateTimeComment := fmt.Sprintf("DateTime Observed: %s", o.DateTime)
+	if o.Period != "" {
+		dateTimeComment = fmt.Sprintf("%s, %s", dateTimeComment, GetPeriodNote(o.Period))
+	}
 	return NoteComponent{
 		Comments: dateTimeComment,
 		ID:       o.Code,
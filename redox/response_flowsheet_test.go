@@ -113,6 +113,9 @@ var _ = Describe("Flowsheet", func() {
 					MatchObservation(Observation{"TIME_BELOW_RANGE_LOW_CGM", "8.6139", "Numeric", &expectedPercentageUnits, "CGM Time in Level 1 Hypoglycemia: Time below range (TBR-L): % of readings and time 54–69 mg/dL (3.0–3.8 mmol/L)"}),
 					MatchObservation(Observation{"TIME_BELOW_RANGE_VERY_LOW_CGM", "5.0495", "Numeric", &expectedPercentageUnits, "CGM Time in Level 2 Hypoglycemia: <Time below range (TBR-VL): % of readings and time <54 mg/dL (<3.0 mmol/L)"}),
 					MatchObservation(Observation{"GLUCOSE_MANAGEMENT_INDICATOR", "6.7206", "Numeric", nil, "CGM Glucose Management Indicator during reporting period"}),
+					MatchObservation(Observation{"GLYCEMIA_RISK_INDEX_CGM", "63.3861", "Numeric", nil, "CGM Glycemia Risk Index (GRI) during reporting period"}),
+					MatchObservation(Observation{"GLYCEMIA_RISK_INDEX_HYPO_COMPONENT_CGM", "11.9406", "Numeric", &expectedPercentageUnits, "CGM Glycemia Risk Index Hypoglycemia Component: TBR-VL + (0.8 × TBR-L)"}),
+					MatchObservation(Observation{"GLYCEMIA_RISK_INDEX_HYPER_COMPONENT_CGM", "17.2277", "Numeric", &expectedPercentageUnits, "CGM Glycemia Risk Index Hyperglycemia Component: TAR-VH + (0.5 × TAR-H)"}),
 					MatchObservation(Observation{"AVERAGE_CGM", "7.9212", "Numeric", &expectedBgUnits, "CGM Average Glucose during reporting period"}),
 					MatchObservation(Observation{"STANDARD_DEVIATION_CGM", "1.4697", "Numeric", &expectedBgUnits, "The standard deviation of CGM measurements during the reporting period"}),
 					MatchObservation(Observation{"COEFFICIENT_OF_VARIATION_CGM", "0.2004", "Numeric", nil, "The coefficient of variation (standard deviation * 100 / mean) of CGM measurements during the reporting period"}),
@@ -163,6 +166,9 @@ var _ = Describe("Flowsheet", func() {
 					MatchObservation(Observation{"TIME_BELOW_RANGE_LOW_CGM", "9", "Numeric", &expectedPercentageUnits, "CGM Time in Level 1 Hypoglycemia: Time below range (TBR-L): % of readings and time 54–69 mg/dL (3.0–3.8 mmol/L)"}),
 					MatchObservation(Observation{"TIME_BELOW_RANGE_VERY_LOW_CGM", "5", "Numeric", &expectedPercentageUnits, "CGM Time in Level 2 Hypoglycemia: <Time below range (TBR-VL): % of readings and time <54 mg/dL (<3.0 mmol/L)"}),
 					MatchObservation(Observation{"GLUCOSE_MANAGEMENT_INDICATOR", "6.7", "Numeric", nil, "CGM Glucose Management Indicator during reporting period"}),
+					MatchObservation(Observation{"GLYCEMIA_RISK_INDEX_CGM", "63.4", "Numeric", nil, "CGM Glycemia Risk Index (GRI) during reporting period"}),
+					MatchObservation(Observation{"GLYCEMIA_RISK_INDEX_HYPO_COMPONENT_CGM", "11.9406", "Numeric", &expectedPercentageUnits, "CGM Glycemia Risk Index Hypoglycemia Component: TBR-VL + (0.8 × TBR-L)"}),
+					MatchObservation(Observation{"GLYCEMIA_RISK_INDEX_HYPER_COMPONENT_CGM", "17.2277", "Numeric", &expectedPercentageUnits, "CGM Glycemia Risk Index Hyperglycemia Component: TAR-VH + (0.5 × TAR-H)"}),
 					MatchObservation(Observation{"AVERAGE_CGM", "7.9", "Numeric", &expectedBgUnits, "CGM Average Glucose during reporting period"}),
 					MatchObservation(Observation{"STANDARD_DEVIATION_CGM", "1.5", "Numeric", &expectedBgUnits, "The standard deviation of CGM measurements during the reporting period"}),
 					MatchObservation(Observation{"COEFFICIENT_OF_VARIATION_CGM", "20.0", "Numeric", &expectedPercentageUnits, "The coefficient of variation (standard deviation * 100 / mean) of CGM measurements during the reporting period"}),
@@ -287,6 +293,172 @@ var _ = Describe("Flowsheet", func() {
 				Expect(observations).To(ContainElement(MatchObservation(Observation{"MIN_SMBG", "53.8464", "Numeric", &expectedBgUnits, "Minimum blood glucose reading over the time period"})))
 				Expect(observations).To(ContainElement(MatchObservation(Observation{"MAX_SMBG", "280.2426", "Numeric", &expectedBgUnits, "Maximum blood glucose reading over the time period"})))
 			})
+
+			It("uses standard codes and clinic overrides when configured", func() {
+				flowsheet := redox.NewFlowsheet()
+				settings := redox.FlowsheetSettings{
+					PreferredBGUnits: string(response.Clinic.PreferredBgUnits),
+					Codes: redox.ObservationCodeSettings{
+						UseStandardCodes: true,
+						Overrides: map[string]redox.ObservationCode{
+							"AVERAGE_CGM": {Code: "TP-AVG-CGM", Codeset: "Clinic"},
+						},
+					},
+				}
+				redox.PopulateSummaryStatistics((*response.Patients)[0], settings, &flowsheet)
+
+				codes := map[string]string{}
+				for _, observation := range flowsheet.Observations {
+					Expect(observation.Codeset).ToNot(BeNil())
+					codes[observation.Code] = *observation.Codeset
+				}
+				Expect(codes).To(HaveKeyWithValue("97510-2", redox.CodesetLOINC))
+				Expect(codes).To(HaveKeyWithValue("97506-0", redox.CodesetLOINC))
+				Expect(codes).To(HaveKeyWithValue("104643-2", redox.CodesetLOINC))
+				Expect(codes).To(HaveKeyWithValue("104639-0", redox.CodesetLOINC))
+				Expect(codes).To(HaveKeyWithValue("TP-AVG-CGM", "Clinic"))
+				Expect(codes).To(HaveKeyWithValue("TIME_IN_RANGE_SMBG", redox.CodesetTidepool))
+				Expect(codes).ToNot(HaveKey("TIME_IN_RANGE_CGM"))
+			})
+
+			It("populates a group of observations for each selected period", func() {
+				flowsheet := redox.NewFlowsheet()
+				settings := redox.FlowsheetSettings{
+					PreferredBGUnits: string(response.Clinic.PreferredBgUnits),
+					Periods:          []string{"7d", "14d"},
+				}
+				redox.PopulateSummaryStatistics((*response.Patients)[0], settings, &flowsheet)
+
+				periodNote := &[]interface{}{redox.GetPeriodNote("7d")}
+				Expect(flowsheet.Observations).To(ContainElement(SatisfyAll(
+					MatchObservation(Observation{"REPORTING_PERIOD_START_CGM_7D", "2023-04-16T17:44:09Z", "DateTime", nil, "CGM Reporting Period Start (7 days)"}),
+					HaveField("Notes", Equal(periodNote)),
+				)))
+				Expect(flowsheet.Observations).To(ContainElement(SatisfyAll(
+					MatchObservation(Observation{"REPORTING_PERIOD_END_CGM_7D", "2023-04-23T17:44:09Z", "DateTime", nil, "CGM Reporting Period End (7 days)"}),
+					HaveField("Notes", Equal(periodNote)),
+				)))
+				Expect(flowsheet.Observations).To(ContainElement(SatisfyAll(HaveField("Code", "TIME_IN_RANGE_CGM_7D"), HaveField("Notes", Equal(periodNote)))))
+				Expect(flowsheet.Observations).To(ContainElement(SatisfyAll(HaveField("Code", "TIME_IN_RANGE_SMBG_7D"), HaveField("Notes", Equal(periodNote)))))
+				Expect(flowsheet.Observations).To(ContainElement(SatisfyAll(
+					MatchObservation(Observation{"REPORTING_PERIOD_START_CGM", "2023-04-09T17:44:09Z", "DateTime", nil, "CGM Reporting Period Start"}),
+					HaveField("Notes", BeNil()),
+				)))
+				Expect(flowsheet.Observations).To(ContainElement(SatisfyAll(HaveField("Code", "TIME_IN_RANGE_CGM"), HaveField("Notes", BeNil()))))
+				Expect(flowsheet.Observations[0].Code).To(Equal("REPORTING_PERIOD_START_CGM_7D"))
+				Expect(flowsheet.Observations[0].Notes).To(Equal(periodNote))
+			})
+
+			It("uses distinct codes for the observations of each period", func() {
+				flowsheet := redox.NewFlowsheet()
+				settings := redox.FlowsheetSettings{
+					PreferredBGUnits: string(response.Clinic.PreferredBgUnits),
+					Periods:          []string{"7d", "14d"},
+					Codes:            redox.ObservationCodeSettings{UseStandardCodes: true},
+				}
+				redox.PopulateSummaryStatistics((*response.Patients)[0], settings, &flowsheet)
+
+				codes := map[string]int{}
+				for _, observation := range flowsheet.Observations {
+					codes[observation.Code]++
+				}
+				for code, count := range codes {
+					Expect(count).To(Equal(1), "code %s is used by more than one observation", code)
+				}
+				Expect(codes).To(HaveKey("97510-2"))
+				Expect(codes).To(HaveKey("TIME_IN_RANGE_CGM_7D"))
+			})
+
+			It("uses the period codes and clinic overrides for observations of the 7 day period", func() {
+				flowsheet := redox.NewFlowsheet()
+				settings := redox.FlowsheetSettings{
+					PreferredBGUnits: string(response.Clinic.PreferredBgUnits),
+					Periods:          []string{"7d"},
+					Codes: redox.ObservationCodeSettings{
+						UseStandardCodes: true,
+						Overrides: map[string]redox.ObservationCode{
+							"AVERAGE_CGM":    {Code: "TP-AVG-CGM", Codeset: "Clinic"},
+							"AVERAGE_CGM_7D": {Code: "TP-AVG-CGM-7", Codeset: "Clinic"},
+						},
+					},
+				}
+				observations := redox.PopulateSummaryStatistics((*response.Patients)[0], settings, &flowsheet)
+
+				periodNote := &[]interface{}{redox.GetPeriodNote("7d")}
+				codes := map[string]string{}
+				for _, observation := range flowsheet.Observations {
+					Expect(observation.Codeset).ToNot(BeNil())
+					Expect(observation.Notes).To(Equal(periodNote))
+					codes[observation.Code] = *observation.Codeset
+				}
+				Expect(codes).To(HaveKeyWithValue("TIME_IN_RANGE_CGM_7D", redox.CodesetTidepool))
+				Expect(codes).To(HaveKeyWithValue("GLUCOSE_MANAGEMENT_INDICATOR_7D", redox.CodesetTidepool))
+				Expect(codes).To(HaveKeyWithValue("TP-AVG-CGM-7", "Clinic"))
+				Expect(codes).ToNot(HaveKey("97510-2"))
+				Expect(codes).ToNot(HaveKey("TP-AVG-CGM"))
+
+				components := redox.ObservationsToGMINoteComponents(observations)
+				Expect(components).To(ContainElement(SatisfyAll(
+					HaveField("ID", "GLUCOSE_MANAGEMENT_INDICATOR"),
+					HaveField("Comments", ContainSubstring(redox.GetPeriodNote("7d"))),
+				)))
+			})
+
+			It("only populates the selected observations", func() {
+				flowsheet := redox.NewFlowsheet()
+				settings := redox.FlowsheetSettings{
+					PreferredBGUnits: string(response.Clinic.PreferredBgUnits),
+					Periods:          []string{"30d", "unsupported"},
+					Observations:     []string{"TIME_IN_RANGE_CGM", "TIME_IN_RANGE_SMBG"},
+				}
+				redox.PopulateSummaryStatistics((*response.Patients)[0], settings, &flowsheet)
+
+				var codes []string
+				for _, observation := range flowsheet.Observations {
+					Expect(observation.Notes).To(Equal(&[]interface{}{redox.GetPeriodNote("30d")}))
+					codes = append(codes, observation.Code)
+				}
+				Expect(codes).To(ConsistOf(
+					"REPORTING_PERIOD_START_CGM_30D",
+					"REPORTING_PERIOD_END_CGM_30D",
+					"REPORTING_PERIOD_START_CGM_DATA_30D",
+					"TIME_IN_RANGE_CGM_30D",
+					"REPORTING_PERIOD_START_SMBG_30D",
+					"REPORTING_PERIOD_END_SMBG_30D",
+					"REPORTING_PERIOD_START_SMBG_DATA_30D",
+					"TIME_IN_RANGE_SMBG_30D",
+				))
+			})
+
+			It("caps the glycemia risk index at 100", func() {
+				patient := (*response.Patients)[0]
+				period := patient.Summary.CgmStats.Periods["14d"]
+				veryLow := 0.4
+				period.TimeInVeryLowPercent = &veryLow
+				patient.Summary.CgmStats.Periods["14d"] = period
+
+				flowsheet := redox.NewFlowsheet()
+				settings := redox.FlowsheetSettings{
+					PreferredBGUnits: string(response.Clinic.PreferredBgUnits),
+				}
+				redox.PopulateSummaryStatistics(patient, settings, &flowsheet)
+
+				observations := Observations(flowsheet)
+				Expect(observations).To(HaveKeyWithValue("GLYCEMIA_RISK_INDEX_CGM", HaveField("Value", "100.0000")))
+			})
+
+			It("does not set a codeset when standard codes are not used", func() {
+				flowsheet := redox.NewFlowsheet()
+				settings := redox.FlowsheetSettings{
+					PreferredBGUnits: string(response.Clinic.PreferredBgUnits),
+				}
+				redox.PopulateSummaryStatistics((*response.Patients)[0], settings, &flowsheet)
+
+				Expect(flowsheet.Observations).ToNot(BeEmpty())
+				for _, observation := range flowsheet.Observations {
+					Expect(observation.Codeset).To(BeNil())
+				}
+			})
 		})
 
 	})
@@ -0,0 +1,191 @@
+package redox
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"github.com/tidepool-org/clinic-worker/hl7"
+)
+
+const (
+	HL7MessageTypeObservationResult = "ORU"
+	HL7TriggerEventUnsolicited      = "R01"
+	HL7MessageStructureORU          = "ORU_R01"
+	HL7ResultStatusFinal            = "F"
+	HL7CodingSystemLocal            = "L"
+	HL7CodingSystemLOINC            = "LN"
+	HL7ValueTypeNumeric             = "NM"
+	HL7ValueTypeDateTime            = "DTM"
+	HL7ValueTypeString              = "ST"
+	HL7ValueTypeEncapsulatedData    = "ED"
+	HL7EncapsulatedDataApplication  = "AP"
+	HL7EncapsulatedDataEncoding     = "Base64"
+
+	HL7ReportObservationCode        = "TIDEPOOL_REPORT"
+	HL7ReportObservationDescription = "Tidepool Report"
+
+	hl7ControlIdLength = 20
+)
+
+// NewHL7ControlId returns a unique message control id which fits in MSH-10
+func NewHL7ControlId() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")[:hl7ControlIdLength]
+}
+
+// NewORU creates an ORU^R01 message with an OBX segment for each observation. The observations must be coded with
+// the codes of the clinic. If a report is provided, it is embedded as an additional encapsulated data (ED) observation.
+func NewORU(header hl7.Header, order ehr.Order, observations []ehr.Observation, report []byte) *hl7.Message {
+	header.MessageType = HL7MessageTypeObservationResult
+	header.TriggerEvent = HL7TriggerEventUnsolicited
+	header.MessageStructure = HL7MessageStructureORU
+
+	message := hl7.NewMessage(header)
+	message.AddSegment("PID", GetHL7PatientIdentification(order)...)
+	message.AddSegment("OBR", GetHL7ObservationRequest(order, header.DateTime)...)
+
+	setId := 1
+	for _, observation := range observations {
+		message.AddSegment("OBX", GetHL7ObservationResult(setId, observation)...)
+		setId++
+	}
+
+	if len(report) > 0 {
+		message.AddSegment("OBX", GetHL7EncapsulatedReport(setId, report, header.DateTime)...)
+	}
+
+	return message
+}
+
+func GetHL7PatientIdentification(order ehr.Order) []string {
+	identifiers := make([]string, 0, len(order.Patient.Identifiers))
+	for _, identifier := range order.Patient.Identifiers {
+		identifiers = append(identifiers, hl7.Components(identifier.Id, "", "", identifier.Type))
+	}
+
+	patient := order.Patient
+	name := hl7.Components(patient.LastName, patient.FirstName, patient.MiddleName)
+	var dob string
+	if birthDate, err := time.Parse(time.DateOnly, patient.BirthDate); err == nil {
+		dob = hl7.FormatDate(birthDate)
+	}
+
+	return []string{
+		"1",                                  // PID-1 Set ID
+		"",                                   // PID-2 Patient ID
+		hl7.Repetitions(identifiers...),      // PID-3 Patient Identifier List
+		"",                                   // PID-4 Alternate Patient ID
+		name,                                 // PID-5 Patient Name
+		"",                                   // PID-6 Mother's Maiden Name
+		dob,                                  // PID-7 Date of Birth
+		getHL7AdministrativeSex(patient.Sex), // PID-8 Administrative Sex
+	}
+}
+
+func GetHL7ObservationRequest(order ehr.Order, dateTime time.Time) []string {
+	procedure := hl7.Components(order.ProcedureCode, order.ProcedureDescription, order.ProcedureCodeset)
+
+	var provider string
+	if order.Provider != nil {
+		provider = hl7.Components(order.Provider.Id, order.Provider.LastName, order.Provider.FirstName)
+	}
+
+	fields := make([]string, 25)
+	fields[0] = "1"                           // OBR-1 Set ID
+	fields[1] = hl7.Escape(order.Id)          // OBR-2 Placer Order Number
+	fields[3] = procedure                     // OBR-4 Universal Service Identifier
+	fields[6] = hl7.FormatDateTime(dateTime)  // OBR-7 Observation Date/Time
+	fields[15] = provider                     // OBR-16 Ordering Provider
+	fields[21] = hl7.FormatDateTime(dateTime) // OBR-22 Results Rpt/Status Chng - Date/Time
+	fields[24] = HL7ResultStatusFinal         // OBR-25 Result Status
+	return fields
+}
+
+func GetHL7ObservationResult(setId int, observation ehr.Observation) []string {
+	valueType := HL7ValueTypeString
+	value := hl7.Escape(observation.Value)
+	switch observation.ValueType {
+	case "Numeric":
+		valueType = HL7ValueTypeNumeric
+	case "DateTime":
+		valueType = HL7ValueTypeDateTime
+		value = formatHL7DateTime(observation.Value)
+	}
+
+	var units string
+	if observation.Units != nil {
+		units = hl7.Components(*observation.Units)
+	}
+
+	fields := make([]string, 14)
+	fields[0] = formatSetId(setId)                                                                                 // OBX-1 Set ID
+	fields[1] = valueType                                                                                          // OBX-2 Value Type
+	fields[2] = hl7.Components(observation.Code, observation.Description, getHL7CodingSystem(observation.Codeset)) // OBX-3 Observation Identifier
+	fields[3] = hl7.Escape(observation.Period)                                                                     // OBX-4 Observation Sub-ID
+	fields[4] = value                                                                                              // OBX-5 Observation Value
+	fields[5] = units                                                                                              // OBX-6 Units
+	fields[10] = HL7ResultStatusFinal                                                                              // OBX-11 Observation Result Status
+	fields[13] = formatHL7DateTime(observation.DateTime)                                                           // OBX-14 Date/Time of the Observation
+	return fields
+}
+
+func GetHL7EncapsulatedReport(setId int, report []byte, dateTime time.Time) []string {
+	data := hl7.Components(
+		"",
+		HL7EncapsulatedDataApplication,
+		NoteReportFileType,
+		HL7EncapsulatedDataEncoding,
+		base64.StdEncoding.EncodeToString(report),
+	)
+
+	fields := make([]string, 14)
+	fields[0] = formatSetId(setId)
+	fields[1] = HL7ValueTypeEncapsulatedData
+	fields[2] = hl7.Components(HL7ReportObservationCode, HL7ReportObservationDescription, HL7CodingSystemLocal)
+	fields[4] = data
+	fields[10] = HL7ResultStatusFinal
+	fields[13] = hl7.FormatDateTime(dateTime)
+	return fields
+}
+
+func getHL7CodingSystem(codeset string) string {
+	switch codeset {
+	case CodesetLOINC:
+		return HL7CodingSystemLOINC
+	case "", CodesetTidepool:
+		return HL7CodingSystemLocal
+	default:
+		return codeset
+	}
+}
+
+func getHL7AdministrativeSex(sex string) string {
+	if sex == "" {
+		return ""
+	}
+	switch strings.ToLower(sex) {
+	case "male":
+		return "M"
+	case "female":
+		return "F"
+	case "other":
+		return "O"
+	default:
+		return "U"
+	}
+}
+
+func formatHL7DateTime(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return hl7.Escape(value)
+	}
+	return hl7.FormatDateTime(t)
+}
+
+func formatSetId(setId int) string {
+	return formatInt(&setId)
+}
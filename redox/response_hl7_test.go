@@ -0,0 +1,122 @@
+package redox_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/hl7"
+	"github.com/tidepool-org/clinic-worker/redox"
+	"github.com/tidepool-org/clinic-worker/test"
+	models "github.com/tidepool-org/clinic/redox_models"
+)
+
+var _ = Describe("HL7", func() {
+	var order models.NewOrder
+	var header hl7.Header
+
+	BeforeEach(func() {
+		fixture, err := test.LoadFixture("test/fixtures/subscriptionorder.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(json.Unmarshal(fixture, &order)).To(Succeed())
+
+		header = hl7.Header{
+			SendingApplication:   "Tidepool",
+			ReceivingApplication: "EHR",
+			ControlId:            redox.NewHL7ControlId(),
+			DateTime:             time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		}
+	})
+
+	Describe("NewHL7ControlId", func() {
+		It("returns an id which fits in the control id field", func() {
+			Expect(redox.NewHL7ControlId()).To(HaveLen(20))
+		})
+	})
+
+	Describe("NewORU", func() {
+		var units string
+		var observations []*redox.Observation
+
+		BeforeEach(func() {
+			units = "%"
+			observations = []*redox.Observation{
+				{Code: "REPORTING_PERIOD_END_CGM", Value: "2023-04-23T17:44:09Z", ValueType: "DateTime", DateTime: "2023-04-23T17:44:09Z", Description: "CGM Reporting Period End"},
+				{Code: "TIME_IN_RANGE_CGM", Value: "56.2871", ValueType: "Numeric", Units: &units, DateTime: "2023-04-23T17:44:09Z", Description: "CGM Time in Range"},
+			}
+		})
+
+		It("sets the message type in the header", func() {
+			segments := hl7.ParseSegments(redox.NewORU(header, redox.NormalizeOrder(order), redox.CodeObservations(observations, redox.ObservationCodeSettings{}), nil).Encode())
+			Expect(segments[0].Id()).To(Equal("MSH"))
+			Expect(segments[0].Field(9)).To(Equal("ORU^R01^ORU_R01"))
+			Expect(segments[0].Field(10)).To(Equal(header.ControlId))
+			Expect(segments[0].Field(12)).To(Equal("2.5.1"))
+		})
+
+		It("sets the patient identification from the order", func() {
+			segments := hl7.ParseSegments(redox.NewORU(header, redox.NormalizeOrder(order), redox.CodeObservations(observations, redox.ObservationCodeSettings{}), nil).Encode())
+			Expect(segments[1].Id()).To(Equal("PID"))
+			Expect(segments[1].Field(3)).To(Equal("0000000001^^^MRN~e167267c-16c9-4fe3-96ae-9cff5703e90a^^^EHRID~a1d4ee8aba494ca^^^NIST"))
+			Expect(segments[1].Field(5)).To(Equal("Bixby^Timothy^Paul"))
+			Expect(segments[1].Field(7)).To(Equal("20080106"))
+			Expect(segments[1].Field(8)).To(Equal("M"))
+		})
+
+		It("sets the observation request from the order", func() {
+			segments := hl7.ParseSegments(redox.NewORU(header, redox.NormalizeOrder(order), redox.CodeObservations(observations, redox.ObservationCodeSettings{}), nil).Encode())
+			Expect(segments[2].Id()).To(Equal("OBR"))
+			Expect(segments[2].Field(2)).To(Equal("157968300"))
+			Expect(segments[2].Field(4)).To(Equal("PRO1090^Enable Tidepool"))
+			Expect(segments[2].Field(16)).To(Equal("4356789876^Granite^Pat"))
+			Expect(segments[2].Field(25)).To(Equal("F"))
+		})
+
+		It("adds an observation segment for each observation", func() {
+			segments := hl7.ParseSegments(redox.NewORU(header, redox.NormalizeOrder(order), redox.CodeObservations(observations, redox.ObservationCodeSettings{}), nil).Encode())
+			Expect(segments).To(HaveLen(5))
+
+			Expect(segments[3].Field(1)).To(Equal("1"))
+			Expect(segments[3].Field(2)).To(Equal("DTM"))
+			Expect(segments[3].Field(3)).To(Equal("REPORTING_PERIOD_END_CGM^CGM Reporting Period End^L"))
+			Expect(segments[3].Field(5)).To(Equal("20230423174409+0000"))
+
+			Expect(segments[4].Field(1)).To(Equal("2"))
+			Expect(segments[4].Field(2)).To(Equal("NM"))
+			Expect(segments[4].Field(5)).To(Equal("56.2871"))
+			Expect(segments[4].Field(6)).To(Equal("%"))
+			Expect(segments[4].Field(11)).To(Equal("F"))
+			Expect(segments[4].Field(14)).To(Equal("20230423174409+0000"))
+		})
+
+		It("uses the LOINC coding system for standard codes", func() {
+			codes := redox.ObservationCodeSettings{UseStandardCodes: true}
+			segments := hl7.ParseSegments(redox.NewORU(header, redox.NormalizeOrder(order), redox.CodeObservations(observations, codes), nil).Encode())
+			Expect(segments[3].Field(3)).To(Equal("REPORTING_PERIOD_END_CGM^CGM Reporting Period End^L"))
+			Expect(segments[4].Field(3)).To(Equal("97510-2^CGM Time in Range^LN"))
+		})
+
+		It("sets the period of the observation in the sub-id and uses the code of the period", func() {
+			observations[1].Period = "7d"
+			codes := redox.ObservationCodeSettings{UseStandardCodes: true}
+			segments := hl7.ParseSegments(redox.NewORU(header, redox.NormalizeOrder(order), redox.CodeObservations(observations, codes), nil).Encode())
+			Expect(segments[3].Field(4)).To(BeEmpty())
+			Expect(segments[4].Field(3)).To(Equal("TIME_IN_RANGE_CGM_7D^CGM Time in Range^L"))
+			Expect(segments[4].Field(4)).To(Equal("7d"))
+		})
+
+		It("embeds the report as encapsulated data", func() {
+			report := []byte("%PDF-1.4")
+			segments := hl7.ParseSegments(redox.NewORU(header, redox.NormalizeOrder(order), redox.CodeObservations(observations, redox.ObservationCodeSettings{}), report).Encode())
+			Expect(segments).To(HaveLen(6))
+
+			Expect(segments[5].Field(1)).To(Equal("3"))
+			Expect(segments[5].Field(2)).To(Equal("ED"))
+			Expect(segments[5].Field(3)).To(Equal("TIDEPOOL_REPORT^Tidepool Report^L"))
+			Expect(segments[5].Field(5)).To(Equal("^AP^PDF^Base64^" + base64.StdEncoding.EncodeToString(report)))
+		})
+	})
+})
@@ -36,6 +36,13 @@ func (n *NewNotes) SetDestination(destinationId string) {
 	(*n.Meta.Destinations)[0].ID = &destinationId
 }
 
+// WithDestination returns a copy of the notes which is sent to the destination
+func (n *NewNotes) WithDestination(destinationId string) Notes {
+	notes := *n
+	notes.SetDestination(destinationId)
+	return &notes
+}
+
 func (n *NewNotes) SetComponents(cs []NoteComponent) {
 	modelNoteComponents := types.NewSlicePtr(n.Note.Components, len(cs))
 	for i, c := range cs {
@@ -163,3 +170,10 @@ func (n *NewNotes) SetUploadReference(fileName string, fileType string, result U
 
 	return nil
 }
+
+func (n *NewNotes) SetPlainTextContents(contents string) {
+	n.Note.ContentType = NoteContentTypePlainText
+	n.Note.FileName = nil
+	n.Note.FileType = nil
+	n.Note.FileContents = &contents
+}
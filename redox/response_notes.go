@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"fmt"
 	"io"
+	"strings"
 
 	models "github.com/tidepool-org/clinic/redox_models"
 )
@@ -22,6 +23,8 @@ const (
 	NoteReportDocumentType     = "Tidepool Report"
 	NoteReportFileType         = "PDF"
 	NoteReportFileName         = "report.pdf"
+
+	FallbackNoteExplanation = "The Tidepool report is temporarily unavailable. The report will replace this note when it becomes available."
 )
 
 type NoteComponent struct {
@@ -36,6 +39,7 @@ type Notes interface {
 	SetSourceFromClient(client Client)
 	SetComponents(components []NoteComponent)
 	SetDestination(destinationId string)
+	WithDestination(destinationId string) Notes
 	SetPatientFromOrder(order models.NewOrder)
 	SetProviderFromOrder(order models.NewOrder)
 	SetProcedureFromOrder(order models.NewOrder)
@@ -45,6 +49,16 @@ type Notes interface {
 	SetReportMetadata(documentId string)
 	SetEmbeddedFile(fileName string, fileType string, reader io.Reader) error
 	SetUploadReference(fileName string, fileType string, result UploadResult) error
+	SetPlainTextContents(contents string)
+}
+
+// NewFallbackNoteContents returns the contents of the plain-text note which is sent when the report couldn't be generated
+func NewFallbackNoteContents(components []NoteComponent) string {
+	lines := []string{FallbackNoteExplanation}
+	for _, component := range components {
+		lines = append(lines, fmt.Sprintf("%s: %s", component.Name, component.Value))
+	}
+	return strings.Join(lines, "\n")
 }
 
 func GenerateReportDocumentId(clinicId string, patientId string) string {
@@ -42,6 +42,13 @@ func (n *ReplaceNotes) SetDestination(destinationId string) {
 	(*n.Meta.Destinations)[0].ID = &destinationId
 }
 
+// WithDestination returns a copy of the notes which is sent to the destination
+func (n *ReplaceNotes) WithDestination(destinationId string) Notes {
+	notes := *n
+	notes.SetDestination(destinationId)
+	return &notes
+}
+
 func (n *ReplaceNotes) SetComponents(cs []NoteComponent) {
 	modelNoteComponents := types.NewSlicePtr(n.Note.Components, len(cs))
 	for i, c := range cs {
@@ -171,3 +178,10 @@ func (n *ReplaceNotes) SetUploadReference(fileName string, fileType string, resu
 
 	return nil
 }
+
+func (n *ReplaceNotes) SetPlainTextContents(contents string) {
+	n.Note.ContentType = NoteContentTypePlainText
+	n.Note.FileName = nil
+	n.Note.FileType = nil
+	n.Note.FileContents = &contents
+}
@@ -97,39 +97,39 @@ var _ = Describe("Notes", func() {
 					reportingTime := "2026-02-25T11:06:39"
 
 					observations := []*redox.Observation{
-						{"REPORTING_PERIOD_START_CGM", "2023-04-09T17:44:09Z", "DateTime", nil, reportingTime, "CGM Reporting Period Start"},
-						{"REPORTING_PERIOD_END_CGM", "2023-04-23T17:44:09Z", "DateTime", nil, reportingTime, "CGM Reporting Period End"},
-						{"REPORTING_PERIOD_START_CGM_DATA", "2023-04-14T00:00:00Z", "DateTime", nil, reportingTime, "CGM Reporting Period Start Date of actual Data"},
-						{"TIME_ABOVE_RANGE_VERY_HIGH_CGM", "4.4059", "Numeric", &percentageUnits, reportingTime, "CGM Level 2 Hyperglycemia: Time above range (TAR-VH): % of readings and time >250 mg/dL (>13.9 mmol/L)"},
-						{"TIME_ABOVE_RANGE_HIGH_CGM", "25.6436", "Numeric", &percentageUnits, reportingTime, "CGM Time in Level 1 Hyperglycemia: Time above range (TAR-H): % of readings and time 181–250 mg/dL (10.1–13.9 mmol/L)"},
-						{"TIME_IN_RANGE_CGM", "56.2871", "Numeric", &percentageUnits, reportingTime, "CGM Time in Range: Time in range (TIR): % of readings and time 70–180 mg/dL (3.9–10.0 mmol/L)"},
-						{"TIME_BELOW_RANGE_LOW_CGM", "8.6139", "Numeric", &percentageUnits, reportingTime, "CGM Time in Level 1 Hypoglycemia: Time below range (TBR-L): % of readings and time 54–69 mg/dL (3.0–3.8 mmol/L)"},
-						{"TIME_BELOW_RANGE_VERY_LOW_CGM", "5.0495", "Numeric", &percentageUnits, reportingTime, "CGM Time in Level 2 Hypoglycemia: <Time below range (TBR-VL): % of readings and time <54 mg/dL (<3.0 mmol/L)"},
-						{"GLUCOSE_MANAGEMENT_INDICATOR", "6.7206", "Numeric", nil, reportingTime, "CGM Glucose Management Indicator during reporting period"},
-						{"AVERAGE_CGM", "7.9212", "Numeric", &bgUnits, reportingTime, "CGM Average Glucose during reporting period"},
-						{"STANDARD_DEVIATION_CGM", "1.4697", "Numeric", &bgUnits, reportingTime, "The standard deviation of CGM measurements during the reporting period"},
-						{"COEFFICIENT_OF_VARIATION_CGM", "0.2004", "Numeric", nil, reportingTime, "The coefficient of variation (standard deviation * 100 / mean) of CGM measurements during the reporting period"},
-						{"ACTIVE_WEAR_TIME_CGM", "50.1262", "Numeric", &percentageUnits, reportingTime, "Percentage of time CGM worn during reporting period"},
-						{"DAYS_WITH_DATA_CGM", "2", "Numeric", &dayUnits, reportingTime, "Number of days with at least one CGM datum during the reporting period"},
-						{"HOURS_WITH_DATA_CGM", "28", "Numeric", &hourUnits, reportingTime, "Number of hours with at least one CGM datum during the reporting period"},
-						{"REPORTING_PERIOD_START_SMBG", "2023-04-11T00:57:11Z", "DateTime", nil, reportingTime, "SMBG Reporting Period Start"},
-						{"REPORTING_PERIOD_END_SMBG", "2023-04-25T00:57:11Z", "DateTime", nil, reportingTime, "SMBG Reporting Period End"},
-						{"REPORTING_PERIOD_START_SMBG_DATA", "2023-04-11T00:57:11Z", "DateTime", nil, reportingTime, "SMBG Reporting Period Start Date of actual Data"},
-						{"TIME_ABOVE_RANGE_VERY_HIGH_SMBG", "18.8406", "Numeric", &percentageUnits, reportingTime, "% of readings > 250 mg/dL (>13.9 mmol/L)"},
-						{"TIME_ABOVE_RANGE_HIGH_SMBG", "23.1884", "Numeric", &percentageUnits, reportingTime, "% of readings between 181–250 mg/dL (10.1–13.9 mmol/L)"},
-						{"TIME_IN_RANGE_SMBG", "44.9275", "Numeric", &percentageUnits, reportingTime, "% of readings between 70–180 mg/dL (3.9–10.0 mmol/L)"},
-						{"TIME_BELOW_RANGE_LOW_SMBG", "7.2464", "Numeric", &percentageUnits, reportingTime, "% of readings between 54–69 mg/dL (3.0–3.8 mmol/L)"},
-						{"TIME_BELOW_RANGE_VERY_LOW_SMBG", "5.7971", "Numeric", &percentageUnits, reportingTime, "% of readings < 54 mg/dL (<3.0 mmol/L)"},
-						{"READINGS_ABOVE_RANGE_VERY_HIGH_SMBG", "13", "Numeric", nil, reportingTime, "SMBG Level 2 Hyperglycemia: Number of readings above range (TAR-VH) time >250 mg/dL (>13.9 mmol/L) during reporting period"},
-						{"READINGS_BELOW_RANGE_VERY_LOW_SMBG", "4", "Numeric", nil, reportingTime, "SMBG Level 2 Hypoglycemia Events: Number of readings <54 mg/dL (<3.0 mmol/L) during reporting period"},
-						{"MAX_SMBG", "15.5556", "Numeric", &bgUnits, reportingTime, "Maximum blood glucose reading over the time period"},
-						{"MIN_SMBG", "2.9889", "Numeric", &bgUnits, reportingTime, "Minimum blood glucose reading over the time period"},
-						{"AVERAGE_SMBG", "9.5634", "Numeric", &bgUnits, reportingTime, "SMBG Average Glucose during reporting period"},
-						{"STANDARD_DEVIATION_SMBG", "1.4698", "Numeric", &bgUnits, reportingTime, "The standard deviation of SMBG measurements during the reporting period"},
-						{"COEFFICIENT_OF_VARIATION_SMBG", "0.2005", "Numeric", nil, reportingTime, "The coefficient of variation (standard deviation * 100 / mean) of SMBG measurements during the reporting period"},
-						{"TOTAL_READING_COUNT_SMBG", "69", "Numeric", nil, reportingTime, "The total number of SMBG readings taken during the SMBG Reporting Period"},
-						{"CHECK_RATE_READINGS_DAY_SMBG", "4.9286", "Numeric", nil, reportingTime, "Average Numeric of SMBG readings per day during reporting period"},
-						{"DAYS_WITH_DATA_SMBG", "3", "Numeric", &dayUnits, reportingTime, "The total number of days with at least 1 SMBG reading over the reporting period"},
+						{"REPORTING_PERIOD_START_CGM", "2023-04-09T17:44:09Z", "DateTime", nil, reportingTime, "CGM Reporting Period Start", ""},
+						{"REPORTING_PERIOD_END_CGM", "2023-04-23T17:44:09Z", "DateTime", nil, reportingTime, "CGM Reporting Period End", ""},
+						{"REPORTING_PERIOD_START_CGM_DATA", "2023-04-14T00:00:00Z", "DateTime", nil, reportingTime, "CGM Reporting Period Start Date of actual Data", ""},
+						{"TIME_ABOVE_RANGE_VERY_HIGH_CGM", "4.4059", "Numeric", &percentageUnits, reportingTime, "CGM Level 2 Hyperglycemia: Time above range (TAR-VH): % of readings and time >250 mg/dL (>13.9 mmol/L)", ""},
+						{"TIME_ABOVE_RANGE_HIGH_CGM", "25.6436", "Numeric", &percentageUnits, reportingTime, "CGM Time in Level 1 Hyperglycemia: Time above range (TAR-H): % of readings and time 181–250 mg/dL (10.1–13.9 mmol/L)", ""},
+						{"TIME_IN_RANGE_CGM", "56.2871", "Numeric", &percentageUnits, reportingTime, "CGM Time in Range: Time in range (TIR): % of readings and time 70–180 mg/dL (3.9–10.0 mmol/L)", ""},
+						{"TIME_BELOW_RANGE_LOW_CGM", "8.6139", "Numeric", &percentageUnits, reportingTime, "CGM Time in Level 1 Hypoglycemia: Time below range (TBR-L): % of readings and time 54–69 mg/dL (3.0–3.8 mmol/L)", ""},
+						{"TIME_BELOW_RANGE_VERY_LOW_CGM", "5.0495", "Numeric", &percentageUnits, reportingTime, "CGM Time in Level 2 Hypoglycemia: <Time below range (TBR-VL): % of readings and time <54 mg/dL (<3.0 mmol/L)", ""},
+						{"GLUCOSE_MANAGEMENT_INDICATOR", "6.7206", "Numeric", nil, reportingTime, "CGM Glucose Management Indicator during reporting period", ""},
+						{"AVERAGE_CGM", "7.9212", "Numeric", &bgUnits, reportingTime, "CGM Average Glucose during reporting period", ""},
+						{"STANDARD_DEVIATION_CGM", "1.4697", "Numeric", &bgUnits, reportingTime, "The standard deviation of CGM measurements during the reporting period", ""},
+						{"COEFFICIENT_OF_VARIATION_CGM", "0.2004", "Numeric", nil, reportingTime, "The coefficient of variation (standard deviation * 100 / mean) of CGM measurements during the reporting period", ""},
+						{"ACTIVE_WEAR_TIME_CGM", "50.1262", "Numeric", &percentageUnits, reportingTime, "Percentage of time CGM worn during reporting period", ""},
+						{"DAYS_WITH_DATA_CGM", "2", "Numeric", &dayUnits, reportingTime, "Number of days with at least one CGM datum during the reporting period", ""},
+						{"HOURS_WITH_DATA_CGM", "28", "Numeric", &hourUnits, reportingTime, "Number of hours with at least one CGM datum during the reporting period", ""},
+						{"REPORTING_PERIOD_START_SMBG", "2023-04-11T00:57:11Z", "DateTime", nil, reportingTime, "SMBG Reporting Period Start", ""},
+						{"REPORTING_PERIOD_END_SMBG", "2023-04-25T00:57:11Z", "DateTime", nil, reportingTime, "SMBG Reporting Period End", ""},
+						{"REPORTING_PERIOD_START_SMBG_DATA", "2023-04-11T00:57:11Z", "DateTime", nil, reportingTime, "SMBG Reporting Period Start Date of actual Data", ""},
+						{"TIME_ABOVE_RANGE_VERY_HIGH_SMBG", "18.8406", "Numeric", &percentageUnits, reportingTime, "% of readings > 250 mg/dL (>13.9 mmol/L)", ""},
+						{"TIME_ABOVE_RANGE_HIGH_SMBG", "23.1884", "Numeric", &percentageUnits, reportingTime, "% of readings between 181–250 mg/dL (10.1–13.9 mmol/L)", ""},
+						{"TIME_IN_RANGE_SMBG", "44.9275", "Numeric", &percentageUnits, reportingTime, "% of readings between 70–180 mg/dL (3.9–10.0 mmol/L)", ""},
+						{"TIME_BELOW_RANGE_LOW_SMBG", "7.2464", "Numeric", &percentageUnits, reportingTime, "% of readings between 54–69 mg/dL (3.0–3.8 mmol/L)", ""},
+						{"TIME_BELOW_RANGE_VERY_LOW_SMBG", "5.7971", "Numeric", &percentageUnits, reportingTime, "% of readings < 54 mg/dL (<3.0 mmol/L)", ""},
+						{"READINGS_ABOVE_RANGE_VERY_HIGH_SMBG", "13", "Numeric", nil, reportingTime, "SMBG Level 2 Hyperglycemia: Number of readings above range (TAR-VH) time >250 mg/dL (>13.9 mmol/L) during reporting period", ""},
+						{"READINGS_BELOW_RANGE_VERY_LOW_SMBG", "4", "Numeric", nil, reportingTime, "SMBG Level 2 Hypoglycemia Events: Number of readings <54 mg/dL (<3.0 mmol/L) during reporting period", ""},
+						{"MAX_SMBG", "15.5556", "Numeric", &bgUnits, reportingTime, "Maximum blood glucose reading over the time period", ""},
+						{"MIN_SMBG", "2.9889", "Numeric", &bgUnits, reportingTime, "Minimum blood glucose reading over the time period", ""},
+						{"AVERAGE_SMBG", "9.5634", "Numeric", &bgUnits, reportingTime, "SMBG Average Glucose during reporting period", ""},
+						{"STANDARD_DEVIATION_SMBG", "1.4698", "Numeric", &bgUnits, reportingTime, "The standard deviation of SMBG measurements during the reporting period", ""},
+						{"COEFFICIENT_OF_VARIATION_SMBG", "0.2005", "Numeric", nil, reportingTime, "The coefficient of variation (standard deviation * 100 / mean) of SMBG measurements during the reporting period", ""},
+						{"TOTAL_READING_COUNT_SMBG", "69", "Numeric", nil, reportingTime, "The total number of SMBG readings taken during the SMBG Reporting Period", ""},
+						{"CHECK_RATE_READINGS_DAY_SMBG", "4.9286", "Numeric", nil, reportingTime, "Average Numeric of SMBG readings per day during reporting period", ""},
+						{"DAYS_WITH_DATA_SMBG", "3", "Numeric", &dayUnits, reportingTime, "The total number of days with at least 1 SMBG reading over the reporting period", ""},
 					}
 					expectedNoteComponents := []redox.NoteComponent{
 						{ID: "GLUCOSE_MANAGEMENT_INDICATOR", Name: "CGM Glucose Management Indicator during reporting period", Value: "6.7206", Comments: fmt.Sprintf("DateTime Observed: %s", reportingTime)},
@@ -3,6 +3,7 @@ package redox
 import (
 	"time"
 
+	"github.com/tidepool-org/clinic-worker/ehr"
 	"github.com/tidepool-org/clinic-worker/types"
 	models "github.com/tidepool-org/clinic/redox_models"
 )
@@ -15,17 +16,37 @@ const (
 	AccountCreationResultDescription  = "Indicates whether the account was successfully created"
 	AccountCreationMessageCode        = "ACCOUNT_CREATION_RESULT_MESSAGE"
 	AccountCreationMessageDescription = "Message indicating the result of the account creation"
+	AccountCreationCodeCode           = "ACCOUNT_CREATION_RESULT_CODE"
+	AccountCreationCodeDescription    = "Machine-readable code indicating the result of the account creation"
 
 	MatchingResultCode               = "MATCHING_RESULT"
 	MatchingResultMessageCode        = "MATCHING_RESULT_MESSAGE"
 	MatchingResultDescription        = "Indicates whether the order was successfully matched"
 	MatchingResultMessageDescription = "Message indicating the result of the matching process"
+	MatchingResultCodeCode           = "MATCHING_RESULT_CODE"
+	MatchingResultCodeDescription    = "Machine-readable code indicating the result of the matching process"
+
+	MatchingMethodCode            = "MATCHING_METHOD"
+	MatchingMethodDescription     = "The method which was used to match the patient"
+	MatchingConfidenceCode        = "MATCHING_CONFIDENCE"
+	MatchingConfidenceDescription = "The confidence of the patient match between 0 and 1"
 
 	NoMatchingPatientsMessage       = "No matching patients were found"
 	MultipleMatchingPatientsMessage = "Multiple matching patients were found"
 	SuccessfulMatchingMessage       = "Patient was successfully matched"
 
+	SuccessfulDemographicsMatchingMessage = "Patient was matched by name and date of birth and the MRN was linked"
+	ConfirmMatchingPatientMessage         = "A patient with matching name and date of birth was found and requires confirmation by a clinician"
+	PossibleMatchingPatientsMessage       = "Possible matching patients were found and were queued for review by a clinician"
+	ConflictingMrnMessage                 = "A patient with matching name and date of birth was found, but is linked to a different MRN and requires review by a clinician"
+
 	SuccessfulAccountCreationMessage = "Account was successfully created"
+
+	DuplicateOrderMessage = "The order was already processed"
+
+	ReportUnavailableMessage = "Patient was successfully matched, but the report is temporarily unavailable. A summary note was sent instead."
+
+	ReportUnchangedMessage = "The summary and report didn't change since they were last sent"
 )
 
 var (
@@ -34,12 +55,21 @@ var (
 
 type ResultsNotification struct {
 	IsSuccess bool
-	Message   string
+	// Code is included in the results if set
+	Code    ResultCode
+	Message string
+	// MatchMethod and MatchConfidence are included in the results of patient matching notifications if set
+	MatchMethod     string
+	MatchConfidence float64
+	// Details are appended to the results as string values
+	Details []ehr.ResultDetail
 }
 
 type NotificationFields struct {
 	MessageCode                string
 	MessageDescription         string
+	ResultCode                 string
+	ResultCodeDescription      string
 	OperationResultCode        string
 	OperationResultDescription string
 }
@@ -48,12 +78,16 @@ var (
 	accountCreationNotificationFields = NotificationFields{
 		MessageCode:                AccountCreationMessageCode,
 		MessageDescription:         AccountCreationMessageDescription,
+		ResultCode:                 AccountCreationCodeCode,
+		ResultCodeDescription:      AccountCreationCodeDescription,
 		OperationResultCode:        AccountCreationResultCode,
 		OperationResultDescription: AccountCreationResultDescription,
 	}
 	patientMatchingNotificationFields = NotificationFields{
 		MessageCode:                MatchingResultMessageCode,
 		MessageDescription:         MatchingResultMessageDescription,
+		ResultCode:                 MatchingResultCodeCode,
+		ResultCodeDescription:      MatchingResultCodeDescription,
 		OperationResultCode:        MatchingResultCode,
 		OperationResultDescription: MatchingResultDescription,
 	}
@@ -114,6 +148,57 @@ func SetNotificationResult(notification ResultsNotification, fields Notification
 	results.Orders[0].Results[1].ValueType = "String"
 	results.Orders[0].Results[1].Value = notification.Message
 	results.Orders[0].Results[1].Status = &OrderResultsStatusFinal
+
+	if notification.Code != "" {
+		code := types.NewItemForSlice(results.Orders[0].Results)
+		code.Code = fields.ResultCode
+		code.CompletionDateTime = &now
+		code.Description = &fields.ResultCodeDescription
+		code.ValueType = "String"
+		code.Value = string(notification.Code)
+		code.Status = &OrderResultsStatusFinal
+		results.Orders[0].Results = append(results.Orders[0].Results, code)
+	}
+
+	if notification.MatchMethod != "" {
+		methodDescription := MatchingMethodDescription
+		confidenceDescription := MatchingConfidenceDescription
+
+		method := types.NewItemForSlice(results.Orders[0].Results)
+		method.Code = MatchingMethodCode
+		method.CompletionDateTime = &now
+		method.Description = &methodDescription
+		method.ValueType = "String"
+		method.Value = notification.MatchMethod
+		method.Status = &OrderResultsStatusFinal
+
+		confidence := types.NewItemForSlice(results.Orders[0].Results)
+		confidence.Code = MatchingConfidenceCode
+		confidence.CompletionDateTime = &now
+		confidence.Description = &confidenceDescription
+		confidence.ValueType = "Numeric"
+		confidence.Value = formatFloatWithPrecision(&notification.MatchConfidence, 2)
+		confidence.Status = &OrderResultsStatusFinal
+
+		results.Orders[0].Results = append(results.Orders[0].Results, method, confidence)
+	}
+
+	for _, detail := range notification.Details {
+		description := detail.Description
+		result := types.NewItemForSlice(results.Orders[0].Results)
+		result.Code = detail.Code
+		result.CompletionDateTime = &now
+		result.Description = &description
+		result.ValueType = "String"
+		result.Value = detail.Value
+		result.Status = &OrderResultsStatusFinal
+		results.Orders[0].Results = append(results.Orders[0].Results, result)
+	}
+}
+
+func SetDestinationInResult(destinationId string, result *models.NewResults) {
+	result.Meta.Destinations = types.NewSlicePtr(result.Meta.Destinations, 1)
+	(*result.Meta.Destinations)[0].ID = &destinationId
 }
 
 func SetVisitNumberInResult(order models.NewOrder, result *models.NewResults) {
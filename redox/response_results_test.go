@@ -160,6 +160,53 @@ var _ = Describe("Results", func() {
 					Expect(results.Orders[0].Provider).To(PointTo(Equal(*order.Order.Provider)))
 				})
 			})
+
+			When("matching result has a code", func() {
+				BeforeEach(func() {
+					matchingResult = redox.ResultsNotification{
+						IsSuccess: false,
+						Code:      redox.ResultCodeMultipleMatches,
+						Message:   "Multiple patients matched!",
+					}
+					redox.SetMatchingResult(matchingResult, order, &results)
+				})
+
+				It("sets the result code", func() {
+					Expect(results.Orders[0].Results).To(HaveLen(3))
+					Expect(results.Orders[0].Results[2].Code).To(Equal("MATCHING_RESULT_CODE"))
+					Expect(results.Orders[0].Results[2].Value).To(Equal("MULTIPLE_MATCHES"))
+					Expect(results.Orders[0].Results[2].ValueType).To(Equal("String"))
+					Expect(results.Orders[0].Results[2].Description).To(PointTo(Equal("Machine-readable code indicating the result of the matching process")))
+					Expect(results.Orders[0].Results[2].Status).To(PointTo(Equal("Final")))
+				})
+			})
+
+			When("matching result has a match method", func() {
+				BeforeEach(func() {
+					matchingResult = redox.ResultsNotification{
+						IsSuccess:       true,
+						Message:         "Matched!",
+						MatchMethod:     redox.MatchMethodNameDob,
+						MatchConfidence: 0.9,
+					}
+					redox.SetMatchingResult(matchingResult, order, &results)
+				})
+
+				It("sets the match method and confidence", func() {
+					Expect(results.Orders).To(HaveLen(1))
+					Expect(results.Orders[0].Results).To(HaveLen(4))
+
+					Expect(results.Orders[0].Results[2].Code).To(Equal("MATCHING_METHOD"))
+					Expect(results.Orders[0].Results[2].Value).To(Equal("NAME_DOB"))
+					Expect(results.Orders[0].Results[2].ValueType).To(Equal("String"))
+					Expect(results.Orders[0].Results[2].Status).To(PointTo(Equal("Final")))
+
+					Expect(results.Orders[0].Results[3].Code).To(Equal("MATCHING_CONFIDENCE"))
+					Expect(results.Orders[0].Results[3].Value).To(Equal("0.90"))
+					Expect(results.Orders[0].Results[3].ValueType).To(Equal("Numeric"))
+					Expect(results.Orders[0].Results[3].Status).To(PointTo(Equal("Final")))
+				})
+			})
 		})
 	})
 
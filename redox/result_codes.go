@@ -0,0 +1,35 @@
+package redox
+
+import (
+	"github.com/tidepool-org/clinic-worker/ehr"
+)
+
+// The result codes are shared by all EHR adapters
+type ResultCode = ehr.ResultCode
+
+const (
+	ResultCodeSuccess             = ehr.ResultCodeSuccess
+	ResultCodeUnknownError        = ehr.ResultCodeUnknownError
+	ResultCodeDuplicateOrder      = ehr.ResultCodeDuplicateOrder
+	ResultCodeReportUnavailable   = ehr.ResultCodeReportUnavailable
+	ResultCodeNoMatches           = ehr.ResultCodeNoMatches
+	ResultCodeMultipleMatches     = ehr.ResultCodeMultipleMatches
+	ResultCodeMatchReviewRequired = ehr.ResultCodeMatchReviewRequired
+	ResultCodePatientExists       = ehr.ResultCodePatientExists
+	ResultCodeMrnMissing          = ehr.ResultCodeMrnMissing
+	ResultCodeDobMissing          = ehr.ResultCodeDobMissing
+	ResultCodeDobInvalid          = ehr.ResultCodeDobInvalid
+	ResultCodeNameMissing         = ehr.ResultCodeNameMissing
+	ResultCodeEmailInvalid        = ehr.ResultCodeEmailInvalid
+	ResultCodeEmailInUse          = ehr.ResultCodeEmailInUse
+)
+
+type ResultError = ehr.ResultError
+
+func NewResultError(code ResultCode, message string) *ResultError {
+	return ehr.NewResultError(code, message)
+}
+
+func GetResultCode(err error) ResultCode {
+	return ehr.GetResultCode(err)
+}
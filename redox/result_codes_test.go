@@ -0,0 +1,54 @@
+package redox_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+	"github.com/tidepool-org/clinic-worker/test"
+	models "github.com/tidepool-org/clinic/redox_models"
+)
+
+var _ = Describe("ResultCodes", func() {
+	Describe("GetResultCode", func() {
+		It("returns success when there is no error", func() {
+			Expect(redox.GetResultCode(nil)).To(Equal(redox.ResultCodeSuccess))
+		})
+
+		It("returns the code of a wrapped result error", func() {
+			err := fmt.Errorf("unable to create account: %w", redox.ErrMrnMissing)
+			Expect(redox.GetResultCode(err)).To(Equal(redox.ResultCodeMrnMissing))
+		})
+
+		It("returns unknown error for other errors", func() {
+			Expect(redox.GetResultCode(errors.New("unexpected"))).To(Equal(redox.ResultCodeUnknownError))
+		})
+	})
+
+	Describe("GetMrn", func() {
+		It("returns a result error when the mrn is missing", func() {
+			_, err := redox.NormalizeOrder(models.NewOrder{}).GetMrn("MRN")
+			Expect(err).To(MatchError(redox.ErrMrnMissing))
+			Expect(redox.GetResultCode(err)).To(Equal(redox.ResultCodeMrnMissing))
+		})
+	})
+
+	Describe("GetBirthDate", func() {
+		It("returns a result error when the date of birth is invalid", func() {
+			order := models.NewOrder{}
+			fixture, err := test.LoadFixture("test/fixtures/subscriptionorder.json")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(json.Unmarshal(fixture, &order)).To(Succeed())
+
+			dob := "06/01/2008"
+			order.Patient.Demographics.DOB = &dob
+			_, err = redox.NormalizeOrder(order).GetBirthDate()
+			Expect(err).To(HaveOccurred())
+			Expect(redox.GetResultCode(err)).To(Equal(redox.ResultCodeDobInvalid))
+		})
+	})
+})
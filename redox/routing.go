@@ -0,0 +1,94 @@
+package redox
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+)
+
+type PayloadType string
+
+const (
+	PayloadTypeFlowsheet PayloadType = "flowsheet"
+	PayloadTypeNotes     PayloadType = "notes"
+	PayloadTypeResults   PayloadType = "results"
+)
+
+// RoutingSettings define the destinations of the payloads sent to the EHR. The destinations of the matching rules
+// replace the destination defined in the EHR settings of the clinic, so orders of a facility can be routed away from
+// the default destination. Rules which should also deliver to the default destination must list it explicitly.
+// If none of the rules match an order, the payloads are sent to the destination defined in the EHR settings.
+type RoutingSettings struct {
+	Rules []RoutingRule `json:"rules,omitempty"`
+}
+
+// RoutingRule applies to orders which match all of its conditions. Empty conditions match all orders.
+type RoutingRule struct {
+	Facilities     []string            `json:"facilities,omitempty"`
+	Departments    []string            `json:"departments,omitempty"`
+	ProcedureCodes []string            `json:"procedureCodes,omitempty"`
+	Destinations   RoutingDestinations `json:"destinations"`
+}
+
+type RoutingDestinations struct {
+	Flowsheet []string `json:"flowsheet,omitempty"`
+	Notes     []string `json:"notes,omitempty"`
+	Results   []string `json:"results,omitempty"`
+}
+
+func (r RoutingDestinations) Get(payloadType PayloadType) []string {
+	switch payloadType {
+	case PayloadTypeFlowsheet:
+		return r.Flowsheet
+	case PayloadTypeNotes:
+		return r.Notes
+	case PayloadTypeResults:
+		return r.Results
+	default:
+		return nil
+	}
+}
+
+// GetDestinations returns the destinations of all rules matching the order instead of the default destination, or the
+// default destination if there are none
+func (r RoutingSettings) GetDestinations(payloadType PayloadType, order ehr.Order, defaultDestination string) []string {
+	var destinations []string
+	for _, rule := range r.Rules {
+		if !rule.Matches(order) {
+			continue
+		}
+		for _, destination := range rule.Destinations.Get(payloadType) {
+			if destination != "" && !slices.Contains(destinations, destination) {
+				destinations = append(destinations, destination)
+			}
+		}
+	}
+	if len(destinations) == 0 {
+		return []string{defaultDestination}
+	}
+	return destinations
+}
+
+func (r RoutingRule) Matches(order ehr.Order) bool {
+	var location ehr.Location
+	if order.Visit != nil {
+		location = order.Visit.Location
+	}
+
+	return matchesAnyFold(r.Facilities, location.Facility) &&
+		matchesAnyFold(r.Departments, location.Department) &&
+		(len(r.ProcedureCodes) == 0 || slices.Contains(r.ProcedureCodes, order.ProcedureCode))
+}
+
+func matchesAnyFold(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), strings.TrimSpace(value)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package redox_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+	"github.com/tidepool-org/clinic-worker/test"
+	models "github.com/tidepool-org/clinic/redox_models"
+)
+
+var _ = Describe("RoutingSettings", func() {
+	var order models.NewOrder
+
+	BeforeEach(func() {
+		fixture, err := test.LoadFixture("test/fixtures/subscriptionorder.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(json.Unmarshal(fixture, &order)).To(Succeed())
+	})
+
+	Describe("GetDestinations", func() {
+		It("returns the default destination when there are no rules", func() {
+			settings := redox.RoutingSettings{}
+			Expect(settings.GetDestinations(redox.PayloadTypeFlowsheet, redox.NormalizeOrder(order), "default")).To(Equal([]string{"default"}))
+		})
+
+		It("returns the destinations of all matching rules without duplicates", func() {
+			settings := redox.RoutingSettings{
+				Rules: []redox.RoutingRule{{
+					Destinations: redox.RoutingDestinations{Flowsheet: []string{"ehr", "warehouse"}},
+				}, {
+					Facilities:     []string{"res general hospital"},
+					Departments:    []string{"3N"},
+					ProcedureCodes: []string{"PRO1090"},
+					Destinations:   redox.RoutingDestinations{Flowsheet: []string{"warehouse", "facility"}},
+				}},
+			}
+			Expect(settings.GetDestinations(redox.PayloadTypeFlowsheet, redox.NormalizeOrder(order), "default")).To(Equal([]string{"ehr", "warehouse", "facility"}))
+		})
+
+		It("replaces the default destination with the destinations of the matching rules", func() {
+			settings := redox.RoutingSettings{
+				Rules: []redox.RoutingRule{{
+					Destinations: redox.RoutingDestinations{Notes: []string{"warehouse"}},
+				}},
+			}
+			Expect(settings.GetDestinations(redox.PayloadTypeNotes, redox.NormalizeOrder(order), "default")).To(Equal([]string{"warehouse"}))
+		})
+
+		It("sends to the default destination in addition to the rule destinations only if the rule lists it", func() {
+			settings := redox.RoutingSettings{
+				Rules: []redox.RoutingRule{{
+					Destinations: redox.RoutingDestinations{Notes: []string{"default", "warehouse"}},
+				}},
+			}
+			Expect(settings.GetDestinations(redox.PayloadTypeNotes, redox.NormalizeOrder(order), "default")).To(Equal([]string{"default", "warehouse"}))
+		})
+
+		It("ignores rules which don't match the order", func() {
+			settings := redox.RoutingSettings{
+				Rules: []redox.RoutingRule{{
+					Facilities:   []string{"Other Hospital"},
+					Destinations: redox.RoutingDestinations{Notes: []string{"other"}},
+				}, {
+					ProcedureCodes: []string{"PRO1091"},
+					Destinations:   redox.RoutingDestinations{Notes: []string{"disable"}},
+				}},
+			}
+			Expect(settings.GetDestinations(redox.PayloadTypeNotes, redox.NormalizeOrder(order), "default")).To(Equal([]string{"default"}))
+		})
+
+		It("returns the default destination when the matching rules don't define destinations for the payload type", func() {
+			settings := redox.RoutingSettings{
+				Rules: []redox.RoutingRule{{
+					Destinations: redox.RoutingDestinations{Flowsheet: []string{"warehouse"}},
+				}},
+			}
+			Expect(settings.GetDestinations(redox.PayloadTypeResults, redox.NormalizeOrder(order), "default")).To(Equal([]string{"default"}))
+		})
+	})
+})
@@ -0,0 +1,77 @@
+package redox
+
+import (
+	"time"
+
+	clinics "github.com/tidepool-org/clinic/client"
+)
+
+const (
+	DefaultVisitLeadTime = 24 * time.Hour
+)
+
+// scheduledReportsCadenceDays are the number of days between scheduled reports for each cadence of the scheduled
+// reports settings of the clinic service
+var scheduledReportsCadenceDays = map[clinics.ScheduledReportsV1Cadence]int{
+	clinics.N1d:  1,
+	clinics.N7d:  7,
+	clinics.N14d: 14,
+	clinics.N30d: 30,
+}
+
+// ScheduleSettings define how the worker sends summaries and reports of patients with reports enabled. The cadence is
+// the cadence of the scheduled reports in the EHR settings of the clinic in the clinic service.
+type ScheduleSettings struct {
+	// Enabled moves the scheduling of the reports of the clinic from the clinic service to the worker. The clinic
+	// service must not emit scheduled orders for the clinic and the worker ignores the ones it still emits.
+	Enabled bool `json:"enabled"`
+	// Time of the day (HH:MM) in the timezone of the clinic when reports are sent. Defaults to midnight.
+	Time string `json:"time,omitempty"`
+	// VisitLeadTime is the duration before a visit when the report for an appointment from Redox Scheduling events is sent
+	VisitLeadTime string `json:"visitLeadTime,omitempty"`
+}
+
+func (s ScheduleSettings) GetVisitLeadTime() time.Duration {
+	if duration, err := time.ParseDuration(s.VisitLeadTime); err == nil && duration > 0 {
+		return duration
+	}
+	return DefaultVisitLeadTime
+}
+
+// GetDueTime returns the most recent time when the report following the previous one was due or false if no report
+// is due. Reports are due at the time of the day after the days of the cadence passed. If multiple reports were due,
+// e.g. because the worker wasn't running, only the most recent one is returned, so they aren't all sent at once.
+func (s ScheduleSettings) GetDueTime(cadence clinics.ScheduledReportsV1Cadence, previous time.Time, now time.Time, location *time.Location) (time.Time, bool) {
+	days, ok := scheduledReportsCadenceDays[cadence]
+	if !s.Enabled || !ok {
+		return time.Time{}, false
+	}
+
+	due := s.getTimeOfDay(previous.In(location).AddDate(0, 0, days), location)
+	if due.After(now) {
+		return time.Time{}, false
+	}
+	for next := due.AddDate(0, 0, days); !next.After(now); next = next.AddDate(0, 0, days) {
+		due = next
+	}
+	return due, true
+}
+
+func (s ScheduleSettings) getTimeOfDay(day time.Time, location *time.Location) time.Time {
+	var hour, minute int
+	if t, err := time.Parse("15:04", s.Time); err == nil {
+		hour, minute = t.Hour(), t.Minute()
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, location)
+}
+
+// GetDueTime returns the time when the next report of the subscription was due or false if no report is due. The
+// first report is due a cadence after the subscription was created, because the order which enabled reports already
+// sent one.
+func (r ReportSubscription) GetDueTime(settings ScheduleSettings, cadence clinics.ScheduledReportsV1Cadence, now time.Time, location *time.Location) (time.Time, bool) {
+	previous := r.CreatedTime
+	if r.LastScheduled != nil {
+		previous = r.LastScheduled.CreatedTime
+	}
+	return settings.GetDueTime(cadence, previous, now, location)
+}
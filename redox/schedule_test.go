@@ -0,0 +1,111 @@
+package redox_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	clinics "github.com/tidepool-org/clinic/client"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+)
+
+var _ = Describe("ScheduleSettings", func() {
+	// Wednesday
+	now := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	settings := redox.ScheduleSettings{Enabled: true, Time: "08:00"}
+
+	Describe("GetDueTime", func() {
+		getDueTime := func(settings redox.ScheduleSettings, cadence clinics.ScheduledReportsV1Cadence, previous time.Time, location *time.Location) time.Time {
+			due, ok := settings.GetDueTime(cadence, previous, now, location)
+			Expect(ok).To(BeTrue())
+			return due
+		}
+
+		It("returns the time of the day after the days of the cadence", func() {
+			previous := time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC)
+			Expect(getDueTime(settings, clinics.N1d, previous, time.UTC)).To(Equal(time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC)))
+		})
+
+		It("returns the time of the day regardless of the time of the previous report", func() {
+			previous := time.Date(2024, 5, 8, 17, 45, 0, 0, time.UTC)
+			Expect(getDueTime(settings, clinics.N7d, previous, time.UTC)).To(Equal(time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC)))
+		})
+
+		It("returns only the most recent due time if multiple reports were due", func() {
+			previous := time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC)
+			Expect(getDueTime(settings, clinics.N14d, previous, time.UTC)).To(Equal(time.Date(2024, 5, 13, 8, 0, 0, 0, time.UTC)))
+		})
+
+		It("uses the timezone of the clinic", func() {
+			location, err := time.LoadLocation("America/New_York")
+			Expect(err).ToNot(HaveOccurred())
+
+			previous := time.Date(2024, 5, 13, 12, 0, 0, 0, time.UTC)
+			Expect(getDueTime(settings, clinics.N1d, previous, location).UTC()).To(Equal(time.Date(2024, 5, 14, 12, 0, 0, 0, time.UTC)))
+		})
+
+		It("defaults to midnight", func() {
+			previous := time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC)
+			Expect(getDueTime(redox.ScheduleSettings{Enabled: true}, clinics.N1d, previous, time.UTC)).To(Equal(time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)))
+		})
+
+		It("isn't due before the days of the cadence passed", func() {
+			previous := time.Date(2024, 5, 10, 8, 0, 0, 0, time.UTC)
+			_, ok := settings.GetDueTime(clinics.N7d, previous, now, time.UTC)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("isn't due before the time of the day", func() {
+			previous := time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC)
+			_, ok := redox.ScheduleSettings{Enabled: true, Time: "12:00"}.GetDueTime(clinics.N1d, previous, now, time.UTC)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("isn't due if scheduled reports are disabled", func() {
+			previous := time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC)
+			_, ok := settings.GetDueTime(clinics.DISABLED, previous, now, time.UTC)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("isn't due if the worker doesn't schedule the reports of the clinic", func() {
+			previous := time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC)
+			_, ok := redox.ScheduleSettings{Time: "08:00"}.GetDueTime(clinics.N1d, previous, now, time.UTC)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("ReportSubscription GetDueTime", func() {
+		It("is due a cadence after the subscription was created", func() {
+			subscription := redox.ReportSubscription{CreatedTime: now.Add(-26 * time.Hour)}
+			due, ok := subscription.GetDueTime(settings, clinics.N1d, now, time.UTC)
+			Expect(ok).To(BeTrue())
+			Expect(due).To(Equal(time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC)))
+		})
+
+		It("is due a cadence after the last scheduled report", func() {
+			subscription := redox.ReportSubscription{
+				CreatedTime:   now.Add(-72 * time.Hour),
+				LastScheduled: &redox.PrecedingDocument{CreatedTime: time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC)},
+			}
+			due, ok := subscription.GetDueTime(settings, clinics.N1d, now, time.UTC)
+			Expect(ok).To(BeTrue())
+			Expect(due).To(Equal(time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC)))
+		})
+
+		It("isn't due if the report was scheduled since the due time", func() {
+			subscription := redox.ReportSubscription{
+				CreatedTime:   now.Add(-72 * time.Hour),
+				LastScheduled: &redox.PrecedingDocument{CreatedTime: time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC)},
+			}
+			_, ok := subscription.GetDueTime(settings, clinics.N1d, now, time.UTC)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("isn't due if the subscription was created after the last due time", func() {
+			subscription := redox.ReportSubscription{CreatedTime: now.Add(-time.Hour)}
+			_, ok := subscription.GetDueTime(settings, clinics.N1d, now, time.UTC)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,221 @@
+package redox
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/clinic-worker/cdc"
+	"github.com/tidepool-org/clinic-worker/store"
+	clinics "github.com/tidepool-org/clinic/client"
+	"github.com/tidepool-org/go-common/events"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	schedulerLeaseName = "redox-scheduler"
+)
+
+type SchedulerConfig struct {
+	Enabled  bool          `envconfig:"TIDEPOOL_REDOX_SCHEDULER_ENABLED" default:"false"`
+	Interval time.Duration `envconfig:"TIDEPOOL_REDOX_SCHEDULER_INTERVAL" default:"5m"`
+}
+
+// Scheduler periodically emits scheduled summaries and reports of subscribed patients according to the cadence of
+// the scheduled reports of their clinic. Only the instance which holds the scheduler lease emits work items, which are
+// sent by the work item dispatcher.
+type Scheduler struct {
+	config         SchedulerConfig
+	clinics        clinics.ClientWithResponsesInterface
+	clinicSettings ClinicSettingsProvider
+	subscriptions  SubscriptionStore
+	workItems      WorkItemStore
+	runner         *store.LeaseRunner
+	logger         *zap.SugaredLogger
+}
+
+var _ events.EventConsumer = &Scheduler{}
+
+type SchedulerParams struct {
+	fx.In
+
+	Logger *zap.SugaredLogger
+
+	Config         ModuleConfig
+	Clinics        clinics.ClientWithResponsesInterface
+	ClinicSettings ClinicSettingsProvider
+	Subscriptions  SubscriptionStore
+	WorkItems      WorkItemStore
+	Leases         store.Leases
+}
+
+// CreateScheduler returns the scheduler as a consumer, so it's started and stopped together with the consumers
+func CreateScheduler(p SchedulerParams) (events.EventConsumer, error) {
+	if !p.Config.Enabled {
+		return &cdc.DisabledEventConsumer{}, nil
+	}
+
+	config := SchedulerConfig{}
+	if err := envconfig.Process("", &config); err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return &cdc.DisabledEventConsumer{}, nil
+	}
+
+	return NewScheduler(config, p.Clinics, p.ClinicSettings, p.Subscriptions, p.WorkItems, p.Leases, p.Logger), nil
+}
+
+func NewScheduler(config SchedulerConfig, clinics clinics.ClientWithResponsesInterface, clinicSettings ClinicSettingsProvider, subscriptions SubscriptionStore, workItems WorkItemStore, leases store.Leases, logger *zap.SugaredLogger) *Scheduler {
+	return &Scheduler{
+		config:         config,
+		clinics:        clinics,
+		clinicSettings: clinicSettings,
+		subscriptions:  subscriptions,
+		workItems:      workItems,
+		runner:         store.NewLeaseRunner(schedulerLeaseName, config.Interval, leases, logger),
+		logger:         logger,
+	}
+}
+
+// Start runs the scheduler until it's stopped
+func (s *Scheduler) Start() error {
+	return s.runner.Run(func(ctx context.Context, lease *store.Lease) error {
+		return s.schedule(ctx, lease, time.Now())
+	})
+}
+
+func (s *Scheduler) Stop() error {
+	return s.runner.Stop()
+}
+
+// RunOnce emits the summaries and reports which are due if this instance holds the scheduler lease
+func (s *Scheduler) RunOnce(ctx context.Context, now time.Time) error {
+	return s.runner.RunOnce(ctx, func(ctx context.Context, lease *store.Lease) error {
+		return s.schedule(ctx, lease, now)
+	})
+}
+
+func (s *Scheduler) schedule(ctx context.Context, lease *store.Lease, now time.Time) error {
+	clinicIds, err := s.subscriptions.ListClinicIds(ctx)
+	if err != nil {
+		return err
+	}
+	for _, clinicId := range clinicIds {
+		// Scheduling a clinic may take longer than the lease, so it's renewed before each clinic
+		if err := lease.Renew(ctx); err != nil {
+			return err
+		}
+		if err := s.scheduleClinic(ctx, clinicId, now); err != nil {
+			s.logger.Errorw("unable to schedule summaries and reports of clinic", "clinicId", clinicId, zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) scheduleClinic(ctx context.Context, clinicId string, now time.Time) error {
+	settings, err := s.clinicSettings.GetClinicSettings(ctx, clinicId)
+	if err != nil {
+		return fmt.Errorf("unable to get clinic settings: %w", err)
+	}
+	if !settings.Schedule.Enabled {
+		return nil
+	}
+
+	ehrSettings, err := s.getEHRSettings(ctx, clinicId)
+	if err != nil {
+		return err
+	}
+	if ehrSettings == nil || !ehrSettings.Enabled {
+		return nil
+	}
+	cadence := ehrSettings.ScheduledReports.Cadence
+
+	location, err := s.getClinicLocation(ctx, clinicId)
+	if err != nil {
+		return err
+	}
+
+	return s.subscriptions.ForEach(ctx, clinicId, func(subscription ReportSubscription) error {
+		due, ok := subscription.GetDueTime(settings.Schedule, cadence, now, location)
+		if !ok {
+			return nil
+		}
+		// A failure to process one subscription shouldn't prevent the others from being scheduled
+		if err := s.emit(ctx, subscription, due); err != nil {
+			s.logger.Errorw("unable to schedule summary and report", "clinicId", clinicId, "patientId", subscription.PatientId, zap.Error(err))
+		}
+		return nil
+	})
+}
+
+func (s *Scheduler) emit(ctx context.Context, subscription ReportSubscription, due time.Time) error {
+	clinicId, err := primitive.ObjectIDFromHex(subscription.ClinicId)
+	if err != nil {
+		return fmt.Errorf("invalid clinic id: %w", err)
+	}
+
+	scheduled := ScheduledSummaryAndReport{
+		Id:                ScheduledReportId(subscription.ClinicId, subscription.PatientId, due),
+		UserId:            subscription.PatientId,
+		ClinicId:          clinicId,
+		LastMatchedOrder:  subscription.LastMatchedOrder,
+		PrecedingDocument: subscription.LastScheduled,
+		CreatedTime:       due,
+	}
+
+	s.logger.Infow("emitting scheduled summary and report", "clinicId", subscription.ClinicId, "patientId", subscription.PatientId, "id", scheduled.Id.Hex())
+	if err := s.workItems.Enqueue(ctx, NewScheduledReport(scheduled)); err != nil {
+		return err
+	}
+
+	return s.subscriptions.SetLastScheduled(ctx, subscription.ClinicId, subscription.PatientId, PrecedingDocument{
+		Id:          scheduled.Id,
+		CreatedTime: scheduled.CreatedTime,
+	})
+}
+
+// ScheduledReportId returns the id of the summary and report of the patient which was due at the given time. The id
+// is derived from the subscription and the due time, so the report is enqueued only once, even if the last scheduled
+// report of the subscription couldn't be updated after it was enqueued.
+func ScheduledReportId(clinicId string, patientId string, due time.Time) primitive.ObjectID {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%d", clinicId, patientId, due.Unix())))
+	var id primitive.ObjectID
+	copy(id[:], sum[:])
+	return id
+}
+
+func (s *Scheduler) getEHRSettings(ctx context.Context, clinicId string) (*clinics.EhrSettingsV1, error) {
+	resp, err := s.clinics.GetEHRSettingsWithResponse(ctx, clinicId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get clinic ehr settings: %w", err)
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return nil, nil
+	} else if resp.StatusCode() != http.StatusOK || resp.JSON200 == nil {
+		return nil, fmt.Errorf("unexpected status code when getting ehr settings of clinic %s: %d", clinicId, resp.StatusCode())
+	}
+	return resp.JSON200, nil
+}
+
+func (s *Scheduler) getClinicLocation(ctx context.Context, clinicId string) (*time.Location, error) {
+	resp, err := s.clinics.GetClinicWithResponse(ctx, clinicId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get clinic: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK || resp.JSON200 == nil {
+		return nil, fmt.Errorf("unexpected status code when getting clinic %s: %d", clinicId, resp.StatusCode())
+	}
+
+	if resp.JSON200.Timezone != nil {
+		if location, err := time.LoadLocation(string(*resp.JSON200.Timezone)); err == nil {
+			return location, nil
+		}
+	}
+	return time.UTC, nil
+}
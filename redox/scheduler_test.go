@@ -0,0 +1,201 @@
+package redox_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+	testRedox "github.com/tidepool-org/clinic-worker/redox/test"
+	"github.com/tidepool-org/clinic-worker/store"
+	testStore "github.com/tidepool-org/clinic-worker/store/test"
+	"github.com/tidepool-org/clinic-worker/test"
+	clinics "github.com/tidepool-org/clinic/client"
+	models "github.com/tidepool-org/clinic/redox_models"
+)
+
+var _ = Describe("Scheduler", func() {
+	var clinicClient *clinics.MockClientWithResponsesInterface
+	var clinicSettings *testRedox.ClinicSettingsProvider
+	var subscriptions *testRedox.SubscriptionStore
+	var leases *testStore.Leases
+	var workItems *testRedox.WorkItemStore
+	var scheduler *redox.Scheduler
+	var subscription redox.ReportSubscription
+	var now time.Time
+
+	clinicId := primitive.NewObjectID().Hex()
+
+	// emitted returns the scheduled summaries and reports of the work items in the order they were scheduled
+	emitted := func() []redox.ScheduledSummaryAndReport {
+		var result []redox.ScheduledSummaryAndReport
+		for _, item := range workItems.Items {
+			Expect(item.Type).To(Equal(redox.WorkItemTypeScheduledReport))
+			scheduled, err := item.ScheduledSummaryAndReport()
+			Expect(err).ToNot(HaveOccurred())
+			result = append(result, scheduled)
+		}
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].CreatedTime.Before(result[j].CreatedTime)
+		})
+		return result
+	}
+
+	BeforeEach(func() {
+		clinicClient = clinics.NewMockClientWithResponsesInterface(gomock.NewController(GinkgoT()))
+		clinicClient.EXPECT().
+			GetClinicWithResponse(gomock.Any(), clinicId).
+			Return(&clinics.GetClinicResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &clinics.ClinicV1{Id: &clinicId},
+			}, nil).
+			AnyTimes()
+		clinicClient.EXPECT().
+			GetEHRSettingsWithResponse(gomock.Any(), gomock.Any()).
+			Return(&clinics.GetEHRSettingsResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200: &clinics.EhrSettingsV1{
+					Enabled:          true,
+					ScheduledReports: clinics.ScheduledReportsV1{Cadence: clinics.N1d},
+				},
+			}, nil).
+			AnyTimes()
+
+		clinicSettings = &testRedox.ClinicSettingsProvider{
+			Clinics: map[string]redox.ClinicSettings{
+				clinicId: {Schedule: redox.ScheduleSettings{Enabled: true, Time: "08:00"}},
+			},
+		}
+		subscriptions = &testRedox.SubscriptionStore{}
+		leases = testStore.NewLeases()
+		workItems = testRedox.NewWorkItemStore()
+		scheduler = redox.NewScheduler(redox.SchedulerConfig{Interval: time.Minute}, clinicClient, clinicSettings, subscriptions, workItems, leases, zap.NewNop().Sugar())
+
+		order := models.NewOrder{}
+		orderFixture, err := test.LoadFixture("test/fixtures/subscriptionorder.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(json.Unmarshal(orderFixture, &order)).To(Succeed())
+
+		encoded, err := bson.Marshal(order)
+		Expect(err).ToNot(HaveOccurred())
+		envelope := models.MessageEnvelope{Id: primitive.NewObjectID(), Meta: order.Meta, Message: encoded}
+		subscription = redox.NewReportSubscription(clinicId, "patient-1", envelope, redox.NormalizeOrder(order), "MR")
+		Expect(subscriptions.Upsert(context.Background(), subscription)).To(Succeed())
+
+		now = time.Now().Add(48 * time.Hour)
+	})
+
+	It("emits the summaries and reports which are due", func() {
+		Expect(scheduler.RunOnce(context.Background(), now)).To(Succeed())
+		Expect(emitted()).To(HaveLen(1))
+
+		scheduled := emitted()[0]
+		Expect(scheduled.UserId).To(Equal("patient-1"))
+		Expect(scheduled.ClinicId.Hex()).To(Equal(clinicId))
+		Expect(scheduled.Id).ToNot(Equal(primitive.NilObjectID))
+		Expect(scheduled.LastMatchedOrder.Id).To(Equal(subscription.LastMatchedOrder.Id))
+		order, err := scheduled.LastMatchedOrder.Message.LookupErr("order", "id")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(order.StringValue()).To(Equal("157968300"))
+		Expect(scheduled.PrecedingDocument).To(BeNil())
+	})
+
+	It("links the next summary and report to the preceding one", func() {
+		Expect(scheduler.RunOnce(context.Background(), now)).To(Succeed())
+		Expect(scheduler.RunOnce(context.Background(), now)).To(Succeed())
+		Expect(emitted()).To(HaveLen(1))
+
+		Expect(scheduler.RunOnce(context.Background(), now.Add(24*time.Hour))).To(Succeed())
+		Expect(emitted()).To(HaveLen(2))
+		Expect(emitted()[1].PrecedingDocument).ToNot(BeNil())
+		Expect(emitted()[1].PrecedingDocument.Id).To(Equal(emitted()[0].Id))
+	})
+
+	It("emits the summary and report which is due only once if the last scheduled report isn't updated", func() {
+		Expect(scheduler.RunOnce(context.Background(), now)).To(Succeed())
+		Expect(emitted()).To(HaveLen(1))
+
+		// Simulate a failure to update the subscription after the work item was enqueued
+		subscriptions.Get(clinicId, "patient-1").LastScheduled = nil
+
+		Expect(scheduler.RunOnce(context.Background(), now)).To(Succeed())
+		Expect(emitted()).To(HaveLen(1))
+	})
+
+	It("stops scheduling when the lease is taken over by another instance", func() {
+		// The lease is taken over while the second clinic is scheduled, so the third clinic isn't scheduled
+		otherClinicIds := []string{primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()}
+		for i, otherClinicId := range otherClinicIds {
+			other := subscription
+			other.ClinicId = otherClinicId
+			Expect(subscriptions.Upsert(context.Background(), other)).To(Succeed())
+			clinicSettings.Clinics[otherClinicId] = clinicSettings.Clinics[clinicId]
+
+			takeOver := i == 0
+			clinicClient.EXPECT().
+				GetClinicWithResponse(gomock.Any(), otherClinicId).
+				DoAndReturn(func(ctx context.Context, id string, editors ...clinics.RequestEditorFn) (*clinics.GetClinicResponse, error) {
+					if takeOver {
+						leases.Owners["redox-scheduler"] = "another-instance"
+					}
+					return &clinics.GetClinicResponse{
+						HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+						JSON200:      &clinics.ClinicV1{Id: &id},
+					}, nil
+				}).
+				AnyTimes()
+		}
+
+		Expect(scheduler.RunOnce(context.Background(), now)).To(MatchError(store.ErrLeaseLost))
+		Expect(emitted()).To(HaveLen(2))
+	})
+
+	It("doesn't emit summaries and reports when another instance holds the lease", func() {
+		_, err := leases.TryAcquire(context.Background(), "redox-scheduler", "another-instance", time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(scheduler.RunOnce(context.Background(), now)).To(Succeed())
+		Expect(emitted()).To(BeEmpty())
+	})
+
+	It("doesn't emit summaries and reports when scheduled reports of the clinic are disabled", func() {
+		clinicClient = clinics.NewMockClientWithResponsesInterface(gomock.NewController(GinkgoT()))
+		clinicClient.EXPECT().
+			GetEHRSettingsWithResponse(gomock.Any(), clinicId).
+			Return(&clinics.GetEHRSettingsResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200: &clinics.EhrSettingsV1{
+					Enabled:          true,
+					ScheduledReports: clinics.ScheduledReportsV1{Cadence: clinics.DISABLED},
+				},
+			}, nil).
+			AnyTimes()
+		clinicClient.EXPECT().
+			GetClinicWithResponse(gomock.Any(), clinicId).
+			Return(&clinics.GetClinicResponse{
+				HTTPResponse: &http.Response{StatusCode: http.StatusOK},
+				JSON200:      &clinics.ClinicV1{Id: &clinicId},
+			}, nil).
+			AnyTimes()
+		scheduler = redox.NewScheduler(redox.SchedulerConfig{Interval: time.Minute}, clinicClient, clinicSettings, subscriptions, workItems, leases, zap.NewNop().Sugar())
+
+		Expect(scheduler.RunOnce(context.Background(), now)).To(Succeed())
+		Expect(emitted()).To(BeEmpty())
+	})
+
+	It("doesn't emit summaries and reports when the clinic doesn't have a schedule", func() {
+		clinicSettings.Clinics = nil
+
+		Expect(scheduler.RunOnce(context.Background(), now)).To(Succeed())
+		Expect(emitted()).To(BeEmpty())
+	})
+})
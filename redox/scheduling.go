@@ -0,0 +1,237 @@
+package redox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	models "github.com/tidepool-org/clinic/redox_models"
+	"go.uber.org/zap"
+)
+
+const (
+	DataModelScheduling           = "Scheduling"
+	EventTypeSchedulingNew        = "New"
+	EventTypeSchedulingReschedule = "Reschedule"
+	EventTypeSchedulingCancel     = "Cancel"
+)
+
+var ErrAppointmentInvalid = errors.New("appointment doesn't have a visit number or a valid visit time")
+
+// SchedulingMessage contains the fields of Redox Scheduling messages which are used by the worker
+type SchedulingMessage struct {
+	Meta    models.Meta `json:"Meta"`
+	Patient struct {
+		Identifiers []struct {
+			ID     string `json:"ID"`
+			IDType string `json:"IDType"`
+		} `json:"Identifiers"`
+	} `json:"Patient"`
+	Visit *struct {
+		VisitNumber   *string `json:"VisitNumber"`
+		VisitDateTime *string `json:"VisitDateTime"`
+		Location      *struct {
+			Facility   *string `json:"Facility"`
+			Department *string `json:"Department"`
+			Room       *string `json:"Room"`
+		} `json:"Location,omitempty"`
+	} `json:"Visit,omitempty"`
+}
+
+// GetAppointment returns the appointment of the scheduling message
+func (s SchedulingMessage) GetAppointment() (Appointment, error) {
+	appointment := Appointment{}
+	if s.Visit == nil || s.Visit.VisitNumber == nil || *s.Visit.VisitNumber == "" {
+		return appointment, ErrAppointmentInvalid
+	}
+	appointment.VisitNumber = *s.Visit.VisitNumber
+
+	if s.Visit.VisitDateTime != nil {
+		appointment.Time, _ = time.Parse(time.RFC3339, *s.Visit.VisitDateTime)
+	}
+	if location := s.Visit.Location; location != nil {
+		appointment.Facility = stringValue(location.Facility)
+		appointment.Department = stringValue(location.Department)
+		appointment.Room = stringValue(location.Room)
+	}
+	return appointment, nil
+}
+
+// Appointment is an upcoming visit of a patient with reports enabled
+type Appointment struct {
+	VisitNumber string    `bson:"visitNumber"`
+	Time        time.Time `bson:"time"`
+	Facility    string    `bson:"facility,omitempty"`
+	Department  string    `bson:"department,omitempty"`
+	Room        string    `bson:"room,omitempty"`
+}
+
+// ApplyAppointment replaces the visit of the order with the appointment, so the documents of the report are tied to it.
+// The native order of orders received from Redox is updated as well, because the Redox adapter replies with it.
+func ApplyAppointment(order *ehr.Order, appointment Appointment) error {
+	visit := ehr.Visit{}
+	if order.Visit != nil {
+		visit = *order.Visit
+	}
+	visitTime := appointment.Time.UTC()
+	visit.Number = appointment.VisitNumber
+	visit.Time = &visitTime
+	visit.Location = ehr.Location{
+		Facility:   appointment.Facility,
+		Department: appointment.Department,
+		Room:       appointment.Room,
+	}
+	order.Visit = &visit
+
+	if native, ok := order.Native.(models.NewOrder); ok {
+		if err := applyNativeAppointment(&native, appointment); err != nil {
+			return err
+		}
+		order.Native = native
+	}
+	return nil
+}
+
+func applyNativeAppointment(order *models.NewOrder, appointment Appointment) error {
+	// The visit and its location are anonymous structs, unmarshalling allocates them
+	if order.Visit == nil {
+		if err := json.Unmarshal([]byte("{}"), &order.Visit); err != nil {
+			return fmt.Errorf("unable to set visit: %w", err)
+		}
+	}
+	if order.Visit.Location == nil {
+		if err := json.Unmarshal([]byte("{}"), &order.Visit.Location); err != nil {
+			return fmt.Errorf("unable to set visit location: %w", err)
+		}
+	}
+
+	visitNumber := appointment.VisitNumber
+	visitDateTime := appointment.Time.UTC().Format(time.RFC3339)
+	order.Visit.VisitNumber = &visitNumber
+	order.Visit.VisitDateTime = &visitDateTime
+	order.Visit.Location.Facility = stringPointer(appointment.Facility)
+	order.Visit.Location.Department = stringPointer(appointment.Department)
+	order.Visit.Location.Room = stringPointer(appointment.Room)
+	return nil
+}
+
+type SchedulingProcessor interface {
+	ProcessScheduling(ctx context.Context, envelope models.MessageEnvelope, message SchedulingMessage) error
+}
+
+type schedulingProcessor struct {
+	subscriptions  SubscriptionStore
+	workItems      WorkItemStore
+	clinicSettings ClinicSettingsProvider
+	logger         *zap.SugaredLogger
+}
+
+func NewSchedulingProcessor(subscriptions SubscriptionStore, workItems WorkItemStore, clinicSettings ClinicSettingsProvider, logger *zap.SugaredLogger) SchedulingProcessor {
+	return &schedulingProcessor{
+		subscriptions:  subscriptions,
+		workItems:      workItems,
+		clinicSettings: clinicSettings,
+		logger:         logger,
+	}
+}
+
+// ProcessScheduling schedules the reports of patients with reports enabled before their appointments, independently
+// of the report cadence of the clinic. The reports are sent the visit lead time of the clinic before the appointment.
+func (s *schedulingProcessor) ProcessScheduling(ctx context.Context, envelope models.MessageEnvelope, message SchedulingMessage) error {
+	subscriptions, err := s.findSubscriptions(ctx, message)
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		s.logger.Debugw("ignoring appointment of patient without reports enabled", "scheduling", message.Meta)
+		return nil
+	}
+
+	appointment, err := message.GetAppointment()
+	if err != nil {
+		s.logger.Warnw("ignoring invalid appointment", "scheduling", message.Meta, zap.Error(err))
+		return nil
+	}
+
+	for _, subscription := range subscriptions {
+		switch message.Meta.EventType {
+		case EventTypeSchedulingNew, EventTypeSchedulingReschedule:
+			if appointment.Time.IsZero() {
+				s.logger.Warnw("ignoring appointment without visit time", "scheduling", message.Meta)
+				return nil
+			}
+			err = s.schedulePreVisitReport(ctx, subscription, appointment)
+		case EventTypeSchedulingCancel:
+			s.logger.Infow("cancelling pre-visit report", "clinicId", subscription.ClinicId, "patientId", subscription.PatientId, "visitNumber", appointment.VisitNumber)
+			err = s.workItems.Cancel(ctx, PreVisitReportId(subscription.ClinicId, subscription.PatientId, appointment.VisitNumber))
+		default:
+			s.logger.Infow("unexpected scheduling event type", "scheduling", message.Meta)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *schedulingProcessor) schedulePreVisitReport(ctx context.Context, subscription ReportSubscription, appointment Appointment) error {
+	now := time.Now()
+	if !appointment.Time.After(now) {
+		s.logger.Infow("ignoring past appointment", "clinicId", subscription.ClinicId, "patientId", subscription.PatientId, "visitNumber", appointment.VisitNumber)
+		return nil
+	}
+
+	settings, err := s.clinicSettings.GetClinicSettings(ctx, subscription.ClinicId)
+	if err != nil {
+		return err
+	}
+
+	// Send the report right away if the appointment is within the lead time
+	dueTime := appointment.Time.Add(-settings.Schedule.GetVisitLeadTime())
+	if dueTime.Before(now) {
+		dueTime = now
+	}
+
+	s.logger.Infow("scheduling pre-visit report", "clinicId", subscription.ClinicId, "patientId", subscription.PatientId, "visitNumber", appointment.VisitNumber, "dueTime", dueTime)
+	return s.workItems.Schedule(ctx, NewPreVisitReport(subscription, appointment), dueTime)
+}
+
+func (s *schedulingProcessor) findSubscriptions(ctx context.Context, message SchedulingMessage) ([]ReportSubscription, error) {
+	if message.Meta.Source == nil || message.Meta.Source.ID == nil {
+		return nil, nil
+	}
+
+	var result []ReportSubscription
+	for _, identifier := range message.Patient.Identifiers {
+		subscriptions, err := s.subscriptions.FindByMrn(ctx, *message.Meta.Source.ID, identifier.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, subscription := range subscriptions {
+			if strings.EqualFold(subscription.MrnIdType, identifier.IDType) {
+				result = append(result, subscription)
+			}
+		}
+	}
+	return result, nil
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func stringPointer(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,241 @@
+package redox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"github.com/tidepool-org/clinic-worker/redox"
+	testRedox "github.com/tidepool-org/clinic-worker/redox/test"
+	testStore "github.com/tidepool-org/clinic-worker/store/test"
+	"github.com/tidepool-org/clinic-worker/test"
+	models "github.com/tidepool-org/clinic/redox_models"
+)
+
+var _ = Describe("SchedulingProcessor", func() {
+	var subscriptions *testRedox.SubscriptionStore
+	var workItems *testRedox.WorkItemStore
+	var clinicSettings *testRedox.ClinicSettingsProvider
+	var processor redox.SchedulingProcessor
+	var message redox.SchedulingMessage
+	var visitTime time.Time
+
+	clinicId := primitive.NewObjectID().Hex()
+
+	BeforeEach(func() {
+		subscriptions = &testRedox.SubscriptionStore{}
+		workItems = testRedox.NewWorkItemStore()
+		clinicSettings = &testRedox.ClinicSettingsProvider{
+			Clinics: map[string]redox.ClinicSettings{
+				clinicId: {Schedule: redox.ScheduleSettings{VisitLeadTime: "12h"}},
+			},
+		}
+		processor = redox.NewSchedulingProcessor(subscriptions, workItems, clinicSettings, zap.NewNop().Sugar())
+
+		order := models.NewOrder{}
+		orderFixture, err := test.LoadFixture("test/fixtures/subscriptionorder.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(json.Unmarshal(orderFixture, &order)).To(Succeed())
+
+		encoded, err := bson.Marshal(order)
+		Expect(err).ToNot(HaveOccurred())
+		envelope := models.MessageEnvelope{Id: primitive.NewObjectID(), Meta: order.Meta, Message: encoded}
+		subscription := redox.NewReportSubscription(clinicId, "patient-1", envelope, redox.NormalizeOrder(order), "MRN")
+		Expect(subscriptions.Upsert(context.Background(), subscription)).To(Succeed())
+
+		message = redox.SchedulingMessage{}
+		schedulingFixture, err := test.LoadFixture("test/fixtures/schedulingnew.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(json.Unmarshal(schedulingFixture, &message)).To(Succeed())
+
+		visitTime = time.Now().Add(72 * time.Hour).Truncate(time.Second).UTC()
+		visitDateTime := visitTime.Format(time.RFC3339)
+		message.Visit.VisitDateTime = &visitDateTime
+	})
+
+	Describe("ApplyAppointment", func() {
+		appointment := redox.Appointment{
+			VisitNumber: "5678",
+			Time:        time.Date(2024, 5, 15, 14, 30, 0, 0, time.UTC),
+			Facility:    "RES Diabetes Clinic",
+			Room:        "204",
+		}
+
+		It("ties the visit of the order to the appointment", func() {
+			order := ehr.Order{Id: "1", Visit: &ehr.Visit{Number: "1234", AccountNumber: "ACC"}}
+			Expect(redox.ApplyAppointment(&order, appointment)).To(Succeed())
+			Expect(order.Visit.Number).To(Equal("5678"))
+			Expect(order.Visit.AccountNumber).To(Equal("ACC"))
+			Expect(*order.Visit.Time).To(Equal(appointment.Time))
+			Expect(order.Visit.Location).To(Equal(ehr.Location{Facility: "RES Diabetes Clinic", Room: "204"}))
+			Expect(order.Native).To(BeNil())
+		})
+
+		It("ties the visit of the native order of redox orders to the appointment", func() {
+			native := models.NewOrder{}
+			orderFixture, err := test.LoadFixture("test/fixtures/subscriptionorder.json")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(json.Unmarshal(orderFixture, &native)).To(Succeed())
+
+			order := redox.NormalizeOrder(native)
+			Expect(redox.ApplyAppointment(&order, appointment)).To(Succeed())
+			Expect(order.Visit.Number).To(Equal("5678"))
+
+			updated, ok := order.Native.(models.NewOrder)
+			Expect(ok).To(BeTrue())
+			Expect(*updated.Visit.VisitNumber).To(Equal("5678"))
+			Expect(*updated.Visit.Location.Facility).To(Equal("RES Diabetes Clinic"))
+			Expect(*updated.Visit.Location.Room).To(Equal("204"))
+		})
+	})
+
+	process := func(eventType string) {
+		message.Meta.EventType = eventType
+		Expect(processor.ProcessScheduling(context.Background(), models.MessageEnvelope{Meta: message.Meta}, message)).To(Succeed())
+	}
+
+	preVisitReport := func() *redox.WorkItem {
+		return workItems.Items[redox.PreVisitReportId(clinicId, "patient-1", "5678")]
+	}
+
+	It("schedules the report of a patient with reports enabled before the appointment", func() {
+		process(redox.EventTypeSchedulingNew)
+
+		item := preVisitReport()
+		Expect(item).ToNot(BeNil())
+		Expect(item.Type).To(Equal(redox.WorkItemTypePreVisitReport))
+		Expect(item.Status).To(Equal(redox.WorkItemStatusPending))
+		Expect(item.NextAttemptTime).To(Equal(visitTime.Add(-12 * time.Hour)))
+		Expect(*item.Appointment).To(Equal(redox.Appointment{
+			VisitNumber: "5678",
+			Time:        visitTime,
+			Facility:    "RES Diabetes Clinic",
+			Department:  "2W",
+			Room:        "204",
+		}))
+	})
+
+	It("schedules the report regardless of the report cadence of the clinic", func() {
+		clinicSettings.Clinics = nil
+		process(redox.EventTypeSchedulingNew)
+
+		Expect(preVisitReport()).ToNot(BeNil())
+		Expect(preVisitReport().NextAttemptTime).To(Equal(visitTime.Add(-redox.DefaultVisitLeadTime)))
+	})
+
+	It("moves the report of a rescheduled appointment", func() {
+		process(redox.EventTypeSchedulingNew)
+
+		visitTime = visitTime.Add(24 * time.Hour)
+		visitDateTime := visitTime.Format(time.RFC3339)
+		message.Visit.VisitDateTime = &visitDateTime
+		process(redox.EventTypeSchedulingReschedule)
+
+		Expect(workItems.Items).To(HaveLen(1))
+		Expect(preVisitReport().Appointment.Time).To(Equal(visitTime))
+		Expect(preVisitReport().NextAttemptTime).To(Equal(visitTime.Add(-12 * time.Hour)))
+	})
+
+	It("cancels the report of a cancelled appointment", func() {
+		process(redox.EventTypeSchedulingNew)
+		process(redox.EventTypeSchedulingCancel)
+
+		Expect(preVisitReport().Status).To(Equal(redox.WorkItemStatusCancelled))
+	})
+
+	It("ignores appointments of patients without reports enabled", func() {
+		message.Patient.Identifiers[0].ID = "0000000002"
+		process(redox.EventTypeSchedulingNew)
+
+		Expect(workItems.Items).To(BeEmpty())
+	})
+
+	It("ignores past appointments", func() {
+		visitDateTime := time.Now().Add(-time.Hour).Format(time.RFC3339)
+		message.Visit.VisitDateTime = &visitDateTime
+		process(redox.EventTypeSchedulingNew)
+
+		Expect(workItems.Items).To(BeEmpty())
+	})
+
+	Describe("dispatching the report", func() {
+		var scheduled *testRedox.ScheduledOrderProcessor
+		var dispatcher *redox.WorkItemDispatcher
+
+		BeforeEach(func() {
+			scheduled = &testRedox.ScheduledOrderProcessor{}
+			config := redox.WorkItemConfig{Interval: time.Minute, BatchSize: 10, RetryDelay: time.Minute, MaxAttempts: 3}
+			dispatcher = redox.NewWorkItemDispatcher(config, workItems, subscriptions, testStore.NewLeases(), nil, scheduled, zap.NewNop().Sugar())
+			process(redox.EventTypeSchedulingNew)
+		})
+
+		It("doesn't send the report before the lead time", func() {
+			Expect(dispatcher.RunOnce(context.Background(), visitTime.Add(-24*time.Hour))).To(Succeed())
+			Expect(scheduled.Scheduled).To(BeEmpty())
+		})
+
+		It("ties the report to the appointment", func() {
+			now := visitTime.Add(-12 * time.Hour)
+			Expect(dispatcher.RunOnce(context.Background(), now)).To(Succeed())
+			Expect(scheduled.Scheduled).To(HaveLen(1))
+
+			Expect(scheduled.Scheduled[0].LastMatchedOrder).To(Equal(subscriptions.Get(clinicId, "patient-1").LastMatchedOrder))
+			Expect(scheduled.Scheduled[0].Appointment).To(Equal(preVisitReport().Appointment))
+
+			Expect(preVisitReport().Status).To(Equal(redox.WorkItemStatusCompleted))
+			Expect(subscriptions.Get(clinicId, "patient-1").LastScheduled.Id).To(Equal(scheduled.Scheduled[0].Id))
+		})
+
+		It("doesn't send the report of a cancelled appointment", func() {
+			process(redox.EventTypeSchedulingCancel)
+
+			Expect(dispatcher.RunOnce(context.Background(), visitTime)).To(Succeed())
+			Expect(scheduled.Scheduled).To(BeEmpty())
+			Expect(preVisitReport().CompletedTime).ToNot(BeNil())
+		})
+
+		It("expires the report when it failed after the maximum number of attempts", func() {
+			scheduled.Err = errors.New("unable to send report")
+
+			now := visitTime
+			for i := 0; i < 3; i++ {
+				Expect(dispatcher.RunOnce(context.Background(), now)).To(Succeed())
+				now = now.Add(24 * time.Hour)
+			}
+			Expect(preVisitReport().Status).To(Equal(redox.WorkItemStatusFailed))
+			Expect(preVisitReport().CompletedTime).ToNot(BeNil())
+		})
+
+		It("doesn't send the report when reports were disabled", func() {
+			Expect(subscriptions.Disable(context.Background(), redox.ReportSubscription{ClinicId: clinicId, PatientId: "patient-1"})).To(Succeed())
+
+			Expect(dispatcher.RunOnce(context.Background(), visitTime)).To(Succeed())
+			Expect(scheduled.Scheduled).To(BeEmpty())
+			Expect(preVisitReport().Status).To(Equal(redox.WorkItemStatusCompleted))
+		})
+
+		It("sends the report again when a completed appointment is rescheduled", func() {
+			Expect(dispatcher.RunOnce(context.Background(), visitTime)).To(Succeed())
+
+			process(redox.EventTypeSchedulingNew)
+			Expect(dispatcher.RunOnce(context.Background(), visitTime)).To(Succeed())
+			Expect(scheduled.Scheduled).To(HaveLen(1))
+
+			visitTime = visitTime.Add(24 * time.Hour)
+			visitDateTime := visitTime.Format(time.RFC3339)
+			message.Visit.VisitDateTime = &visitDateTime
+			process(redox.EventTypeSchedulingReschedule)
+			Expect(dispatcher.RunOnce(context.Background(), visitTime)).To(Succeed())
+			Expect(scheduled.Scheduled).To(HaveLen(2))
+			Expect(scheduled.Scheduled[1].Id).ToNot(Equal(scheduled.Scheduled[0].Id))
+		})
+	})
+})
@@ -0,0 +1,213 @@
+package redox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+
+	"github.com/tidepool-org/clinic-worker/hl7"
+)
+
+const (
+	DefaultMaxReportFailures = 3
+
+	clinicSettingsCollectionName = "redox_clinic_settings"
+)
+
+// ClinicSettings are per-clinic integration settings which complement clinics.EhrSettingsV1 of the clinic service
+type ClinicSettings struct {
+	Flowsheets      FlowsheetClinicSettings `json:"flowsheets"`
+	Notes           NotesClinicSettings     `json:"notes"`
+	Reports         ReportClinicSettings    `json:"reports"`
+	HL7v2           HL7v2Settings           `json:"hl7v2"`
+	PatientMatching PatientMatchingSettings `json:"patientMatching"`
+	Routing         RoutingSettings         `json:"routing"`
+	Schedule        ScheduleSettings        `json:"schedule"`
+	Tags            TagSettings             `json:"tags"`
+	AccountCreation AccountCreationSettings `json:"accountCreation"`
+	Subscriptions   SubscriptionSettings    `json:"subscriptions"`
+}
+
+type FlowsheetClinicSettings struct {
+	Codes        ObservationCodeSettings `json:"codes"`
+	Periods      []string                `json:"periods,omitempty"`
+	Observations []string                `json:"observations,omitempty"`
+}
+
+type NotesClinicSettings struct {
+	// MaxReportFailures is the number of times the report generation can fail before a plain-text note is sent instead
+	MaxReportFailures int `json:"maxReportFailures,omitempty"`
+}
+
+func (n NotesClinicSettings) GetMaxReportFailures() int {
+	if n.MaxReportFailures <= 0 {
+		return DefaultMaxReportFailures
+	}
+	return n.MaxReportFailures
+}
+
+const DefaultFinalNoteText = "Tidepool summaries and reports have been disabled for this patient. No further reports will be sent."
+
+type SubscriptionSettings struct {
+	// FinalNote sends a plain-text note when an order disables the reports of a patient with an active subscription
+	FinalNote     bool   `json:"finalNote,omitempty"`
+	FinalNoteText string `json:"finalNoteText,omitempty"`
+}
+
+func (s SubscriptionSettings) GetFinalNoteText() string {
+	if s.FinalNoteText == "" {
+		return DefaultFinalNoteText
+	}
+	return s.FinalNoteText
+}
+
+type HL7v2Settings struct {
+	// Enabled delivers summary statistics and reports as HL7v2 ORU^R01 messages instead of Redox data models
+	Enabled              bool   `json:"enabled"`
+	SendingApplication   string `json:"sendingApplication"`
+	SendingFacility      string `json:"sendingFacility"`
+	ReceivingApplication string `json:"receivingApplication"`
+	ReceivingFacility    string `json:"receivingFacility"`
+	// Destination is the name of one of the hl7 destinations configured by the operators
+	Destination string `json:"destination"`
+}
+
+// Validate returns an error if the messages can't be delivered to a configured destination
+func (h HL7v2Settings) Validate(destinations hl7.Destinations) error {
+	if !h.Enabled {
+		return nil
+	}
+	if _, ok := destinations[h.Destination]; !ok {
+		return fmt.Errorf("unknown hl7 destination %q", h.Destination)
+	}
+	return nil
+}
+
+// GetHL7DestinationId identifies the receiver of HL7v2 messages
+func GetHL7DestinationId(settings HL7v2Settings) string {
+	return settings.ReceivingApplication + "^" + settings.ReceivingFacility
+}
+
+type ClinicSettingsProvider interface {
+	GetClinicSettings(ctx context.Context, clinicId string) (ClinicSettings, error)
+}
+
+// ClinicSettingsStore keeps the integration settings of clinics in the worker database, because the EHR settings of
+// the clinic service don't define them. The settings are managed with the API of the worker.
+type ClinicSettingsStore interface {
+	ClinicSettingsProvider
+	// SetClinicSettings replaces the settings of the clinic
+	SetClinicSettings(ctx context.Context, clinicId string, settings ClinicSettings) error
+}
+
+// NewClinicSettingsProvider provides the settings of clinics from the store
+func NewClinicSettingsProvider(store ClinicSettingsStore) ClinicSettingsProvider {
+	return store
+}
+
+type MongoClinicSettingsStore struct {
+	collection *mongo.Collection
+}
+
+var _ ClinicSettingsStore = &MongoClinicSettingsStore{}
+
+func NewClinicSettingsStore(db *mongo.Database, config ModuleConfig, lifecycle fx.Lifecycle) ClinicSettingsStore {
+	store := &MongoClinicSettingsStore{
+		collection: db.Collection(clinicSettingsCollectionName),
+	}
+	if config.Enabled {
+		lifecycle.Append(fx.Hook{
+			OnStart: store.CreateIndexes,
+		})
+	}
+	return store
+}
+
+func (m *MongoClinicSettingsStore) CreateIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "clinicId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create clinic settings indexes: %w", err)
+	}
+	return nil
+}
+
+// clinicSettingsDocument keeps the settings with the field names of their JSON encoding, so the database and the
+// API use the same schema
+type clinicSettingsDocument struct {
+	ClinicId     string    `bson:"clinicId"`
+	Settings     bson.Raw  `bson:"settings"`
+	ModifiedTime time.Time `bson:"modifiedTime"`
+}
+
+// GetClinicSettings returns the default settings if the clinic doesn't have settings
+func (m *MongoClinicSettingsStore) GetClinicSettings(ctx context.Context, clinicId string) (ClinicSettings, error) {
+	document := clinicSettingsDocument{}
+	err := m.collection.FindOne(ctx, bson.M{"clinicId": clinicId}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ClinicSettings{}, nil
+	} else if err != nil {
+		return ClinicSettings{}, fmt.Errorf("unable to get clinic settings: %w", err)
+	}
+
+	encoded, err := bson.MarshalExtJSON(document.Settings, false, false)
+	if err != nil {
+		return ClinicSettings{}, fmt.Errorf("unable to encode clinic settings: %w", err)
+	}
+	return ParseClinicSettings(encoded)
+}
+
+func (m *MongoClinicSettingsStore) SetClinicSettings(ctx context.Context, clinicId string, settings ClinicSettings) error {
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("unable to encode clinic settings: %w", err)
+	}
+	var raw bson.Raw
+	if err := bson.UnmarshalExtJSON(encoded, false, &raw); err != nil {
+		return fmt.Errorf("unable to encode clinic settings: %w", err)
+	}
+
+	update := bson.M{
+		"$set": clinicSettingsDocument{
+			ClinicId:     clinicId,
+			Settings:     raw,
+			ModifiedTime: time.Now(),
+		},
+	}
+	if _, err := m.collection.UpdateOne(ctx, bson.M{"clinicId": clinicId}, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("unable to set clinic settings: %w", err)
+	}
+	return nil
+}
+
+// ParseClinicSettings decodes and validates the settings. Unknown fields are rejected, so misspelled settings aren't
+// silently ignored.
+func ParseClinicSettings(data []byte) (ClinicSettings, error) {
+	settings := ClinicSettings{}
+	if len(data) == 0 {
+		return settings, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&settings); err != nil {
+		return settings, fmt.Errorf("unable to parse clinic settings: %w", err)
+	}
+	if err := settings.Validate(); err != nil {
+		return settings, fmt.Errorf("invalid clinic settings: %w", err)
+	}
+	return settings, nil
+}
+
+func (c ClinicSettings) Validate() error {
+	return c.Tags.Validate()
+}
@@ -0,0 +1,100 @@
+package redox_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/hl7"
+	"github.com/tidepool-org/clinic-worker/redox"
+	testRedox "github.com/tidepool-org/clinic-worker/redox/test"
+)
+
+var _ = Describe("ClinicSettings", func() {
+	settings := `{
+		"notes": {"maxReportFailures": 2},
+		"tags": {"mode": "additive", "rules": [{"codes": ["TAGS"]}]},
+		"subscriptions": {"finalNote": true}
+	}`
+
+	Describe("ParseClinicSettings", func() {
+		It("decodes the settings", func() {
+			parsed, err := redox.ParseClinicSettings([]byte(settings))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed.Notes.GetMaxReportFailures()).To(Equal(2))
+			Expect(parsed.Tags.GetMode()).To(Equal(redox.TagModeAdditive))
+			Expect(parsed.Subscriptions.FinalNote).To(BeTrue())
+		})
+
+		It("rejects unknown settings", func() {
+			_, err := redox.ParseClinicSettings([]byte(`{"subscription": {"finalNote": true}}`))
+			Expect(err).To(MatchError(ContainSubstring(`unknown field "subscription"`)))
+		})
+
+		It("rejects invalid settings", func() {
+			_, err := redox.ParseClinicSettings([]byte(`{"tags": {"mode": "unknown"}}`))
+			Expect(err).To(MatchError(ContainSubstring("invalid clinic settings")))
+		})
+	})
+
+	Describe("API", func() {
+		var store *testRedox.ClinicSettingsProvider
+		var api *redox.API
+
+		BeforeEach(func() {
+			store = &testRedox.ClinicSettingsProvider{}
+			api = redox.NewAPI(store, testRedox.NewOrderLedger(), testRedox.NewQueryResponseStore(), &testRedox.PatientContactStore{}, hl7.Config{Destinations: hl7.Destinations{
+				"hospital": {Type: hl7.TransportTypeMLLP, Address: "10.0.0.5:2575"},
+			}}, zap.NewNop().Sugar())
+		})
+
+		serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+			return rec
+		}
+
+		It("stores the settings of a clinic", func() {
+			rec := serve(http.MethodPut, "/v1/redox/clinics/clinic-1/settings", settings)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(store.Clinics).To(HaveKey("clinic-1"))
+			Expect(store.Clinics["clinic-1"].Subscriptions.FinalNote).To(BeTrue())
+
+			rec = serve(http.MethodGet, "/v1/redox/clinics/clinic-1/settings", "")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			parsed, err := redox.ParseClinicSettings(rec.Body.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(Equal(store.Clinics["clinic-1"]))
+		})
+
+		It("doesn't store invalid settings", func() {
+			rec := serve(http.MethodPut, "/v1/redox/clinics/clinic-1/settings", `{"tags": {"mode": "unknown"}}`)
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			Expect(store.Clinics).To(BeEmpty())
+		})
+
+		It("only delivers hl7v2 messages to the destinations configured by the operators", func() {
+			rec := serve(http.MethodPut, "/v1/redox/clinics/clinic-1/settings", `{"hl7v2": {"enabled": true, "destination": "hospital"}}`)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			rec = serve(http.MethodPut, "/v1/redox/clinics/clinic-2/settings", `{"hl7v2": {"enabled": true, "destination": "attacker"}}`)
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			Expect(store.Clinics).ToNot(HaveKey("clinic-2"))
+
+			rec = serve(http.MethodPut, "/v1/redox/clinics/clinic-2/settings", `{"hl7v2": {"enabled": true, "transport": {"type": "file", "directory": "/etc"}}}`)
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("returns the default settings of clinics without settings", func() {
+			rec := serve(http.MethodGet, "/v1/redox/clinics/clinic-2/settings", "")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			parsed, err := redox.ParseClinicSettings(rec.Body.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(Equal(redox.ClinicSettings{}))
+		})
+	})
+})
@@ -0,0 +1,253 @@
+package redox
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+var ErrNoActiveSigningKey = errors.New("there are no active redox signing keys")
+
+// SigningKey signs the assertions of token requests. The key is only used within its activation window.
+type SigningKey struct {
+	KeyId      string
+	PrivateKey *rsa.PrivateKey
+	// NotBefore and NotAfter are the activation window of the key. The window is unbounded if they are zero.
+	NotBefore  time.Time
+	NotAfter   time.Time
+	LoadedTime time.Time
+}
+
+func (k SigningKey) IsActive(now time.Time) bool {
+	return (k.NotBefore.IsZero() || !now.Before(k.NotBefore)) && (k.NotAfter.IsZero() || now.Before(k.NotAfter))
+}
+
+// KeyHealth reports the age and the expiry of a signing key
+type KeyHealth struct {
+	KeyId            string     `json:"keyId"`
+	Active           bool       `json:"active"`
+	AgeSeconds       int64      `json:"ageSeconds"`
+	ExpiresInSeconds *int64     `json:"expiresInSeconds,omitempty"`
+	NotBefore        *time.Time `json:"notBefore,omitempty"`
+	NotAfter         *time.Time `json:"notAfter,omitempty"`
+}
+
+func (k SigningKey) Health(now time.Time) KeyHealth {
+	health := KeyHealth{
+		KeyId:  k.KeyId,
+		Active: k.IsActive(now),
+	}
+
+	// The age of keys without an activation time is counted from when they were loaded
+	activated := k.LoadedTime
+	if !k.NotBefore.IsZero() {
+		notBefore := k.NotBefore
+		health.NotBefore = &notBefore
+		activated = notBefore
+	}
+	health.AgeSeconds = int64(now.Sub(activated).Seconds())
+
+	if !k.NotAfter.IsZero() {
+		notAfter := k.NotAfter
+		expiresIn := int64(notAfter.Sub(now).Seconds())
+		health.NotAfter = &notAfter
+		health.ExpiresInSeconds = &expiresIn
+	}
+	return health
+}
+
+// signingKeysFile is the format of keys files. Private keys are either inline or in a separate PEM file.
+type signingKeysFile struct {
+	Keys []struct {
+		KeyId          string     `json:"keyId"`
+		PrivateKey     string     `json:"privateKey"`
+		PrivateKeyFile string     `json:"privateKeyFile"`
+		NotBefore      *time.Time `json:"notBefore"`
+		NotAfter       *time.Time `json:"notAfter"`
+	} `json:"keys"`
+}
+
+// keyRing holds the signing keys of a source. Keys loaded from a file are reloaded when the file or any of the
+// private key files referenced by it change.
+type keyRing struct {
+	file           string
+	reloadInterval time.Duration
+	logger         *zap.SugaredLogger
+
+	mu          sync.Mutex
+	keys        []SigningKey
+	modTimes    map[string]time.Time
+	lastChecked time.Time
+	reloadErr   error
+}
+
+func newKeyRing(keyId string, privateKeyPem string, file string, reloadInterval time.Duration, logger *zap.SugaredLogger) (*keyRing, error) {
+	ring := &keyRing{
+		file:           file,
+		reloadInterval: reloadInterval,
+		logger:         logger,
+	}
+
+	now := time.Now()
+	if file != "" {
+		keys, modTimes, err := loadSigningKeys(file, nil, now)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys = keys
+		ring.modTimes = modTimes
+		ring.lastChecked = now
+		return ring, nil
+	}
+
+	if keyId == "" || privateKeyPem == "" {
+		return nil, fmt.Errorf("either a keys file or a key id and a private key are required")
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKeyPem))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key %s: %w", keyId, err)
+	}
+	ring.keys = []SigningKey{{KeyId: keyId, PrivateKey: privateKey, LoadedTime: now}}
+	return ring, nil
+}
+
+// Active returns the active keys with the most recently activated key first
+func (k *keyRing) Active(now time.Time) []SigningKey {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.refresh(now)
+
+	var active []SigningKey
+	for _, key := range k.keys {
+		if key.IsActive(now) {
+			active = append(active, key)
+		}
+	}
+	slices.SortStableFunc(active, func(a, b SigningKey) int {
+		return b.NotBefore.Compare(a.NotBefore)
+	})
+	return active
+}
+
+func (k *keyRing) Health(now time.Time) ([]KeyHealth, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.refresh(now)
+
+	health := make([]KeyHealth, 0, len(k.keys))
+	for _, key := range k.keys {
+		health = append(health, key.Health(now))
+	}
+	return health, k.reloadErr
+}
+
+// refresh reloads the keys if the watched files changed. The previous keys are kept if the files are invalid.
+func (k *keyRing) refresh(now time.Time) {
+	if k.file == "" || now.Sub(k.lastChecked) < k.reloadInterval {
+		return
+	}
+	k.lastChecked = now
+	if !k.changed() {
+		return
+	}
+
+	keys, modTimes, err := loadSigningKeys(k.file, k.keys, now)
+	if err != nil {
+		k.logger.Errorw("unable to reload redox signing keys", "file", k.file, zap.Error(err))
+		k.reloadErr = err
+		return
+	}
+
+	k.keys = keys
+	k.modTimes = modTimes
+	k.reloadErr = nil
+	k.logger.Infow("reloaded redox signing keys", "file", k.file, "count", len(keys))
+}
+
+func (k *keyRing) changed() bool {
+	for path, modTime := range k.modTimes {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSigningKeys returns the keys in the file and the modification times of the files they were loaded from.
+// Previously loaded keys keep their load time, so their age isn't reset when the file changes.
+func loadSigningKeys(file string, previous []SigningKey, now time.Time) ([]SigningKey, map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	contents, err := readWatchedFile(file, modTimes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keysFile := signingKeysFile{}
+	if err := json.Unmarshal(contents, &keysFile); err != nil {
+		return nil, nil, fmt.Errorf("unable to parse keys file %s: %w", file, err)
+	}
+	if len(keysFile.Keys) == 0 {
+		return nil, nil, fmt.Errorf("keys file %s doesn't contain any keys", file)
+	}
+
+	keys := make([]SigningKey, 0, len(keysFile.Keys))
+	for _, entry := range keysFile.Keys {
+		if entry.KeyId == "" {
+			return nil, nil, fmt.Errorf("key id is required in keys file %s", file)
+		}
+
+		privateKeyPem := []byte(entry.PrivateKey)
+		if entry.PrivateKeyFile != "" {
+			if privateKeyPem, err = readWatchedFile(entry.PrivateKeyFile, modTimes); err != nil {
+				return nil, nil, err
+			}
+		}
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyPem)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid private key %s: %w", entry.KeyId, err)
+		}
+
+		key := SigningKey{
+			KeyId:      entry.KeyId,
+			PrivateKey: privateKey,
+			LoadedTime: now,
+		}
+		if entry.NotBefore != nil {
+			key.NotBefore = *entry.NotBefore
+		}
+		if entry.NotAfter != nil {
+			key.NotAfter = *entry.NotAfter
+		}
+		if !key.NotBefore.IsZero() && !key.NotAfter.IsZero() && !key.NotAfter.After(key.NotBefore) {
+			return nil, nil, fmt.Errorf("the activation window of key %s is empty", entry.KeyId)
+		}
+		if i := slices.IndexFunc(previous, func(p SigningKey) bool { return p.KeyId == key.KeyId }); i >= 0 {
+			key.LoadedTime = previous[i].LoadedTime
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, modTimes, nil
+}
+
+func readWatchedFile(path string, modTimes map[string]time.Time) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	modTimes[path] = info.ModTime()
+	return contents, nil
+}
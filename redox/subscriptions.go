@@ -0,0 +1,308 @@
+package redox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	models "github.com/tidepool-org/clinic/redox_models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+)
+
+const (
+	subscriptionsCollectionName = "redox_report_subscriptions"
+
+	SubscriptionStateBeforeCode        = "SUBSCRIPTION_STATE_BEFORE"
+	SubscriptionStateBeforeDescription = "The state of the report subscription before the order was processed"
+	SubscriptionStateAfterCode         = "SUBSCRIPTION_STATE_AFTER"
+	SubscriptionStateAfterDescription  = "The state of the report subscription after the order was processed"
+)
+
+type SubscriptionState string
+
+const (
+	SubscriptionStateActive   SubscriptionState = "ACTIVE"
+	SubscriptionStateInactive SubscriptionState = "INACTIVE"
+)
+
+// SubscriptionTransition is a change of the subscription state by an order. It's kept with the subscription, so
+// the state before the change is reported again if the order is retried.
+type SubscriptionTransition struct {
+	DocumentId string            `bson:"documentId"`
+	From       SubscriptionState `bson:"from"`
+	To         SubscriptionState `bson:"to"`
+	Time       time.Time         `bson:"time"`
+}
+
+// ReportSubscription is a patient with reports enabled by an order. It keeps the last matched order, which is used
+// to address the reports scheduled by the worker.
+type ReportSubscription struct {
+	ClinicId         string                 `bson:"clinicId"`
+	PatientId        string                 `bson:"patientId"`
+	LastMatchedOrder models.MessageEnvelope `bson:"lastMatchedOrder"`
+	// SourceId, Mrn and MrnIdType identify the patient in scheduling events of the EHR
+	SourceId  string `bson:"sourceId"`
+	Mrn       string `bson:"mrn"`
+	MrnIdType string `bson:"mrnIdType"`
+	// LastScheduled is the last scheduled summary and report, which precedes the next one
+	LastScheduled *PrecedingDocument `bson:"lastScheduled,omitempty"`
+	// NextVisitTime is the time of the upcoming visit of the patient, if known
+	NextVisitTime *time.Time `bson:"nextVisitTime,omitempty"`
+	// State is empty for subscriptions which were created before disabled subscriptions were kept
+	State          SubscriptionState       `bson:"state,omitempty"`
+	LastTransition *SubscriptionTransition `bson:"lastTransition,omitempty"`
+	// DisabledTime is the time when the subscription was disabled. Scheduled summaries and reports of inactive
+	// subscriptions are cancelled.
+	DisabledTime *time.Time `bson:"disabledTime,omitempty"`
+	CreatedTime  time.Time  `bson:"createdTime"`
+	ModifiedTime time.Time  `bson:"modifiedTime"`
+}
+
+// NewReportSubscription returns a subscription for the patient which was matched by the order. The message of the
+// order is kept, so it can be normalized again by the adapter when reports are scheduled.
+func NewReportSubscription(clinicId string, patientId string, envelope models.MessageEnvelope, order ehr.Order, mrnIdType string) ReportSubscription {
+	subscription := ReportSubscription{
+		ClinicId:         clinicId,
+		PatientId:        patientId,
+		LastMatchedOrder: envelope,
+		SourceId:         order.SourceId,
+		MrnIdType:        mrnIdType,
+	}
+	if mrn, err := order.GetMrn(mrnIdType); err == nil && mrn != nil {
+		subscription.Mrn = *mrn
+	}
+	if order.Visit != nil && order.Visit.Time != nil && order.Visit.Time.After(time.Now()) {
+		visitTime := *order.Visit.Time
+		subscription.NextVisitTime = &visitTime
+	}
+	return subscription
+}
+
+// GetState returns the state of the subscription, which is inactive if the subscription doesn't exist
+func (r *ReportSubscription) GetState() SubscriptionState {
+	if r == nil || r.State == SubscriptionStateInactive {
+		return SubscriptionStateInactive
+	}
+	return SubscriptionStateActive
+}
+
+// NewSubscriptionTransition returns the transition of the subscription to the state requested by the order. The state
+// before the transition is the state of the subscription kept by the worker. The transition of a previous attempt to
+// process the same order is returned if there is one, because the subscription is already in the new state when the
+// order is retried.
+func NewSubscriptionTransition(existing *ReportSubscription, documentId string, to SubscriptionState) SubscriptionTransition {
+	if existing != nil && existing.LastTransition != nil && existing.LastTransition.DocumentId == documentId && existing.LastTransition.To == to {
+		return *existing.LastTransition
+	}
+	return SubscriptionTransition{
+		DocumentId: documentId,
+		From:       existing.GetState(),
+		To:         to,
+		Time:       time.Now(),
+	}
+}
+
+// ResultDetails returns the states before and after the transition which are reported in the results
+func (t SubscriptionTransition) ResultDetails() []ehr.ResultDetail {
+	return []ehr.ResultDetail{
+		{Code: SubscriptionStateBeforeCode, Description: SubscriptionStateBeforeDescription, Value: string(t.From)},
+		{Code: SubscriptionStateAfterCode, Description: SubscriptionStateAfterDescription, Value: string(t.To)},
+	}
+}
+
+type SubscriptionStore interface {
+	// Upsert creates the subscription or replaces the last matched order and the identifiers of an existing one. The
+	// subscription becomes active.
+	Upsert(ctx context.Context, subscription ReportSubscription) error
+	// Find returns the active or inactive subscription of the patient or nil if it doesn't exist
+	Find(ctx context.Context, clinicId string, patientId string) (*ReportSubscription, error)
+	// Disable keeps the subscription as inactive with the last transition, so it isn't scheduled and pending scheduled
+	// items are cancelled. The subscription is created if it doesn't exist, e.g. for patients who were subscribed
+	// before the worker kept subscriptions.
+	Disable(ctx context.Context, subscription ReportSubscription) error
+	// FindByMrn returns the active subscriptions of patients with the mrn in the source
+	FindByMrn(ctx context.Context, sourceId string, mrn string) ([]ReportSubscription, error)
+	// ListClinicIds returns the clinics with active subscriptions
+	ListClinicIds(ctx context.Context) ([]string, error)
+	// ForEach calls the function with each active subscription of the clinic and stops at the first error
+	ForEach(ctx context.Context, clinicId string, fn func(subscription ReportSubscription) error) error
+	SetLastScheduled(ctx context.Context, clinicId string, patientId string, scheduled PrecedingDocument) error
+}
+
+type MongoSubscriptionStore struct {
+	collection *mongo.Collection
+}
+
+var _ SubscriptionStore = &MongoSubscriptionStore{}
+
+func NewSubscriptionStore(db *mongo.Database, config ModuleConfig, lifecycle fx.Lifecycle) SubscriptionStore {
+	store := &MongoSubscriptionStore{
+		collection: db.Collection(subscriptionsCollectionName),
+	}
+	if config.Enabled {
+		lifecycle.Append(fx.Hook{
+			OnStart: store.CreateIndexes,
+		})
+	}
+	return store
+}
+
+func (m *MongoSubscriptionStore) CreateIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "clinicId", Value: 1}, {Key: "patientId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "sourceId", Value: 1}, {Key: "mrn", Value: 1}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create report subscription indexes: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoSubscriptionStore) Upsert(ctx context.Context, subscription ReportSubscription) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"lastMatchedOrder": subscription.LastMatchedOrder,
+			"sourceId":         subscription.SourceId,
+			"mrn":              subscription.Mrn,
+			"mrnIdType":        subscription.MrnIdType,
+			"nextVisitTime":    subscription.NextVisitTime,
+			"state":            SubscriptionStateActive,
+			"lastTransition":   subscription.LastTransition,
+			"modifiedTime":     now,
+		},
+		"$unset":       bson.M{"disabledTime": ""},
+		"$setOnInsert": bson.M{"createdTime": now},
+	}
+	_, err := m.collection.UpdateOne(ctx, subscriptionFilter(subscription.ClinicId, subscription.PatientId), update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("unable to upsert report subscription: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoSubscriptionStore) Find(ctx context.Context, clinicId string, patientId string) (*ReportSubscription, error) {
+	subscription := &ReportSubscription{}
+	err := m.collection.FindOne(ctx, subscriptionFilter(clinicId, patientId)).Decode(subscription)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to find report subscription: %w", err)
+	}
+	return subscription, nil
+}
+
+func (m *MongoSubscriptionStore) Disable(ctx context.Context, subscription ReportSubscription) error {
+	now := time.Now()
+	disabledTime := now
+	if subscription.LastTransition != nil {
+		disabledTime = subscription.LastTransition.Time
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"state":          SubscriptionStateInactive,
+			"lastTransition": subscription.LastTransition,
+			"disabledTime":   disabledTime,
+			"modifiedTime":   now,
+		},
+		// The order which disabled the subscription identifies the patient only if the subscription didn't exist
+		"$setOnInsert": bson.M{
+			"lastMatchedOrder": subscription.LastMatchedOrder,
+			"sourceId":         subscription.SourceId,
+			"mrn":              subscription.Mrn,
+			"mrnIdType":        subscription.MrnIdType,
+			"createdTime":      now,
+		},
+	}
+	_, err := m.collection.UpdateOne(ctx, subscriptionFilter(subscription.ClinicId, subscription.PatientId), update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("unable to disable report subscription: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoSubscriptionStore) FindByMrn(ctx context.Context, sourceId string, mrn string) ([]ReportSubscription, error) {
+	cursor, err := m.collection.Find(ctx, activeSubscriptionsFilter(bson.M{"sourceId": sourceId, "mrn": mrn}))
+	if err != nil {
+		return nil, fmt.Errorf("unable to find report subscriptions: %w", err)
+	}
+
+	var subscriptions []ReportSubscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, fmt.Errorf("unable to decode report subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+func (m *MongoSubscriptionStore) ListClinicIds(ctx context.Context) ([]string, error) {
+	values, err := m.collection.Distinct(ctx, "clinicId", activeSubscriptionsFilter(bson.M{}))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list clinics with report subscriptions: %w", err)
+	}
+
+	clinicIds := make([]string, 0, len(values))
+	for _, value := range values {
+		if clinicId, ok := value.(string); ok {
+			clinicIds = append(clinicIds, clinicId)
+		}
+	}
+	return clinicIds, nil
+}
+
+func (m *MongoSubscriptionStore) ForEach(ctx context.Context, clinicId string, fn func(subscription ReportSubscription) error) error {
+	cursor, err := m.collection.Find(ctx, activeSubscriptionsFilter(bson.M{"clinicId": clinicId}))
+	if err != nil {
+		return fmt.Errorf("unable to list report subscriptions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		subscription := ReportSubscription{}
+		if err := cursor.Decode(&subscription); err != nil {
+			return fmt.Errorf("unable to decode report subscription: %w", err)
+		}
+		if err := fn(subscription); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("unable to list report subscriptions: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoSubscriptionStore) SetLastScheduled(ctx context.Context, clinicId string, patientId string, scheduled PrecedingDocument) error {
+	update := bson.M{
+		"$set": bson.M{
+			"lastScheduled": scheduled,
+			"modifiedTime":  time.Now(),
+		},
+	}
+	if _, err := m.collection.UpdateOne(ctx, subscriptionFilter(clinicId, patientId), update); err != nil {
+		return fmt.Errorf("unable to update report subscription: %w", err)
+	}
+	return nil
+}
+
+func subscriptionFilter(clinicId string, patientId string) bson.M {
+	return bson.M{
+		"clinicId":  clinicId,
+		"patientId": patientId,
+	}
+}
+
+// activeSubscriptionsFilter excludes inactive subscriptions. Subscriptions without state are active.
+func activeSubscriptionsFilter(filter bson.M) bson.M {
+	filter["state"] = bson.M{"$ne": SubscriptionStateInactive}
+	return filter
+}
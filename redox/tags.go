@@ -0,0 +1,164 @@
+package redox
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	clinics "github.com/tidepool-org/clinic/client"
+)
+
+type TagMode string
+
+const (
+	// TagModeReplace replaces the tags of the patient with the tags derived from the order
+	TagModeReplace TagMode = "replace"
+	// TagModeAdditive adds the tags derived from the order to the existing tags of the patient
+	TagModeAdditive TagMode = "additive"
+)
+
+// TagSettings define how patient tags are derived from the clinical info of orders. If there are no rules, the tag
+// codes and separator of the EHR settings of the clinic are used.
+type TagSettings struct {
+	Mode TagMode `json:"mode,omitempty"`
+	// Prefixes are prepended to the tag names, keyed by the source id of the order
+	Prefixes map[string]string `json:"prefixes,omitempty"`
+	// RemoveOnDisable removes the tags derived from disable orders from the patient
+	RemoveOnDisable bool      `json:"removeOnDisable,omitempty"`
+	Rules           []TagRule `json:"rules,omitempty"`
+}
+
+// TagRule extracts tag names from the values of the clinical info with the given codes
+type TagRule struct {
+	Codes     []string `json:"codes"`
+	Separator string   `json:"separator,omitempty"`
+	// Pattern skips values which don't match it. The first capture group is used as tag name if the pattern has one,
+	// otherwise the whole match is used.
+	Pattern string `json:"pattern,omitempty"`
+	// Names maps extracted values to tag names. Values without a mapping are used as they are.
+	Names map[string]string `json:"names,omitempty"`
+}
+
+func (t TagSettings) GetMode() TagMode {
+	if t.Mode == "" {
+		return TagModeReplace
+	}
+	return t.Mode
+}
+
+func (t TagSettings) Validate() error {
+	switch t.GetMode() {
+	case TagModeReplace, TagModeAdditive:
+	default:
+		return fmt.Errorf("invalid tag mode %s", t.Mode)
+	}
+	for _, rule := range t.Rules {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid tag pattern %s: %w", rule.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// GetTagNames returns the unique tag names derived from the order, or nil if tags are not configured
+func (t TagSettings) GetTagNames(order ehr.Order, sourceId string, ehrSettings clinics.EhrTagsSettingsV1) ([]string, error) {
+	rules := t.Rules
+	if len(rules) == 0 {
+		rule := TagRule{}
+		if ehrSettings.Codes != nil {
+			rule.Codes = *ehrSettings.Codes
+		}
+		if ehrSettings.Separator != nil {
+			rule.Separator = *ehrSettings.Separator
+		}
+		if len(rule.Codes) == 0 {
+			return nil, nil
+		}
+		rules = []TagRule{rule}
+	}
+
+	prefix := t.Prefixes[sourceId]
+	names := make([]string, 0)
+	for _, rule := range rules {
+		ruleNames, err := rule.Apply(order)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range ruleNames {
+			name = prefix + name
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func (r TagRule) Apply(order ehr.Order) ([]string, error) {
+	var pattern *regexp.Regexp
+	if r.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(r.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid tag pattern %s: %w", r.Pattern, err)
+		}
+	}
+
+	codes := make(map[string]struct{}, len(r.Codes))
+	for _, code := range r.Codes {
+		codes[code] = struct{}{}
+	}
+
+	var names []string
+	for _, value := range order.GetClinicalInfoValues(codes, r.Separator) {
+		if pattern != nil {
+			submatches := pattern.FindStringSubmatch(value)
+			if submatches == nil {
+				continue
+			}
+			value = submatches[0]
+			if len(submatches) > 1 {
+				value = submatches[1]
+			}
+		}
+		if name, ok := r.Names[value]; ok {
+			value = name
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			names = append(names, value)
+		}
+	}
+
+	return names, nil
+}
+
+// MergeTagIds returns the tags of the patient after applying the tags derived from an order
+func (t TagSettings) MergeTagIds(existing *clinics.PatientTagIdsV1, derived clinics.PatientTagIdsV1) clinics.PatientTagIdsV1 {
+	if t.GetMode() == TagModeReplace || existing == nil {
+		return derived
+	}
+
+	merged := slices.Clone(*existing)
+	for _, id := range derived {
+		if !slices.Contains(merged, id) {
+			merged = append(merged, id)
+		}
+	}
+	return merged
+}
+
+// RemoveTagIds returns the tags of the patient without the removed tags
+func RemoveTagIds(existing *clinics.PatientTagIdsV1, removed clinics.PatientTagIdsV1) clinics.PatientTagIdsV1 {
+	remaining := clinics.PatientTagIdsV1{}
+	if existing == nil {
+		return remaining
+	}
+	for _, id := range *existing {
+		if !slices.Contains(removed, id) {
+			remaining = append(remaining, id)
+		}
+	}
+	return remaining
+}
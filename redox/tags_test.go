@@ -0,0 +1,101 @@
+package redox_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/ehr"
+	"github.com/tidepool-org/clinic-worker/redox"
+	clinics "github.com/tidepool-org/clinic/client"
+)
+
+var _ = Describe("TagSettings", func() {
+	var order ehr.Order
+
+	BeforeEach(func() {
+		order = ehr.Order{
+			ClinicalInfo: []ehr.ClinicalInfo{
+				{Code: "TIDEPOOL_TAGS", Value: "T1D, ADULT"},
+				{Code: "DIAGNOSIS", Value: "E10.9 Type 1 diabetes mellitus without complications"},
+			},
+		}
+	})
+
+	Describe("GetTagNames", func() {
+		It("uses the codes and separator of the ehr settings when there are no rules", func() {
+			codes := []string{"TIDEPOOL_TAGS"}
+			separator := ","
+			ehrSettings := clinics.EhrTagsSettingsV1{Codes: &codes, Separator: &separator}
+
+			names, err := redox.TagSettings{}.GetTagNames(order, "source", ehrSettings)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(names).To(Equal([]string{"T1D", "ADULT"}))
+		})
+
+		It("returns nil when tags are not configured", func() {
+			names, err := redox.TagSettings{}.GetTagNames(order, "source", clinics.EhrTagsSettingsV1{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(names).To(BeNil())
+		})
+
+		It("maps, extracts and prefixes tag names with the rules", func() {
+			settings := redox.TagSettings{
+				Prefixes: map[string]string{"source": "EHR: "},
+				Rules: []redox.TagRule{{
+					Codes:     []string{"TIDEPOOL_TAGS"},
+					Separator: ",",
+					Names:     map[string]string{"T1D": "Type 1"},
+				}, {
+					Codes:   []string{"DIAGNOSIS"},
+					Pattern: `^(E1[01])\.`,
+					Names:   map[string]string{"E10": "Type 1", "E11": "Type 2"},
+				}},
+			}
+
+			names, err := settings.GetTagNames(order, "source", clinics.EhrTagsSettingsV1{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(names).To(Equal([]string{"EHR: Type 1", "EHR: ADULT"}))
+		})
+
+		It("skips values which don't match the pattern", func() {
+			settings := redox.TagSettings{
+				Rules: []redox.TagRule{{Codes: []string{"TIDEPOOL_TAGS"}, Separator: ",", Pattern: "^T[12]D$"}},
+			}
+
+			names, err := settings.GetTagNames(order, "other", clinics.EhrTagsSettingsV1{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(names).To(Equal([]string{"T1D"}))
+		})
+	})
+
+	Describe("Validate", func() {
+		It("returns an error if a pattern is invalid", func() {
+			settings := redox.TagSettings{Rules: []redox.TagRule{{Pattern: "("}}}
+			Expect(settings.Validate()).ToNot(Succeed())
+		})
+
+		It("returns an error if the mode is unknown", func() {
+			Expect(redox.TagSettings{Mode: "merge"}.Validate()).ToNot(Succeed())
+		})
+	})
+
+	Describe("MergeTagIds", func() {
+		existing := &clinics.PatientTagIdsV1{"1", "2"}
+
+		It("replaces the existing tags by default", func() {
+			Expect(redox.TagSettings{}.MergeTagIds(existing, clinics.PatientTagIdsV1{"3"})).To(Equal(clinics.PatientTagIdsV1{"3"}))
+		})
+
+		It("adds to the existing tags in additive mode", func() {
+			settings := redox.TagSettings{Mode: redox.TagModeAdditive}
+			Expect(settings.MergeTagIds(existing, clinics.PatientTagIdsV1{"2", "3"})).To(Equal(clinics.PatientTagIdsV1{"1", "2", "3"}))
+		})
+	})
+
+	Describe("RemoveTagIds", func() {
+		It("removes the tags from the existing tags", func() {
+			existing := &clinics.PatientTagIdsV1{"1", "2"}
+			Expect(redox.RemoveTagIds(existing, clinics.PatientTagIdsV1{"1"})).To(Equal(clinics.PatientTagIdsV1{"2"}))
+		})
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/tidepool-org/clinic-worker/redox"
+	clinics "github.com/tidepool-org/clinic/client"
 	"io"
 )
 
@@ -13,6 +14,12 @@ type RedoxClient struct {
 	uploadEnabled bool
 	Sent          []interface{}
 	Uploaded      map[string]interface{}
+	// UploadFailures is the number of uploads which fail before an upload succeeds
+	UploadFailures int
+	// Sources are the clients returned for clinics with the source id
+	Sources map[string]*RedoxClient
+	// HealthStatus is returned by Health
+	HealthStatus redox.ClientHealth
 }
 
 var _ redox.Client = &RedoxClient{}
@@ -34,6 +41,17 @@ func (t *RedoxClient) GetSource() (source struct {
 	return
 }
 
+func (t *RedoxClient) ForClinic(settings clinics.EhrSettingsV1) redox.Client {
+	if source, ok := t.Sources[settings.SourceId]; ok {
+		return source
+	}
+	return t
+}
+
+func (t *RedoxClient) Health() redox.ClientHealth {
+	return t.HealthStatus
+}
+
 func (t *RedoxClient) Send(ctx context.Context, payload interface{}) error {
 	t.Sent = append(t.Sent, payload)
 	return nil
@@ -48,6 +66,11 @@ func (t *RedoxClient) IsUploadFileEnabled() bool {
 }
 
 func (t *RedoxClient) UploadFile(ctx context.Context, fileName string, reader io.Reader) (*redox.UploadResult, error) {
+	if t.UploadFailures > 0 {
+		t.UploadFailures--
+		return nil, fmt.Errorf("upload failed")
+	}
+
 	body, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, err
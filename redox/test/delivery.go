@@ -0,0 +1,67 @@
+package test
+
+import (
+	"encoding/base64"
+
+	ehrTest "github.com/tidepool-org/clinic-worker/ehr/test"
+	"github.com/tidepool-org/clinic-worker/redox"
+	models "github.com/tidepool-org/clinic/redox_models"
+)
+
+// Delivered returns the payloads which were sent with the client, decoded to the deliveries of the EHR adapter
+func (t *RedoxClient) Delivered() []ehrTest.Delivery {
+	var delivered []ehrTest.Delivery
+	for _, payload := range t.Sent {
+		delivered = append(delivered, decodeDelivery(payload))
+	}
+	return delivered
+}
+
+func decodeDelivery(payload interface{}) ehrTest.Delivery {
+	switch p := payload.(type) {
+	case models.NewResults:
+		delivery := ehrTest.Delivery{Type: ehrTest.DeliveryResults, DestinationId: getDestinationId(p.Meta.Destinations), Details: map[string]string{}}
+		for _, result := range p.Orders[0].Results {
+			switch result.Code {
+			case redox.MatchingResultCode, redox.AccountCreationResultCode:
+				delivery.IsSuccess = result.Value == "SUCCESS"
+			case redox.MatchingResultCodeCode, redox.AccountCreationCodeCode:
+				delivery.Code = result.Value
+			case redox.MatchingResultMessageCode, redox.AccountCreationMessageCode:
+				delivery.Message = result.Value
+			case redox.MatchingMethodCode, redox.MatchingConfidenceCode:
+			default:
+				delivery.Details[result.Code] = result.Value
+			}
+		}
+		return delivery
+	case models.NewFlowsheet:
+		delivery := ehrTest.Delivery{Type: ehrTest.DeliveryObservations, DestinationId: getDestinationId(p.Meta.Destinations), Observations: map[string]string{}}
+		for _, observation := range p.Observations {
+			delivery.Observations[observation.Code] = observation.Value
+		}
+		return delivery
+	case *redox.NewNotes:
+		delivery := ehrTest.Delivery{Type: ehrTest.DeliveryDocument, DestinationId: getDestinationId(p.Meta.Destinations), DocumentId: p.Note.DocumentID}
+		if p.Note.FileContents == nil {
+			return delivery
+		}
+		if p.Note.ContentType == redox.NoteContentTypeBase64 {
+			delivery.Content, _ = base64.StdEncoding.DecodeString(*p.Note.FileContents)
+		} else {
+			delivery.Text = *p.Note.FileContents
+		}
+		return delivery
+	}
+	return ehrTest.Delivery{}
+}
+
+func getDestinationId(destinations *[]struct {
+	ID   *string `json:"ID"`
+	Name *string `json:"Name"`
+}) string {
+	if destinations == nil || len(*destinations) == 0 || (*destinations)[0].ID == nil {
+		return ""
+	}
+	return *(*destinations)[0].ID
+}
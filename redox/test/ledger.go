@@ -0,0 +1,95 @@
+package test
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+)
+
+type OrderLedger struct {
+	Entries map[redox.OrderKey]*redox.OrderLedgerEntry
+}
+
+var _ redox.OrderLedger = &OrderLedger{}
+
+func NewOrderLedger() *OrderLedger {
+	return &OrderLedger{
+		Entries: make(map[redox.OrderKey]*redox.OrderLedgerEntry),
+	}
+}
+
+func (t *OrderLedger) GetEntry(ctx context.Context, key redox.OrderKey) (*redox.OrderLedgerEntry, error) {
+	entry, ok := t.Entries[key]
+	if !ok {
+		return nil, nil
+	}
+	result := *entry
+	result.Steps = slices.Clone(entry.Steps)
+	result.Timeline = slices.Clone(entry.Timeline)
+	result.Failures = make(map[redox.OrderStep]int)
+	for step, failures := range entry.Failures {
+		result.Failures[step] = failures
+	}
+	return &result, nil
+}
+
+func (t *OrderLedger) CompleteStep(ctx context.Context, key redox.OrderKey, step redox.OrderStep, destinationId string) error {
+	entry := t.getOrCreate(key)
+	entry.Steps = append(entry.Steps, redox.CompletedStep{Step: step, DestinationId: destinationId, Time: time.Now()})
+	entry.ModifiedTime = time.Now()
+	return nil
+}
+
+func (t *OrderLedger) RecordFailure(ctx context.Context, key redox.OrderKey, step redox.OrderStep) (int, error) {
+	entry := t.getOrCreate(key)
+	if entry.Failures == nil {
+		entry.Failures = make(map[redox.OrderStep]int)
+	}
+	entry.Failures[step]++
+	entry.ModifiedTime = time.Now()
+	return entry.Failures[step], nil
+}
+
+func (t *OrderLedger) RecordReportUpload(ctx context.Context, key redox.OrderKey, upload redox.ReportUpload) error {
+	entry := t.getOrCreate(key)
+	entry.ReportUpload = &upload
+	entry.ModifiedTime = time.Now()
+	return nil
+}
+
+func (t *OrderLedger) CompleteOrder(ctx context.Context, key redox.OrderKey) error {
+	entry := t.getOrCreate(key)
+	now := time.Now()
+	entry.CompletedTime = &now
+	entry.ModifiedTime = now
+	return nil
+}
+
+func (t *OrderLedger) RecordStatus(ctx context.Context, event redox.OrderStatusEvent) error {
+	entry := t.getOrCreate(redox.OrderKey{OrderId: event.OrderId, ProcedureCode: event.ProcedureCode})
+	entry.Timeline = append(entry.Timeline, event)
+	entry.ModifiedTime = time.Now()
+	return nil
+}
+
+func (t *OrderLedger) GetTimeline(ctx context.Context, documentId string) ([]redox.OrderStatusEvent, error) {
+	var entries []redox.OrderLedgerEntry
+	for _, entry := range t.Entries {
+		entries = append(entries, *entry)
+	}
+	return redox.GetDocumentTimeline(entries, documentId), nil
+}
+
+func (t *OrderLedger) getOrCreate(key redox.OrderKey) *redox.OrderLedgerEntry {
+	entry, ok := t.Entries[key]
+	if !ok {
+		entry = &redox.OrderLedgerEntry{
+			OrderKey:    key,
+			CreatedTime: time.Now(),
+		}
+		t.Entries[key] = entry
+	}
+	return entry
+}
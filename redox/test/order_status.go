@@ -0,0 +1,26 @@
+package test
+
+import (
+	"context"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+)
+
+type OrderStatusRecorder struct {
+	Events []redox.OrderStatusEvent
+}
+
+var _ redox.OrderStatusRecorder = &OrderStatusRecorder{}
+
+func (t *OrderStatusRecorder) RecordStatus(ctx context.Context, event redox.OrderStatusEvent) error {
+	t.Events = append(t.Events, event)
+	return nil
+}
+
+func (t *OrderStatusRecorder) Statuses() []redox.OrderStatus {
+	statuses := make([]redox.OrderStatus, len(t.Events))
+	for i, event := range t.Events {
+		statuses[i] = event.Status
+	}
+	return statuses
+}
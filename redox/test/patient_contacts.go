@@ -0,0 +1,44 @@
+package test
+
+import (
+	"context"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+)
+
+// PatientContactStore fails to store contacts while Err is set
+type PatientContactStore struct {
+	Contacts []redox.PatientContact
+	Err      error
+}
+
+var _ redox.PatientContactStore = &PatientContactStore{}
+
+func (t *PatientContactStore) Upsert(ctx context.Context, contact redox.PatientContact) error {
+	if t.Err != nil {
+		return t.Err
+	}
+	for i, existing := range t.Contacts {
+		if existing.ClinicId == contact.ClinicId && existing.PatientId == contact.PatientId {
+			t.Contacts[i].PhoneNumber = contact.PhoneNumber
+			t.Contacts[i].Guardian = contact.Guardian
+			t.Contacts[i].ModifiedTime = time.Now()
+			return nil
+		}
+	}
+
+	contact.CreatedTime = time.Now()
+	contact.ModifiedTime = contact.CreatedTime
+	t.Contacts = append(t.Contacts, contact)
+	return nil
+}
+
+func (t *PatientContactStore) Get(ctx context.Context, clinicId string, patientId string) (*redox.PatientContact, error) {
+	for i, contact := range t.Contacts {
+		if contact.ClinicId == clinicId && contact.PatientId == patientId {
+			return &t.Contacts[i], nil
+		}
+	}
+	return nil, nil
+}
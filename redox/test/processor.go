@@ -7,9 +7,13 @@ import (
 
 type ScheduledOrderProcessor struct {
 	Scheduled []redox.ScheduledSummaryAndReport
+	Err       error
 }
 
 func (t *ScheduledOrderProcessor) ProcessOrder(ctx context.Context, scheduled redox.ScheduledSummaryAndReport) error {
+	if t.Err != nil {
+		return t.Err
+	}
 	t.Scheduled = append(t.Scheduled, scheduled)
 	return nil
 }
@@ -0,0 +1,35 @@
+package test
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+)
+
+type QueryResponseStore struct {
+	Responses map[primitive.ObjectID]redox.QueryResponse
+}
+
+var _ redox.QueryResponseStore = &QueryResponseStore{}
+
+func NewQueryResponseStore() *QueryResponseStore {
+	return &QueryResponseStore{
+		Responses: make(map[primitive.ObjectID]redox.QueryResponse),
+	}
+}
+
+func (t *QueryResponseStore) Put(ctx context.Context, response redox.QueryResponse) error {
+	if _, ok := t.Responses[response.QueryId]; !ok {
+		t.Responses[response.QueryId] = response
+	}
+	return nil
+}
+
+func (t *QueryResponseStore) Get(ctx context.Context, queryId primitive.ObjectID) (*redox.QueryResponse, error) {
+	if response, ok := t.Responses[queryId]; ok {
+		return &response, nil
+	}
+	return nil, nil
+}
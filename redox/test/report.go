@@ -0,0 +1,23 @@
+package test
+
+import (
+	"context"
+
+	"github.com/tidepool-org/clinic-worker/report"
+)
+
+// ReportGenerator fails to generate reports while Err is set and delegates to the sample report generator otherwise
+type ReportGenerator struct {
+	Err      error
+	Requests []report.Parameters
+}
+
+var _ report.Generator = &ReportGenerator{}
+
+func (t *ReportGenerator) GenerateReport(ctx context.Context, params report.Parameters) (*report.Report, error) {
+	t.Requests = append(t.Requests, params)
+	if t.Err != nil {
+		return nil, t.Err
+	}
+	return report.NewSampleReportGenerator().GenerateReport(ctx, params)
+}
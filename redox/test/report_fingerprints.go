@@ -0,0 +1,28 @@
+package test
+
+import (
+	"context"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+)
+
+type ReportFingerprintStore struct {
+	Fingerprints map[redox.ReportFingerprintKey]string
+}
+
+var _ redox.ReportFingerprintStore = &ReportFingerprintStore{}
+
+func NewReportFingerprintStore() *ReportFingerprintStore {
+	return &ReportFingerprintStore{
+		Fingerprints: make(map[redox.ReportFingerprintKey]string),
+	}
+}
+
+func (t *ReportFingerprintStore) GetFingerprint(ctx context.Context, key redox.ReportFingerprintKey) (string, error) {
+	return t.Fingerprints[key], nil
+}
+
+func (t *ReportFingerprintStore) SetFingerprint(ctx context.Context, key redox.ReportFingerprintKey, fingerprint string) error {
+	t.Fingerprints[key] = fingerprint
+	return nil
+}
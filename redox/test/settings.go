@@ -0,0 +1,30 @@
+package test
+
+import (
+	"context"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+)
+
+// ClinicSettingsProvider returns the settings of a clinic if defined, otherwise it returns the default settings
+type ClinicSettingsProvider struct {
+	Default redox.ClinicSettings
+	Clinics map[string]redox.ClinicSettings
+}
+
+var _ redox.ClinicSettingsStore = &ClinicSettingsProvider{}
+
+func (s *ClinicSettingsProvider) GetClinicSettings(_ context.Context, clinicId string) (redox.ClinicSettings, error) {
+	if settings, ok := s.Clinics[clinicId]; ok {
+		return settings, nil
+	}
+	return s.Default, nil
+}
+
+func (s *ClinicSettingsProvider) SetClinicSettings(_ context.Context, clinicId string, settings redox.ClinicSettings) error {
+	if s.Clinics == nil {
+		s.Clinics = make(map[string]redox.ClinicSettings)
+	}
+	s.Clinics[clinicId] = settings
+	return nil
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+)
+
+type SubscriptionStore struct {
+	Subscriptions []redox.ReportSubscription
+}
+
+var _ redox.SubscriptionStore = &SubscriptionStore{}
+
+func (t *SubscriptionStore) Upsert(ctx context.Context, subscription redox.ReportSubscription) error {
+	if existing := t.Get(subscription.ClinicId, subscription.PatientId); existing != nil {
+		existing.LastMatchedOrder = subscription.LastMatchedOrder
+		existing.SourceId = subscription.SourceId
+		existing.Mrn = subscription.Mrn
+		existing.MrnIdType = subscription.MrnIdType
+		existing.NextVisitTime = subscription.NextVisitTime
+		existing.State = redox.SubscriptionStateActive
+		existing.LastTransition = subscription.LastTransition
+		existing.DisabledTime = nil
+		existing.ModifiedTime = time.Now()
+		return nil
+	}
+
+	subscription.State = redox.SubscriptionStateActive
+	subscription.DisabledTime = nil
+	subscription.CreatedTime = time.Now()
+	subscription.ModifiedTime = subscription.CreatedTime
+	t.Subscriptions = append(t.Subscriptions, subscription)
+	return nil
+}
+
+func (t *SubscriptionStore) Find(ctx context.Context, clinicId string, patientId string) (*redox.ReportSubscription, error) {
+	if existing := t.Get(clinicId, patientId); existing != nil {
+		subscription := *existing
+		return &subscription, nil
+	}
+	return nil, nil
+}
+
+func (t *SubscriptionStore) Disable(ctx context.Context, subscription redox.ReportSubscription) error {
+	disabledTime := time.Now()
+	if subscription.LastTransition != nil {
+		disabledTime = subscription.LastTransition.Time
+	}
+	if existing := t.Get(subscription.ClinicId, subscription.PatientId); existing != nil {
+		existing.State = redox.SubscriptionStateInactive
+		existing.LastTransition = subscription.LastTransition
+		existing.DisabledTime = &disabledTime
+		existing.ModifiedTime = time.Now()
+		return nil
+	}
+
+	subscription.State = redox.SubscriptionStateInactive
+	subscription.DisabledTime = &disabledTime
+	subscription.CreatedTime = time.Now()
+	subscription.ModifiedTime = subscription.CreatedTime
+	t.Subscriptions = append(t.Subscriptions, subscription)
+	return nil
+}
+
+func (t *SubscriptionStore) FindByMrn(ctx context.Context, sourceId string, mrn string) ([]redox.ReportSubscription, error) {
+	var result []redox.ReportSubscription
+	for _, subscription := range t.Subscriptions {
+		if subscription.SourceId == sourceId && subscription.Mrn == mrn && subscription.GetState() == redox.SubscriptionStateActive {
+			result = append(result, subscription)
+		}
+	}
+	return result, nil
+}
+
+func (t *SubscriptionStore) ListClinicIds(ctx context.Context) ([]string, error) {
+	var clinicIds []string
+	for _, subscription := range t.Subscriptions {
+		if subscription.GetState() == redox.SubscriptionStateActive && !slices.Contains(clinicIds, subscription.ClinicId) {
+			clinicIds = append(clinicIds, subscription.ClinicId)
+		}
+	}
+	return clinicIds, nil
+}
+
+func (t *SubscriptionStore) ForEach(ctx context.Context, clinicId string, fn func(subscription redox.ReportSubscription) error) error {
+	for _, subscription := range t.Subscriptions {
+		if subscription.ClinicId != clinicId || subscription.GetState() != redox.SubscriptionStateActive {
+			continue
+		}
+		if err := fn(subscription); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *SubscriptionStore) SetLastScheduled(ctx context.Context, clinicId string, patientId string, scheduled redox.PrecedingDocument) error {
+	if existing := t.Get(clinicId, patientId); existing != nil {
+		existing.LastScheduled = &scheduled
+	}
+	return nil
+}
+
+func (t *SubscriptionStore) Get(clinicId string, patientId string) *redox.ReportSubscription {
+	for i := range t.Subscriptions {
+		if t.Subscriptions[i].ClinicId == clinicId && t.Subscriptions[i].PatientId == patientId {
+			return &t.Subscriptions[i]
+		}
+	}
+	return nil
+}
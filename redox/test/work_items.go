@@ -0,0 +1,104 @@
+package test
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+)
+
+// WorkItemStore keeps the work items in memory
+type WorkItemStore struct {
+	Items map[string]*redox.WorkItem
+}
+
+var _ redox.WorkItemStore = &WorkItemStore{}
+
+func NewWorkItemStore() *WorkItemStore {
+	return &WorkItemStore{
+		Items: make(map[string]*redox.WorkItem),
+	}
+}
+
+func (t *WorkItemStore) Enqueue(ctx context.Context, item redox.WorkItem) error {
+	if _, ok := t.Items[item.Id]; ok {
+		return nil
+	}
+	now := time.Now()
+	item.Status = redox.WorkItemStatusPending
+	item.Attempts = 0
+	item.NextAttemptTime = now
+	item.CreatedTime = now
+	item.ModifiedTime = now
+	t.Items[item.Id] = &item
+	return nil
+}
+
+func (t *WorkItemStore) Schedule(ctx context.Context, item redox.WorkItem, dueTime time.Time) error {
+	now := time.Now()
+	item.CreatedTime = now
+	if existing, ok := t.Items[item.Id]; ok {
+		if existing.Status == redox.WorkItemStatusCompleted && existing.NextAttemptTime.Equal(dueTime) {
+			return nil
+		}
+		item.CreatedTime = existing.CreatedTime
+	}
+	item.Status = redox.WorkItemStatusPending
+	item.Attempts = 0
+	item.LastError = ""
+	item.CompletedTime = nil
+	item.NextAttemptTime = dueTime
+	item.ModifiedTime = now
+	t.Items[item.Id] = &item
+	return nil
+}
+
+func (t *WorkItemStore) Cancel(ctx context.Context, id string) error {
+	if item, ok := t.Items[id]; ok && item.Status == redox.WorkItemStatusPending {
+		now := time.Now()
+		item.Status = redox.WorkItemStatusCancelled
+		item.CompletedTime = &now
+	}
+	return nil
+}
+
+func (t *WorkItemStore) ListDue(ctx context.Context, now time.Time, limit int) ([]redox.WorkItem, error) {
+	var due []redox.WorkItem
+	for _, item := range t.Items {
+		if item.Status == redox.WorkItemStatusPending && !item.NextAttemptTime.After(now) {
+			due = append(due, *item)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedTime.Before(due[j].CreatedTime)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (t *WorkItemStore) Complete(ctx context.Context, id string) error {
+	now := time.Now()
+	item := t.Items[id]
+	item.Status = redox.WorkItemStatusCompleted
+	item.Attempts++
+	item.LastError = ""
+	item.CompletedTime = &now
+	return nil
+}
+
+func (t *WorkItemStore) RecordFailure(ctx context.Context, id string, reason string, nextAttemptTime *time.Time) error {
+	item := t.Items[id]
+	item.Attempts++
+	item.LastError = reason
+	if nextAttemptTime != nil {
+		item.NextAttemptTime = *nextAttemptTime
+	} else {
+		now := time.Now()
+		item.Status = redox.WorkItemStatusFailed
+		item.CompletedTime = &now
+	}
+	return nil
+}
@@ -0,0 +1,507 @@
+package redox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/clinic-worker/cdc"
+	"github.com/tidepool-org/clinic-worker/store"
+	models "github.com/tidepool-org/clinic/redox_models"
+	"github.com/tidepool-org/go-common/events"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	workItemsCollectionName = "redox_work_items"
+	workItemsLeaseName      = "redox-work-items"
+	maxWorkItemBackoff      = 24 * time.Hour
+)
+
+type WorkItemConfig struct {
+	Interval  time.Duration `envconfig:"TIDEPOOL_REDOX_WORK_ITEMS_INTERVAL" default:"1m"`
+	BatchSize int           `envconfig:"TIDEPOOL_REDOX_WORK_ITEMS_BATCH_SIZE" default:"20"`
+	// RetryDelay is the delay before the second attempt to process an item. The delay doubles with each attempt.
+	RetryDelay  time.Duration `envconfig:"TIDEPOOL_REDOX_WORK_ITEMS_RETRY_DELAY" default:"15m"`
+	MaxAttempts int           `envconfig:"TIDEPOOL_REDOX_WORK_ITEMS_MAX_ATTEMPTS" default:"10"`
+	// Retention is the duration for which completed, cancelled and failed items are kept. Completed items are kept to
+	// deduplicate them.
+	Retention time.Duration `envconfig:"TIDEPOOL_REDOX_WORK_ITEMS_RETENTION" default:"720h"`
+}
+
+func NewWorkItemConfig() (WorkItemConfig, error) {
+	config := WorkItemConfig{}
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+type WorkItemType string
+
+const (
+	// WorkItemTypeOrderReport sends the report of an order which was completed with a fallback note
+	WorkItemTypeOrderReport WorkItemType = "orderReport"
+	// WorkItemTypeScheduledReport sends a scheduled summary and report
+	WorkItemTypeScheduledReport WorkItemType = "scheduledReport"
+	// WorkItemTypePreVisitReport sends a summary and report tied to an appointment before the visit
+	WorkItemTypePreVisitReport WorkItemType = "preVisitReport"
+)
+
+type WorkItemStatus string
+
+const (
+	WorkItemStatusPending   WorkItemStatus = "pending"
+	WorkItemStatusCompleted WorkItemStatus = "completed"
+	// WorkItemStatusFailed is set when the item couldn't be processed after the maximum number of attempts
+	WorkItemStatusFailed WorkItemStatus = "failed"
+	// WorkItemStatusCancelled is set when a pending item is no longer needed, e.g. because the appointment was cancelled
+	WorkItemStatusCancelled WorkItemStatus = "cancelled"
+)
+
+// WorkItem is a durable request to send a summary and report, which is processed by the work item dispatcher
+type WorkItem struct {
+	Id   string       `bson:"_id"`
+	Type WorkItemType `bson:"type"`
+	// DocumentId is the id of the order or of the scheduled summary and report
+	DocumentId primitive.ObjectID `bson:"documentId"`
+	ClinicId   string             `bson:"clinicId,omitempty"`
+	PatientId  string             `bson:"patientId,omitempty"`
+	// Order is the order or the last matched order of the patient for scheduled summaries and reports
+	Order             models.MessageEnvelope `bson:"order"`
+	PrecedingDocument *PrecedingDocument     `bson:"precedingDocument,omitempty"`
+	// ScheduledTime is the creation time of the scheduled summary and report
+	ScheduledTime time.Time `bson:"scheduledTime,omitempty"`
+	// Appointment is the visit which the pre-visit summary and report is tied to
+	Appointment     *Appointment   `bson:"appointment,omitempty"`
+	Status          WorkItemStatus `bson:"status"`
+	Attempts        int            `bson:"attempts"`
+	LastError       string         `bson:"lastError,omitempty"`
+	NextAttemptTime time.Time      `bson:"nextAttemptTime"`
+	// CompletedTime is the time when the item was completed, cancelled or failed
+	CompletedTime *time.Time `bson:"completedTime,omitempty"`
+	CreatedTime   time.Time  `bson:"createdTime"`
+	ModifiedTime  time.Time  `bson:"modifiedTime"`
+}
+
+// NewOrderReportRetry returns an item which processes the order again to replace its fallback note with the report
+func NewOrderReportRetry(envelope models.MessageEnvelope, key OrderKey) WorkItem {
+	return WorkItem{
+		Id:         reportRetryId(key),
+		Type:       WorkItemTypeOrderReport,
+		DocumentId: envelope.Id,
+		Order:      envelope,
+	}
+}
+
+// NewScheduledReport returns an item which sends the scheduled summary and report
+func NewScheduledReport(scheduled ScheduledSummaryAndReport) WorkItem {
+	return WorkItem{
+		Id:                fmt.Sprintf("scheduled:%s", scheduled.Id.Hex()),
+		Type:              WorkItemTypeScheduledReport,
+		DocumentId:        scheduled.Id,
+		ClinicId:          scheduled.ClinicId.Hex(),
+		PatientId:         scheduled.UserId,
+		Order:             scheduled.LastMatchedOrder,
+		PrecedingDocument: scheduled.PrecedingDocument,
+		ScheduledTime:     scheduled.CreatedTime,
+	}
+}
+
+// NewScheduledReportRetry returns an item which processes the scheduled summary and report again to replace its
+// fallback note with the report
+func NewScheduledReportRetry(scheduled ScheduledSummaryAndReport) WorkItem {
+	item := NewScheduledReport(scheduled)
+	item.Id = reportRetryId(OrderKey{OrderId: scheduled.Id.Hex(), ProcedureCode: ScheduledProcedureCode})
+	return item
+}
+
+// NewPreVisitReport returns an item which sends the summary and report of the subscribed patient before the visit
+func NewPreVisitReport(subscription ReportSubscription, appointment Appointment) WorkItem {
+	return WorkItem{
+		Id:          PreVisitReportId(subscription.ClinicId, subscription.PatientId, appointment.VisitNumber),
+		Type:        WorkItemTypePreVisitReport,
+		DocumentId:  primitive.NewObjectID(),
+		ClinicId:    subscription.ClinicId,
+		PatientId:   subscription.PatientId,
+		Appointment: &appointment,
+	}
+}
+
+// PreVisitReportId returns the id of the item which sends the summary and report before the visit
+func PreVisitReportId(clinicId string, patientId string, visitNumber string) string {
+	return fmt.Sprintf("preVisit:%s:%s:%s", clinicId, patientId, visitNumber)
+}
+
+func reportRetryId(key OrderKey) string {
+	return fmt.Sprintf("reportRetry:%s:%s", key.ProcedureCode, key.OrderId)
+}
+
+// ScheduledSummaryAndReport returns the scheduled summary and report of the item
+func (w WorkItem) ScheduledSummaryAndReport() (ScheduledSummaryAndReport, error) {
+	clinicId, err := primitive.ObjectIDFromHex(w.ClinicId)
+	if err != nil {
+		return ScheduledSummaryAndReport{}, fmt.Errorf("invalid clinic id: %w", err)
+	}
+	return ScheduledSummaryAndReport{
+		Id:                w.DocumentId,
+		UserId:            w.PatientId,
+		ClinicId:          clinicId,
+		LastMatchedOrder:  w.Order,
+		PrecedingDocument: w.PrecedingDocument,
+		CreatedTime:       w.ScheduledTime,
+	}, nil
+}
+
+type WorkItemStore interface {
+	// Enqueue records the item, which is due immediately. The item is ignored if its id was already recorded.
+	Enqueue(ctx context.Context, item WorkItem) error
+	// Schedule records the item, which is due at the given time, or replaces the item with the same id. A completed
+	// item is replaced only if it was due at another time, so the same item isn't processed twice.
+	Schedule(ctx context.Context, item WorkItem, dueTime time.Time) error
+	// Cancel cancels the item if it's pending
+	Cancel(ctx context.Context, id string) error
+	// ListDue returns the pending items which are due in the order they were recorded
+	ListDue(ctx context.Context, now time.Time, limit int) ([]WorkItem, error)
+	Complete(ctx context.Context, id string) error
+	// RecordFailure increments the attempts of the item. The item is marked as failed if the next attempt is nil.
+	RecordFailure(ctx context.Context, id string, reason string, nextAttemptTime *time.Time) error
+}
+
+type MongoWorkItemStore struct {
+	collection *mongo.Collection
+	retention  time.Duration
+}
+
+var _ WorkItemStore = &MongoWorkItemStore{}
+
+func NewWorkItemStore(db *mongo.Database, config ModuleConfig, workItemConfig WorkItemConfig, lifecycle fx.Lifecycle) WorkItemStore {
+	store := &MongoWorkItemStore{
+		collection: db.Collection(workItemsCollectionName),
+		retention:  workItemConfig.Retention,
+	}
+	if config.Enabled {
+		lifecycle.Append(fx.Hook{
+			OnStart: store.CreateIndexes,
+		})
+	}
+	return store
+}
+
+func (m *MongoWorkItemStore) CreateIndexes(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptTime", Value: 1}},
+		},
+		{
+			// Completed, cancelled and failed items are removed after the retention period. Pending items are never removed.
+			Keys:    bson.D{{Key: "completedTime", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(m.retention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create work item indexes: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoWorkItemStore) Enqueue(ctx context.Context, item WorkItem) error {
+	now := time.Now()
+	item.Status = WorkItemStatusPending
+	item.Attempts = 0
+	item.NextAttemptTime = now
+	item.CreatedTime = now
+	item.ModifiedTime = now
+
+	// The id of the item is the id of the document, so recording the same item again is a no-op
+	update := bson.M{"$setOnInsert": item}
+	if _, err := m.collection.UpdateOne(ctx, bson.M{"_id": item.Id}, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("unable to enqueue work item: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoWorkItemStore) Schedule(ctx context.Context, item WorkItem, dueTime time.Time) error {
+	now := time.Now()
+	item.Status = WorkItemStatusPending
+	item.Attempts = 0
+	item.NextAttemptTime = dueTime
+	item.ModifiedTime = now
+
+	set, err := bson.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("unable to encode work item: %w", err)
+	}
+	setDocument := bson.M{}
+	if err := bson.Unmarshal(set, &setDocument); err != nil {
+		return fmt.Errorf("unable to encode work item: %w", err)
+	}
+	delete(setDocument, "_id")
+	delete(setDocument, "createdTime")
+
+	filter := bson.M{
+		"_id": item.Id,
+		"$nor": bson.A{
+			bson.M{"status": WorkItemStatusCompleted, "nextAttemptTime": dueTime},
+		},
+	}
+	update := bson.M{
+		"$set":         setDocument,
+		"$unset":       bson.M{"lastError": "", "completedTime": ""},
+		"$setOnInsert": bson.M{"createdTime": now},
+	}
+
+	// The upsert fails with a duplicate key error if the item was already completed at the same due time
+	_, err = m.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to schedule work item: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoWorkItemStore) Cancel(ctx context.Context, id string) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"status":        WorkItemStatusCancelled,
+			"completedTime": now,
+			"modifiedTime":  now,
+		},
+	}
+	if _, err := m.collection.UpdateOne(ctx, bson.M{"_id": id, "status": WorkItemStatusPending}, update); err != nil {
+		return fmt.Errorf("unable to cancel work item: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoWorkItemStore) ListDue(ctx context.Context, now time.Time, limit int) ([]WorkItem, error) {
+	filter := bson.M{
+		"status":          WorkItemStatusPending,
+		"nextAttemptTime": bson.M{"$lte": now},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdTime", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := m.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list due work items: %w", err)
+	}
+	var items []WorkItem
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("unable to decode due work items: %w", err)
+	}
+	return items, nil
+}
+
+func (m *MongoWorkItemStore) Complete(ctx context.Context, id string) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"status":        WorkItemStatusCompleted,
+			"completedTime": now,
+			"modifiedTime":  now,
+		},
+		"$unset": bson.M{"lastError": ""},
+		"$inc":   bson.M{"attempts": 1},
+	}
+	if _, err := m.collection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return fmt.Errorf("unable to complete work item: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoWorkItemStore) RecordFailure(ctx context.Context, id string, reason string, nextAttemptTime *time.Time) error {
+	now := time.Now()
+	set := bson.M{
+		"lastError":    reason,
+		"modifiedTime": now,
+	}
+	if nextAttemptTime != nil {
+		set["nextAttemptTime"] = *nextAttemptTime
+	} else {
+		set["status"] = WorkItemStatusFailed
+		set["completedTime"] = now
+	}
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{"attempts": 1},
+	}
+	if _, err := m.collection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return fmt.Errorf("unable to record work item failure: %w", err)
+	}
+	return nil
+}
+
+// WorkItemDispatcher periodically processes the pending work items. Only the instance which holds the lease
+// processes items, so each item is processed by a single instance.
+type WorkItemDispatcher struct {
+	config             WorkItemConfig
+	store              WorkItemStore
+	subscriptions      SubscriptionStore
+	orderProcessor     NewOrderProcessor
+	scheduledProcessor ScheduledSummaryAndReportProcessor
+	runner             *store.LeaseRunner
+	logger             *zap.SugaredLogger
+}
+
+var _ events.EventConsumer = &WorkItemDispatcher{}
+
+type WorkItemDispatcherParams struct {
+	fx.In
+
+	Logger *zap.SugaredLogger
+
+	Config             ModuleConfig
+	WorkItemConfig     WorkItemConfig
+	Store              WorkItemStore
+	Subscriptions      SubscriptionStore
+	Leases             store.Leases
+	OrderProcessor     NewOrderProcessor
+	ScheduledProcessor ScheduledSummaryAndReportProcessor
+}
+
+// CreateWorkItemDispatcher returns the dispatcher as a consumer, so it's started and stopped together with the consumers
+func CreateWorkItemDispatcher(p WorkItemDispatcherParams) (events.EventConsumer, error) {
+	if !p.Config.Enabled {
+		return &cdc.DisabledEventConsumer{}, nil
+	}
+	return NewWorkItemDispatcher(p.WorkItemConfig, p.Store, p.Subscriptions, p.Leases, p.OrderProcessor, p.ScheduledProcessor, p.Logger), nil
+}
+
+func NewWorkItemDispatcher(config WorkItemConfig, workItems WorkItemStore, subscriptions SubscriptionStore, leases store.Leases, orderProcessor NewOrderProcessor, scheduledProcessor ScheduledSummaryAndReportProcessor, logger *zap.SugaredLogger) *WorkItemDispatcher {
+	return &WorkItemDispatcher{
+		config:             config,
+		store:              workItems,
+		subscriptions:      subscriptions,
+		orderProcessor:     orderProcessor,
+		scheduledProcessor: scheduledProcessor,
+		runner:             store.NewLeaseRunner(workItemsLeaseName, config.Interval, leases, logger),
+		logger:             logger,
+	}
+}
+
+// Start runs the dispatcher until it's stopped
+func (d *WorkItemDispatcher) Start() error {
+	return d.runner.Run(func(ctx context.Context, lease *store.Lease) error {
+		return d.dispatchDue(ctx, lease, time.Now())
+	})
+}
+
+func (d *WorkItemDispatcher) Stop() error {
+	return d.runner.Stop()
+}
+
+// RunOnce processes the items which are due if this instance holds the lease
+func (d *WorkItemDispatcher) RunOnce(ctx context.Context, now time.Time) error {
+	return d.runner.RunOnce(ctx, func(ctx context.Context, lease *store.Lease) error {
+		return d.dispatchDue(ctx, lease, now)
+	})
+}
+
+func (d *WorkItemDispatcher) dispatchDue(ctx context.Context, lease *store.Lease, now time.Time) error {
+	items, err := d.store.ListDue(ctx, now, d.config.BatchSize)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		// Processing an item may take longer than the lease, so it's renewed before each item
+		if err := lease.Renew(ctx); err != nil {
+			return err
+		}
+		// A failure to process one item shouldn't prevent the others from being processed
+		if err := d.dispatch(ctx, item, now); err != nil {
+			d.logger.Errorw("unable to process work item", "id", item.Id, "type", item.Type, zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (d *WorkItemDispatcher) dispatch(ctx context.Context, item WorkItem, now time.Time) error {
+	if err := d.process(ctx, item, now); err != nil {
+		var nextAttemptTime *time.Time
+		if attempts := item.Attempts + 1; attempts < d.config.MaxAttempts {
+			next := now.Add(d.backoff(attempts))
+			nextAttemptTime = &next
+		} else {
+			d.logger.Errorw("giving up processing work item after the maximum number of attempts", "id", item.Id, "type", item.Type, "attempts", attempts)
+		}
+		if recordErr := d.store.RecordFailure(ctx, item.Id, err.Error(), nextAttemptTime); recordErr != nil {
+			return errors.Join(err, recordErr)
+		}
+		return err
+	}
+
+	d.logger.Infow("processed work item", "id", item.Id, "type", item.Type)
+	return d.store.Complete(ctx, item.Id)
+}
+
+func (d *WorkItemDispatcher) process(ctx context.Context, item WorkItem, now time.Time) error {
+	switch item.Type {
+	case WorkItemTypeOrderReport:
+		return d.orderProcessor.ProcessOrder(ctx, item.Order)
+	case WorkItemTypeScheduledReport:
+		scheduled, err := item.ScheduledSummaryAndReport()
+		if err != nil {
+			return err
+		}
+		return d.scheduledProcessor.ProcessOrder(ctx, scheduled)
+	case WorkItemTypePreVisitReport:
+		return d.sendPreVisitReport(ctx, item, now)
+	default:
+		return fmt.Errorf("unsupported work item type %q", item.Type)
+	}
+}
+
+// sendPreVisitReport sends the summary and report of the subscribed patient tied to the appointment
+func (d *WorkItemDispatcher) sendPreVisitReport(ctx context.Context, item WorkItem, now time.Time) error {
+	if item.Appointment == nil {
+		return fmt.Errorf("pre-visit work item doesn't have an appointment")
+	}
+	clinicId, err := primitive.ObjectIDFromHex(item.ClinicId)
+	if err != nil {
+		return fmt.Errorf("invalid clinic id: %w", err)
+	}
+
+	subscription, err := d.subscriptions.Find(ctx, item.ClinicId, item.PatientId)
+	if err != nil {
+		return err
+	}
+	if subscription.GetState() != SubscriptionStateActive {
+		d.logger.Infow("reports of the patient are disabled, skipping pre-visit report", "clinicId", item.ClinicId, "patientId", item.PatientId, "visitNumber", item.Appointment.VisitNumber)
+		return nil
+	}
+
+	// The report is sent for the last matched order of the patient, which is normalized by the adapter of the EHR it
+	// was received from and tied to the visit number and the location of the appointment
+	scheduled := ScheduledSummaryAndReport{
+		Id:                item.DocumentId,
+		UserId:            item.PatientId,
+		ClinicId:          clinicId,
+		LastMatchedOrder:  subscription.LastMatchedOrder,
+		PrecedingDocument: subscription.LastScheduled,
+		CreatedTime:       now,
+		Appointment:       item.Appointment,
+	}
+	if err := d.scheduledProcessor.ProcessOrder(ctx, scheduled); err != nil {
+		return err
+	}
+	return d.subscriptions.SetLastScheduled(ctx, item.ClinicId, item.PatientId, PrecedingDocument{
+		Id:          scheduled.Id,
+		CreatedTime: scheduled.CreatedTime,
+	})
+}
+
+// backoff doubles the delay between attempts starting from the retry delay
+func (d *WorkItemDispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.RetryDelay
+	for i := 1; i < attempts && delay < maxWorkItemBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxWorkItemBackoff)
+}
@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"github.com/go-resty/resty/v2"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/tidepool-org/clinic-worker/redact"
 	clinics "github.com/tidepool-org/clinic/client"
 	"github.com/tidepool-org/go-common/clients/shoreline"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"io"
 	"time"
 )
@@ -102,6 +104,25 @@ type UserDetail struct {
 	MRN         string `json:"mrn,omitempty"`
 }
 
+// MarshalLogObject logs the parameters with the name, date of birth and MRN of the patient redacted
+func (p Parameters) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
+	encoder.AddString("clinicId", p.ClinicId)
+	if err := encoder.AddObject("userDetail", p.UserDetail); err != nil {
+		return err
+	}
+	return encoder.AddReflected("reportDetail", p.ReportDetail)
+}
+
+func (u UserDetail) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
+	encoder.AddString("userId", u.UserId)
+	encoder.AddString("fullName", redact.Mask(u.FullName))
+	encoder.AddString("dob", redact.Hash(u.DateOfBirth))
+	if u.MRN != "" {
+		encoder.AddString("mrn", redact.Hash(u.MRN))
+	}
+	return nil
+}
+
 type ReportDetail struct {
 	TimezoneName string   `json:"tzName,omitempty"`
 	BgUnits      string   `json:"bgUnits,omitempty"`
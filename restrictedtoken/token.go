@@ -1,10 +1,12 @@
 package token
 
 import (
+	"context"
 	"fmt"
 	"slices"
 	"time"
 
+	"github.com/tidepool-org/clinic-worker/audit"
 	"github.com/tidepool-org/go-common/clients"
 	"github.com/tidepool-org/go-common/clients/shoreline"
 )
@@ -13,7 +15,7 @@ const (
 	RestrictedTokenExpirationDuration = time.Hour * 24 * 30
 )
 
-func UpsertRestrictedTokenForProvider(auth clients.AuthClient, shoreline shoreline.Client, userId string, providerName string) (*clients.RestrictedToken, error) {
+func UpsertRestrictedTokenForProvider(ctx context.Context, auth clients.AuthClient, shoreline shoreline.Client, auditor audit.Auditor, userId string, providerName string) (*clients.RestrictedToken, error) {
 	restrictedTokenPaths := []string{"/v1/oauth/" + providerName}
 	restrictedTokenExpirationTime := time.Now().Add(RestrictedTokenExpirationDuration)
 
@@ -29,9 +31,11 @@ func UpsertRestrictedTokenForProvider(auth clients.AuthClient, shoreline shoreli
 		}
 	}
 
+	target := audit.Target{UserId: userId}
 	var lastExistingToken *clients.RestrictedToken
 	for _, tokenID := range existingTokenIDs {
 		restrictedToken, err := auth.UpdateRestrictedToken(tokenID, restrictedTokenExpirationTime, restrictedTokenPaths, shoreline.TokenProvide())
+		auditor.Record(ctx, newRestrictedTokenEvent(audit.ActionRestrictedTokenUpdated, target, tokenID, providerName, err))
 		if err != nil {
 			return nil, err
 		}
@@ -41,5 +45,21 @@ func UpsertRestrictedTokenForProvider(auth clients.AuthClient, shoreline shoreli
 	if lastExistingToken != nil {
 		return lastExistingToken, nil
 	}
-	return auth.CreateRestrictedToken(userId, restrictedTokenExpirationTime, restrictedTokenPaths, shoreline.TokenProvide())
+
+	restrictedToken, err := auth.CreateRestrictedToken(userId, restrictedTokenExpirationTime, restrictedTokenPaths, shoreline.TokenProvide())
+	tokenID := ""
+	if restrictedToken != nil {
+		tokenID = restrictedToken.ID
+	}
+	auditor.Record(ctx, newRestrictedTokenEvent(audit.ActionRestrictedTokenCreated, target, tokenID, providerName, err))
+	return restrictedToken, err
+}
+
+func newRestrictedTokenEvent(action audit.Action, target audit.Target, tokenID string, providerName string, err error) audit.Event {
+	event := audit.NewEvent(action, target, err)
+	event.Details = map[string]string{"providerName": providerName}
+	if tokenID != "" {
+		event.Details["restrictedTokenId"] = tokenID
+	}
+	return event
 }
@@ -0,0 +1,13 @@
+package smart_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSMART(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SMART Suite")
+}
@@ -0,0 +1,124 @@
+package smart
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// ExpirationDelta is the period of time before the token expiration when the token should be refreshed
+	ExpirationDelta = 1 * time.Minute
+
+	assertionDuration = 5 * time.Minute
+	assertionType     = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// ErrAssertionRejected is returned when the token endpoint rejects the signed assertion, e.g. because the key
+// was revoked or isn't registered yet
+var ErrAssertionRejected = errors.New("the token endpoint rejected the assertion")
+
+// Assertion is the authentication JWT of the SMART backend services specification, which is also used by Redox
+type Assertion struct {
+	ClientId string
+	// Audience is the token url. It's omitted from the claims if it's empty.
+	Audience   string
+	KeyId      string
+	PrivateKey *rsa.PrivateKey
+}
+
+func (a Assertion) Sign() (string, error) {
+	now := time.Now()
+	nonce, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"iss": a.ClientId,
+		"sub": a.ClientId,
+		"iat": now.Unix(),
+		"exp": now.Add(assertionDuration).Unix(),
+		"jti": nonce.String(),
+	}
+	if a.Audience != "" {
+		claims["aud"] = a.Audience
+	}
+
+	assertion := jwt.New(jwt.SigningMethodRS384)
+	assertion.Header = map[string]interface{}{
+		"alg": "RS384",
+		"kid": a.KeyId,
+		"typ": "JWT",
+	}
+	assertion.Claims = claims
+
+	return assertion.SignedString(a.PrivateKey)
+}
+
+// RequestToken requests a token with the client credentials grant. The scope is omitted if it's empty.
+func RequestToken(ctx context.Context, client *resty.Client, tokenUrl string, assertion string, scope string) (*Token, error) {
+	token := &Token{}
+	authErr := &AuthError{}
+	data := map[string]string{
+		"grant_type":            "client_credentials",
+		"client_assertion_type": assertionType,
+		"client_assertion":      assertion,
+	}
+	if scope != "" {
+		data["scope"] = scope
+	}
+
+	resp, err := client.R().
+		SetContext(ctx).
+		SetFormData(data).
+		SetResult(token).
+		SetError(authErr).
+		Post(tokenUrl)
+	if err != nil {
+		return nil, fmt.Errorf("error obtaining token: %w", err)
+	}
+	if resp.StatusCode() == http.StatusBadRequest || resp.StatusCode() == http.StatusUnauthorized {
+		return nil, fmt.Errorf("%w: %w", ErrAssertionRejected, authErr)
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("error response when obtaining token: %w", authErr)
+	}
+
+	token.SetExpirationTime()
+	return token, nil
+}
+
+type Token struct {
+	AccessToken    string `json:"access_token"`
+	ExpiresIn      int    `json:"expires_in"`
+	ExpirationTime time.Time
+}
+
+func (t *Token) SetExpirationTime() {
+	t.ExpirationTime = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+}
+
+func (t *Token) IsExpired(delta time.Duration) bool {
+	return time.Now().After(t.ExpirationTime.Add(-delta))
+}
+
+type AuthError struct {
+	Err              string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	ErrorUri         string `json:"error_uri"`
+}
+
+func (a AuthError) Error() string {
+	if a.ErrorUri == "" {
+		return fmt.Sprintf("%v: %v", a.Err, a.ErrorDescription)
+	}
+	return fmt.Sprintf("%v: %v. URI: %v", a.Err, a.ErrorDescription, a.ErrorUri)
+}
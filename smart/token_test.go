@@ -0,0 +1,92 @@
+package smart_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tidepool-org/clinic-worker/smart"
+)
+
+var _ = Describe("Token", func() {
+	var privateKey *rsa.PrivateKey
+	var server *httptest.Server
+	var form map[string]string
+	var status int
+
+	BeforeEach(func() {
+		var err error
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).ToNot(HaveOccurred())
+
+		status = http.StatusOK
+		form = map[string]string{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			for key := range r.PostForm {
+				form[key] = r.PostForm.Get(key)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			if status == http.StatusOK {
+				_, _ = w.Write([]byte(`{"access_token":"token","expires_in":300}`))
+			} else {
+				_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"unknown key"}`))
+			}
+		}))
+		DeferCleanup(server.Close)
+	})
+
+	It("signs the assertion with the key", func() {
+		signed, err := smart.Assertion{ClientId: "client", Audience: server.URL, KeyId: "key-1", PrivateKey: privateKey}.Sign()
+		Expect(err).ToNot(HaveOccurred())
+
+		claims := jwt.MapClaims{}
+		token, err := jwt.ParseWithClaims(signed, claims, func(token *jwt.Token) (interface{}, error) {
+			return &privateKey.PublicKey, nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token.Header["kid"]).To(Equal("key-1"))
+		Expect(claims["iss"]).To(Equal("client"))
+		Expect(claims["sub"]).To(Equal("client"))
+		Expect(claims["aud"]).To(Equal(server.URL))
+	})
+
+	It("omits the audience if it's empty", func() {
+		signed, err := smart.Assertion{ClientId: "client", KeyId: "key-1", PrivateKey: privateKey}.Sign()
+		Expect(err).ToNot(HaveOccurred())
+
+		claims := jwt.MapClaims{}
+		_, err = jwt.ParseWithClaims(signed, claims, func(token *jwt.Token) (interface{}, error) {
+			return &privateKey.PublicKey, nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claims).ToNot(HaveKey("aud"))
+	})
+
+	It("requests a token with the assertion and the scope", func() {
+		token, err := smart.RequestToken(context.Background(), resty.New(), server.URL, "assertion", "system/Observation.write")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("token"))
+		Expect(token.IsExpired(smart.ExpirationDelta)).To(BeFalse())
+		Expect(token.ExpirationTime).To(BeTemporally("~", time.Now().Add(5*time.Minute), time.Second))
+		Expect(form).To(HaveKeyWithValue("client_assertion", "assertion"))
+		Expect(form).To(HaveKeyWithValue("scope", "system/Observation.write"))
+	})
+
+	It("returns an error if the assertion is rejected", func() {
+		status = http.StatusUnauthorized
+		_, err := smart.RequestToken(context.Background(), resty.New(), server.URL, "assertion", "")
+		Expect(err).To(MatchError(smart.ErrAssertionRejected))
+		Expect(err.Error()).To(ContainSubstring("unknown key"))
+		Expect(form).ToNot(HaveKey("scope"))
+	})
+})
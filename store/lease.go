@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const leasesCollectionName = "leases"
+
+// Leases elect a single owner of a named lease across all worker instances. A lease is held until it expires or is
+// released, and must be renewed by its owner before the expiration.
+type Leases interface {
+	// TryAcquire acquires or renews the lease and returns true if the owner holds the lease
+	TryAcquire(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, name string, owner string) error
+}
+
+type MongoLeases struct {
+	collection *mongo.Collection
+}
+
+var _ Leases = &MongoLeases{}
+
+func NewLeases(db *mongo.Database) Leases {
+	return &MongoLeases{
+		collection: db.Collection(leasesCollectionName),
+	}
+}
+
+func (m *MongoLeases) TryAcquire(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expirationTime": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"owner":          owner,
+			"expirationTime": now.Add(ttl),
+			"modifiedTime":   now,
+		},
+	}
+
+	// The upsert fails with a duplicate key error if another owner holds a lease which didn't expire yet
+	_, err := m.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("unable to acquire lease: %w", err)
+	}
+	return true, nil
+}
+
+func (m *MongoLeases) Release(ctx context.Context, name string, owner string) error {
+	if _, err := m.collection.DeleteOne(ctx, bson.M{"_id": name, "owner": owner}); err != nil {
+		return fmt.Errorf("unable to release lease: %w", err)
+	}
+	return nil
+}
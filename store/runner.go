@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	releaseTimeout = 30 * time.Second
+)
+
+// ErrLeaseLost is returned when the lease was taken over by another instance while a task was running
+var ErrLeaseLost = errors.New("the lease is held by another instance")
+
+// Task processes work while the runner holds the lease. Tasks which process work in batches must renew the lease
+// before each batch, so work isn't processed by two instances when a task outlives the lease.
+type Task func(ctx context.Context, lease *Lease) error
+
+// Lease is a lease held by a runner while its task is running
+type Lease struct {
+	leases Leases
+	name   string
+	owner  string
+	ttl    time.Duration
+}
+
+// Renew extends the lease and returns ErrLeaseLost if the lease is held by another instance
+func (l *Lease) Renew(ctx context.Context) error {
+	acquired, err := l.leases.TryAcquire(ctx, l.name, l.owner, l.ttl)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// LeaseRunner periodically runs a task on the single worker instance which holds the named lease
+type LeaseRunner struct {
+	name     string
+	owner    string
+	interval time.Duration
+	leases   Leases
+	logger   *zap.SugaredLogger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+func NewLeaseRunner(name string, interval time.Duration, leases Leases, logger *zap.SugaredLogger) *LeaseRunner {
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LeaseRunner{
+		name:     name,
+		owner:    fmt.Sprintf("%s-%s", hostname, uuid.NewString()),
+		interval: interval,
+		leases:   leases,
+		logger:   logger,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Run runs the task every interval until the runner is stopped
+func (r *LeaseRunner) Run(task Task) error {
+	done := make(chan struct{})
+	r.mu.Lock()
+	r.done = done
+	r.mu.Unlock()
+	defer close(done)
+
+	ctx := r.ctx
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.RunOnce(ctx, task); err != nil {
+			r.logger.Errorw("unable to run task", "lease", r.name, zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop waits for the running task to return and releases the lease
+func (r *LeaseRunner) Stop() error {
+	r.cancel()
+	r.mu.Lock()
+	done := r.done
+	r.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	return r.leases.Release(ctx, r.name, r.owner)
+}
+
+// RunOnce runs the task if this instance holds the lease
+func (r *LeaseRunner) RunOnce(ctx context.Context, task Task) error {
+	// The lease outlives a few intervals, so it isn't lost between runs when a run takes longer than the interval
+	lease := &Lease{
+		leases: r.leases,
+		name:   r.name,
+		owner:  r.owner,
+		ttl:    3 * r.interval,
+	}
+	if err := lease.Renew(ctx); errors.Is(err, ErrLeaseLost) {
+		r.logger.Debugw("the lease is held by another instance", "lease", r.name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return task(ctx, lease)
+}
@@ -0,0 +1,63 @@
+package store_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/store"
+	testStore "github.com/tidepool-org/clinic-worker/store/test"
+)
+
+var _ = Describe("LeaseRunner", func() {
+	var leases *testStore.Leases
+	var runner *store.LeaseRunner
+
+	BeforeEach(func() {
+		leases = testStore.NewLeases()
+		runner = store.NewLeaseRunner("lease", time.Minute, leases, zap.NewNop().Sugar())
+	})
+
+	It("runs the task while it holds the lease", func() {
+		runs := 0
+		task := func(ctx context.Context, lease *store.Lease) error {
+			runs++
+			return lease.Renew(ctx)
+		}
+
+		Expect(runner.RunOnce(context.Background(), task)).To(Succeed())
+		Expect(runner.RunOnce(context.Background(), task)).To(Succeed())
+		Expect(runs).To(Equal(2))
+		Expect(leases.Owners).To(HaveKey("lease"))
+	})
+
+	It("doesn't run the task when the lease is held by another instance", func() {
+		Expect(leases.TryAcquire(context.Background(), "lease", "other", time.Minute)).To(BeTrue())
+
+		runs := 0
+		Expect(runner.RunOnce(context.Background(), func(ctx context.Context, lease *store.Lease) error {
+			runs++
+			return nil
+		})).To(Succeed())
+		Expect(runs).To(BeZero())
+	})
+
+	It("fails to renew the lease after it was taken over by another instance", func() {
+		err := runner.RunOnce(context.Background(), func(ctx context.Context, lease *store.Lease) error {
+			leases.Owners["lease"] = "other"
+			return lease.Renew(ctx)
+		})
+		Expect(err).To(MatchError(store.ErrLeaseLost))
+	})
+
+	It("releases the lease when it's stopped", func() {
+		Expect(runner.RunOnce(context.Background(), func(ctx context.Context, lease *store.Lease) error {
+			return nil
+		})).To(Succeed())
+		Expect(runner.Stop()).To(Succeed())
+		Expect(leases.Owners).ToNot(HaveKey("lease"))
+	})
+})
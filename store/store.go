@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(
+	NewConfig,
+	NewDatabase,
+	NewLeases,
+)
+
+const (
+	connectTimeout    = 30 * time.Second
+	disconnectTimeout = 10 * time.Second
+)
+
+// Config is the configuration of the database used by the worker to persist processing state
+type Config struct {
+	Scheme    string `envconfig:"TIDEPOOL_STORE_SCHEME" default:"mongodb"`
+	Addresses string `envconfig:"TIDEPOOL_STORE_ADDRESSES" default:"localhost:27017"`
+	Database  string `envconfig:"TIDEPOOL_STORE_DATABASE" default:"clinic_worker"`
+	Username  string `envconfig:"TIDEPOOL_STORE_USERNAME"`
+	Password  string `envconfig:"TIDEPOOL_STORE_PASSWORD"`
+	TLS       bool   `envconfig:"TIDEPOOL_STORE_TLS" default:"false"`
+	OptParams string `envconfig:"TIDEPOOL_STORE_OPT_PARAMS"`
+}
+
+func NewConfig() (Config, error) {
+	config := Config{}
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+func (c Config) URI() string {
+	uri := url.URL{
+		Scheme: c.Scheme,
+		Host:   c.Addresses,
+		Path:   "/",
+	}
+	if c.Username != "" {
+		uri.User = url.UserPassword(c.Username, c.Password)
+	}
+
+	params := make([]string, 0, 2)
+	if c.TLS {
+		params = append(params, "tls=true")
+	}
+	if c.OptParams != "" {
+		params = append(params, strings.TrimPrefix(c.OptParams, "?"))
+	}
+	uri.RawQuery = strings.Join(params, "&")
+
+	return uri.String()
+}
+
+// NewDatabase returns a handle to the database. The driver connects lazily, so the worker can
+// start without a database if none of the enabled modules use it.
+func NewDatabase(config Config, lifecycle fx.Lifecycle) (*mongo.Database, error) {
+	opts := options.Client().
+		ApplyURI(config.URI()).
+		SetConnectTimeout(connectTimeout)
+
+	client, err := mongo.Connect(context.Background(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create database client: %w", err)
+	}
+
+	lifecycle.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, disconnectTimeout)
+			defer cancel()
+			return client.Disconnect(ctx)
+		},
+	})
+
+	return client.Database(config.Database), nil
+}
@@ -0,0 +1,36 @@
+package test
+
+import (
+	"context"
+	"time"
+
+	"github.com/tidepool-org/clinic-worker/store"
+)
+
+// Leases grants the lease to the first owner until it's released
+type Leases struct {
+	Owners map[string]string
+}
+
+var _ store.Leases = &Leases{}
+
+func NewLeases() *Leases {
+	return &Leases{
+		Owners: make(map[string]string),
+	}
+}
+
+func (t *Leases) TryAcquire(ctx context.Context, name string, owner string, ttl time.Duration) (bool, error) {
+	if current, ok := t.Owners[name]; ok && current != owner {
+		return false, nil
+	}
+	t.Owners[name] = owner
+	return true, nil
+}
+
+func (t *Leases) Release(ctx context.Context, name string, owner string) error {
+	if t.Owners[name] == owner {
+		delete(t.Owners, name)
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package worker
 
 import (
+	"github.com/tidepool-org/clinic-worker/audit"
+	"github.com/tidepool-org/clinic-worker/fhir"
 	"github.com/tidepool-org/clinic-worker/merge"
 	"github.com/tidepool-org/clinic-worker/redox"
 	"net/http"
@@ -11,9 +13,11 @@ import (
 	"github.com/tidepool-org/clinic-worker/datasources"
 	"github.com/tidepool-org/clinic-worker/marketo"
 	"github.com/tidepool-org/clinic-worker/migration"
+	"github.com/tidepool-org/clinic-worker/outbox"
 	"github.com/tidepool-org/clinic-worker/patientdeletions"
 	"github.com/tidepool-org/clinic-worker/patients"
 	"github.com/tidepool-org/clinic-worker/patientsummary"
+	"github.com/tidepool-org/clinic-worker/store"
 	"github.com/tidepool-org/clinic-worker/users"
 	"github.com/tidepool-org/go-common/events"
 	"go.uber.org/fx"
@@ -38,6 +42,9 @@ var dependencies = fx.Provide(
 
 var Modules = []fx.Option{
 	dependencies,
+	audit.Module,
+	store.Module,
+	outbox.Module,
 	datasources.Module,
 	patients.Module,
 	patientsummary.Module,
@@ -45,6 +52,7 @@ var Modules = []fx.Option{
 	clinicians.Module,
 	merge.Module,
 	migration.Module,
+	fhir.Module,
 	redox.Module,
 	users.Module,
 	marketo.Module,
@@ -2,21 +2,66 @@ package worker
 
 import (
 	"context"
-	"go.uber.org/fx"
+	"encoding/json"
 	"log"
 	"net/http"
+
+	"github.com/tidepool-org/clinic-worker/redox"
+	"github.com/tidepool-org/go-common/clients/shoreline"
+	"go.uber.org/fx"
 )
 
-func healthCheckServerProvider() *http.Server {
+type diagnosticsStatus struct {
+	Redox redox.ClientHealth `json:"redox"`
+}
+
+func healthCheckServerProvider(redoxClient redox.Client, redoxAPI *redox.API, shorelineClient shoreline.Client) *http.Server {
+	return &http.Server{
+		Addr:    ":8080",
+		Handler: NewHealthCheckHandler(redoxClient, redoxAPI, shorelineClient),
+	}
+}
+
+// NewHealthCheckHandler returns the handler of the liveness probe, of the diagnostics and of the API of the worker.
+// The diagnostics and the API are only available to services authenticated with a server token.
+func NewHealthCheckHandler(redoxClient redox.Client, redoxAPI http.Handler, shorelineClient shoreline.Client) http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
+	mux.Handle("/v1/redox/", requireServerToken(shorelineClient, redoxAPI))
+	mux.Handle("/diagnostics/redox", requireServerToken(shorelineClient, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Report a failure when a source can't sign assertions, so it can be alerted on
+		status := diagnosticsStatus{
+			Redox: redoxClient.Health(),
+		}
+		statusCode := http.StatusOK
+		if !status.Redox.IsHealthy() {
+			statusCode = http.StatusServiceUnavailable
+		}
 
-	return &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
-	}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Printf("unable to encode diagnostics status: %v", err)
+		}
+	})))
+	return mux
+}
+
+func requireServerToken(shorelineClient shoreline.Client, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("x-tidepool-session-token")
+		if token == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if tokenData := shorelineClient.CheckToken(token); tokenData == nil || !tokenData.IsServer {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func startHealthCheckServer(components Components) {
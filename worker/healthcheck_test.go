@@ -0,0 +1,96 @@
+package worker_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tidepool-org/go-common/clients/shoreline"
+	"go.uber.org/zap"
+
+	"github.com/tidepool-org/clinic-worker/hl7"
+	"github.com/tidepool-org/clinic-worker/redox"
+	testRedox "github.com/tidepool-org/clinic-worker/redox/test"
+	"github.com/tidepool-org/clinic-worker/worker"
+)
+
+// tokenChecker accepts the server token and the user token
+type tokenChecker struct {
+	shoreline.Client
+}
+
+func (t *tokenChecker) CheckToken(token string) *shoreline.TokenData {
+	switch token {
+	case "server":
+		return &shoreline.TokenData{UserID: "clinic-worker", IsServer: true}
+	case "user":
+		return &shoreline.TokenData{UserID: "1234567890"}
+	default:
+		return nil
+	}
+}
+
+var _ = Describe("Health check", func() {
+	var redoxClient *testRedox.RedoxClient
+	var handler http.Handler
+
+	BeforeEach(func() {
+		redoxClient = testRedox.NewTestRedoxClient("sourceId", "sourceName")
+		redoxClient.HealthStatus = redox.ClientHealth{
+			Sources: []redox.SourceHealth{{
+				SourceId: "sourceId",
+				Keys:     []redox.KeyHealth{{KeyId: "current", Active: true}},
+			}},
+		}
+		api := redox.NewAPI(&testRedox.ClinicSettingsProvider{}, testRedox.NewOrderLedger(), testRedox.NewQueryResponseStore(), &testRedox.PatientContactStore{}, hl7.Config{}, zap.NewNop().Sugar())
+		handler = worker.NewHealthCheckHandler(redoxClient, api, &tokenChecker{})
+	})
+
+	get := func(path string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("x-tidepool-session-token", token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("returns an empty liveness status", func() {
+		rec := get("/status", "")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(BeEmpty())
+	})
+
+	It("doesn't return the diagnostics without a token", func() {
+		Expect(get("/diagnostics/redox", "").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("doesn't return the diagnostics to users", func() {
+		Expect(get("/diagnostics/redox", "user").Code).To(Equal(http.StatusForbidden))
+		Expect(get("/diagnostics/redox", "invalid").Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("returns the signing keys to services", func() {
+		rec := get("/diagnostics/redox", "server")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		status := map[string]redox.ClientHealth{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &status)).To(Succeed())
+		Expect(status["redox"].Sources[0].Keys[0].KeyId).To(Equal("current"))
+	})
+
+	It("returns a failure when a source doesn't have an active key", func() {
+		redoxClient.HealthStatus.Sources[0].Keys[0].Active = false
+
+		Expect(get("/diagnostics/redox", "server").Code).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("returns the api only to services", func() {
+		Expect(get("/v1/redox/clinics/clinic-1/settings", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(get("/v1/redox/clinics/clinic-1/settings", "user").Code).To(Equal(http.StatusForbidden))
+		Expect(get("/v1/redox/clinics/clinic-1/settings", "server").Code).To(Equal(http.StatusOK))
+	})
+})
@@ -1,13 +1,27 @@
 package worker
 
-import "go.uber.org/zap"
+import (
+	"github.com/tidepool-org/clinic-worker/redact"
+	"go.uber.org/zap"
+)
 
 func loggerProvider() (*zap.SugaredLogger, error) {
+	redactConfig, err := redact.NewConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := redact.Configure(redactConfig); err != nil {
+		return nil, err
+	}
+
 	config := zap.NewProductionConfig()
 	config.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
-	logger, err := config.Build()
+	logger, err := config.Build(zap.WrapCore(redact.NewCore))
 	if err != nil {
 		return nil, err
 	}
+	if redact.BreakGlass() {
+		logger.Warn("break-glass mode is enabled, PHI is logged without redaction", zap.String("environment", redactConfig.Environment))
+	}
 	return logger.Sugar(), nil
 }
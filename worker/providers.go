@@ -117,12 +117,15 @@ func authProvider(config DependenciesConfig, httpClient *http.Client, shoreline
 		Build()
 }
 
-func clinicProvider(config DependenciesConfig, shoreline shoreline.Client) (clinics.ClientWithResponsesInterface, error) {
-	opts := clinics.WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
+func clinicAuthEditor(shoreline shoreline.Client) clinics.RequestEditorFn {
+	return func(ctx context.Context, req *http.Request) error {
 		req.Header.Add("x-tidepool-session-token", shoreline.TokenProvide())
 		return nil
-	})
-	return clinics.NewClientWithResponses(config.ClinicsHost, opts)
+	}
+}
+
+func clinicProvider(config DependenciesConfig, shoreline shoreline.Client) (clinics.ClientWithResponsesInterface, error) {
+	return clinics.NewClientWithResponses(config.ClinicsHost, clinics.WithRequestEditorFn(clinicAuthEditor(shoreline)))
 }
 
 func mailerProvider() (clients.MailerClient, error) {